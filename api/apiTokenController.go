@@ -0,0 +1,194 @@
+package api
+
+import (
+	"app/models"
+	"app/policy"
+	util "app/utils"
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"github.com/satori/go.uuid"
+	"gopkg.in/go-playground/validator.v9"
+	"net/http"
+)
+
+type APITokenInput struct {
+	Name          string   `json:"name" validate:"required,max=100"`
+	Scopes        []string `json:"scopes" validate:"required"`
+	ExpiresInDays int      `json:"expiresInDays" validate:"min=0"` // 0 if the token never expires
+}
+
+// Get the personal access tokens of the user
+var IndexPersonalAccessTokens = func(w http.ResponseWriter, r *http.Request) {
+	var errors []string
+	userId := r.Context().Value("user").(uuid.UUID)
+
+	user := models.GetUser(userId)
+
+	if user == nil {
+		resp := util.Message(false, http.StatusUnprocessableEntity, "Something wrong has occured. Please try again.", errors)
+		util.Respond(w, resp)
+		return
+	}
+
+	resp := user.GetPersonalAccessTokens()
+	util.Respond(w, resp)
+}
+
+// Create the personal access token of the user
+var CreatePersonalAccessToken = func(w http.ResponseWriter, r *http.Request) {
+	var errors []string
+	userId := r.Context().Value("user").(uuid.UUID)
+
+	user := models.GetUser(userId)
+
+	if user == nil {
+		resp := util.Message(false, http.StatusUnprocessableEntity, "Something wrong has occured. Please try again.", errors)
+		util.Respond(w, resp)
+		return
+	}
+
+	input, ok := decodeAPITokenInput(w, r)
+	if !ok {
+		return
+	}
+
+	resp := user.CreatePersonalAccessToken(input.Name, input.Scopes, input.ExpiresInDays)
+	util.Respond(w, resp)
+}
+
+// Revoke the personal access token of the user
+var RevokePersonalAccessToken = func(w http.ResponseWriter, r *http.Request) {
+	var errors []string
+	userId := r.Context().Value("user").(uuid.UUID)
+
+	user := models.GetUser(userId)
+
+	if user == nil {
+		resp := util.Message(false, http.StatusUnprocessableEntity, "Something wrong has occured. Please try again.", errors)
+		util.Respond(w, resp)
+		return
+	}
+
+	// Get the ID of the token passed in via URL
+	vars := mux.Vars(r)
+	tokenId, _ := uuid.FromString(vars["tokenId"])
+
+	resp := user.RevokePersonalAccessToken(tokenId)
+	util.Respond(w, resp)
+}
+
+// Get the API keys of the company
+var IndexCompanyAPIKeys = func(w http.ResponseWriter, r *http.Request) {
+	var errors []string
+	userId := r.Context().Value("user").(uuid.UUID)
+
+	// Get the ID of the company passed in via URL
+	vars := mux.Vars(r)
+	companyId, _ := uuid.FromString(vars["id"])
+
+	// Authorization
+	if ok := policy.ManageCompanyAPIKeys(userId, companyId); !ok {
+		resp := util.Message(false, http.StatusForbidden, "You are not authorized to perform the action.", errors)
+		util.Respond(w, resp)
+		return
+	}
+
+	company := models.GetCompany(companyId, userId)
+
+	if company == nil {
+		resp := util.Message(false, http.StatusUnprocessableEntity, "Something wrong has occured. Please try again.", errors)
+		util.Respond(w, resp)
+		return
+	}
+
+	resp := company.GetAPIKeys()
+	util.Respond(w, resp)
+}
+
+// Create the API key of the company
+var CreateCompanyAPIKey = func(w http.ResponseWriter, r *http.Request) {
+	var errors []string
+	userId := r.Context().Value("user").(uuid.UUID)
+
+	// Get the ID of the company passed in via URL
+	vars := mux.Vars(r)
+	companyId, _ := uuid.FromString(vars["id"])
+
+	// Authorization
+	if ok := policy.ManageCompanyAPIKeys(userId, companyId); !ok {
+		resp := util.Message(false, http.StatusForbidden, "You are not authorized to perform the action.", errors)
+		util.Respond(w, resp)
+		return
+	}
+
+	company := models.GetCompany(companyId, userId)
+
+	if company == nil {
+		resp := util.Message(false, http.StatusUnprocessableEntity, "Something wrong has occured. Please try again.", errors)
+		util.Respond(w, resp)
+		return
+	}
+
+	input, ok := decodeAPITokenInput(w, r)
+	if !ok {
+		return
+	}
+
+	resp := company.CreateAPIKey(userId, input.Name, input.Scopes, input.ExpiresInDays)
+	util.Respond(w, resp)
+}
+
+// Revoke the API key of the company
+var RevokeCompanyAPIKey = func(w http.ResponseWriter, r *http.Request) {
+	var errors []string
+	userId := r.Context().Value("user").(uuid.UUID)
+
+	// Get the ID of the company and the key passed in via URL
+	vars := mux.Vars(r)
+	companyId, _ := uuid.FromString(vars["id"])
+	keyId, _ := uuid.FromString(vars["keyId"])
+
+	// Authorization
+	if ok := policy.ManageCompanyAPIKeys(userId, companyId); !ok {
+		resp := util.Message(false, http.StatusForbidden, "You are not authorized to perform the action.", errors)
+		util.Respond(w, resp)
+		return
+	}
+
+	company := models.GetCompany(companyId, userId)
+
+	if company == nil {
+		resp := util.Message(false, http.StatusUnprocessableEntity, "Something wrong has occured. Please try again.", errors)
+		util.Respond(w, resp)
+		return
+	}
+
+	resp := company.RevokeAPIKey(keyId)
+	util.Respond(w, resp)
+}
+
+// Decode and validate the input of the token, respond with the errors if it is invalid
+func decodeAPITokenInput(w http.ResponseWriter, r *http.Request) (*APITokenInput, bool) {
+	var errors []string
+
+	input := &APITokenInput{}
+	err := json.NewDecoder(r.Body).Decode(input)
+	if err != nil {
+		errors = append(errors, err.Error())
+		util.Respond(w, util.Message(false, http.StatusInternalServerError, "Error decoding request body", errors))
+		return nil, false
+	}
+
+	// Validate the input
+	validate = validator.New()
+	err = validate.Struct(input)
+	if err != nil {
+		util.GetErrorMessages(&errors, err)
+
+		resp := util.Message(false, http.StatusUnprocessableEntity, "Validation error", errors)
+		util.Respond(w, resp)
+		return nil, false
+	}
+
+	return input, true
+}
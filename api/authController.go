@@ -6,17 +6,30 @@ import (
 	util "app/utils"
 	"app/models"
 	"gopkg.in/go-playground/validator.v9"
+	"github.com/satori/go.uuid"
+	"app/throttle"
+	"app/password"
+	"strconv"
+	"time"
 )
 
 type LoginInput struct {
 	Email string `json:"email" validate:"required,email"`
-	Password string `json:"password" validate:"required,min=8,max=16"`
+	Password string `json:"password" validate:"required"`
+}
+
+type MagicLoginInput struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+type RedeemMagicLoginInput struct {
+	Token string `json:"token" validate:"required"`
 }
 
 type SignupInput struct {
 	Name string `json:"name" validate:"required"`
 	Email string `json:"email" validate:"required,email"`
-	Password string `json:"password" validate:"required,min=8,max=16"`
+	Password string `json:"password" validate:"required,password"`
 }
 
 type ResendActivationInput struct {
@@ -27,13 +40,21 @@ type ActivateAccountInput struct {
 	ActivationCode string `json:"activationCode" validate:"required"`
 }
 
+type ConfirmEmailInput struct {
+	Token string `json:"token" validate:"required"`
+}
+
 type ForgetPasswordInput struct {
 	Email string `json:"email" validate:"required,email"`
 }
 
+type RefreshTokenInput struct {
+	RefreshToken string `json:"refreshToken" validate:"required"`
+}
+
 type ResetPasswordInput struct {
 	ResetPasswordCode string `json:"resetPasswordCode" validate:"required"`
-	Password string `json:"password" validate:"required,min=8,max=16"`
+	Password string `json:"password" validate:"required,password"`
 }
 
 // use a single instance of Validate, it caches struct info
@@ -60,9 +81,85 @@ var Login = func(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	
+	// Check if the client has too many failed attempts
+	ip := util.GetClientIP(r)
+	if !allowAttempt(w, ip) {
+		return
+	}
+	
 	// Login in the user
 	user := &models.User{}
-	resp := user.Login(input.Email, input.Password)
+	resp := user.Login(input.Email, input.Password, getClient(r))
+	recordAttempt(ip, resp)
+	util.Respond(w, resp)
+}
+
+// Email the one-time login link to the user
+var MagicLogin = func(w http.ResponseWriter, r *http.Request) {
+	var errors []string
+	input := MagicLoginInput{}
+	err := json.NewDecoder(r.Body).Decode(&input)
+	if err != nil {
+		errors = append(errors, err.Error())
+		util.Respond(w, util.Message(false, http.StatusInternalServerError, "Error decoding request body", errors))
+		return
+	}
+
+	// Validate the input
+	validate = validator.New()
+	err = validate.Struct(input)
+	if err != nil {
+		util.GetErrorMessages(&errors, err)
+
+		resp := util.Message(false, http.StatusUnprocessableEntity, "Validation error", errors)
+		util.Respond(w, resp)
+		return
+	}
+
+	// Check if the client has too many attempts, every request counts as the response is the same whether the link is sent or not
+	ip := util.GetClientIP(r)
+	if !allowAttempt(w, ip) {
+		return
+	}
+
+	user := &models.User{}
+	user.Email = input.Email
+	resp := user.SendMagicLogin()
+	throttle.IP.Fail(ip)
+
+	util.Respond(w, resp)
+}
+
+// Log in the user with the token from the login link
+var RedeemMagicLogin = func(w http.ResponseWriter, r *http.Request) {
+	var errors []string
+	input := RedeemMagicLoginInput{}
+	err := json.NewDecoder(r.Body).Decode(&input)
+	if err != nil {
+		errors = append(errors, err.Error())
+		util.Respond(w, util.Message(false, http.StatusInternalServerError, "Error decoding request body", errors))
+		return
+	}
+
+	// Validate the input
+	validate = validator.New()
+	err = validate.Struct(input)
+	if err != nil {
+		util.GetErrorMessages(&errors, err)
+
+		resp := util.Message(false, http.StatusUnprocessableEntity, "Validation error", errors)
+		util.Respond(w, resp)
+		return
+	}
+
+	// Check if the client has too many failed attempts
+	ip := util.GetClientIP(r)
+	if !allowAttempt(w, ip) {
+		return
+	}
+
+	resp := models.RedeemMagicLogin(input.Token, getClient(r))
+	recordAttempt(ip, resp)
 	util.Respond(w, resp)
 }
 
@@ -79,6 +176,7 @@ var Signup = func(w http.ResponseWriter, r *http.Request) {
 
 	// Validate the input
 	validate = validator.New()
+	password.RegisterValidation(validate)
 	err = validate.Struct(input)
 	if err != nil {
 		util.GetErrorMessages(&errors, err)
@@ -152,8 +250,50 @@ var ActivateAccount = func(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	
+	// Check if the client has too many failed attempts
+	ip := util.GetClientIP(r)
+	if !allowAttempt(w, ip) {
+		return
+	}
+	
 	user := &models.User{}
 	resp := user.ActivateAccount(input.ActivationCode)
+	recordAttempt(ip, resp)
+	
+	util.Respond(w, resp)
+}
+
+// Confirm the new email address of the user with the token from the confirmation email
+var ConfirmEmail = func(w http.ResponseWriter, r *http.Request) {
+	var errors []string
+	input := ConfirmEmailInput{}
+	err := json.NewDecoder(r.Body).Decode(&input)
+	if err != nil {
+		errors = append(errors, err.Error())
+		resp := util.Message(false, http.StatusInternalServerError, "Error decoding request body", errors)
+		util.Respond(w, resp)
+		return
+	}
+	
+	// Validate the input
+	validate = validator.New()
+	err = validate.Struct(input)
+	if err != nil {
+		util.GetErrorMessages(&errors, err)
+
+		resp := util.Message(false, http.StatusUnprocessableEntity, "Validation error", errors)
+		util.Respond(w, resp)
+		return
+	}
+	
+	// Check if the client has too many failed attempts
+	ip := util.GetClientIP(r)
+	if !allowAttempt(w, ip) {
+		return
+	}
+	
+	resp := models.ConfirmEmailChange(input.Token)
+	recordAttempt(ip, resp)
 	
 	util.Respond(w, resp)
 }
@@ -201,6 +341,7 @@ var ResetPassword = func(w http.ResponseWriter, r *http.Request) {
 	
 	// Validate the input
 	validate = validator.New()
+	password.RegisterValidation(validate)
 	err = validate.Struct(input)
 	if err != nil {
 		util.GetErrorMessages(&errors, err)
@@ -210,9 +351,90 @@ var ResetPassword = func(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	
+	// Check if the client has too many failed attempts
+	ip := util.GetClientIP(r)
+	if !allowAttempt(w, ip) {
+		return
+	}
+	
 	user := &models.User{}
-	resp := user.ResetPassword(input.ResetPasswordCode, input.Password)
+	resp := user.ResetPassword(input.ResetPasswordCode, input.Password, getClient(r))
+	recordAttempt(ip, resp)
+	
+	util.Respond(w, resp)
+}
+
+var RefreshToken = func(w http.ResponseWriter, r *http.Request) {
+	var errors []string
+	input := RefreshTokenInput{}
+	err := json.NewDecoder(r.Body).Decode(&input)
+	if err != nil {
+		errors = append(errors, err.Error())
+		resp := util.Message(false, http.StatusInternalServerError, "Error decoding request body", errors)
+		util.Respond(w, resp)
+		return
+	}
+	
+	// Validate the input
+	validate = validator.New()
+	err = validate.Struct(input)
+	if err != nil {
+		util.GetErrorMessages(&errors, err)
+
+		resp := util.Message(false, http.StatusUnprocessableEntity, "Validation error", errors)
+		util.Respond(w, resp)
+		return
+	}
+	
+	resp := models.RefreshLogin(input.RefreshToken, getClient(r))
+	
+	util.Respond(w, resp)
+}
+
+var Logout = func(w http.ResponseWriter, r *http.Request) {
+	tokenId := r.Context().Value("tokenId") . (uuid.UUID)
+	tokenExpiry := r.Context().Value("tokenExpiry") . (time.Time)
+
+	resp := models.Logout(tokenId, tokenExpiry)
 	
 	util.Respond(w, resp)
 }
 
+// Check if the client is still allowed to attempt, otherwise respond with the time to wait
+func allowAttempt(w http.ResponseWriter, ip string) bool {
+	var errors []string
+	if ok, wait := throttle.IP.Allow(ip); !ok {
+		w.Header().Set("Retry-After", strconv.Itoa(throttle.RetryAfter(wait)))
+		resp := util.Message(false, http.StatusTooManyRequests, throttle.RetryMessage(wait), errors)
+		resp["retryAfter"] = throttle.RetryAfter(wait)
+		util.Respond(w, resp)
+		return false
+	}
+
+	return true
+}
+
+// Record the attempt of the client if it is rejected
+func recordAttempt(ip string, resp map[string]interface{}) {
+	if success, _ := resp["success"].(bool); success {
+		return
+	}
+
+	if status, _ := resp["status"].(int); status != http.StatusInternalServerError {
+		throttle.IP.Fail(ip)
+	}
+}
+
+// Get the IP address and user agent of the client for the session, along with the superuser if impersonating
+func getClient(r *http.Request) models.Client {
+	client := models.Client{
+		IP:        util.GetClientIP(r),
+		UserAgent: r.UserAgent(),
+	}
+
+	if impersonatorId, ok := r.Context().Value("impersonator").(uuid.UUID); ok {
+		client.ImpersonatorID = &impersonatorId
+	}
+
+	return client
+}
@@ -13,13 +13,18 @@ import (
 )
 
 type CompanyInput struct {
-	Name        string `json:"name" validate:"required"`
-	Slug        string `json:"slug" validate:"required"`
-	Description string `json:"description"`
-	Email       string `json:"email"`
-	Phone       string `json:"phone"`
-	Fax         string `json:"fax"`
-	Address     string `json:"address"`
+	Name                 string `json:"name" validate:"required"`
+	Slug                 string `json:"slug" validate:"required"`
+	Description          string `json:"description"`
+	Email                string `json:"email"`
+	Phone                string `json:"phone"`
+	Fax                  string `json:"fax"`
+	Address              string `json:"address"`
+	InvitationExpiryDays int    `json:"invitationExpiryDays" validate:"omitempty,min=-1,max=90"` // Days the invitations are valid, unchanged if not set and -1 resets to the default
+}
+
+type CompanyUserRoleInput struct {
+	RoleID uuid.UUID `json:"roleId" validate:"required"`
 }
 
 // Get a list of companies
@@ -73,13 +78,14 @@ var CreateCompany = func(w http.ResponseWriter, r *http.Request) {
 	}
 
 	company := models.Company{
-		Name:        input.Name,
-		Slug:        input.Slug,
-		Description: input.Description,
-		Email:       input.Email,
-		Phone:       input.Phone,
-		Fax:         input.Fax,
-		Address:     input.Address,
+		Name:                 input.Name,
+		Slug:                 input.Slug,
+		Description:          input.Description,
+		Email:                input.Email,
+		Phone:                input.Phone,
+		Fax:                  input.Fax,
+		Address:              input.Address,
+		InvitationExpiryDays: input.InvitationExpiryDays,
 	}
 
 	resp := user.CreateCompany(&company)
@@ -169,6 +175,12 @@ var EditCompany = func(w http.ResponseWriter, r *http.Request) {
 	company.Phone = input.Phone
 	company.Fax = input.Fax
 	company.Address = input.Address
+	// The expiry is only changed when given, -1 goes back to the default of the environment
+	if input.InvitationExpiryDays > 0 {
+		company.InvitationExpiryDays = input.InvitationExpiryDays
+	} else if input.InvitationExpiryDays < 0 {
+		company.InvitationExpiryDays = 0
+	}
 
 	resp := company.EditCompany()
 
@@ -185,7 +197,7 @@ var DeleteCompany = func(w http.ResponseWriter, r *http.Request) {
 	companyId, _ := uuid.FromString(vars["id"])
 
 	// Authorization
-	if ok := policy.UpdateCompany(userId, companyId); !ok {
+	if ok := policy.DeleteCompany(userId, companyId); !ok {
 		resp := util.Message(false, http.StatusForbidden, "You are not authorized to perform the action.", errors)
 		util.Respond(w, resp)
 		return
@@ -200,7 +212,7 @@ var DeleteCompany = func(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	resp := company.DeleteCompany()
+	resp := company.DeleteCompany(user, getClient(r))
 
 	util.Respond(w, resp)
 }
@@ -313,3 +325,192 @@ var VisitCompany = func(w http.ResponseWriter, r *http.Request) {
 
 	util.Respond(w, resp)
 }
+
+// Unlock the account of the member that has been locked due to too many failed logins
+var UnlockCompanyUser = func(w http.ResponseWriter, r *http.Request) {
+	var errors []string
+	userId := r.Context().Value("user").(uuid.UUID)
+
+	// Get the ID of the company and the user passed in via URL
+	vars := mux.Vars(r)
+	companyId, _ := uuid.FromString(vars["id"])
+	targetUserId, _ := uuid.FromString(vars["userId"])
+
+	// Authorization
+	if ok := policy.UnlockCompanyUser(userId, companyId, targetUserId); !ok {
+		resp := util.Message(false, http.StatusForbidden, "You are not authorized to perform the action.", errors)
+		util.Respond(w, resp)
+		return
+	}
+
+	user := models.GetUser(targetUserId)
+
+	if user == nil {
+		resp := util.Message(false, http.StatusUnprocessableEntity, "Something wrong has occured. Please try again.", errors)
+		util.Respond(w, resp)
+		return
+	}
+
+	resp := user.Unlock()
+
+	util.Respond(w, resp)
+}
+
+// Change the role of the member of the company
+var ChangeCompanyUserRole = func(w http.ResponseWriter, r *http.Request) {
+	var errors []string
+	userId := r.Context().Value("user").(uuid.UUID)
+
+	// Get the ID of the company and the user passed in via URL
+	vars := mux.Vars(r)
+	companyId, _ := uuid.FromString(vars["id"])
+	targetUserId, _ := uuid.FromString(vars["userId"])
+
+	// Authorization
+	if ok := policy.ChangeCompanyUserRole(userId, companyId, targetUserId); !ok {
+		resp := util.Message(false, http.StatusForbidden, "You are not authorized to perform the action.", errors)
+		util.Respond(w, resp)
+		return
+	}
+
+	user := models.GetUser(userId)
+	company := models.GetCompany(companyId, userId)
+
+	if user == nil || company == nil {
+		resp := util.Message(false, http.StatusUnprocessableEntity, "Something wrong has occured. Please try again.", errors)
+		util.Respond(w, resp)
+		return
+	}
+
+	input := CompanyUserRoleInput{}
+	err := json.NewDecoder(r.Body).Decode(&input)
+	if err != nil {
+		errors = append(errors, err.Error())
+		util.Respond(w, util.Message(false, http.StatusInternalServerError, "Error decoding request body", errors))
+		return
+	}
+
+	// Validate the input
+	validate = validator.New()
+	err = validate.Struct(input)
+	if err != nil {
+		util.GetErrorMessages(&errors, err)
+
+		resp := util.Message(false, http.StatusUnprocessableEntity, "Validation error", errors)
+		util.Respond(w, resp)
+		return
+	}
+
+	resp := company.ChangeMemberRole(user, targetUserId, input.RoleID, getClient(r))
+
+	util.Respond(w, resp)
+}
+
+// Remove the member from the company
+var RemoveCompanyUser = func(w http.ResponseWriter, r *http.Request) {
+	var errors []string
+	userId := r.Context().Value("user").(uuid.UUID)
+
+	// Get the ID of the company and the user passed in via URL
+	vars := mux.Vars(r)
+	companyId, _ := uuid.FromString(vars["id"])
+	targetUserId, _ := uuid.FromString(vars["userId"])
+
+	// Authorization
+	if ok := policy.RemoveCompanyUser(userId, companyId, targetUserId); !ok {
+		resp := util.Message(false, http.StatusForbidden, "You are not authorized to perform the action.", errors)
+		util.Respond(w, resp)
+		return
+	}
+
+	user := models.GetUser(userId)
+	company := models.GetCompany(companyId, userId)
+
+	if user == nil || company == nil {
+		resp := util.Message(false, http.StatusUnprocessableEntity, "Something wrong has occured. Please try again.", errors)
+		util.Respond(w, resp)
+		return
+	}
+
+	resp := company.RemoveMember(user, targetUserId, getClient(r))
+
+	util.Respond(w, resp)
+}
+
+// Leave the company
+var LeaveCompany = func(w http.ResponseWriter, r *http.Request) {
+	var errors []string
+	userId := r.Context().Value("user").(uuid.UUID)
+
+	// Get the ID of the company passed in via URL
+	vars := mux.Vars(r)
+	companyId, _ := uuid.FromString(vars["id"])
+
+	// Authorization
+	if ok := policy.LeaveCompany(userId, companyId); !ok {
+		resp := util.Message(false, http.StatusForbidden, "You are not authorized to perform the action.", errors)
+		util.Respond(w, resp)
+		return
+	}
+
+	user := models.GetUser(userId)
+	company := models.GetCompany(companyId, userId)
+
+	if user == nil || company == nil {
+		resp := util.Message(false, http.StatusUnprocessableEntity, "Something wrong has occured. Please try again.", errors)
+		util.Respond(w, resp)
+		return
+	}
+
+	resp := user.LeaveCompany(company, getClient(r))
+
+	util.Respond(w, resp)
+}
+
+// Get the deleted companies that can still be restored
+var IndexDeletedCompany = func(w http.ResponseWriter, r *http.Request) {
+	var errors []string
+	userId := r.Context().Value("user").(uuid.UUID)
+
+	user := models.GetUser(userId)
+
+	if user == nil {
+		resp := util.Message(false, http.StatusUnprocessableEntity, "Something wrong has occured. Please try again.", errors)
+		util.Respond(w, resp)
+		return
+	}
+
+	resp := user.GetDeletedCompanies()
+
+	util.Respond(w, resp)
+}
+
+// Restore the deleted company
+var RestoreCompany = func(w http.ResponseWriter, r *http.Request) {
+	var errors []string
+	userId := r.Context().Value("user").(uuid.UUID)
+
+	// Get the ID of the company passed in via URL
+	vars := mux.Vars(r)
+	companyId, _ := uuid.FromString(vars["id"])
+
+	// Authorization
+	if ok := policy.RestoreCompany(userId, companyId); !ok {
+		resp := util.Message(false, http.StatusForbidden, "You are not authorized to perform the action.", errors)
+		util.Respond(w, resp)
+		return
+	}
+
+	user := models.GetUser(userId)
+	company := models.GetDeletedCompany(companyId, userId)
+
+	if user == nil || company == nil {
+		resp := util.Message(false, http.StatusUnprocessableEntity, "Something wrong has occured. Please try again.", errors)
+		util.Respond(w, resp)
+		return
+	}
+
+	resp := company.RestoreCompany(user, getClient(r))
+
+	util.Respond(w, resp)
+}
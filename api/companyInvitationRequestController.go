@@ -9,18 +9,27 @@ import (
 	"encoding/json"
 	"app/models"
 	"app/policy"
+	"app/password"
 	"github.com/satori/go.uuid"
+	"gopkg.in/go-playground/validator.v9"
 )
 
 type CompanyInvitationInput struct {
 	Emails []string `json:"emails"`
 	Message string `json:"message"`
+	RoleID *uuid.UUID `json:"roleId"` // The default role of the company if not set
+	TeamIDs []uuid.UUID `json:"teamIds"`
 }
 
 type CompanyInvitationResponseInput struct {
 	IsJoin bool `json:"is_join"`
 }
 
+type InvitationSignupInput struct {
+	Name string `json:"name" validate:"required"`
+	Password string `json:"password" validate:"required,password"`
+}
+
 // Send invitation to emails to join company
 var InviteToCompany = func(w http.ResponseWriter, r *http.Request) {
 	var errors []string
@@ -32,7 +41,7 @@ var InviteToCompany = func(w http.ResponseWriter, r *http.Request) {
 	companyId, _ := uuid.FromString(vars["id"]) 
 
 	// Authorization
-	if ok := policy.CreateUpdateDeleteCompanyInvitation(userId, companyId); !ok {
+	if ok := policy.CreateCompanyInvitation(userId, companyId); !ok {
 		resp := util.Message(false, http.StatusForbidden, "You are not authorized to perform the action.", errors)	
 		util.Respond(w, resp)
 		return
@@ -55,6 +64,12 @@ var InviteToCompany = func(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Check if the user can grant the role and the teams
+	if resp, ok := company.ValidateInvitationGrant(user, input.RoleID, input.TeamIDs); !ok {
+		util.Respond(w, resp)
+		return
+	}
+
 	emails := util.GetUniqueValues(input.Emails)
 	message := input.Message
 
@@ -66,7 +81,7 @@ var InviteToCompany = func(w http.ResponseWriter, r *http.Request) {
 	for w := 1; w <= noOfEmailWorkers; w++ {
 		go func(id int, emailJobs <-chan string, results chan<- models.CompanyInvitationRequest) {
 			for emailInput := range emailJobs {
-				result := company.InviteToCompany(emailInput, message, userId)
+				result := company.InviteToCompany(emailInput, message, userId, input.RoleID, input.TeamIDs)
 				// signal that the routine has completed
 				if(result["success"].(bool)) {
 					results <- result["data"].(models.CompanyInvitationRequest)
@@ -120,7 +135,7 @@ var IndexInviteToCompany = func(w http.ResponseWriter, r *http.Request) {
 	companyId, _ := uuid.FromString(vars["id"]) 
 
 	// Authorization
-	if ok := policy.CreateUpdateDeleteCompanyInvitation(userId, companyId); !ok {
+	if ok := policy.ShowCompanyInvitation(userId, companyId); !ok {
 		resp := util.Message(false, http.StatusForbidden, "You are not authorized to perform the action.", errors)	
 		util.Respond(w, resp)
 		return
@@ -184,6 +199,77 @@ var ShowCompanyInvitationRequest = func(w http.ResponseWriter, r *http.Request)
 	util.Respond(w, resp)
 }
 
+// Resend the invitation with a fresh link and expiry
+var ResendCompanyInvitationRequest = func(w http.ResponseWriter, r *http.Request) {
+	var errors []string
+	var resp map[string] interface{}
+	userId := r.Context().Value("user") . (uuid.UUID)
+	// Get the ID of the company passed in via URL
+	vars := mux.Vars(r)
+	companyId, _ := uuid.FromString(vars["id"]) 
+	
+	// Authorization
+	if ok := policy.ResendCompanyInvitation(userId, companyId); !ok {
+		resp := util.Message(false, http.StatusForbidden, "You are not authorized to perform the action.", errors)	
+		util.Respond(w, resp)
+		return
+	}
+
+	user := models.GetUser(userId)
+	invitationId, _ := uuid.FromString(vars["invitationID"]) 
+	company := models.GetCompany(companyId, userId) 
+
+	if user == nil || company == nil {
+		resp := util.Message(false, http.StatusUnprocessableEntity, "Something wrong has occured. Please try again.", errors)	
+		util.Respond(w, resp)
+		return
+	} 
+
+	invitation := &models.CompanyInvitationRequest{}
+	resp = invitation.GetInvitation(invitationId, companyId)
+	if _, ok := resp["data"]; ok {
+		data := resp["data"] . (*models.CompanyInvitationRequest)
+		resp = data.ResendInvitation(company, user)
+	}
+	
+	util.Respond(w, resp)
+}
+
+// Revoke the invitation that is awaiting response
+var RevokeCompanyInvitationRequest = func(w http.ResponseWriter, r *http.Request) {
+	var errors []string
+	var resp map[string] interface{}
+	userId := r.Context().Value("user") . (uuid.UUID)
+	// Get the ID of the company passed in via URL
+	vars := mux.Vars(r)
+	companyId, _ := uuid.FromString(vars["id"]) 
+	
+	// Authorization
+	if ok := policy.RevokeCompanyInvitation(userId, companyId); !ok {
+		resp := util.Message(false, http.StatusForbidden, "You are not authorized to perform the action.", errors)	
+		util.Respond(w, resp)
+		return
+	}
+
+	user := models.GetUser(userId)
+	invitationId, _ := uuid.FromString(vars["invitationID"]) 
+
+	if user == nil {
+		resp := util.Message(false, http.StatusUnprocessableEntity, "Something wrong has occured. Please try again.", errors)	
+		util.Respond(w, resp)
+		return
+	} 
+
+	invitation := &models.CompanyInvitationRequest{}
+	resp = invitation.GetInvitation(invitationId, companyId)
+	if _, ok := resp["data"]; ok {
+		data := resp["data"] . (*models.CompanyInvitationRequest)
+		resp = data.RevokeInvitation()
+	}
+	
+	util.Respond(w, resp)
+}
+
 // Delete the company invitation request
 var DeleteCompanyInvitationRequest = func(w http.ResponseWriter, r *http.Request) {
 	var errors []string
@@ -194,7 +280,7 @@ var DeleteCompanyInvitationRequest = func(w http.ResponseWriter, r *http.Request
 	companyId, _ := uuid.FromString(vars["id"]) 
 	
 	// Authorization
-	if ok := policy.CreateUpdateDeleteCompanyInvitation(userId, companyId); !ok {
+	if ok := policy.DeleteCompanyInvitation(userId, companyId); !ok {
 		resp := util.Message(false, http.StatusForbidden, "You are not authorized to perform the action.", errors)	
 		util.Respond(w, resp)
 		return
@@ -314,7 +400,61 @@ var RespondCompanyInvitationRequest = func(w http.ResponseWriter, r *http.Reques
 		invitation.Status = util.IndexOf("Joined", invitationInterface)
 	}
 
-	resp = invitation.RespondCompanyInvitation(*user)
+	resp = invitation.RespondCompanyInvitation(*user, getClient(r))
+	
+	util.Respond(w, resp)
+}
+
+// Get the invitation from the link in the invitation email
+var ShowInvitationByToken = func(w http.ResponseWriter, r *http.Request) {
+	// Get the token of the invitation passed in via URL
+	vars := mux.Vars(r)
 	
+	resp := models.GetInvitationByToken(vars["token"])
+
+	util.Respond(w, resp)
+}
+
+// Sign up with the email of the invitation and join the company in one go
+var SignupWithInvitation = func(w http.ResponseWriter, r *http.Request) {
+	var errors []string
+
+	// Get the token of the invitation passed in via URL
+	vars := mux.Vars(r)
+
+	input := InvitationSignupInput{}
+	err := json.NewDecoder(r.Body).Decode(&input)
+	if err != nil {
+		errors = append(errors, err.Error())
+		util.Respond(w, util.Message(false, http.StatusInternalServerError, "Error decoding request body", errors))
+		return
+	}
+
+	// Validate the input
+	validate = validator.New()
+	password.RegisterValidation(validate)
+	err = validate.Struct(input)
+	if err != nil {
+		util.GetErrorMessages(&errors, err)
+
+		resp := util.Message(false, http.StatusUnprocessableEntity, "Validation error", errors)
+		util.Respond(w, resp)
+		return
+	}
+
+	// Check if the client has too many failed attempts
+	ip := util.GetClientIP(r)
+	if !allowAttempt(w, ip) {
+		return
+	}
+
+	// The email is taken from the invitation
+	user := &models.User{}
+	user.Name = input.Name
+	user.Password = input.Password
+
+	resp := models.SignupWithInvitation(vars["token"], user, getClient(r))
+	recordAttempt(ip, resp)
+
 	util.Respond(w, resp)
-}
\ No newline at end of file
+}
@@ -0,0 +1,431 @@
+package api
+
+import (
+	"app/models"
+	"app/policy"
+	util "app/utils"
+	"github.com/gorilla/mux"
+	"github.com/satori/go.uuid"
+	"net/http"
+)
+
+type JoinLinkInput struct {
+	RoleID        *uuid.UUID `json:"roleId"`                                 // The default role of the company if not set
+	MaxUses       int        `json:"maxUses" validate:"min=0"`               // Unlimited if not set
+	ExpiresInDays int        `json:"expiresInDays" validate:"min=0,max=365"` // Never expires if not set
+}
+
+type CompanyDomainInput struct {
+	Domain   string     `json:"domain" validate:"required,max=255"`
+	AutoJoin bool       `json:"autoJoin"`
+	RoleID   *uuid.UUID `json:"roleId"` // The default role of the company if not set
+}
+
+type CompanyDomainSettingsInput struct {
+	AutoJoin bool       `json:"autoJoin"`
+	RoleID   *uuid.UUID `json:"roleId"`
+}
+
+type JoinRequestResponseInput struct {
+	Approve bool `json:"approve"`
+}
+
+// Get the join links of the company
+var IndexCompanyJoinLinks = func(w http.ResponseWriter, r *http.Request) {
+	var errors []string
+	userId := r.Context().Value("user").(uuid.UUID)
+
+	// Get the ID of the company passed in via URL
+	vars := mux.Vars(r)
+	companyId, _ := uuid.FromString(vars["id"])
+
+	// Authorization
+	if ok := policy.ViewCompanyJoinLinks(userId, companyId); !ok {
+		resp := util.Message(false, http.StatusForbidden, "You are not authorized to perform the action.", errors)
+		util.Respond(w, resp)
+		return
+	}
+
+	company := models.GetCompany(companyId, userId)
+
+	if company == nil {
+		resp := util.Message(false, http.StatusUnprocessableEntity, "Something wrong has occured. Please try again.", errors)
+		util.Respond(w, resp)
+		return
+	}
+
+	resp := company.GetJoinLinks()
+	util.Respond(w, resp)
+}
+
+// Create the join link of the company
+var CreateCompanyJoinLink = func(w http.ResponseWriter, r *http.Request) {
+	var errors []string
+	userId := r.Context().Value("user").(uuid.UUID)
+
+	// Get the ID of the company passed in via URL
+	vars := mux.Vars(r)
+	companyId, _ := uuid.FromString(vars["id"])
+
+	// Authorization
+	if ok := policy.CreateCompanyJoinLink(userId, companyId); !ok {
+		resp := util.Message(false, http.StatusForbidden, "You are not authorized to perform the action.", errors)
+		util.Respond(w, resp)
+		return
+	}
+
+	user := models.GetUser(userId)
+	company := models.GetCompany(companyId, userId)
+
+	if user == nil || company == nil {
+		resp := util.Message(false, http.StatusUnprocessableEntity, "Something wrong has occured. Please try again.", errors)
+		util.Respond(w, resp)
+		return
+	}
+
+	input := JoinLinkInput{}
+	if !decodeInput(w, r, &input) {
+		return
+	}
+
+	resp := company.CreateJoinLink(user, input.RoleID, input.MaxUses, input.ExpiresInDays)
+	util.Respond(w, resp)
+}
+
+// Revoke the join link of the company
+var RevokeCompanyJoinLink = func(w http.ResponseWriter, r *http.Request) {
+	var errors []string
+	userId := r.Context().Value("user").(uuid.UUID)
+
+	// Get the ID of the company and the join link passed in via URL
+	vars := mux.Vars(r)
+	companyId, _ := uuid.FromString(vars["id"])
+	linkId, _ := uuid.FromString(vars["linkId"])
+
+	// Authorization
+	if ok := policy.RevokeCompanyJoinLink(userId, companyId); !ok {
+		resp := util.Message(false, http.StatusForbidden, "You are not authorized to perform the action.", errors)
+		util.Respond(w, resp)
+		return
+	}
+
+	company := models.GetCompany(companyId, userId)
+
+	if company == nil {
+		resp := util.Message(false, http.StatusUnprocessableEntity, "Something wrong has occured. Please try again.", errors)
+		util.Respond(w, resp)
+		return
+	}
+
+	resp := company.RevokeJoinLink(linkId)
+	util.Respond(w, resp)
+}
+
+// Get the email domains of the company
+var IndexCompanyDomains = func(w http.ResponseWriter, r *http.Request) {
+	var errors []string
+	userId := r.Context().Value("user").(uuid.UUID)
+
+	// Get the ID of the company passed in via URL
+	vars := mux.Vars(r)
+	companyId, _ := uuid.FromString(vars["id"])
+
+	// Authorization
+	if ok := policy.ManageCompanyDomains(userId, companyId); !ok {
+		resp := util.Message(false, http.StatusForbidden, "You are not authorized to perform the action.", errors)
+		util.Respond(w, resp)
+		return
+	}
+
+	company := models.GetCompany(companyId, userId)
+
+	if company == nil {
+		resp := util.Message(false, http.StatusUnprocessableEntity, "Something wrong has occured. Please try again.", errors)
+		util.Respond(w, resp)
+		return
+	}
+
+	resp := company.GetDomains()
+	util.Respond(w, resp)
+}
+
+// Add the email domain to the company
+var CreateCompanyDomain = func(w http.ResponseWriter, r *http.Request) {
+	var errors []string
+	userId := r.Context().Value("user").(uuid.UUID)
+
+	// Get the ID of the company passed in via URL
+	vars := mux.Vars(r)
+	companyId, _ := uuid.FromString(vars["id"])
+
+	// Authorization
+	if ok := policy.ManageCompanyDomains(userId, companyId); !ok {
+		resp := util.Message(false, http.StatusForbidden, "You are not authorized to perform the action.", errors)
+		util.Respond(w, resp)
+		return
+	}
+
+	user := models.GetUser(userId)
+	company := models.GetCompany(companyId, userId)
+
+	if user == nil || company == nil {
+		resp := util.Message(false, http.StatusUnprocessableEntity, "Something wrong has occured. Please try again.", errors)
+		util.Respond(w, resp)
+		return
+	}
+
+	input := CompanyDomainInput{}
+	if !decodeInput(w, r, &input) {
+		return
+	}
+
+	domain := &models.CompanyDomain{
+		Domain:   input.Domain,
+		AutoJoin: input.AutoJoin,
+		RoleID:   input.RoleID,
+	}
+
+	resp := company.AddDomain(user, domain)
+	util.Respond(w, resp)
+}
+
+// Update how the users with the email domain join the company
+var UpdateCompanyDomain = func(w http.ResponseWriter, r *http.Request) {
+	var errors []string
+	userId := r.Context().Value("user").(uuid.UUID)
+
+	// Get the ID of the company and the email domain passed in via URL
+	vars := mux.Vars(r)
+	companyId, _ := uuid.FromString(vars["id"])
+	domainId, _ := uuid.FromString(vars["domainId"])
+
+	// Authorization
+	if ok := policy.ManageCompanyDomains(userId, companyId); !ok {
+		resp := util.Message(false, http.StatusForbidden, "You are not authorized to perform the action.", errors)
+		util.Respond(w, resp)
+		return
+	}
+
+	user := models.GetUser(userId)
+	company := models.GetCompany(companyId, userId)
+
+	if user == nil || company == nil {
+		resp := util.Message(false, http.StatusUnprocessableEntity, "Something wrong has occured. Please try again.", errors)
+		util.Respond(w, resp)
+		return
+	}
+
+	input := CompanyDomainSettingsInput{}
+	if !decodeInput(w, r, &input) {
+		return
+	}
+
+	domain := &models.CompanyDomain{
+		AutoJoin: input.AutoJoin,
+		RoleID:   input.RoleID,
+	}
+
+	resp := company.UpdateDomain(user, domainId, domain)
+	util.Respond(w, resp)
+}
+
+// Verify the email domain of the company with its DNS record
+var VerifyCompanyDomain = func(w http.ResponseWriter, r *http.Request) {
+	var errors []string
+	userId := r.Context().Value("user").(uuid.UUID)
+
+	// Get the ID of the company and the email domain passed in via URL
+	vars := mux.Vars(r)
+	companyId, _ := uuid.FromString(vars["id"])
+	domainId, _ := uuid.FromString(vars["domainId"])
+
+	// Authorization
+	if ok := policy.ManageCompanyDomains(userId, companyId); !ok {
+		resp := util.Message(false, http.StatusForbidden, "You are not authorized to perform the action.", errors)
+		util.Respond(w, resp)
+		return
+	}
+
+	company := models.GetCompany(companyId, userId)
+
+	if company == nil {
+		resp := util.Message(false, http.StatusUnprocessableEntity, "Something wrong has occured. Please try again.", errors)
+		util.Respond(w, resp)
+		return
+	}
+
+	resp := company.VerifyDomain(domainId)
+	util.Respond(w, resp)
+}
+
+// Delete the email domain of the company
+var DeleteCompanyDomain = func(w http.ResponseWriter, r *http.Request) {
+	var errors []string
+	userId := r.Context().Value("user").(uuid.UUID)
+
+	// Get the ID of the company and the email domain passed in via URL
+	vars := mux.Vars(r)
+	companyId, _ := uuid.FromString(vars["id"])
+	domainId, _ := uuid.FromString(vars["domainId"])
+
+	// Authorization
+	if ok := policy.ManageCompanyDomains(userId, companyId); !ok {
+		resp := util.Message(false, http.StatusForbidden, "You are not authorized to perform the action.", errors)
+		util.Respond(w, resp)
+		return
+	}
+
+	company := models.GetCompany(companyId, userId)
+
+	if company == nil {
+		resp := util.Message(false, http.StatusUnprocessableEntity, "Something wrong has occured. Please try again.", errors)
+		util.Respond(w, resp)
+		return
+	}
+
+	resp := company.DeleteDomain(domainId)
+	util.Respond(w, resp)
+}
+
+// Get the requests to join the company
+var IndexCompanyJoinRequests = func(w http.ResponseWriter, r *http.Request) {
+	var errors []string
+	userId := r.Context().Value("user").(uuid.UUID)
+
+	// Get the ID of the company passed in via URL
+	vars := mux.Vars(r)
+	companyId, _ := uuid.FromString(vars["id"])
+
+	// Authorization
+	if ok := policy.ViewCompanyJoinRequests(userId, companyId); !ok {
+		resp := util.Message(false, http.StatusForbidden, "You are not authorized to perform the action.", errors)
+		util.Respond(w, resp)
+		return
+	}
+
+	company := models.GetCompany(companyId, userId)
+
+	if company == nil {
+		resp := util.Message(false, http.StatusUnprocessableEntity, "Something wrong has occured. Please try again.", errors)
+		util.Respond(w, resp)
+		return
+	}
+
+	resp := company.GetJoinRequests()
+	util.Respond(w, resp)
+}
+
+// Approve or decline the request to join the company
+var RespondCompanyJoinRequest = func(w http.ResponseWriter, r *http.Request) {
+	var errors []string
+	userId := r.Context().Value("user").(uuid.UUID)
+
+	// Get the ID of the company and the request passed in via URL
+	vars := mux.Vars(r)
+	companyId, _ := uuid.FromString(vars["id"])
+	invitationId, _ := uuid.FromString(vars["invitationID"])
+
+	// Authorization
+	if ok := policy.RespondCompanyJoinRequest(userId, companyId); !ok {
+		resp := util.Message(false, http.StatusForbidden, "You are not authorized to perform the action.", errors)
+		util.Respond(w, resp)
+		return
+	}
+
+	user := models.GetUser(userId)
+	company := models.GetCompany(companyId, userId)
+
+	if user == nil || company == nil {
+		resp := util.Message(false, http.StatusUnprocessableEntity, "Something wrong has occured. Please try again.", errors)
+		util.Respond(w, resp)
+		return
+	}
+
+	input := JoinRequestResponseInput{}
+	if !decodeInput(w, r, &input) {
+		return
+	}
+
+	invitation := &models.CompanyInvitationRequest{}
+	resp := invitation.GetInvitation(invitationId, companyId)
+	if _, ok := resp["data"]; ok {
+		resp = invitation.RespondJoinRequest(user, input.Approve, getClient(r))
+	}
+
+	util.Respond(w, resp)
+}
+
+// Get the company of the join link before joining
+var ShowJoinLinkByToken = func(w http.ResponseWriter, r *http.Request) {
+	// Get the token of the join link passed in via URL
+	vars := mux.Vars(r)
+
+	resp := models.GetJoinLinkByToken(vars["token"])
+	util.Respond(w, resp)
+}
+
+// Join the company with the join link
+var JoinCompanyByLink = func(w http.ResponseWriter, r *http.Request) {
+	var errors []string
+	userId := r.Context().Value("user").(uuid.UUID)
+
+	// Get the token of the join link passed in via URL
+	vars := mux.Vars(r)
+
+	user := models.GetUser(userId)
+
+	if user == nil {
+		resp := util.Message(false, http.StatusUnprocessableEntity, "Something wrong has occured. Please try again.", errors)
+		util.Respond(w, resp)
+		return
+	}
+
+	// Check if the client has too many failed attempts
+	ip := util.GetClientIP(r)
+	if !allowAttempt(w, ip) {
+		return
+	}
+
+	resp := user.JoinCompanyByLink(vars["token"], getClient(r))
+	recordAttempt(ip, resp)
+	util.Respond(w, resp)
+}
+
+// Get the companies that the user can join with the email domain
+var IndexJoinableCompany = func(w http.ResponseWriter, r *http.Request) {
+	var errors []string
+	userId := r.Context().Value("user").(uuid.UUID)
+
+	user := models.GetUser(userId)
+
+	if user == nil {
+		resp := util.Message(false, http.StatusUnprocessableEntity, "Something wrong has occured. Please try again.", errors)
+		util.Respond(w, resp)
+		return
+	}
+
+	resp := user.GetJoinableCompanies()
+	util.Respond(w, resp)
+}
+
+// Join or request to join the company with the email domain
+var JoinCompanyByDomain = func(w http.ResponseWriter, r *http.Request) {
+	var errors []string
+	userId := r.Context().Value("user").(uuid.UUID)
+
+	// Get the ID of the company passed in via URL
+	vars := mux.Vars(r)
+	companyId, _ := uuid.FromString(vars["id"])
+
+	user := models.GetUser(userId)
+	company := models.GetCompanyByID(companyId)
+
+	if user == nil || company == nil {
+		resp := util.Message(false, http.StatusUnprocessableEntity, "Something wrong has occured. Please try again.", errors)
+		util.Respond(w, resp)
+		return
+	}
+
+	resp := user.JoinCompanyByDomain(company, getClient(r))
+	util.Respond(w, resp)
+}
@@ -0,0 +1,167 @@
+package api
+
+import (
+	"app/models"
+	"app/policy"
+	util "app/utils"
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"github.com/satori/go.uuid"
+	"gopkg.in/go-playground/validator.v9"
+	"net/http"
+)
+
+type OwnershipTransferInput struct {
+	UserID uuid.UUID `json:"userId" validate:"required"`
+}
+
+type OwnershipTransferResponseInput struct {
+	Accept bool `json:"accept"`
+}
+
+// Get the pending ownership transfer of the company
+var ShowCompanyOwnershipTransfer = func(w http.ResponseWriter, r *http.Request) {
+	var errors []string
+	userId := r.Context().Value("user").(uuid.UUID)
+
+	// Get the ID of the company passed in via URL
+	vars := mux.Vars(r)
+	companyId, _ := uuid.FromString(vars["id"])
+
+	// Authorization
+	if ok := policy.RespondCompanyOwnershipTransfer(userId, companyId); !ok {
+		resp := util.Message(false, http.StatusForbidden, "You are not authorized to perform the action.", errors)
+		util.Respond(w, resp)
+		return
+	}
+
+	user := models.GetUser(userId)
+	company := models.GetCompany(companyId, userId)
+
+	if user == nil || company == nil {
+		resp := util.Message(false, http.StatusUnprocessableEntity, "Something wrong has occured. Please try again.", errors)
+		util.Respond(w, resp)
+		return
+	}
+
+	resp := company.GetOwnershipTransfer(user)
+
+	util.Respond(w, resp)
+}
+
+// Nominate another member as the new owner of the company
+var TransferCompanyOwnership = func(w http.ResponseWriter, r *http.Request) {
+	var errors []string
+	userId := r.Context().Value("user").(uuid.UUID)
+
+	// Get the ID of the company passed in via URL
+	vars := mux.Vars(r)
+	companyId, _ := uuid.FromString(vars["id"])
+
+	// Authorization
+	if ok := policy.TransferCompanyOwnership(userId, companyId); !ok {
+		resp := util.Message(false, http.StatusForbidden, "You are not authorized to perform the action.", errors)
+		util.Respond(w, resp)
+		return
+	}
+
+	user := models.GetUser(userId)
+	company := models.GetCompany(companyId, userId)
+
+	if user == nil || company == nil {
+		resp := util.Message(false, http.StatusUnprocessableEntity, "Something wrong has occured. Please try again.", errors)
+		util.Respond(w, resp)
+		return
+	}
+
+	input := OwnershipTransferInput{}
+	err := json.NewDecoder(r.Body).Decode(&input)
+	if err != nil {
+		errors = append(errors, err.Error())
+		util.Respond(w, util.Message(false, http.StatusInternalServerError, "Error decoding request body", errors))
+		return
+	}
+
+	// Validate the input
+	validate = validator.New()
+	err = validate.Struct(input)
+	if err != nil {
+		util.GetErrorMessages(&errors, err)
+
+		resp := util.Message(false, http.StatusUnprocessableEntity, "Validation error", errors)
+		util.Respond(w, resp)
+		return
+	}
+
+	resp := company.TransferOwnership(user, input.UserID, getClient(r))
+
+	util.Respond(w, resp)
+}
+
+// Cancel the pending ownership transfer of the company
+var CancelCompanyOwnershipTransfer = func(w http.ResponseWriter, r *http.Request) {
+	var errors []string
+	userId := r.Context().Value("user").(uuid.UUID)
+
+	// Get the ID of the company passed in via URL
+	vars := mux.Vars(r)
+	companyId, _ := uuid.FromString(vars["id"])
+
+	// Authorization
+	if ok := policy.TransferCompanyOwnership(userId, companyId); !ok {
+		resp := util.Message(false, http.StatusForbidden, "You are not authorized to perform the action.", errors)
+		util.Respond(w, resp)
+		return
+	}
+
+	user := models.GetUser(userId)
+	company := models.GetCompany(companyId, userId)
+
+	if user == nil || company == nil {
+		resp := util.Message(false, http.StatusUnprocessableEntity, "Something wrong has occured. Please try again.", errors)
+		util.Respond(w, resp)
+		return
+	}
+
+	resp := company.CancelOwnershipTransfer(user, getClient(r))
+
+	util.Respond(w, resp)
+}
+
+// Accept or decline the ownership of the company as the nominated member
+var RespondCompanyOwnershipTransfer = func(w http.ResponseWriter, r *http.Request) {
+	var errors []string
+	userId := r.Context().Value("user").(uuid.UUID)
+
+	// Get the ID of the company passed in via URL
+	vars := mux.Vars(r)
+	companyId, _ := uuid.FromString(vars["id"])
+
+	// Authorization
+	if ok := policy.RespondCompanyOwnershipTransfer(userId, companyId); !ok {
+		resp := util.Message(false, http.StatusForbidden, "You are not authorized to perform the action.", errors)
+		util.Respond(w, resp)
+		return
+	}
+
+	user := models.GetUser(userId)
+	company := models.GetCompany(companyId, userId)
+
+	if user == nil || company == nil {
+		resp := util.Message(false, http.StatusUnprocessableEntity, "Something wrong has occured. Please try again.", errors)
+		util.Respond(w, resp)
+		return
+	}
+
+	input := OwnershipTransferResponseInput{}
+	err := json.NewDecoder(r.Body).Decode(&input)
+	if err != nil {
+		errors = append(errors, err.Error())
+		util.Respond(w, util.Message(false, http.StatusInternalServerError, "Error decoding request body", errors))
+		return
+	}
+
+	resp := company.RespondOwnershipTransfer(user, input.Accept, getClient(r))
+
+	util.Respond(w, resp)
+}
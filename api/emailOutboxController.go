@@ -0,0 +1,56 @@
+package api
+
+import (
+	"app/models"
+	"app/policy"
+	util "app/utils"
+	"github.com/gorilla/mux"
+	"github.com/satori/go.uuid"
+	"net/http"
+	"strconv"
+)
+
+// Get the pending/failed emails sent out by the company
+var IndexCompanyEmails = func(w http.ResponseWriter, r *http.Request) {
+	var errors []string
+	userId := r.Context().Value("user").(uuid.UUID)
+
+	// Get the ID of the company passed in via URL
+	vars := mux.Vars(r)
+	companyId, _ := uuid.FromString(vars["id"])
+
+	// Authorization
+	if ok := policy.ShowCompanyEmails(userId, companyId); !ok {
+		resp := util.Message(false, http.StatusForbidden, "You are not authorized to perform the action.", errors)
+		util.Respond(w, resp)
+		return
+	}
+
+	company := models.GetCompany(companyId, userId)
+
+	if company == nil {
+		resp := util.Message(false, http.StatusUnprocessableEntity, "Something wrong has occured. Please try again.", errors)
+		util.Respond(w, resp)
+		return
+	}
+
+	// Get the page and status passed in via URL
+	pageKeys, ok := r.URL.Query()["page"]
+	page := 0 // if page 0, then show all
+
+	if ok && len(pageKeys[0]) >= 1 {
+		if _, err := strconv.Atoi(pageKeys[0]); err == nil {
+			page, _ = strconv.Atoi(pageKeys[0])
+		}
+	}
+
+	statusKeys, ok := r.URL.Query()["status"]
+	status := "" // if no status, then show both pending and failed
+	if ok {
+		status = statusKeys[0]
+	}
+
+	resp := company.GetEmailOutbox(status, page)
+
+	util.Respond(w, resp)
+}
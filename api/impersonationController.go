@@ -0,0 +1,77 @@
+package api
+
+import (
+	"app/models"
+	"app/policy"
+	util "app/utils"
+	"encoding/json"
+	"github.com/satori/go.uuid"
+	"gopkg.in/go-playground/validator.v9"
+	"net/http"
+)
+
+type ImpersonateInput struct {
+	UserID string `json:"userId" validate:"required,uuid"`
+	Reason string `json:"reason" validate:"required,max=500"`
+}
+
+// Issue the token for the superuser to act as the user for support
+var Impersonate = func(w http.ResponseWriter, r *http.Request) {
+	var errors []string
+	userId := r.Context().Value("user").(uuid.UUID)
+
+	input := ImpersonateInput{}
+	err := json.NewDecoder(r.Body).Decode(&input)
+	if err != nil {
+		errors = append(errors, err.Error())
+		util.Respond(w, util.Message(false, http.StatusInternalServerError, "Error decoding request body", errors))
+		return
+	}
+
+	// Validate the input
+	validate = validator.New()
+	err = validate.Struct(input)
+	if err != nil {
+		util.GetErrorMessages(&errors, err)
+
+		resp := util.Message(false, http.StatusUnprocessableEntity, "Validation error", errors)
+		util.Respond(w, resp)
+		return
+	}
+
+	targetUserId, _ := uuid.FromString(input.UserID)
+
+	// Authorization
+	if ok := policy.Impersonate(userId, targetUserId); !ok {
+		resp := util.Message(false, http.StatusForbidden, "You are not authorized to perform the action.", errors)
+		util.Respond(w, resp)
+		return
+	}
+
+	user := models.GetUser(userId)
+
+	if user == nil {
+		resp := util.Message(false, http.StatusUnprocessableEntity, "Something wrong has occured. Please try again.", errors)
+		util.Respond(w, resp)
+		return
+	}
+
+	resp := user.Impersonate(targetUserId, input.Reason, getClient(r))
+	util.Respond(w, resp)
+}
+
+// End the impersonation of the current token
+var EndImpersonation = func(w http.ResponseWriter, r *http.Request) {
+	var errors []string
+
+	if _, ok := r.Context().Value("impersonator").(uuid.UUID); !ok {
+		resp := util.Message(false, http.StatusUnprocessableEntity, "You are not impersonating any user.", errors)
+		util.Respond(w, resp)
+		return
+	}
+
+	impersonationId := r.Context().Value("session").(uuid.UUID)
+
+	resp := models.EndImpersonation(impersonationId, getClient(r))
+	util.Respond(w, resp)
+}
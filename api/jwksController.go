@@ -0,0 +1,14 @@
+package api
+
+import (
+	"app/models"
+	"encoding/json"
+	"net/http"
+)
+
+// Get the public keys that verify the login tokens, in the JSON Web Key Set format
+var JWKS = func(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	json.NewEncoder(w).Encode(models.GetJWKS())
+}
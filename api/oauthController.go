@@ -0,0 +1,115 @@
+package api
+
+import (
+	"app/models"
+	"app/oauth"
+	util "app/utils"
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"github.com/satori/go.uuid"
+	"gopkg.in/go-playground/validator.v9"
+	"net/http"
+)
+
+type OAuthCallbackInput struct {
+	Code  string `json:"code" validate:"required"`
+	State string `json:"state" validate:"required"`
+}
+
+// Get the URL of the provider to start the social login
+var OAuthLogin = func(w http.ResponseWriter, r *http.Request) {
+	var errors []string
+
+	// Get the provider passed in via URL
+	vars := mux.Vars(r)
+	provider, ok := oauth.GetProvider(vars["provider"])
+	if !ok {
+		resp := util.Message(false, http.StatusNotFound, "The login provider is not supported.", errors)
+		util.Respond(w, resp)
+		return
+	}
+
+	resp := models.StartOAuthLogin(provider)
+	util.Respond(w, resp)
+}
+
+// Complete the social login with the code returned by the provider
+var OAuthCallback = func(w http.ResponseWriter, r *http.Request) {
+	var errors []string
+
+	// Get the provider passed in via URL
+	vars := mux.Vars(r)
+	provider, ok := oauth.GetProvider(vars["provider"])
+	if !ok {
+		resp := util.Message(false, http.StatusNotFound, "The login provider is not supported.", errors)
+		util.Respond(w, resp)
+		return
+	}
+
+	input := OAuthCallbackInput{}
+	err := json.NewDecoder(r.Body).Decode(&input)
+	if err != nil {
+		errors = append(errors, err.Error())
+		util.Respond(w, util.Message(false, http.StatusInternalServerError, "Error decoding request body", errors))
+		return
+	}
+
+	// Validate the input
+	validate = validator.New()
+	err = validate.Struct(input)
+	if err != nil {
+		util.GetErrorMessages(&errors, err)
+
+		resp := util.Message(false, http.StatusUnprocessableEntity, "Validation error", errors)
+		util.Respond(w, resp)
+		return
+	}
+
+	// Check if the client has too many failed attempts
+	ip := util.GetClientIP(r)
+	if !allowAttempt(w, ip) {
+		return
+	}
+
+	resp := models.CompleteOAuthLogin(provider, input.Code, input.State, getClient(r))
+	recordAttempt(ip, resp)
+	util.Respond(w, resp)
+}
+
+// Get the external accounts linked to the user
+var IndexIdentities = func(w http.ResponseWriter, r *http.Request) {
+	var errors []string
+	userId := r.Context().Value("user").(uuid.UUID)
+
+	user := models.GetUser(userId)
+
+	if user == nil {
+		resp := util.Message(false, http.StatusUnprocessableEntity, "Something wrong has occured. Please try again.", errors)
+		util.Respond(w, resp)
+		return
+	}
+
+	resp := user.GetIdentities()
+	util.Respond(w, resp)
+}
+
+// Unlink the external account from the user
+var DeleteIdentity = func(w http.ResponseWriter, r *http.Request) {
+	var errors []string
+	userId := r.Context().Value("user").(uuid.UUID)
+
+	user := models.GetUser(userId)
+
+	if user == nil {
+		resp := util.Message(false, http.StatusUnprocessableEntity, "Something wrong has occured. Please try again.", errors)
+		util.Respond(w, resp)
+		return
+	}
+
+	// Get the ID of the identity passed in via URL
+	vars := mux.Vars(r)
+	identityId, _ := uuid.FromString(vars["id"])
+
+	resp := user.UnlinkIdentity(identityId)
+	util.Respond(w, resp)
+}
@@ -0,0 +1,95 @@
+package api
+
+import (
+	"app/models"
+	"app/policy"
+	util "app/utils"
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"github.com/satori/go.uuid"
+	"net/http"
+)
+
+type CompanyPasswordPolicyInput struct {
+	MinLength        int  `json:"minLength"`
+	RequireUpper     bool `json:"requireUpper"`
+	RequireLower     bool `json:"requireLower"`
+	RequireDigit     bool `json:"requireDigit"`
+	RequireSymbol    bool `json:"requireSymbol"`
+	DisallowPersonal bool `json:"disallowPersonal"`
+	History          int  `json:"history"`
+}
+
+// Get the password policy of the company
+var ShowCompanyPasswordPolicy = func(w http.ResponseWriter, r *http.Request) {
+	var errors []string
+	userId := r.Context().Value("user").(uuid.UUID)
+
+	// Get the ID of the company passed in via URL
+	vars := mux.Vars(r)
+	companyId, _ := uuid.FromString(vars["id"])
+
+	// Authorization
+	if ok := policy.ManageCompanyPasswordPolicy(userId, companyId); !ok {
+		resp := util.Message(false, http.StatusForbidden, "You are not authorized to perform the action.", errors)
+		util.Respond(w, resp)
+		return
+	}
+
+	company := models.GetCompany(companyId, userId)
+
+	if company == nil {
+		resp := util.Message(false, http.StatusUnprocessableEntity, "Something wrong has occured. Please try again.", errors)
+		util.Respond(w, resp)
+		return
+	}
+
+	resp := company.GetPasswordPolicy()
+	util.Respond(w, resp)
+}
+
+// Update the password policy of the company
+var UpdateCompanyPasswordPolicy = func(w http.ResponseWriter, r *http.Request) {
+	var errors []string
+	userId := r.Context().Value("user").(uuid.UUID)
+
+	// Get the ID of the company passed in via URL
+	vars := mux.Vars(r)
+	companyId, _ := uuid.FromString(vars["id"])
+
+	// Authorization
+	if ok := policy.ManageCompanyPasswordPolicy(userId, companyId); !ok {
+		resp := util.Message(false, http.StatusForbidden, "You are not authorized to perform the action.", errors)
+		util.Respond(w, resp)
+		return
+	}
+
+	company := models.GetCompany(companyId, userId)
+
+	if company == nil {
+		resp := util.Message(false, http.StatusUnprocessableEntity, "Something wrong has occured. Please try again.", errors)
+		util.Respond(w, resp)
+		return
+	}
+
+	input := CompanyPasswordPolicyInput{}
+	err := json.NewDecoder(r.Body).Decode(&input)
+	if err != nil {
+		errors = append(errors, err.Error())
+		util.Respond(w, util.Message(false, http.StatusInternalServerError, "Error decoding request body", errors))
+		return
+	}
+
+	companyPolicy := &models.CompanyPasswordPolicy{
+		MinLength:        input.MinLength,
+		RequireUpper:     input.RequireUpper,
+		RequireLower:     input.RequireLower,
+		RequireDigit:     input.RequireDigit,
+		RequireSymbol:    input.RequireSymbol,
+		DisallowPersonal: input.DisallowPersonal,
+		History:          input.History,
+	}
+
+	resp := company.UpdatePasswordPolicy(companyPolicy)
+	util.Respond(w, resp)
+}
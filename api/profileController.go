@@ -1,12 +1,14 @@
 package api
 
 import (
+	"archive/zip"
 	"net/http"
 	util "app/utils"
 	"encoding/json"
 	"app/models"
 	"gopkg.in/go-playground/validator.v9"
 	"github.com/satori/go.uuid"
+	"app/password"
 	"time"
 )
 
@@ -24,8 +26,18 @@ type UploadPictureInput struct {
 	ProfilePicture string `json:"profilePicture"`
 }
 
+type EditEmailInput struct {
+	Email string `json:"email" validate:"required,email"`
+	Password string `json:"password" validate:"required"`
+}
+
+type DeleteAccountInput struct {
+	Password string `json:"password" validate:"required"`
+}
+
 type EditPasswordInput struct {
-	Password string `json:"password" validate:"required,min=8,max=16"`
+	CurrentPassword string `json:"currentPassword" validate:"required"`
+	Password string `json:"password" validate:"required,password"`
 }
 
 // Get the profile information
@@ -166,6 +178,7 @@ var EditPassword = func(w http.ResponseWriter, r *http.Request) {
 
 	// Validate the input
 	validate = validator.New()
+	password.RegisterValidation(validate)
 	err = validate.Struct(input)
 	if err != nil {
 		util.GetErrorMessages(&errors, err)
@@ -176,7 +189,158 @@ var EditPassword = func(w http.ResponseWriter, r *http.Request) {
 	}
 	// Save the data into database
 	user.Password = input.Password
-	resp := user.EditPassword()
+	sessionId, _ := r.Context().Value("session") . (uuid.UUID)
+	resp := user.EditPassword(input.CurrentPassword, sessionId, getClient(r))
+	
+	util.Respond(w, resp)
+}
+
+// Email the link to set the password, for the user who does not know the current password, ie. signed up with the social login
+var SendPasswordLink = func(w http.ResponseWriter, r *http.Request) {
+	var errors []string
+	userId := r.Context().Value("user") . (uuid.UUID)
+
+	user := models.GetUser(userId)
+
+	if user == nil {
+		resp := util.Message(false, http.StatusUnprocessableEntity, "Something wrong has occured. Please try again.", errors)
+		util.Respond(w, resp)
+		return
+	}
+
+	resp := user.SendPasswordLink()
+
+	util.Respond(w, resp)
+}
+
+// Request to change the email address, the change is applied after the new address is confirmed
+var EditEmail = func(w http.ResponseWriter, r *http.Request) {
+	var errors []string
+	userId := r.Context().Value("user") . (uuid.UUID)
+
+	user := models.GetUser(userId)
+
+	if user == nil {
+		resp := util.Message(false, http.StatusUnprocessableEntity, "Something wrong has occured. Please try again.", errors)	
+		util.Respond(w, resp)
+		return
+	}
+
+	input := EditEmailInput{}
+	err := json.NewDecoder(r.Body).Decode(&input)
+	if err != nil {
+		errors = append(errors, err.Error())
+		util.Respond(w, util.Message(false, http.StatusInternalServerError, "Error decoding request body", errors))
+		return
+	}
+
+	// Validate the input
+	validate = validator.New()
+	err = validate.Struct(input)
+	if err != nil {
+		util.GetErrorMessages(&errors, err)
+		
+		resp := util.Message(false, http.StatusUnprocessableEntity, "Validation error", errors)
+		util.Respond(w, resp)
+		return
+	}
+
+	resp := user.RequestEmailChange(input.Email, input.Password)
+	
+	util.Respond(w, resp)
+}
+
+// Download the personal data of the user as a ZIP of JSON files
+var ExportProfile = func(w http.ResponseWriter, r *http.Request) {
+	var errors []string
+	userId := r.Context().Value("user") . (uuid.UUID)
+
+	user := models.GetUser(userId)
+
+	if user == nil {
+		resp := util.Message(false, http.StatusUnprocessableEntity, "Something wrong has occured. Please try again.", errors)	
+		util.Respond(w, resp)
+		return
+	}
+
+	data, err := user.ExportData(getClient(r))
+	if err != nil {
+		resp := util.Message(false, http.StatusInternalServerError, "Failed to export the data, connection error.", errors)
+		util.Respond(w, resp)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", `attachment; filename="export-`+time.Now().Format("20060102")+`.zip"`)
+
+	archive := zip.NewWriter(w)
+	for name, value := range data {
+		file, err := archive.Create(name + ".json")
+		if err != nil {
+			break
+		}
+
+		encoder := json.NewEncoder(file)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(value); err != nil {
+			break
+		}
+	}
+	archive.Close()
+}
+
+// Schedule the account to be deleted after the grace period
+var DeleteAccount = func(w http.ResponseWriter, r *http.Request) {
+	var errors []string
+	userId := r.Context().Value("user") . (uuid.UUID)
+
+	user := models.GetUser(userId)
+
+	if user == nil {
+		resp := util.Message(false, http.StatusUnprocessableEntity, "Something wrong has occured. Please try again.", errors)	
+		util.Respond(w, resp)
+		return
+	}
+
+	input := DeleteAccountInput{}
+	err := json.NewDecoder(r.Body).Decode(&input)
+	if err != nil {
+		errors = append(errors, err.Error())
+		util.Respond(w, util.Message(false, http.StatusInternalServerError, "Error decoding request body", errors))
+		return
+	}
+
+	// Validate the input
+	validate = validator.New()
+	err = validate.Struct(input)
+	if err != nil {
+		util.GetErrorMessages(&errors, err)
+		
+		resp := util.Message(false, http.StatusUnprocessableEntity, "Validation error", errors)
+		util.Respond(w, resp)
+		return
+	}
+
+	sessionId, _ := r.Context().Value("session") . (uuid.UUID)
+	resp := user.RequestDeletion(input.Password, sessionId, getClient(r))
+	
+	util.Respond(w, resp)
+}
+
+// Cancel the scheduled deletion of the account
+var CancelDeleteAccount = func(w http.ResponseWriter, r *http.Request) {
+	var errors []string
+	userId := r.Context().Value("user") . (uuid.UUID)
+
+	user := models.GetUser(userId)
+
+	if user == nil {
+		resp := util.Message(false, http.StatusUnprocessableEntity, "Something wrong has occured. Please try again.", errors)	
+		util.Respond(w, resp)
+		return
+	}
+
+	resp := user.CancelDeletion(getClient(r))
 	
 	util.Respond(w, resp)
 }
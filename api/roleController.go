@@ -0,0 +1,201 @@
+package api
+
+import (
+	"app/models"
+	"app/policy"
+	util "app/utils"
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"github.com/satori/go.uuid"
+	"gopkg.in/go-playground/validator.v9"
+	"net/http"
+)
+
+type RoleInput struct {
+	Name        string   `json:"name" validate:"required,max=50"`
+	Permissions []string `json:"permissions"`
+	IsDefault   bool     `json:"isDefault"`
+}
+
+// Get the roles of the company and the permissions available
+var IndexCompanyRoles = func(w http.ResponseWriter, r *http.Request) {
+	var errors []string
+	userId := r.Context().Value("user").(uuid.UUID)
+
+	// Get the ID of the company passed in via URL
+	vars := mux.Vars(r)
+	companyId, _ := uuid.FromString(vars["id"])
+
+	// Authorization
+	if ok := policy.ViewCompanyRoles(userId, companyId); !ok {
+		resp := util.Message(false, http.StatusForbidden, "You are not authorized to perform the action.", errors)
+		util.Respond(w, resp)
+		return
+	}
+
+	company := models.GetCompany(companyId, userId)
+
+	if company == nil {
+		resp := util.Message(false, http.StatusUnprocessableEntity, "Something wrong has occured. Please try again.", errors)
+		util.Respond(w, resp)
+		return
+	}
+
+	resp := company.GetRoles()
+	util.Respond(w, resp)
+}
+
+// Get the role of the company
+var ShowCompanyRole = func(w http.ResponseWriter, r *http.Request) {
+	var errors []string
+	userId := r.Context().Value("user").(uuid.UUID)
+
+	// Get the ID of the company and the role passed in via URL
+	vars := mux.Vars(r)
+	companyId, _ := uuid.FromString(vars["id"])
+	roleId, _ := uuid.FromString(vars["roleId"])
+
+	// Authorization
+	if ok := policy.ViewCompanyRoles(userId, companyId); !ok {
+		resp := util.Message(false, http.StatusForbidden, "You are not authorized to perform the action.", errors)
+		util.Respond(w, resp)
+		return
+	}
+
+	company := models.GetCompany(companyId, userId)
+
+	if company == nil {
+		resp := util.Message(false, http.StatusUnprocessableEntity, "Something wrong has occured. Please try again.", errors)
+		util.Respond(w, resp)
+		return
+	}
+
+	resp := company.GetRole(roleId)
+	util.Respond(w, resp)
+}
+
+// Create the custom role of the company
+var CreateCompanyRole = func(w http.ResponseWriter, r *http.Request) {
+	var errors []string
+	userId := r.Context().Value("user").(uuid.UUID)
+
+	// Get the ID of the company passed in via URL
+	vars := mux.Vars(r)
+	companyId, _ := uuid.FromString(vars["id"])
+
+	// Authorization
+	if ok := policy.ManageCompanyRoles(userId, companyId); !ok {
+		resp := util.Message(false, http.StatusForbidden, "You are not authorized to perform the action.", errors)
+		util.Respond(w, resp)
+		return
+	}
+
+	user := models.GetUser(userId)
+	company := models.GetCompany(companyId, userId)
+
+	if user == nil || company == nil {
+		resp := util.Message(false, http.StatusUnprocessableEntity, "Something wrong has occured. Please try again.", errors)
+		util.Respond(w, resp)
+		return
+	}
+
+	input, ok := decodeRoleInput(w, r)
+	if !ok {
+		return
+	}
+
+	role := &models.Role{Name: input.Name, IsDefault: input.IsDefault}
+	resp := company.CreateRole(user, role, input.Permissions)
+	util.Respond(w, resp)
+}
+
+// Update the name and the permissions of the role
+var UpdateCompanyRole = func(w http.ResponseWriter, r *http.Request) {
+	var errors []string
+	userId := r.Context().Value("user").(uuid.UUID)
+
+	// Get the ID of the company and the role passed in via URL
+	vars := mux.Vars(r)
+	companyId, _ := uuid.FromString(vars["id"])
+	roleId, _ := uuid.FromString(vars["roleId"])
+
+	// Authorization
+	if ok := policy.ManageCompanyRoles(userId, companyId); !ok {
+		resp := util.Message(false, http.StatusForbidden, "You are not authorized to perform the action.", errors)
+		util.Respond(w, resp)
+		return
+	}
+
+	user := models.GetUser(userId)
+	company := models.GetCompany(companyId, userId)
+
+	if user == nil || company == nil {
+		resp := util.Message(false, http.StatusUnprocessableEntity, "Something wrong has occured. Please try again.", errors)
+		util.Respond(w, resp)
+		return
+	}
+
+	input, ok := decodeRoleInput(w, r)
+	if !ok {
+		return
+	}
+
+	role := &models.Role{Name: input.Name, IsDefault: input.IsDefault}
+	resp := company.UpdateRole(user, roleId, role, input.Permissions)
+	util.Respond(w, resp)
+}
+
+// Delete the role of the company
+var DeleteCompanyRole = func(w http.ResponseWriter, r *http.Request) {
+	var errors []string
+	userId := r.Context().Value("user").(uuid.UUID)
+
+	// Get the ID of the company and the role passed in via URL
+	vars := mux.Vars(r)
+	companyId, _ := uuid.FromString(vars["id"])
+	roleId, _ := uuid.FromString(vars["roleId"])
+
+	// Authorization
+	if ok := policy.ManageCompanyRoles(userId, companyId); !ok {
+		resp := util.Message(false, http.StatusForbidden, "You are not authorized to perform the action.", errors)
+		util.Respond(w, resp)
+		return
+	}
+
+	company := models.GetCompany(companyId, userId)
+
+	if company == nil {
+		resp := util.Message(false, http.StatusUnprocessableEntity, "Something wrong has occured. Please try again.", errors)
+		util.Respond(w, resp)
+		return
+	}
+
+	resp := company.DeleteRole(roleId)
+	util.Respond(w, resp)
+}
+
+// Decode and validate the role input, the error is responded if it is invalid
+func decodeRoleInput(w http.ResponseWriter, r *http.Request) (*RoleInput, bool) {
+	var errors []string
+
+	input := &RoleInput{}
+	err := json.NewDecoder(r.Body).Decode(input)
+	if err != nil {
+		errors = append(errors, err.Error())
+		util.Respond(w, util.Message(false, http.StatusInternalServerError, "Error decoding request body", errors))
+		return nil, false
+	}
+
+	// Validate the input
+	validate = validator.New()
+	err = validate.Struct(input)
+	if err != nil {
+		util.GetErrorMessages(&errors, err)
+
+		resp := util.Message(false, http.StatusUnprocessableEntity, "Validation error", errors)
+		util.Respond(w, resp)
+		return nil, false
+	}
+
+	return input, true
+}
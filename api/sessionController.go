@@ -0,0 +1,65 @@
+package api
+
+import (
+	"app/models"
+	util "app/utils"
+	"github.com/gorilla/mux"
+	"github.com/satori/go.uuid"
+	"net/http"
+)
+
+// Get the active sessions of the user
+var IndexSessions = func(w http.ResponseWriter, r *http.Request) {
+	var errors []string
+	userId := r.Context().Value("user").(uuid.UUID)
+	sessionId, _ := r.Context().Value("session").(uuid.UUID)
+
+	user := models.GetUser(userId)
+
+	if user == nil {
+		resp := util.Message(false, http.StatusUnprocessableEntity, "Something wrong has occured. Please try again.", errors)
+		util.Respond(w, resp)
+		return
+	}
+
+	resp := user.GetSessions(sessionId)
+	util.Respond(w, resp)
+}
+
+// Sign out the session of the user
+var RevokeSession = func(w http.ResponseWriter, r *http.Request) {
+	var errors []string
+	userId := r.Context().Value("user").(uuid.UUID)
+
+	user := models.GetUser(userId)
+
+	if user == nil {
+		resp := util.Message(false, http.StatusUnprocessableEntity, "Something wrong has occured. Please try again.", errors)
+		util.Respond(w, resp)
+		return
+	}
+
+	// Get the ID of the session passed in via URL
+	vars := mux.Vars(r)
+	sessionId, _ := uuid.FromString(vars["sessionId"])
+
+	resp := user.RevokeSession(sessionId)
+	util.Respond(w, resp)
+}
+
+// Sign out all the sessions of the user
+var RevokeAllSessions = func(w http.ResponseWriter, r *http.Request) {
+	var errors []string
+	userId := r.Context().Value("user").(uuid.UUID)
+
+	user := models.GetUser(userId)
+
+	if user == nil {
+		resp := util.Message(false, http.StatusUnprocessableEntity, "Something wrong has occured. Please try again.", errors)
+		util.Respond(w, resp)
+		return
+	}
+
+	resp := user.RevokeAllSessions()
+	util.Respond(w, resp)
+}
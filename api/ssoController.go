@@ -0,0 +1,188 @@
+package api
+
+import (
+	"app/mailer"
+	"app/models"
+	"app/policy"
+	"app/saml"
+	util "app/utils"
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"github.com/satori/go.uuid"
+	"gopkg.in/go-playground/validator.v9"
+	"net/http"
+	"net/url"
+)
+
+type CompanySSOInput struct {
+	Enabled     bool   `json:"enabled"`
+	Metadata    string `json:"metadata"` // Metadata XML of the IdP, overrides the IdP settings below
+	IdPEntityID string `json:"idpEntityId"`
+	SSOURL      string `json:"ssoUrl"`
+	Certificate string `json:"certificate"`
+	EmailDomain string `json:"emailDomain"`
+	Enforced    bool   `json:"enforced"`
+}
+
+type SSOTokenInput struct {
+	Code string `json:"code" validate:"required"`
+}
+
+// Get the single sign-on settings of the company
+var ShowCompanySSO = func(w http.ResponseWriter, r *http.Request) {
+	var errors []string
+	userId := r.Context().Value("user").(uuid.UUID)
+
+	// Get the ID of the company passed in via URL
+	vars := mux.Vars(r)
+	companyId, _ := uuid.FromString(vars["id"])
+
+	// Authorization
+	if ok := policy.ManageCompanySSO(userId, companyId); !ok {
+		resp := util.Message(false, http.StatusForbidden, "You are not authorized to perform the action.", errors)
+		util.Respond(w, resp)
+		return
+	}
+
+	company := models.GetCompany(companyId, userId)
+
+	if company == nil {
+		resp := util.Message(false, http.StatusUnprocessableEntity, "Something wrong has occured. Please try again.", errors)
+		util.Respond(w, resp)
+		return
+	}
+
+	resp := company.GetSSO()
+	util.Respond(w, resp)
+}
+
+// Update the single sign-on settings of the company
+var UpdateCompanySSO = func(w http.ResponseWriter, r *http.Request) {
+	var errors []string
+	userId := r.Context().Value("user").(uuid.UUID)
+
+	// Get the ID of the company passed in via URL
+	vars := mux.Vars(r)
+	companyId, _ := uuid.FromString(vars["id"])
+
+	// Authorization
+	if ok := policy.ManageCompanySSO(userId, companyId); !ok {
+		resp := util.Message(false, http.StatusForbidden, "You are not authorized to perform the action.", errors)
+		util.Respond(w, resp)
+		return
+	}
+
+	company := models.GetCompany(companyId, userId)
+
+	if company == nil {
+		resp := util.Message(false, http.StatusUnprocessableEntity, "Something wrong has occured. Please try again.", errors)
+		util.Respond(w, resp)
+		return
+	}
+
+	input := CompanySSOInput{}
+	err := json.NewDecoder(r.Body).Decode(&input)
+	if err != nil {
+		errors = append(errors, err.Error())
+		util.Respond(w, util.Message(false, http.StatusInternalServerError, "Error decoding request body", errors))
+		return
+	}
+
+	sso := &models.CompanySSO{
+		Enabled:     input.Enabled,
+		IdPEntityID: input.IdPEntityID,
+		SSOURL:      input.SSOURL,
+		Certificate: input.Certificate,
+		EmailDomain: input.EmailDomain,
+		Enforced:    input.Enforced,
+	}
+
+	resp := company.UpdateSSO(sso, input.Metadata)
+	util.Respond(w, resp)
+}
+
+// Get the metadata of the app to be imported into the IdP
+var SSOMetadata = func(w http.ResponseWriter, r *http.Request) {
+	var errors []string
+
+	metadata, err := saml.Metadata()
+	if err != nil {
+		resp := util.Message(false, http.StatusInternalServerError, "Failed to generate the metadata.", errors)
+		util.Respond(w, resp)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/samlmetadata+xml")
+	w.Write(metadata)
+}
+
+// Get the URL of the IdP of the company to start the single sign-on
+var SSOLogin = func(w http.ResponseWriter, r *http.Request) {
+	// Get the slug of the company passed in via URL
+	vars := mux.Vars(r)
+
+	resp := models.StartSSOLogin(vars["slug"])
+	util.Respond(w, resp)
+}
+
+// Receive the response posted by the IdP and redirect the user back to the frontend to complete the login
+var SSOAssertionConsumer = func(w http.ResponseWriter, r *http.Request) {
+	query := url.Values{}
+
+	// Check if the client has too many failed attempts
+	ip := util.GetClientIP(r)
+	if !allowAttempt(w, ip) {
+		return
+	}
+
+	if err := r.ParseForm(); err != nil || r.PostForm.Get("SAMLResponse") == "" {
+		query.Set("error", "The response from the identity provider is invalid.")
+		http.Redirect(w, r, mailer.Link("/sso/callback?"+query.Encode()), http.StatusSeeOther)
+		return
+	}
+
+	resp := models.CompleteSSOLogin(r.PostForm.Get("SAMLResponse"), r.PostForm.Get("RelayState"))
+	recordAttempt(ip, resp)
+
+	if success, _ := resp["success"].(bool); success {
+		query.Set("code", resp["code"].(string))
+	} else {
+		query.Set("error", resp["message"].(string))
+	}
+
+	http.Redirect(w, r, mailer.Link("/sso/callback?"+query.Encode()), http.StatusSeeOther)
+}
+
+// Exchange the one-time code from the single sign-on for the login tokens
+var SSOToken = func(w http.ResponseWriter, r *http.Request) {
+	var errors []string
+
+	input := SSOTokenInput{}
+	err := json.NewDecoder(r.Body).Decode(&input)
+	if err != nil {
+		errors = append(errors, err.Error())
+		util.Respond(w, util.Message(false, http.StatusInternalServerError, "Error decoding request body", errors))
+		return
+	}
+
+	// Validate the input
+	validate = validator.New()
+	err = validate.Struct(input)
+	if err != nil {
+		util.GetErrorMessages(&errors, err)
+
+		resp := util.Message(false, http.StatusUnprocessableEntity, "Validation error", errors)
+		util.Respond(w, resp)
+		return
+	}
+
+	// Check if the client has too many failed attempts
+	ip := util.GetClientIP(r)
+	if !allowAttempt(w, ip) {
+		return
+	}
+
+	resp := models.RedeemSSOLogin(input.Code, getClient(r))
+	recordAttempt(ip, resp)
+	util.Respond(w, resp)
+}
@@ -0,0 +1,262 @@
+package api
+
+import (
+	"app/models"
+	"app/policy"
+	util "app/utils"
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"github.com/satori/go.uuid"
+	"gopkg.in/go-playground/validator.v9"
+	"net/http"
+)
+
+type TeamInput struct {
+	Name string `json:"name" validate:"required,max=50"`
+}
+
+type TeamUserInput struct {
+	UserID uuid.UUID `json:"userId" validate:"required"`
+}
+
+// Get the teams of the company
+var IndexCompanyTeams = func(w http.ResponseWriter, r *http.Request) {
+	var errors []string
+	userId := r.Context().Value("user").(uuid.UUID)
+
+	// Get the ID of the company passed in via URL
+	vars := mux.Vars(r)
+	companyId, _ := uuid.FromString(vars["id"])
+
+	// Authorization
+	if ok := policy.ViewCompanyTeams(userId, companyId); !ok {
+		resp := util.Message(false, http.StatusForbidden, "You are not authorized to perform the action.", errors)
+		util.Respond(w, resp)
+		return
+	}
+
+	company := models.GetCompany(companyId, userId)
+
+	if company == nil {
+		resp := util.Message(false, http.StatusUnprocessableEntity, "Something wrong has occured. Please try again.", errors)
+		util.Respond(w, resp)
+		return
+	}
+
+	resp := company.GetTeams()
+	util.Respond(w, resp)
+}
+
+// Get the team of the company with its members
+var ShowCompanyTeam = func(w http.ResponseWriter, r *http.Request) {
+	var errors []string
+	userId := r.Context().Value("user").(uuid.UUID)
+
+	// Get the ID of the company and the team passed in via URL
+	vars := mux.Vars(r)
+	companyId, _ := uuid.FromString(vars["id"])
+	teamId, _ := uuid.FromString(vars["teamId"])
+
+	// Authorization
+	if ok := policy.ViewCompanyTeams(userId, companyId); !ok {
+		resp := util.Message(false, http.StatusForbidden, "You are not authorized to perform the action.", errors)
+		util.Respond(w, resp)
+		return
+	}
+
+	company := models.GetCompany(companyId, userId)
+
+	if company == nil {
+		resp := util.Message(false, http.StatusUnprocessableEntity, "Something wrong has occured. Please try again.", errors)
+		util.Respond(w, resp)
+		return
+	}
+
+	resp := company.GetTeam(teamId)
+	util.Respond(w, resp)
+}
+
+// Create the team of the company
+var CreateCompanyTeam = func(w http.ResponseWriter, r *http.Request) {
+	var errors []string
+	userId := r.Context().Value("user").(uuid.UUID)
+
+	// Get the ID of the company passed in via URL
+	vars := mux.Vars(r)
+	companyId, _ := uuid.FromString(vars["id"])
+
+	// Authorization
+	if ok := policy.ManageCompanyTeams(userId, companyId); !ok {
+		resp := util.Message(false, http.StatusForbidden, "You are not authorized to perform the action.", errors)
+		util.Respond(w, resp)
+		return
+	}
+
+	company := models.GetCompany(companyId, userId)
+
+	if company == nil {
+		resp := util.Message(false, http.StatusUnprocessableEntity, "Something wrong has occured. Please try again.", errors)
+		util.Respond(w, resp)
+		return
+	}
+
+	input := TeamInput{}
+	if !decodeInput(w, r, &input) {
+		return
+	}
+
+	resp := company.CreateTeam(input.Name)
+	util.Respond(w, resp)
+}
+
+// Rename the team of the company
+var UpdateCompanyTeam = func(w http.ResponseWriter, r *http.Request) {
+	var errors []string
+	userId := r.Context().Value("user").(uuid.UUID)
+
+	// Get the ID of the company and the team passed in via URL
+	vars := mux.Vars(r)
+	companyId, _ := uuid.FromString(vars["id"])
+	teamId, _ := uuid.FromString(vars["teamId"])
+
+	// Authorization
+	if ok := policy.ManageCompanyTeams(userId, companyId); !ok {
+		resp := util.Message(false, http.StatusForbidden, "You are not authorized to perform the action.", errors)
+		util.Respond(w, resp)
+		return
+	}
+
+	company := models.GetCompany(companyId, userId)
+
+	if company == nil {
+		resp := util.Message(false, http.StatusUnprocessableEntity, "Something wrong has occured. Please try again.", errors)
+		util.Respond(w, resp)
+		return
+	}
+
+	input := TeamInput{}
+	if !decodeInput(w, r, &input) {
+		return
+	}
+
+	resp := company.UpdateTeam(teamId, input.Name)
+	util.Respond(w, resp)
+}
+
+// Delete the team of the company
+var DeleteCompanyTeam = func(w http.ResponseWriter, r *http.Request) {
+	var errors []string
+	userId := r.Context().Value("user").(uuid.UUID)
+
+	// Get the ID of the company and the team passed in via URL
+	vars := mux.Vars(r)
+	companyId, _ := uuid.FromString(vars["id"])
+	teamId, _ := uuid.FromString(vars["teamId"])
+
+	// Authorization
+	if ok := policy.ManageCompanyTeams(userId, companyId); !ok {
+		resp := util.Message(false, http.StatusForbidden, "You are not authorized to perform the action.", errors)
+		util.Respond(w, resp)
+		return
+	}
+
+	company := models.GetCompany(companyId, userId)
+
+	if company == nil {
+		resp := util.Message(false, http.StatusUnprocessableEntity, "Something wrong has occured. Please try again.", errors)
+		util.Respond(w, resp)
+		return
+	}
+
+	resp := company.DeleteTeam(teamId)
+	util.Respond(w, resp)
+}
+
+// Add the member of the company to the team
+var AddCompanyTeamUser = func(w http.ResponseWriter, r *http.Request) {
+	var errors []string
+	userId := r.Context().Value("user").(uuid.UUID)
+
+	// Get the ID of the company and the team passed in via URL
+	vars := mux.Vars(r)
+	companyId, _ := uuid.FromString(vars["id"])
+	teamId, _ := uuid.FromString(vars["teamId"])
+
+	// Authorization
+	if ok := policy.ManageCompanyTeams(userId, companyId); !ok {
+		resp := util.Message(false, http.StatusForbidden, "You are not authorized to perform the action.", errors)
+		util.Respond(w, resp)
+		return
+	}
+
+	company := models.GetCompany(companyId, userId)
+
+	if company == nil {
+		resp := util.Message(false, http.StatusUnprocessableEntity, "Something wrong has occured. Please try again.", errors)
+		util.Respond(w, resp)
+		return
+	}
+
+	input := TeamUserInput{}
+	if !decodeInput(w, r, &input) {
+		return
+	}
+
+	resp := company.AddTeamMember(teamId, input.UserID)
+	util.Respond(w, resp)
+}
+
+// Remove the member from the team
+var RemoveCompanyTeamUser = func(w http.ResponseWriter, r *http.Request) {
+	var errors []string
+	userId := r.Context().Value("user").(uuid.UUID)
+
+	// Get the ID of the company, the team and the user passed in via URL
+	vars := mux.Vars(r)
+	companyId, _ := uuid.FromString(vars["id"])
+	teamId, _ := uuid.FromString(vars["teamId"])
+	targetUserId, _ := uuid.FromString(vars["userId"])
+
+	// Authorization
+	if ok := policy.ManageCompanyTeams(userId, companyId); !ok {
+		resp := util.Message(false, http.StatusForbidden, "You are not authorized to perform the action.", errors)
+		util.Respond(w, resp)
+		return
+	}
+
+	company := models.GetCompany(companyId, userId)
+
+	if company == nil {
+		resp := util.Message(false, http.StatusUnprocessableEntity, "Something wrong has occured. Please try again.", errors)
+		util.Respond(w, resp)
+		return
+	}
+
+	resp := company.RemoveTeamMember(teamId, targetUserId)
+	util.Respond(w, resp)
+}
+
+// Decode and validate the request body into the input, respond with the error if invalid
+func decodeInput(w http.ResponseWriter, r *http.Request, input interface{}) bool {
+	var errors []string
+
+	err := json.NewDecoder(r.Body).Decode(input)
+	if err != nil {
+		errors = append(errors, err.Error())
+		util.Respond(w, util.Message(false, http.StatusInternalServerError, "Error decoding request body", errors))
+		return false
+	}
+
+	// Validate the input
+	validate = validator.New()
+	err = validate.Struct(input)
+	if err != nil {
+		util.GetErrorMessages(&errors, err)
+
+		resp := util.Message(false, http.StatusUnprocessableEntity, "Validation error", errors)
+		util.Respond(w, resp)
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,16 @@
+package main
+
+import (
+	"app/models"
+	"log"
+)
+
+// Rotate the key that signs the login tokens, the previous key still verifies the tokens until they expire
+func main() {
+	key, err := models.RotateSigningKey()
+	if err != nil {
+		log.Fatal("Failed to rotate the signing key: ", err)
+	}
+
+	log.Println("The signing key has been rotated, the new key ID is", key.ID)
+}
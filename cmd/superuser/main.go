@@ -0,0 +1,29 @@
+package main
+
+import (
+	"app/models"
+	"flag"
+	"log"
+)
+
+// Grant or revoke the superuser flag of the user, ie. for the support team to impersonate the users
+func main() {
+	email := flag.String("email", "", "Email address of the user")
+	revoke := flag.Bool("revoke", false, "Revoke the superuser flag instead of granting it")
+	flag.Parse()
+
+	if *email == "" {
+		log.Fatal("The email address is required, ie. -email support@example.com")
+	}
+
+	user, err := models.SetSuperuser(*email, !*revoke)
+	if err != nil {
+		log.Fatal("Failed to update the superuser flag: ", err)
+	}
+
+	if *revoke {
+		log.Println("The superuser flag has been revoked from", user.Email)
+	} else {
+		log.Println("The superuser flag has been granted to", user.Email)
+	}
+}
@@ -0,0 +1,122 @@
+package mailer
+
+import (
+	"time"
+)
+
+// Build the activation email for the newly signed up user
+func NewActivationEmail(name, email, code string) (*Message, error) {
+	return Render(ActivationTemplate, email, map[string]interface{}{
+		"Name": name,
+		"Link": Link("/activateaccount/" + code),
+	})
+}
+
+// Build the reset password email for the user
+func NewResetPasswordEmail(name, email, code string) (*Message, error) {
+	return Render(ResetPasswordTemplate, email, map[string]interface{}{
+		"Name": name,
+		"Link": Link("/resetpassword/" + code),
+	})
+}
+
+// Build the company invitation email for the invited email
+func NewInvitationEmail(email, companyName, senderName, senderEmail, message, token string, expiresAt time.Time) (*Message, error) {
+	return Render(InvitationTemplate, email, map[string]interface{}{
+		"CompanyName": companyName,
+		"SenderName":  senderName,
+		"SenderEmail": senderEmail,
+		"Message":     message,
+		"ExpiresAt":   expiresAt.Format(time.RFC1123),
+		"Link":        Link("/invitation/" + token),
+	})
+}
+
+// Build the reminder of the invitation that is about to expire
+func NewInvitationReminderEmail(email, companyName, token string, expiresAt time.Time) (*Message, error) {
+	return Render(InvitationReminderTemplate, email, map[string]interface{}{
+		"CompanyName": companyName,
+		"ExpiresAt":   expiresAt.Format(time.RFC1123),
+		"Link":        Link("/invitation/" + token),
+	})
+}
+
+// Build the notification of the account being locked after too many failed logins
+func NewAccountLockedEmail(name, email string, lockedUntil time.Time) (*Message, error) {
+	return Render(AccountLockedTemplate, email, map[string]interface{}{
+		"Name":        name,
+		"LockedUntil": lockedUntil.Format(time.RFC1123),
+		"Link":        Link("/forgetpassword"),
+	})
+}
+
+// Build the one-time login link email for the user
+func NewMagicLoginEmail(name, email, token string) (*Message, error) {
+	return Render(MagicLoginTemplate, email, map[string]interface{}{
+		"Name": name,
+		"Link": Link("/login/magic/" + token),
+	})
+}
+
+// Build the confirmation email sent to the new email address of the user
+func NewEmailChangeEmail(name, newEmail, token string) (*Message, error) {
+	return Render(EmailChangeTemplate, newEmail, map[string]interface{}{
+		"Name": name,
+		"Link": Link("/confirmemail/" + token),
+	})
+}
+
+// Build the notice sent to the current email address of the user when the email change is requested
+func NewEmailChangedEmail(name, email, newEmail string) (*Message, error) {
+	return Render(EmailChangedTemplate, email, map[string]interface{}{
+		"Name":     name,
+		"NewEmail": newEmail,
+		"Link":     Link("/forgetpassword"),
+	})
+}
+
+// Build the notification of the password being changed or reset
+func NewPasswordChangedEmail(name, email string, reset bool, changedAt time.Time, ip string) (*Message, error) {
+	action := "changed"
+	if reset {
+		action = "reset"
+	}
+
+	return Render(PasswordChangedTemplate, email, map[string]interface{}{
+		"Name":      name,
+		"Action":    action,
+		"ChangedAt": changedAt.Format(time.RFC1123),
+		"IP":        ip,
+		"Link":      Link("/forgetpassword"),
+	})
+}
+
+// Build the notice of the account being scheduled for deletion
+func NewAccountDeletionEmail(name, email string, deleteAt time.Time) (*Message, error) {
+	return Render(AccountDeletionTemplate, email, map[string]interface{}{
+		"Name":     name,
+		"DeleteAt": deleteAt.Format(time.RFC1123),
+		"Link":     Link("/profile"),
+	})
+}
+
+// Build the nomination of the member as the new owner of the company
+func NewOwnershipTransferEmail(name, email, ownerName, companyName, companyId string, expiresAt time.Time) (*Message, error) {
+	return Render(OwnershipTransferTemplate, email, map[string]interface{}{
+		"Name":        name,
+		"OwnerName":   ownerName,
+		"CompanyName": companyName,
+		"ExpiresAt":   expiresAt.Format(time.RFC1123),
+		"Link":        Link("/company/" + companyId + "/ownership"),
+	})
+}
+
+// Build the notice to the owner of the nominated member accepting or declining the ownership
+func NewOwnershipTransferredEmail(name, email, nomineeName, action, companyName string) (*Message, error) {
+	return Render(OwnershipTransferredTemplate, email, map[string]interface{}{
+		"Name":        name,
+		"NomineeName": nomineeName,
+		"Action":      action,
+		"CompanyName": companyName,
+	})
+}
@@ -0,0 +1,136 @@
+package mailer
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"net/textproto"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Email to be delivered by the transport
+type Message struct {
+	To      []string
+	Subject string
+	Text    string
+	HTML    string
+}
+
+// Transport delivers the composed email, ie. SMTP server, file or memory
+type Transport interface {
+	Send(from string, to []string, body []byte) error
+}
+
+var transport Transport
+var transportOnce sync.Once
+var transportMutex sync.RWMutex
+
+// Replace the transport, mainly used for tests and local development
+func SetTransport(t Transport) {
+	transportOnce.Do(func() {})
+	transportMutex.Lock()
+	transport = t
+	transportMutex.Unlock()
+}
+
+// Get the transport configured in the environment
+func getTransport() Transport {
+	transportOnce.Do(func() {
+		transportMutex.Lock()
+		defer transportMutex.Unlock()
+
+		switch os.Getenv("mail_transport") {
+		case "smtp":
+			transport = NewSMTPTransport(os.Getenv("smtp_host"), os.Getenv("smtp_port"), os.Getenv("smtp_user"), os.Getenv("smtp_pass"))
+		case "memory":
+			transport = NewMemoryTransport()
+		default:
+			dir := os.Getenv("mail_dir")
+			if dir == "" {
+				dir = "mails"
+			}
+			transport = NewFileTransport(dir)
+		}
+	})
+
+	transportMutex.RLock()
+	defer transportMutex.RUnlock()
+
+	return transport
+}
+
+// Get the sender address of the emails
+func sender() string {
+	from := os.Getenv("mail_from")
+	if from == "" {
+		from = "no-reply@localhost"
+	}
+
+	return from
+}
+
+// Send the email with the configured transport
+func Send(msg *Message) error {
+	if len(msg.To) == 0 {
+		return errors.New("The email has no recipient.")
+	}
+
+	from := sender()
+	body, err := msg.Bytes(from)
+	if err != nil {
+		return err
+	}
+
+	return getTransport().Send(from, msg.To, body)
+}
+
+// Compose the email as multipart/alternative with both text and HTML parts
+func (msg *Message) Bytes(from string) ([]byte, error) {
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+
+	headers := []string{
+		"From: " + from,
+		"To: " + strings.Join(msg.To, ", "),
+		"Subject: " + mime.QEncoding.Encode("UTF-8", msg.Subject),
+		"Date: " + time.Now().Format(time.RFC1123Z),
+		"MIME-Version: 1.0",
+		fmt.Sprintf("Content-Type: multipart/alternative; boundary=%q", writer.Boundary()),
+	}
+	buf.WriteString(strings.Join(headers, "\r\n") + "\r\n\r\n")
+
+	parts := []struct {
+		contentType string
+		content     string
+	}{
+		{"text/plain; charset=UTF-8", msg.Text},
+		{"text/html; charset=UTF-8", msg.HTML},
+	}
+
+	for _, part := range parts {
+		if part.content == "" {
+			continue
+		}
+
+		header := textproto.MIMEHeader{}
+		header.Set("Content-Type", part.contentType)
+		w, err := writer.CreatePart(header)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := w.Write([]byte(part.content)); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,134 @@
+package mailer
+
+import (
+	"bytes"
+	"mime"
+	"net/mail"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSendTemplates(t *testing.T) {
+	os.Setenv("app_name", "Äpp")
+	os.Setenv("frontend_url", "https://app.test/")
+	os.Setenv("mail_from", "no-reply@app.test")
+
+	memory := NewMemoryTransport()
+	SetTransport(memory)
+
+	expiresAt := time.Now().Add(time.Hour)
+
+	tests := []struct {
+		name  string
+		build func() (*Message, error)
+		to    string
+		link  string // The link expected in the email, none if empty
+	}{
+		{ActivationTemplate, func() (*Message, error) {
+			return NewActivationEmail("Zoë", "zoe@example.com", "code")
+		}, "zoe@example.com", "https://app.test/activateaccount/code"},
+		{ResetPasswordTemplate, func() (*Message, error) {
+			return NewResetPasswordEmail("Zoë", "zoe@example.com", "code")
+		}, "zoe@example.com", "https://app.test/resetpassword/code"},
+		{InvitationTemplate, func() (*Message, error) {
+			return NewInvitationEmail("new@example.com", "Café Ltd", "Zoë", "zoe@example.com", "Welcome", "token", expiresAt)
+		}, "new@example.com", "https://app.test/invitation/token"},
+		{InvitationReminderTemplate, func() (*Message, error) {
+			return NewInvitationReminderEmail("new@example.com", "Café Ltd", "token", expiresAt)
+		}, "new@example.com", "https://app.test/invitation/token"},
+		{AccountLockedTemplate, func() (*Message, error) {
+			return NewAccountLockedEmail("Zoë", "zoe@example.com", expiresAt)
+		}, "zoe@example.com", "https://app.test/forgetpassword"},
+		{MagicLoginTemplate, func() (*Message, error) {
+			return NewMagicLoginEmail("Zoë", "zoe@example.com", "token")
+		}, "zoe@example.com", "https://app.test/login/magic/token"},
+		{EmailChangeTemplate, func() (*Message, error) {
+			return NewEmailChangeEmail("Zoë", "new@example.com", "token")
+		}, "new@example.com", "https://app.test/confirmemail/token"},
+		{EmailChangedTemplate, func() (*Message, error) {
+			return NewEmailChangedEmail("Zoë", "zoe@example.com", "new@example.com")
+		}, "zoe@example.com", "https://app.test/forgetpassword"},
+		{PasswordChangedTemplate, func() (*Message, error) {
+			return NewPasswordChangedEmail("Zoë", "zoe@example.com", true, expiresAt, "127.0.0.1")
+		}, "zoe@example.com", "https://app.test/forgetpassword"},
+		{AccountDeletionTemplate, func() (*Message, error) {
+			return NewAccountDeletionEmail("Zoë", "zoe@example.com", expiresAt)
+		}, "zoe@example.com", "https://app.test/profile"},
+		{OwnershipTransferTemplate, func() (*Message, error) {
+			return NewOwnershipTransferEmail("Zoë", "zoe@example.com", "Owner", "Café Ltd", "company-id", expiresAt)
+		}, "zoe@example.com", "https://app.test/company/company-id/ownership"},
+		{OwnershipTransferredTemplate, func() (*Message, error) {
+			return NewOwnershipTransferredEmail("Owner", "owner@example.com", "Zoë", "accepted", "Café Ltd")
+		}, "owner@example.com", ""},
+	}
+
+	if len(tests) != len(emailTemplates) {
+		t.Errorf("%d template(s) tested, want all the %d templates", len(tests), len(emailTemplates))
+	}
+
+	for _, test := range tests {
+		msg, err := test.build()
+		if err != nil {
+			t.Errorf("%s: failed to render the email: %v", test.name, err)
+			continue
+		}
+
+		before := len(memory.Messages())
+		if err := Send(msg); err != nil {
+			t.Errorf("%s: Send() returned the error: %v", test.name, err)
+			continue
+		}
+
+		messages := memory.Messages()
+		if len(messages) != before+1 {
+			t.Errorf("%s: %d email(s) sent, want 1", test.name, len(messages)-before)
+			continue
+		}
+
+		sent := messages[len(messages)-1]
+		if len(sent.To) != 1 || sent.To[0] != test.to || sent.From != "no-reply@app.test" {
+			t.Errorf("%s: sent from %q to %v, want from %q to %q", test.name, sent.From, sent.To, "no-reply@app.test", test.to)
+		}
+
+		parsed, err := mail.ReadMessage(bytes.NewReader(sent.Body))
+		if err != nil {
+			t.Errorf("%s: failed to parse the email: %v", test.name, err)
+			continue
+		}
+
+		if got := parsed.Header.Get("To"); got != test.to {
+			t.Errorf("%s: To header = %q, want %q", test.name, got, test.to)
+		}
+
+		// The subjects with the non-ASCII characters are Q-encoded
+		subject := parsed.Header.Get("Subject")
+		if !strings.HasPrefix(subject, "=?UTF-8?q?") {
+			t.Errorf("%s: Subject header = %q, want it Q-encoded", test.name, subject)
+		}
+
+		decoded, err := new(mime.WordDecoder).DecodeHeader(subject)
+		if err != nil || decoded != msg.Subject {
+			t.Errorf("%s: decoded subject = %q (%v), want %q", test.name, decoded, err, msg.Subject)
+		}
+
+		if test.link != "" && !bytes.Contains(sent.Body, []byte(test.link)) {
+			t.Errorf("%s: the email does not contain the link %s", test.name, test.link)
+		}
+	}
+}
+
+func TestRenderUnknownTemplate(t *testing.T) {
+	if _, err := Render("unknown", "zoe@example.com", nil); err == nil {
+		t.Error("Render() of the unknown template returned no error")
+	}
+}
+
+func TestSendWithoutRecipient(t *testing.T) {
+	SetTransport(NewMemoryTransport())
+
+	if err := Send(&Message{Subject: "Subject", Text: "Text"}); err == nil {
+		t.Error("Send() without the recipient returned no error")
+	}
+}
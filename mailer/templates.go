@@ -0,0 +1,270 @@
+package mailer
+
+import (
+	"bytes"
+	"errors"
+	htmltemplate "html/template"
+	"os"
+	"strings"
+	texttemplate "text/template"
+)
+
+// Name of the email templates
+const (
+	ActivationTemplate           = "activation"
+	ResetPasswordTemplate        = "reset_password"
+	InvitationTemplate           = "invitation"
+	InvitationReminderTemplate   = "invitation_reminder"
+	AccountLockedTemplate        = "account_locked"
+	MagicLoginTemplate           = "magic_login"
+	EmailChangeTemplate          = "email_change"
+	EmailChangedTemplate         = "email_changed"
+	PasswordChangedTemplate      = "password_changed"
+	AccountDeletionTemplate      = "account_deletion"
+	OwnershipTransferTemplate    = "ownership_transfer"
+	OwnershipTransferredTemplate = "ownership_transferred"
+)
+
+type emailTemplate struct {
+	Subject string
+	Text    string
+	HTML    string
+}
+
+const layoutHTML = `<!DOCTYPE html>
+<html>
+<body style="font-family: Arial, sans-serif; color: #333333;">
+	{{template "content" .}}
+	<p style="color: #999999; font-size: 12px;">This email was sent by {{.AppName}}. If you did not expect it, you can safely ignore it.</p>
+</body>
+</html>`
+
+var emailTemplates = map[string]emailTemplate{
+	ActivationTemplate: {
+		Subject: "Activate your {{.AppName}} account",
+		Text: `Hi {{.Name}},
+
+Thank you for signing up. Please activate your account by visiting the link below:
+
+{{.Link}}
+`,
+		HTML: `<p>Hi {{.Name}},</p>
+<p>Thank you for signing up. Please activate your account by clicking the link below:</p>
+<p><a href="{{.Link}}">Activate account</a></p>`,
+	},
+	ResetPasswordTemplate: {
+		Subject: "Reset your {{.AppName}} password",
+		Text: `Hi {{.Name}},
+
+We received a request to reset your password. The link below is valid for one hour:
+
+{{.Link}}
+
+If you did not request a password reset, you can ignore this email.
+`,
+		HTML: `<p>Hi {{.Name}},</p>
+<p>We received a request to reset your password. The link below is valid for one hour:</p>
+<p><a href="{{.Link}}">Reset password</a></p>
+<p>If you did not request a password reset, you can ignore this email.</p>`,
+	},
+	InvitationTemplate: {
+		Subject: "{{.SenderName}} invited you to join {{.CompanyName}}",
+		Text: `Hi,
+
+{{.SenderName}} ({{.SenderEmail}}) has invited you to join {{.CompanyName}} on {{.AppName}}.
+{{if .Message}}
+"{{.Message}}"
+{{end}}
+View the invitation before it expires on {{.ExpiresAt}}:
+
+{{.Link}}
+`,
+		HTML: `<p>Hi,</p>
+<p>{{.SenderName}} ({{.SenderEmail}}) has invited you to join <strong>{{.CompanyName}}</strong> on {{.AppName}}.</p>
+{{if .Message}}<blockquote>{{.Message}}</blockquote>{{end}}
+<p><a href="{{.Link}}">View invitation</a></p>
+<p>The invitation expires on {{.ExpiresAt}}.</p>`,
+	},
+	InvitationReminderTemplate: {
+		Subject: "Your invitation to join {{.CompanyName}} expires soon",
+		Text: `Hi,
+
+You have been invited to join {{.CompanyName}} on {{.AppName}}, and the invitation expires on {{.ExpiresAt}}.
+
+View the invitation at:
+
+{{.Link}}
+`,
+		HTML: `<p>Hi,</p>
+<p>You have been invited to join <strong>{{.CompanyName}}</strong> on {{.AppName}}, and the invitation expires on {{.ExpiresAt}}.</p>
+<p><a href="{{.Link}}">View invitation</a></p>`,
+	},
+	AccountLockedTemplate: {
+		Subject: "Your {{.AppName}} account has been temporarily locked",
+		Text: `Hi {{.Name}},
+
+We detected too many failed login attempts on your account, so it has been locked until {{.LockedUntil}}.
+
+If this was not you, we recommend resetting your password at:
+
+{{.Link}}
+`,
+		HTML: `<p>Hi {{.Name}},</p>
+<p>We detected too many failed login attempts on your account, so it has been locked until {{.LockedUntil}}.</p>
+<p>If this was not you, we recommend <a href="{{.Link}}">resetting your password</a>.</p>`,
+	},
+	MagicLoginTemplate: {
+		Subject: "Your {{.AppName}} login link",
+		Text: `Hi {{.Name}},
+
+Use the link below to log in. The link is valid for 15 minutes and can only be used once:
+
+{{.Link}}
+
+If you did not request to log in, you can ignore this email.
+`,
+		HTML: `<p>Hi {{.Name}},</p>
+<p>Use the link below to log in. The link is valid for 15 minutes and can only be used once:</p>
+<p><a href="{{.Link}}">Log in</a></p>
+<p>If you did not request to log in, you can ignore this email.</p>`,
+	},
+	EmailChangeTemplate: {
+		Subject: "Confirm your new {{.AppName}} email address",
+		Text: `Hi {{.Name}},
+
+Please confirm that you want to use this email address for your {{.AppName}} account by visiting the link below:
+
+{{.Link}}
+
+If you did not request to change your email address, you can ignore this email.
+`,
+		HTML: `<p>Hi {{.Name}},</p>
+<p>Please confirm that you want to use this email address for your {{.AppName}} account.</p>
+<p><a href="{{.Link}}">Confirm email address</a></p>
+<p>If you did not request to change your email address, you can ignore this email.</p>`,
+	},
+	EmailChangedTemplate: {
+		Subject: "Your {{.AppName}} email address is being changed",
+		Text: `Hi {{.Name}},
+
+A request has been made to change the email address of your account to {{.NewEmail}}. The change takes effect once the new address is confirmed.
+
+If this was not you, we recommend resetting your password at:
+
+{{.Link}}
+`,
+		HTML: `<p>Hi {{.Name}},</p>
+<p>A request has been made to change the email address of your account to <strong>{{.NewEmail}}</strong>. The change takes effect once the new address is confirmed.</p>
+<p>If this was not you, we recommend <a href="{{.Link}}">resetting your password</a>.</p>`,
+	},
+	PasswordChangedTemplate: {
+		Subject: "Your {{.AppName}} password has been changed",
+		Text: `Hi {{.Name}},
+
+The password of your account was {{.Action}} on {{.ChangedAt}}{{if .IP}} from {{.IP}}{{end}}.
+
+If this was not you, please reset your password immediately at:
+
+{{.Link}}
+`,
+		HTML: `<p>Hi {{.Name}},</p>
+<p>The password of your account was {{.Action}} on {{.ChangedAt}}{{if .IP}} from {{.IP}}{{end}}.</p>
+<p>If this was not you, please <a href="{{.Link}}">reset your password</a> immediately.</p>`,
+	},
+	AccountDeletionTemplate: {
+		Subject: "Your {{.AppName}} account will be deleted",
+		Text: `Hi {{.Name}},
+
+As requested, your account and your personal data will be deleted on {{.DeleteAt}}.
+
+If you change your mind, log in and cancel the deletion from your profile before then:
+
+{{.Link}}
+`,
+		HTML: `<p>Hi {{.Name}},</p>
+<p>As requested, your account and your personal data will be deleted on {{.DeleteAt}}.</p>
+<p>If you change your mind, log in and <a href="{{.Link}}">cancel the deletion from your profile</a> before then.</p>`,
+	},
+	OwnershipTransferTemplate: {
+		Subject: "{{.OwnerName}} wants to make you the owner of {{.CompanyName}}",
+		Text: `Hi {{.Name}},
+
+{{.OwnerName}} has nominated you as the new owner of {{.CompanyName}} on {{.AppName}}. As the owner, you will be able to delete the company and hand it over to someone else.
+
+Please accept or decline the ownership before {{.ExpiresAt}}:
+
+{{.Link}}
+`,
+		HTML: `<p>Hi {{.Name}},</p>
+<p>{{.OwnerName}} has nominated you as the new owner of {{.CompanyName}} on {{.AppName}}. As the owner, you will be able to delete the company and hand it over to someone else.</p>
+<p>Please <a href="{{.Link}}">accept or decline the ownership</a> before {{.ExpiresAt}}.</p>`,
+	},
+	OwnershipTransferredTemplate: {
+		Subject: "{{.NomineeName}} has {{.Action}} the ownership of {{.CompanyName}}",
+		Text: `Hi {{.Name}},
+
+{{.NomineeName}} has {{.Action}} the ownership of {{.CompanyName}} that you nominated them for.
+`,
+		HTML: `<p>Hi {{.Name}},</p>
+<p>{{.NomineeName}} has {{.Action}} the ownership of {{.CompanyName}} that you nominated them for.</p>`,
+	},
+}
+
+// Build the link to the frontend
+func Link(path string) string {
+	baseURL := os.Getenv("frontend_url")
+	if baseURL == "" {
+		baseURL = "http://localhost:3000"
+	}
+
+	return strings.TrimRight(baseURL, "/") + "/" + strings.TrimLeft(path, "/")
+}
+
+// Render the email template with the data
+func Render(name string, to string, data map[string]interface{}) (*Message, error) {
+	tmpl, ok := emailTemplates[name]
+	if !ok {
+		return nil, errors.New("The email template " + name + " does not exist.")
+	}
+
+	values := map[string]interface{}{"AppName": os.Getenv("app_name")}
+	for k, v := range data {
+		values[k] = v
+	}
+
+	msg := &Message{To: []string{to}}
+
+	var subject, text, html bytes.Buffer
+	subjectTemplate, err := texttemplate.New("subject").Parse(tmpl.Subject)
+	if err != nil {
+		return nil, err
+	}
+	if err := subjectTemplate.Execute(&subject, values); err != nil {
+		return nil, err
+	}
+
+	textTemplate, err := texttemplate.New("text").Parse(tmpl.Text)
+	if err != nil {
+		return nil, err
+	}
+	if err := textTemplate.Execute(&text, values); err != nil {
+		return nil, err
+	}
+
+	htmlTemplate, err := htmltemplate.New("layout").Parse(layoutHTML)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := htmlTemplate.New("content").Parse(tmpl.HTML); err != nil {
+		return nil, err
+	}
+	if err := htmlTemplate.ExecuteTemplate(&html, "layout", values); err != nil {
+		return nil, err
+	}
+
+	msg.Subject = subject.String()
+	msg.Text = text.String()
+	msg.HTML = html.String()
+
+	return msg, nil
+}
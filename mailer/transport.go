@@ -0,0 +1,87 @@
+package mailer
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Deliver the emails through SMTP server
+type SMTPTransport struct {
+	Address string
+	Auth    smtp.Auth
+}
+
+func NewSMTPTransport(host, port, username, password string) *SMTPTransport {
+	if port == "" {
+		port = "587"
+	}
+
+	t := &SMTPTransport{Address: host + ":" + port}
+	if username != "" {
+		t.Auth = smtp.PlainAuth("", username, password, host)
+	}
+
+	return t
+}
+
+func (t *SMTPTransport) Send(from string, to []string, body []byte) error {
+	return smtp.SendMail(t.Address, t.Auth, from, to, body)
+}
+
+// Write the emails as .eml files into the directory, for local development
+type FileTransport struct {
+	Dir string
+}
+
+func NewFileTransport(dir string) *FileTransport {
+	return &FileTransport{Dir: dir}
+}
+
+func (t *FileTransport) Send(from string, to []string, body []byte) error {
+	if err := os.MkdirAll(t.Dir, 0755); err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("%d.eml", time.Now().UnixNano())
+	return ioutil.WriteFile(filepath.Join(t.Dir, name), body, 0644)
+}
+
+// Email kept by the memory transport
+type SentMessage struct {
+	From string
+	To   []string
+	Body []byte
+}
+
+// Keep the emails in memory, for tests
+type MemoryTransport struct {
+	mutex    sync.Mutex
+	messages []SentMessage
+}
+
+func NewMemoryTransport() *MemoryTransport {
+	return &MemoryTransport{}
+}
+
+func (t *MemoryTransport) Send(from string, to []string, body []byte) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.messages = append(t.messages, SentMessage{From: from, To: to, Body: body})
+	return nil
+}
+
+// Get the emails that have been sent
+func (t *MemoryTransport) Messages() []SentMessage {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	messages := make([]SentMessage, len(t.messages))
+	copy(messages, t.messages)
+	return messages
+}
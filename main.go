@@ -3,6 +3,7 @@ package main
 import (
 	"app/api"
 	"app/middleware"
+	"app/models"
 	"github.com/gorilla/handlers"
 	"github.com/gorilla/mux"
 	"github.com/joho/godotenv"
@@ -19,52 +20,154 @@ func main() {
 
 	router := mux.NewRouter()
 
+	// Public keys to verify the login tokens
+	router.HandleFunc("/.well-known/jwks.json", api.JWKS).Methods("GET")
+
 	// REST routes
 	apiRoutes := router.PathPrefix("/api").Subrouter()
 	apiRoutes.HandleFunc("/login", api.Login).Methods("POST")
+	apiRoutes.HandleFunc("/login/2fa", api.TwoFactorLogin).Methods("POST")
+	apiRoutes.HandleFunc("/login/magic", api.MagicLogin).Methods("POST")
+	apiRoutes.HandleFunc("/login/magic/redeem", api.RedeemMagicLogin).Methods("POST")
+	apiRoutes.HandleFunc("/oauth/{provider}/login", api.OAuthLogin).Methods("GET")
+	apiRoutes.HandleFunc("/oauth/{provider}/callback", api.OAuthCallback).Methods("POST")
+	apiRoutes.HandleFunc("/sso/metadata", api.SSOMetadata).Methods("GET")
+	apiRoutes.HandleFunc("/sso/acs", api.SSOAssertionConsumer).Methods("POST")
+	apiRoutes.HandleFunc("/sso/token", api.SSOToken).Methods("POST")
+	apiRoutes.HandleFunc("/sso/{slug}/login", api.SSOLogin).Methods("GET")
 	apiRoutes.HandleFunc("/signup", api.Signup).Methods("POST")
 	apiRoutes.HandleFunc("/resendactivation", api.ResendActivation).Methods("POST")
 	apiRoutes.HandleFunc("/activateaccount", api.ActivateAccount).Methods("POST")
+	apiRoutes.HandleFunc("/confirmemail", api.ConfirmEmail).Methods("POST")
 	apiRoutes.HandleFunc("/forgetpassword", api.ForgetPassword).Methods("POST")
 	apiRoutes.HandleFunc("/resetpassword", api.ResetPassword).Methods("POST")
+	apiRoutes.HandleFunc("/token/refresh", api.RefreshToken).Methods("POST")
+	apiRoutes.HandleFunc("/invitation/{token}", api.ShowInvitationByToken).Methods("GET")
+	apiRoutes.HandleFunc("/invitation/{token}/signup", api.SignupWithInvitation).Methods("POST")
+	apiRoutes.HandleFunc("/join/{token}", api.ShowJoinLinkByToken).Methods("GET")
+	apiRoutes.Handle("/logout", middleware.JwtAuthentication()(middleware.SessionOnly()(http.HandlerFunc(api.Logout)))).Methods("POST")
 
 	apiAuthenticatedRoutes := apiRoutes.PathPrefix("/dashboard").Subrouter()
 	apiAuthenticatedRoutes.Use(middleware.JwtAuthentication())
 
+	// Routes that cannot be accessed with the access tokens, ie. to manage the credentials
+	sessionOnly := middleware.SessionOnly()
+
+	// Impersonation routes for the support team
+	apiAuthenticatedRoutes.Handle("/admin/impersonate", sessionOnly(http.HandlerFunc(api.Impersonate))).Methods("POST")
+	apiAuthenticatedRoutes.HandleFunc("/impersonation/end", api.EndImpersonation).Methods("POST")
+
 	// Profiles routes
 	apiProfileRoutes := apiAuthenticatedRoutes.PathPrefix("/profile").Subrouter()
+	apiProfileRoutes.Use(middleware.TokenScope("profile"))
 	apiProfileRoutes.HandleFunc("/get", api.GetProfile).Methods("GET")
 	apiProfileRoutes.HandleFunc("/edit", api.EditProfile).Methods("POST")
-	apiProfileRoutes.HandleFunc("/edit/password", api.EditPassword).Methods("POST")
+	apiProfileRoutes.Handle("/edit/password", sessionOnly(http.HandlerFunc(api.EditPassword))).Methods("POST")
+	apiProfileRoutes.Handle("/edit/password/link", sessionOnly(http.HandlerFunc(api.SendPasswordLink))).Methods("POST")
+	apiProfileRoutes.Handle("/edit/email", sessionOnly(http.HandlerFunc(api.EditEmail))).Methods("POST")
 	apiProfileRoutes.HandleFunc("/upload/picture", api.UploadPicture).Methods("POST")
 	apiProfileRoutes.HandleFunc("/delete/picture", api.DeletePicture).Methods("POST")
+	apiProfileRoutes.Handle("/2fa/enroll", sessionOnly(http.HandlerFunc(api.EnrollTwoFactor))).Methods("POST")
+	apiProfileRoutes.Handle("/2fa/verify", sessionOnly(http.HandlerFunc(api.VerifyTwoFactor))).Methods("POST")
+	apiProfileRoutes.Handle("/2fa/disable", sessionOnly(http.HandlerFunc(api.DisableTwoFactor))).Methods("POST")
+	apiProfileRoutes.Handle("/2fa/recoverycodes", sessionOnly(http.HandlerFunc(api.RegenerateRecoveryCodes))).Methods("POST")
+	apiProfileRoutes.HandleFunc("/identities", api.IndexIdentities).Methods("GET")
+	apiProfileRoutes.Handle("/identities/{id}/delete", sessionOnly(http.HandlerFunc(api.DeleteIdentity))).Methods("DELETE")
+	apiProfileRoutes.Handle("/tokens", sessionOnly(http.HandlerFunc(api.IndexPersonalAccessTokens))).Methods("GET")
+	apiProfileRoutes.Handle("/tokens", sessionOnly(http.HandlerFunc(api.CreatePersonalAccessToken))).Methods("POST")
+	apiProfileRoutes.Handle("/tokens/{tokenId}/revoke", sessionOnly(http.HandlerFunc(api.RevokePersonalAccessToken))).Methods("POST")
+	apiProfileRoutes.Handle("/sessions", sessionOnly(http.HandlerFunc(api.IndexSessions))).Methods("GET")
+	apiProfileRoutes.Handle("/sessions/revokeall", sessionOnly(http.HandlerFunc(api.RevokeAllSessions))).Methods("POST")
+	apiProfileRoutes.Handle("/sessions/{sessionId}/revoke", sessionOnly(http.HandlerFunc(api.RevokeSession))).Methods("POST")
+	apiProfileRoutes.Handle("/export", sessionOnly(http.HandlerFunc(api.ExportProfile))).Methods("GET")
+	apiProfileRoutes.Handle("/delete", sessionOnly(http.HandlerFunc(api.DeleteAccount))).Methods("POST")
+	apiProfileRoutes.Handle("/delete/cancel", sessionOnly(http.HandlerFunc(api.CancelDeleteAccount))).Methods("POST")
 
 	// Invitation routes (incoming)
 	apiInvitedRoutes := apiAuthenticatedRoutes.PathPrefix("/invite/incoming").Subrouter()
+	apiInvitedRoutes.Use(middleware.TokenScope("invitation"))
 	apiInvitedRoutes.HandleFunc("", api.IndexInvitationFromCompany).Methods("GET")
 	apiInvitedRoutes.HandleFunc("/{id}", api.ShowInvitationFromCompany).Methods("GET")
 	apiInvitedRoutes.HandleFunc("/{id}/respond", api.RespondCompanyInvitationRequest).Methods("POST")
 
+	// Join routes, with the join link or the email domain
+	apiJoinRoutes := apiAuthenticatedRoutes.PathPrefix("/join").Subrouter()
+	apiJoinRoutes.Use(middleware.TokenScope("invitation"))
+	apiJoinRoutes.HandleFunc("", api.IndexJoinableCompany).Methods("GET")
+	apiJoinRoutes.HandleFunc("/company/{id}", api.JoinCompanyByDomain).Methods("POST")
+	apiJoinRoutes.HandleFunc("/link/{token}", api.JoinCompanyByLink).Methods("POST")
+
 	// Company routes
 	apiCompanyRoutes := apiAuthenticatedRoutes.PathPrefix("/company").Subrouter()
-	apiCompanyRoutes.HandleFunc("", api.IndexCompany).Methods("GET")
-	apiCompanyRoutes.HandleFunc("/store", api.CreateCompany).Methods("POST")
-	apiCompanyRoutes.HandleFunc("/getUniqueSlug", api.GetUniqueSlug).Methods("GET")
-	apiCompanyRoutes.HandleFunc("/{id}/show", api.ShowCompany).Methods("GET")
-	apiCompanyRoutes.HandleFunc("/{id}/update", api.EditCompany).Methods("PATCH")
-	apiCompanyRoutes.HandleFunc("/{id}/delete", api.DeleteCompany).Methods("DELETE")
-	apiCompanyRoutes.HandleFunc("/{id}/users", api.IndexCompanyUsers).Methods("GET")
-	apiCompanyRoutes.HandleFunc("/{id}/users/search", api.SearchCompanyUsers).Methods("GET")
-	apiCompanyRoutes.HandleFunc("/{id}/visit", api.VisitCompany).Methods("PATCH")
+	apiCompanyRoutes.Use(middleware.TokenScope("company"))
+	apiCompanyRoutes.Use(middleware.CompanyTwoFactor())
+
+	// The access tokens can only use the routes that allow them, the rest are only for the users that have logged in
+	apiCompanyRoutes.Use(middleware.TokenAccess())
+	allowToken := middleware.AllowToken
+
+	apiCompanyRoutes.Handle("", allowToken(http.HandlerFunc(api.IndexCompany))).Methods("GET")
+	apiCompanyRoutes.Handle("/store", allowToken(http.HandlerFunc(api.CreateCompany))).Methods("POST")
+	apiCompanyRoutes.Handle("/getUniqueSlug", allowToken(http.HandlerFunc(api.GetUniqueSlug))).Methods("GET")
+	apiCompanyRoutes.Handle("/trash", allowToken(http.HandlerFunc(api.IndexDeletedCompany))).Methods("GET")
+	apiCompanyRoutes.Handle("/{id}/show", allowToken(http.HandlerFunc(api.ShowCompany))).Methods("GET")
+	apiCompanyRoutes.Handle("/{id}/update", allowToken(http.HandlerFunc(api.EditCompany))).Methods("PATCH")
+	apiCompanyRoutes.Handle("/{id}/delete", sessionOnly(http.HandlerFunc(api.DeleteCompany))).Methods("DELETE")
+	apiCompanyRoutes.Handle("/{id}/restore", sessionOnly(http.HandlerFunc(api.RestoreCompany))).Methods("POST")
+	apiCompanyRoutes.Handle("/{id}/users", allowToken(http.HandlerFunc(api.IndexCompanyUsers))).Methods("GET")
+	apiCompanyRoutes.Handle("/{id}/users/search", allowToken(http.HandlerFunc(api.SearchCompanyUsers))).Methods("GET")
+	apiCompanyRoutes.HandleFunc("/{id}/users/{userId}/unlock", api.UnlockCompanyUser).Methods("POST")
+	apiCompanyRoutes.Handle("/{id}/users/{userId}/role", sessionOnly(http.HandlerFunc(api.ChangeCompanyUserRole))).Methods("PATCH")
+	apiCompanyRoutes.Handle("/{id}/users/{userId}/remove", sessionOnly(http.HandlerFunc(api.RemoveCompanyUser))).Methods("DELETE")
+	apiCompanyRoutes.Handle("/{id}/leave", sessionOnly(http.HandlerFunc(api.LeaveCompany))).Methods("POST")
+	apiCompanyRoutes.Handle("/{id}/owner/transfer", allowToken(http.HandlerFunc(api.ShowCompanyOwnershipTransfer))).Methods("GET")
+	apiCompanyRoutes.Handle("/{id}/owner/transfer", sessionOnly(http.HandlerFunc(api.TransferCompanyOwnership))).Methods("POST")
+	apiCompanyRoutes.Handle("/{id}/owner/transfer/cancel", sessionOnly(http.HandlerFunc(api.CancelCompanyOwnershipTransfer))).Methods("POST")
+	apiCompanyRoutes.Handle("/{id}/owner/transfer/respond", sessionOnly(http.HandlerFunc(api.RespondCompanyOwnershipTransfer))).Methods("POST")
+	apiCompanyRoutes.Handle("/{id}/visit", allowToken(http.HandlerFunc(api.VisitCompany))).Methods("PATCH")
+	apiCompanyRoutes.Handle("/{id}/emails", allowToken(http.HandlerFunc(api.IndexCompanyEmails))).Methods("GET")
+	apiCompanyRoutes.HandleFunc("/{id}/2fa", api.RequireCompanyTwoFactor).Methods("PATCH")
+	apiCompanyRoutes.Handle("/{id}/sso", sessionOnly(http.HandlerFunc(api.ShowCompanySSO))).Methods("GET")
+	apiCompanyRoutes.Handle("/{id}/sso", sessionOnly(http.HandlerFunc(api.UpdateCompanySSO))).Methods("PATCH")
+	apiCompanyRoutes.Handle("/{id}/apikeys", sessionOnly(http.HandlerFunc(api.IndexCompanyAPIKeys))).Methods("GET")
+	apiCompanyRoutes.Handle("/{id}/apikeys", sessionOnly(http.HandlerFunc(api.CreateCompanyAPIKey))).Methods("POST")
+	apiCompanyRoutes.Handle("/{id}/apikeys/{keyId}/revoke", sessionOnly(http.HandlerFunc(api.RevokeCompanyAPIKey))).Methods("POST")
+	apiCompanyRoutes.Handle("/{id}/passwordpolicy", allowToken(http.HandlerFunc(api.ShowCompanyPasswordPolicy))).Methods("GET")
+	apiCompanyRoutes.Handle("/{id}/passwordpolicy", sessionOnly(http.HandlerFunc(api.UpdateCompanyPasswordPolicy))).Methods("PATCH")
+	apiCompanyRoutes.Handle("/{id}/roles", allowToken(http.HandlerFunc(api.IndexCompanyRoles))).Methods("GET")
+	apiCompanyRoutes.Handle("/{id}/roles", sessionOnly(http.HandlerFunc(api.CreateCompanyRole))).Methods("POST")
+	apiCompanyRoutes.Handle("/{id}/roles/{roleId}", allowToken(http.HandlerFunc(api.ShowCompanyRole))).Methods("GET")
+	apiCompanyRoutes.Handle("/{id}/roles/{roleId}", sessionOnly(http.HandlerFunc(api.UpdateCompanyRole))).Methods("PATCH")
+	apiCompanyRoutes.Handle("/{id}/roles/{roleId}", sessionOnly(http.HandlerFunc(api.DeleteCompanyRole))).Methods("DELETE")
+	apiCompanyRoutes.Handle("/{id}/teams", allowToken(http.HandlerFunc(api.IndexCompanyTeams))).Methods("GET")
+	apiCompanyRoutes.Handle("/{id}/teams", sessionOnly(http.HandlerFunc(api.CreateCompanyTeam))).Methods("POST")
+	apiCompanyRoutes.Handle("/{id}/teams/{teamId}", allowToken(http.HandlerFunc(api.ShowCompanyTeam))).Methods("GET")
+	apiCompanyRoutes.Handle("/{id}/teams/{teamId}", sessionOnly(http.HandlerFunc(api.UpdateCompanyTeam))).Methods("PATCH")
+	apiCompanyRoutes.Handle("/{id}/teams/{teamId}", sessionOnly(http.HandlerFunc(api.DeleteCompanyTeam))).Methods("DELETE")
+	apiCompanyRoutes.Handle("/{id}/teams/{teamId}/users", sessionOnly(http.HandlerFunc(api.AddCompanyTeamUser))).Methods("POST")
+	apiCompanyRoutes.Handle("/{id}/teams/{teamId}/users/{userId}", sessionOnly(http.HandlerFunc(api.RemoveCompanyTeamUser))).Methods("DELETE")
 
 	// Company invitation request routes (outgoing)
-	apiCompanyRoutes.HandleFunc("/{id}/invite", api.InviteToCompany).Methods("POST")
-	apiCompanyRoutes.HandleFunc("/{id}/invite/list", api.IndexInviteToCompany).Methods("GET")
-	apiCompanyRoutes.HandleFunc("/{id}/invite/{invitationID}", api.ShowCompanyInvitationRequest).Methods("GET")
+	apiCompanyRoutes.Handle("/{id}/invite", allowToken(http.HandlerFunc(api.InviteToCompany))).Methods("POST")
+	apiCompanyRoutes.Handle("/{id}/invite/list", allowToken(http.HandlerFunc(api.IndexInviteToCompany))).Methods("GET")
+	apiCompanyRoutes.Handle("/{id}/invite/{invitationID}", allowToken(http.HandlerFunc(api.ShowCompanyInvitationRequest))).Methods("GET")
+	apiCompanyRoutes.Handle("/{id}/invite/{invitationID}/resend", allowToken(http.HandlerFunc(api.ResendCompanyInvitationRequest))).Methods("POST")
+	apiCompanyRoutes.HandleFunc("/{id}/invite/{invitationID}/revoke", api.RevokeCompanyInvitationRequest).Methods("POST")
 	apiCompanyRoutes.HandleFunc("/{id}/invite/{invitationID}/delete", api.DeleteCompanyInvitationRequest).Methods("DELETE")
+	apiCompanyRoutes.Handle("/{id}/joinlinks", sessionOnly(http.HandlerFunc(api.IndexCompanyJoinLinks))).Methods("GET")
+	apiCompanyRoutes.Handle("/{id}/joinlinks", sessionOnly(http.HandlerFunc(api.CreateCompanyJoinLink))).Methods("POST")
+	apiCompanyRoutes.Handle("/{id}/joinlinks/{linkId}/revoke", sessionOnly(http.HandlerFunc(api.RevokeCompanyJoinLink))).Methods("POST")
+	apiCompanyRoutes.Handle("/{id}/joinrequests", allowToken(http.HandlerFunc(api.IndexCompanyJoinRequests))).Methods("GET")
+	apiCompanyRoutes.HandleFunc("/{id}/joinrequests/{invitationID}/respond", api.RespondCompanyJoinRequest).Methods("POST")
+	apiCompanyRoutes.Handle("/{id}/domains", sessionOnly(http.HandlerFunc(api.IndexCompanyDomains))).Methods("GET")
+	apiCompanyRoutes.Handle("/{id}/domains", sessionOnly(http.HandlerFunc(api.CreateCompanyDomain))).Methods("POST")
+	apiCompanyRoutes.Handle("/{id}/domains/{domainId}", sessionOnly(http.HandlerFunc(api.UpdateCompanyDomain))).Methods("PATCH")
+	apiCompanyRoutes.Handle("/{id}/domains/{domainId}/verify", sessionOnly(http.HandlerFunc(api.VerifyCompanyDomain))).Methods("POST")
+	apiCompanyRoutes.Handle("/{id}/domains/{domainId}/delete", sessionOnly(http.HandlerFunc(api.DeleteCompanyDomain))).Methods("DELETE")
 
 	// User routes
 	apiUserRoutes := apiAuthenticatedRoutes.PathPrefix("/user").Subrouter()
+	apiUserRoutes.Use(middleware.TokenScope("user"))
 	apiUserRoutes.HandleFunc("/{id}", api.GetUserProfile).Methods("GET")
 
 	port := os.Getenv("port")
@@ -72,6 +175,12 @@ func main() {
 		port = "8000"
 	}
 
+	// Background jobs
+	go models.RunEmailDispatcher()
+	go models.RunAccountPurger()
+	go models.RunCompanyPurger()
+	go models.RunInvitationScheduler()
+
 	log.Println("Server started and running at port", port)
 
 	headers := handlers.AllowedHeaders([]string{"X-Requested-With", "Content-Type", "Authorization"})
@@ -4,11 +4,10 @@ import (
 	"net/http"
 	"strings"
 	"github.com/gorilla/mux"
-	jwt "github.com/dgrijalva/jwt-go"
-	"os"
 	"context"
 	util "app/utils"
 	"app/models"
+	"github.com/satori/go.uuid"
 	"time"
 )
 
@@ -47,11 +46,30 @@ var JwtAuthentication = func() mux.MiddlewareFunc {
 			}
 	
 			tokenPart := splitted[1] // Grab the second part
+
+			// Personal access tokens and company API keys of the machine clients
+			if strings.HasPrefix(tokenPart, models.PersonalAccessTokenPrefix) || strings.HasPrefix(tokenPart, models.CompanyAPIKeyPrefix) {
+				accessToken, err := models.AuthenticateAPIToken(tokenPart)
+				if err != nil {
+					response = util.Message(false, http.StatusUnauthorized, err.Error(), errors)
+					util.Respond(w, response)
+					return
+				}
+
+				// Set the user ID and the scopes of the token in the context
+				ctx := context.WithValue(r.Context(), "user", accessToken.UserID)
+				ctx = context.WithValue(ctx, "scopes", accessToken.GetScopes())
+				if accessToken.CompanyID != nil {
+					ctx = context.WithValue(ctx, "tokenCompany", *accessToken.CompanyID)
+				}
+				r = r.WithContext(ctx)
+				handler.ServeHTTP(w, r)
+				return
+			}
+
 			tk := &models.Token{}
 	
-			token, err := jwt.ParseWithClaims(tokenPart, tk, func(token *jwt.Token) (interface{}, error) {
-				return []byte(os.Getenv("token_password")), nil
-			})
+			token, err := models.ParseToken(tokenPart, tk)
 	
 			if err != nil {
 				response = util.Message(false, http.StatusUnauthorized, "Invalid auth token format.", errors)
@@ -71,10 +89,172 @@ var JwtAuthentication = func() mux.MiddlewareFunc {
 				return
 			}
 
-			// Set the user ID in the context
+			// Check if the token has been revoked, ie. logged out
+			tokenId, _ := uuid.FromString(tk.Id)
+			if tokenId == uuid.Nil || models.IsTokenRevoked(tokenId) {
+				response = util.Message(false, http.StatusUnauthorized, "Token has been revoked. Please login again.", errors)
+				util.Respond(w, response)
+				return
+			}
+
+			// The token of the impersonation is only valid while the impersonation is ongoing
+			if tk.ImpersonatorId != uuid.Nil && !models.IsImpersonationActive(tk.SessionId) {
+				response = util.Message(false, http.StatusUnauthorized, "The impersonation has ended.", errors)
+				util.Respond(w, response)
+				return
+			}
+
+			models.TouchSession(tk.SessionId)
+
+			// Set the user ID and token details in the context
 			ctx := context.WithValue(r.Context(), "user", tk.UserId)
+			ctx = context.WithValue(ctx, "session", tk.SessionId)
+			ctx = context.WithValue(ctx, "tokenId", tokenId)
+			ctx = context.WithValue(ctx, "tokenExpiry", tk.Expiry)
+			if tk.ImpersonatorId != uuid.Nil {
+				ctx = context.WithValue(ctx, "impersonator", tk.ImpersonatorId)
+
+				// Every request made under the impersonation goes into the audit trail
+				models.RecordImpersonatedRequest(tk.SessionId, r.Method, r.URL.Path, models.Client{
+					IP:        util.GetClientIP(r),
+					UserAgent: r.UserAgent(),
+				})
+			}
 			r = r.WithContext(ctx)
 			handler.ServeHTTP(w, r)
 		})
 	}
 }
+
+// Block the members without 2FA from the companies that require 2FA
+var CompanyTwoFactor = func() mux.MiddlewareFunc {
+	return func(handler http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var errors []string
+			vars := mux.Vars(r)
+			companyId, err := uuid.FromString(vars["id"])
+
+			// Only the routes of a specific company are checked
+			if err != nil {
+				handler.ServeHTTP(w, r)
+				return
+			}
+
+			company := models.GetCompanyByID(companyId)
+			if company != nil && company.RequireTwoFactor {
+				userId := r.Context().Value("user") . (uuid.UUID)
+				user := models.GetUser(userId)
+
+				if user == nil || !user.TwoFactorEnabled {
+					response := util.Message(false, http.StatusForbidden, "The company requires two-factor authentication. Please enable it in your profile.", errors)
+					util.Respond(w, response)
+					return
+				}
+			}
+
+			handler.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Restrict the access tokens to the scopes of the area, ie. company:read for GET and company:write for the rest
+var TokenScope = func(area string) mux.MiddlewareFunc {
+	return func(handler http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var errors []string
+			scopes, ok := r.Context().Value("scopes") . ([]string)
+
+			// The user has logged in interactively
+			if !ok {
+				handler.ServeHTTP(w, r)
+				return
+			}
+
+			scope := area + ":write"
+			if r.Method == http.MethodGet || r.Method == http.MethodHead {
+				scope = area + ":read"
+			}
+
+			allowed := false
+			for _, s := range scopes {
+				if s == scope {
+					allowed = true
+				}
+			}
+
+			if !allowed {
+				response := util.Message(false, http.StatusForbidden, "The access token does not have the " + scope + " scope.", errors)
+				util.Respond(w, response)
+				return
+			}
+
+			// The company API key can only access its own company
+			if companyId, ok := r.Context().Value("tokenCompany") . (uuid.UUID); ok {
+				if vars := mux.Vars(r); vars["id"] != companyId.String() {
+					response := util.Message(false, http.StatusForbidden, "The API key can only access its own company.", errors)
+					util.Respond(w, response)
+					return
+				}
+			}
+
+			handler.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Only allow the users that have logged in interactively by themselves, ie. to manage the credentials
+var SessionOnly = func() mux.MiddlewareFunc {
+	return func(handler http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var errors []string
+			if _, ok := r.Context().Value("scopes") . ([]string); ok {
+				response := util.Message(false, http.StatusForbidden, "The action is not allowed with an access token. Please login to continue.", errors)
+				util.Respond(w, response)
+				return
+			}
+
+			// The credentials cannot be managed while impersonating the user either
+			if _, ok := r.Context().Value("impersonator") . (uuid.UUID); ok {
+				response := util.Message(false, http.StatusForbidden, "The action is not allowed while impersonating the user.", errors)
+				util.Respond(w, response)
+				return
+			}
+
+			handler.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Handler of the route that can be accessed with the access tokens
+type tokenHandler struct {
+	http.Handler
+}
+
+// Allow the access tokens on the route of the subrouter protected by TokenAccess
+var AllowToken = func(handler http.Handler) http.Handler {
+	return tokenHandler{handler}
+}
+
+// Only allow the access tokens on the routes marked with AllowToken, so that the company API keys cannot use the new routes
+// with the full permissions of the creator unless the route is deliberately opened to them
+var TokenAccess = func() mux.MiddlewareFunc {
+	return func(handler http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var errors []string
+			if _, ok := r.Context().Value("scopes") . ([]string); !ok {
+				handler.ServeHTTP(w, r)
+				return
+			}
+
+			if route := mux.CurrentRoute(r); route != nil {
+				if _, ok := route.GetHandler() . (tokenHandler); ok {
+					handler.ServeHTTP(w, r)
+					return
+				}
+			}
+
+			response := util.Message(false, http.StatusForbidden, "The action is not allowed with an access token. Please login to continue.", errors)
+			util.Respond(w, response)
+		})
+	}
+}
@@ -0,0 +1,60 @@
+package middleware
+
+import (
+	"context"
+	"github.com/gorilla/mux"
+	"github.com/satori/go.uuid"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTokenAccess(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})
+
+	router := mux.NewRouter()
+	routes := router.PathPrefix("/company").Subrouter()
+
+	// Log in the request as the test case says
+	routes.Use(func(handler http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := context.WithValue(r.Context(), "user", uuid.NewV4())
+			if r.Header.Get("X-Test-Token") != "" {
+				ctx = context.WithValue(ctx, "scopes", []string{"company:read", "company:write"})
+			}
+			handler.ServeHTTP(w, r.WithContext(ctx))
+		})
+	})
+	routes.Use(TokenAccess())
+	routes.Handle("/{id}/show", AllowToken(ok)).Methods("GET")
+	routes.Handle("/{id}/delete", ok).Methods("DELETE")
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		token  bool
+		want   bool
+	}{
+		{"session on the allowed route", "GET", "/company/1/show", false, true},
+		{"session on the other route", "DELETE", "/company/1/delete", false, true},
+		{"token on the allowed route", "GET", "/company/1/show", true, true},
+		{"token on the other route", "DELETE", "/company/1/delete", true, false},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest(test.method, test.path, nil)
+		if test.token {
+			req.Header.Set("X-Test-Token", "1")
+		}
+
+		res := httptest.NewRecorder()
+		router.ServeHTTP(res, req)
+
+		if got := res.Body.String() == "ok"; got != test.want {
+			t.Errorf("%s: allowed = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,344 @@
+package models
+
+import (
+	"app/mailer"
+	util "app/utils"
+	"github.com/jinzhu/gorm"
+	"github.com/satori/go.uuid"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	accountDeletionGraceDays = 14        // Default number of days before the account is deleted, to allow the user to change their mind
+	accountPurgeInterval     = time.Hour // How often the accounts due for deletion are purged
+)
+
+// Membership of the user in the company for the data export
+type companyMembership struct {
+	CompanyID   uuid.UUID  `json:"companyId"`
+	CompanyName string     `json:"companyName"`
+	RoleName    string     `json:"roleName"`
+	IsAdmin     bool       `json:"isAdmin"`
+	LastVisited *time.Time `json:"lastVisited"`
+}
+
+// Collect the personal data of the user for the data export
+func (user *User) ExportData(client Client) (map[string]interface{}, error) {
+	db := GetDB()
+	defer db.Close()
+
+	memberships := []companyMembership{}
+	db.Table("company_users").
+		Joins("JOIN companies ON companies.id = company_users.company_id").
+		Joins("JOIN roles ON roles.id = company_users.role_id").
+		Select("companies.id as company_id, companies.name as company_name, roles.name as role_name, roles.is_admin, company_users.last_visited").
+		Where("company_users.user_id = ? AND companies.deleted_at IS NULL", user.ID).
+		Order("companies.name asc").
+		Scan(&memberships)
+
+	invitationsSent := []CompanyInvitationRequest{}
+	db.Where("sender_id = ?", user.ID).Order("created_at desc").Find(&invitationsSent)
+
+	invitationsReceived := []CompanyInvitationRequest{}
+	db.Where("email = ? OR user_id = ?", user.Email, user.ID).Order("created_at desc").Find(&invitationsReceived)
+
+	identities := []UserIdentity{}
+	db.Where("user_id = ?", user.ID).Find(&identities)
+
+	sessions := []Session{}
+	db.Where("user_id = ?", user.ID).Order("created_at desc").Find(&sessions)
+
+	auditEvents := []AuditEvent{}
+	db.Where("user_id = ?", user.ID).Order("created_at desc").Find(&auditEvents)
+
+	if err := RecordAuditEvent(db, AuditDataExported, &user.ID, client, nil); err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"profile":             user,
+		"companies":           memberships,
+		"invitationsSent":     invitationsSent,
+		"invitationsReceived": invitationsReceived,
+		"identities":          identities,
+		"sessions":            sessions,
+		"auditEvents":         auditEvents,
+	}, nil
+}
+
+// Schedule the account to be deleted after the grace period
+func (user *User) RequestDeletion(password string, currentSessionId uuid.UUID, client Client) map[string]interface{} {
+	var errors []string
+	var resp map[string]interface{}
+
+	if user.IsLocked() {
+		resp = util.Message(false, http.StatusLocked, "The account has been temporarily locked due to too many failed login attempts. Please try again later or reset your password.", errors)
+		return resp
+	}
+
+	// The wrong passwords count towards the lockout like the failed logins
+	if !user.CheckPassword(password) {
+		user.registerFailedLogin()
+		resp = util.Message(false, http.StatusUnprocessableEntity, "The password is incorrect.", errors)
+		return resp
+	}
+
+	db := GetDB()
+	defer db.Close()
+
+	// The company cannot be left without an owner
+	if companies := user.ownedCompanies(db); len(companies) > 0 {
+		resp = util.Message(false, http.StatusUnprocessableEntity, "You are the owner of "+companyNames(companies)+". Please transfer the ownership or delete the company first.", errors)
+		resp["companies"] = companies
+		return resp
+	}
+
+	// The company cannot be left without an admin
+	if companies := user.soleAdminCompanies(db); len(companies) > 0 {
+		resp = util.Message(false, http.StatusUnprocessableEntity, "You are the last admin of "+companyNames(companies)+". Please assign another admin or delete the company first.", errors)
+		resp["companies"] = companies
+		return resp
+	}
+
+	deleteAt := time.Now().AddDate(0, 0, accountDeletionGrace())
+	msg, err := mailer.NewAccountDeletionEmail(user.Name, user.Email, deleteAt)
+
+	tx := db.Begin()
+	if err == nil {
+		err = tx.Model(&user).Update("DeletionScheduledAt", deleteAt).Error
+	}
+
+	if err == nil {
+		err = QueueEmail(tx, nil, msg)
+	}
+
+	if err == nil {
+		err = RecordAuditEvent(tx, AuditAccountDeletionRequested, &user.ID, client, map[string]interface{}{"deleteAt": deleteAt})
+	}
+
+	if err != nil {
+		tx.Rollback()
+		resp = util.Message(false, http.StatusInternalServerError, "Failed to delete the account, connection error.", errors)
+		return resp
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		resp = util.Message(false, http.StatusInternalServerError, "Failed to delete the account, connection error.", errors)
+		return resp
+	}
+
+	// Sign out the other sessions, the user can still login to cancel the deletion
+	revokeUserSessions(db, user.ID, currentSessionId)
+
+	resp = util.Message(true, http.StatusOK, "Your account will be deleted on "+deleteAt.Format("02 Jan 2006")+". You can cancel the deletion before then.", errors)
+	resp["data"] = user
+
+	return resp
+}
+
+// Cancel the scheduled deletion of the account
+func (user *User) CancelDeletion(client Client) map[string]interface{} {
+	var errors []string
+	var resp map[string]interface{}
+
+	if user.DeletionScheduledAt == nil {
+		resp = util.Message(false, http.StatusUnprocessableEntity, "The account is not scheduled to be deleted.", errors)
+		return resp
+	}
+
+	db := GetDB()
+	defer db.Close()
+
+	tx := db.Begin()
+	err := tx.Model(&user).Update("DeletionScheduledAt", nil).Error
+
+	if err == nil {
+		err = RecordAuditEvent(tx, AuditAccountDeletionCancelled, &user.ID, client, nil)
+	}
+
+	if err != nil {
+		tx.Rollback()
+		resp = util.Message(false, http.StatusInternalServerError, "Failed to cancel the deletion, connection error.", errors)
+		return resp
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		resp = util.Message(false, http.StatusInternalServerError, "Failed to cancel the deletion, connection error.", errors)
+		return resp
+	}
+
+	resp = util.Message(true, http.StatusOK, "The deletion of your account has been cancelled.", errors)
+	resp["data"] = user
+
+	return resp
+}
+
+// Keep purging the accounts due for deletion in the background
+func RunAccountPurger() {
+	ticker := time.NewTicker(accountPurgeInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		count, err := PurgeDeletedAccounts()
+		if err != nil {
+			log.Println("Failed to purge the deleted accounts:", err)
+		}
+
+		if count > 0 {
+			log.Println("Purged", count, "deleted account(s).")
+		}
+	}
+}
+
+// Anonymize the accounts whose grace period has passed, return the number of accounts purged
+func PurgeDeletedAccounts() (int, error) {
+	db := GetDB()
+	defer db.Close()
+
+	users := []User{}
+	err := db.Where("deletion_scheduled_at <= ?", time.Now()).Find(&users).Error
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for i := range users {
+		user := &users[i]
+
+		// The user might have become the owner or the last admin during the grace period
+		if companies := user.ownedCompanies(db); len(companies) > 0 {
+			log.Println("Skipped deleting the account", user.ID.String(), "as the owner of", companyNames(companies))
+			continue
+		}
+
+		if companies := user.soleAdminCompanies(db); len(companies) > 0 {
+			log.Println("Skipped deleting the account", user.ID.String(), "as the last admin of", companyNames(companies))
+			continue
+		}
+
+		if err := purgeAccount(db, user); err != nil {
+			return count, err
+		}
+		count++
+	}
+
+	return count, nil
+}
+
+// Remove the personal data of the user, the anonymized record is kept for the references, ie. the invitations sent
+func purgeAccount(db *gorm.DB, user *User) error {
+	revokeUserSessions(db, user.ID, uuid.Nil)
+
+	tx := db.Begin()
+	deletions := []interface{}{
+		CompanyUser{},
+		TeamUser{},
+		UserIdentity{},
+		APIToken{},
+		Session{},
+		RecoveryCode{},
+		TwoFactorChallenge{},
+		VerificationToken{},
+		PasswordHistory{},
+	}
+
+	for _, model := range deletions {
+		if err := tx.Unscoped().Where("user_id = ?", user.ID).Delete(model).Error; err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	// The pending invitations to the email address and the requests to join are no longer relevant
+	err := tx.Unscoped().Where("email = ? AND status IN (?)", user.Email, []int{InvitationPending, InvitationRequested}).Delete(CompanyInvitationRequest{}).Error
+	if err == nil {
+		err = tx.Unscoped().Where("recipient = ?", user.Email).Delete(EmailOutbox{}).Error
+	}
+
+	// The audit trail is kept without where the user has been from
+	if err == nil {
+		err = tx.Model(AuditEvent{}).
+			Where("user_id = ? OR actor_id = ?", user.ID, user.ID).
+			Updates(map[string]interface{}{"IP": "", "UserAgent": ""}).Error
+	}
+
+	if err == nil {
+		err = tx.Model(CompanyOwnershipTransfer{}).
+			Where("(from_user_id = ? OR to_user_id = ?) AND status = ?", user.ID, user.ID, ownershipTransferPending).
+			Updates(map[string]interface{}{"Status": ownershipTransferCancelled, "RespondedAt": time.Now()}).Error
+	}
+
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	now := time.Now()
+	err = tx.Model(user).Updates(map[string]interface{}{
+		"Name":                "Deleted user",
+		"Email":               "deleted-" + user.ID.String() + "@deleted.invalid",
+		"Password":            "",
+		"ProfilePicture":      "",
+		"Phone":               "",
+		"City":                "",
+		"Country":             0,
+		"Gender":              0,
+		"Birthday":            nil,
+		"Bio":                 "",
+		"TwoFactorEnabled":    false,
+		"TwoFactorSecret":     nil,
+		"LockedUntil":         nil,
+		"DeletionScheduledAt": nil,
+		"DeletedAt":           now,
+	}).Error
+
+	if err == nil {
+		err = RecordAuditEvent(tx, AuditAccountDeleted, &user.ID, Client{}, nil)
+	}
+
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit().Error
+}
+
+// Get the companies in which the user is the only admin
+func (user *User) soleAdminCompanies(db *gorm.DB) []Company {
+	companies := []Company{}
+	db.Table("companies").
+		Joins("JOIN company_users ON company_users.company_id = companies.id").
+		Joins("JOIN roles ON roles.id = company_users.role_id").
+		Select("companies.*").
+		Where("company_users.user_id = ? AND roles.is_admin = ? AND companies.deleted_at IS NULL", user.ID, true).
+		Where(`NOT EXISTS (SELECT 1 FROM company_users CU JOIN roles R ON R.id = CU.role_id
+			WHERE CU.company_id = companies.id AND CU.user_id <> ? AND R.is_admin = ?)`, user.ID, true).
+		Order("companies.name asc").
+		Find(&companies)
+
+	return companies
+}
+
+func companyNames(companies []Company) string {
+	names := []string{}
+	for _, company := range companies {
+		names = append(names, company.Name)
+	}
+
+	return strings.Join(names, ", ")
+}
+
+// Get the grace period in days configured in the environment
+func accountDeletionGrace() int {
+	if days, err := strconv.Atoi(os.Getenv("account_deletion_grace_days")); err == nil && days >= 0 {
+		return days
+	}
+
+	return accountDeletionGraceDays
+}
@@ -0,0 +1,145 @@
+package models
+
+import (
+	"app/mailer"
+	"github.com/satori/go.uuid"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRequestDeletionLockout(t *testing.T) {
+	db := testDB(t)
+	defer db.Close()
+
+	user := createTestUser(t, db, "Password123!")
+	defer deleteTestUser(db, user)
+
+	locked := createTestUser(t, db, "Password123!")
+	defer deleteTestUser(db, locked)
+	lockedUntil := time.Now().Add(time.Hour)
+	locked.LockedUntil = &lockedUntil
+
+	tests := []struct {
+		name     string
+		user     *User
+		password string
+		status   int
+	}{
+		{"wrong password", user, "WrongPassword1!", http.StatusUnprocessableEntity},
+		{"locked account", locked, "Password123!", http.StatusLocked},
+	}
+
+	for _, test := range tests {
+		resp := test.user.RequestDeletion(test.password, uuid.Nil, testClient)
+		if resp["status"] != test.status {
+			t.Errorf("%s: RequestDeletion() status = %v, want %v", test.name, resp["status"], test.status)
+		}
+
+		if got := GetUser(test.user.ID); got.DeletionScheduledAt != nil {
+			t.Errorf("%s: the deletion is scheduled", test.name)
+		}
+	}
+}
+
+func TestPurgeAccount(t *testing.T) {
+	db := testDB(t)
+	defer db.Close()
+
+	user := createTestUser(t, db, "Password123!")
+	defer deleteTestUser(db, user)
+
+	email := user.Email
+	if err := QueueEmail(db, nil, &mailer.Message{To: []string{email}, Subject: "Test", Text: "Test"}); err != nil {
+		t.Fatalf("Failed to queue the email: %v", err)
+	}
+
+	if err := RecordAuditEvent(db, AuditAccountDeletionRequested, &user.ID, testClient, nil); err != nil {
+		t.Fatalf("Failed to record the audit event: %v", err)
+	}
+
+	if err := purgeAccount(db, user); err != nil {
+		t.Fatalf("purgeAccount() returned the error: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		model interface{}
+		where string
+		value interface{}
+	}{
+		{"emails to the address", EmailOutbox{}, "recipient = ?", email},
+		{"audit events with the IP", AuditEvent{}, "user_id = ? AND (ip <> '' OR user_agent <> '')", user.ID},
+	}
+
+	for _, test := range tests {
+		count := 0
+		db.Unscoped().Model(test.model).Where(test.where, test.value).Count(&count)
+		if count != 0 {
+			t.Errorf("%d %s are left, want none", count, test.name)
+		}
+	}
+}
+
+func TestScheduledDeletion(t *testing.T) {
+	db := testDB(t)
+	defer db.Close()
+
+	owner := createTestUser(t, db, "Password123!")
+	defer deleteTestUser(db, owner)
+
+	admin := createTestUser(t, db, "Password123!")
+	defer deleteTestUser(db, admin)
+
+	nominee := createTestUser(t, db, "Password123!")
+	defer deleteTestUser(db, nominee)
+
+	company, adminRole, memberRole := createTestCompany(t, db, owner)
+	defer deleteTestCompany(db, company)
+	defer db.Unscoped().Where("company_id = ?", company.ID).Delete(CompanyOwnershipTransfer{})
+	addTestMember(t, db, company, admin, adminRole)
+	addTestMember(t, db, company, nominee, memberRole)
+
+	if resp := company.TransferOwnership(owner, nominee.ID, testClient); resp["status"] != http.StatusOK {
+		t.Fatalf("TransferOwnership() = %v", resp)
+	}
+
+	scheduledAt := time.Now().Add(-time.Minute)
+	for _, user := range []*User{owner, nominee} {
+		user.DeletionScheduledAt = &scheduledAt
+		db.Model(user).Update("DeletionScheduledAt", scheduledAt)
+	}
+
+	tests := []struct {
+		name    string
+		respond func() map[string]interface{}
+	}{
+		{"create a company", func() map[string]interface{} {
+			return nominee.CreateCompany(&Company{Name: "Scheduled Company"})
+		}},
+		{"accept the ownership", func() map[string]interface{} {
+			return company.RespondOwnershipTransfer(nominee, true, testClient)
+		}},
+	}
+
+	for _, test := range tests {
+		if resp := test.respond(); resp["status"] != http.StatusUnprocessableEntity {
+			t.Errorf("%s: status = %v, want %v", test.name, resp["status"], http.StatusUnprocessableEntity)
+		}
+	}
+
+	if updated := GetCompany(company.ID, owner.ID); updated == nil || !updated.IsOwner(owner.ID) {
+		t.Errorf("The ownership is transferred to the account scheduled for deletion")
+	}
+
+	// The owner is not the last admin but still owns the company
+	if _, err := PurgeDeletedAccounts(); err != nil {
+		t.Fatalf("PurgeDeletedAccounts() returned the error: %v", err)
+	}
+
+	count := 0
+	db.Model(User{}).Where("id = ?", owner.ID).Count(&count)
+	if count != 1 {
+		t.Errorf("The owner of the company is purged")
+	}
+}
@@ -0,0 +1,240 @@
+package models
+
+import (
+	util "app/utils"
+	"errors"
+	"github.com/jinzhu/gorm"
+	"github.com/satori/go.uuid"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Prefix of the plain tokens, to tell them apart from the login tokens
+const (
+	PersonalAccessTokenPrefix = "pat_"
+	CompanyAPIKeyPrefix       = "key_"
+	maxAPITokenLifetime       = 365         // days
+	apiTokenUsageInterval     = time.Minute // How often the last used time is recorded
+)
+
+// Scopes that can be granted to the personal access tokens, in the form of {area}:{access}
+var PersonalAccessTokenScopes = []string{
+	"profile:read",
+	"profile:write",
+	"company:read",
+	"company:write",
+	"invitation:read",
+	"invitation:write",
+	"user:read",
+}
+
+// Scopes that can be granted to the company API keys
+var APIKeyScopes = []string{
+	"company:read",
+	"company:write",
+}
+
+var ErrInvalidAPIToken = errors.New("The access token is invalid, expired or has been revoked.")
+
+// Long-lived token for the machine clients, either personal to the user or scoped to the company
+type APIToken struct {
+	Base
+	Name       string     `json:"name" gorm:"not null"`
+	UserID     uuid.UUID  `json:"userId" gorm:"type:uuid;not null;index"` // The owner of the personal token, or the creator of the company key
+	CompanyID  *uuid.UUID `json:"companyId" gorm:"type:uuid;index"`       // Only set for the company API keys
+	TokenHash  string     `json:"-" gorm:"not null;unique_index"`
+	Hint       string     `json:"hint"` // The last characters of the token to identify it
+	Scopes     string     `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expiresAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt"`
+	RevokedAt  *time.Time `json:"revokedAt"`
+}
+
+// Create the personal access token of the user
+func (user *User) CreatePersonalAccessToken(name string, scopes []string, expiresInDays int) map[string]interface{} {
+	token := &APIToken{
+		Name:   name,
+		UserID: user.ID,
+	}
+
+	return createAPIToken(token, PersonalAccessTokenPrefix, PersonalAccessTokenScopes, scopes, expiresInDays)
+}
+
+// Get the personal access tokens of the user
+func (user *User) GetPersonalAccessTokens() map[string]interface{} {
+	var errors []string
+	var resp map[string]interface{}
+
+	tokens := []APIToken{}
+	db := GetDB()
+	db.Where("user_id = ? AND company_id IS NULL", user.ID).Order("created_at desc").Find(&tokens)
+	defer db.Close()
+
+	resp = util.Message(true, http.StatusOK, "You have successfully retrieved the personal access tokens.", errors)
+	resp["data"] = tokens
+
+	return resp
+}
+
+// Revoke the personal access token of the user
+func (user *User) RevokePersonalAccessToken(tokenId uuid.UUID) map[string]interface{} {
+	db := GetDB()
+	query := db.Where("id = ? AND user_id = ? AND company_id IS NULL", tokenId, user.ID)
+	defer db.Close()
+
+	return revokeAPIToken(query)
+}
+
+// Create the API key of the company
+func (company *Company) CreateAPIKey(creatorId uuid.UUID, name string, scopes []string, expiresInDays int) map[string]interface{} {
+	token := &APIToken{
+		Name:      name,
+		UserID:    creatorId,
+		CompanyID: &company.ID,
+	}
+
+	return createAPIToken(token, CompanyAPIKeyPrefix, APIKeyScopes, scopes, expiresInDays)
+}
+
+// Get the API keys of the company
+func (company *Company) GetAPIKeys() map[string]interface{} {
+	var errors []string
+	var resp map[string]interface{}
+
+	tokens := []APIToken{}
+	db := GetDB()
+	db.Where("company_id = ?", company.ID).Order("created_at desc").Find(&tokens)
+	defer db.Close()
+
+	resp = util.Message(true, http.StatusOK, "You have successfully retrieved the API keys of the company.", errors)
+	resp["data"] = tokens
+
+	return resp
+}
+
+// Revoke the API key of the company
+func (company *Company) RevokeAPIKey(tokenId uuid.UUID) map[string]interface{} {
+	db := GetDB()
+	query := db.Where("id = ? AND company_id = ?", tokenId, company.ID)
+	defer db.Close()
+
+	return revokeAPIToken(query)
+}
+
+// Get the valid access token by the plain token and record its usage
+func AuthenticateAPIToken(plainToken string) (*APIToken, error) {
+	db := GetDB()
+	defer db.Close()
+
+	token := &APIToken{}
+	db.Where("token_hash = ? AND revoked_at IS NULL", util.HashToken(plainToken)).First(token)
+
+	if token.ID == uuid.Nil || (token.ExpiresAt != nil && time.Now().After(*token.ExpiresAt)) {
+		return nil, ErrInvalidAPIToken
+	}
+
+	// The API key is no longer valid once the company is deleted
+	if token.CompanyID != nil && GetCompanyByID(*token.CompanyID) == nil {
+		return nil, ErrInvalidAPIToken
+	}
+
+	// Only record the usage once in a while to avoid a write on every request
+	now := time.Now()
+	db.Model(APIToken{}).
+		Where("id = ? AND (last_used_at IS NULL OR last_used_at < ?)", token.ID, now.Add(-apiTokenUsageInterval)).
+		Update("LastUsedAt", now)
+
+	return token, nil
+}
+
+// Get the scopes granted to the token
+func (token *APIToken) GetScopes() []string {
+	return strings.Fields(token.Scopes)
+}
+
+// Validate the scopes and expiry, then store the hash of the token and return the plain token once
+func createAPIToken(token *APIToken, prefix string, allowedScopes, scopes []string, expiresInDays int) map[string]interface{} {
+	var errors []string
+	var resp map[string]interface{}
+
+	token.Name = strings.TrimSpace(token.Name)
+	if token.Name == "" {
+		errors = append(errors, "Name is required.")
+	}
+
+	if len(scopes) == 0 {
+		errors = append(errors, "At least one scope is required.")
+	}
+
+	for _, scope := range scopes {
+		if !contains(allowedScopes, scope) {
+			errors = append(errors, "Scope "+scope+" is invalid.")
+		}
+	}
+
+	if expiresInDays < 0 || expiresInDays > maxAPITokenLifetime {
+		errors = append(errors, "The token can only be valid for up to 365 days.")
+	}
+
+	if len(errors) > 0 {
+		resp = util.Message(false, http.StatusUnprocessableEntity, "Validation error", errors)
+		return resp
+	}
+
+	randomToken, err := util.GenerateRandomToken(32)
+	if err != nil {
+		resp = util.Message(false, http.StatusInternalServerError, "Failed to create the token, please try again.", errors)
+		return resp
+	}
+
+	plainToken := prefix + randomToken
+	token.TokenHash = util.HashToken(plainToken)
+	token.Hint = plainToken[len(plainToken)-4:]
+	token.Scopes = strings.Join(scopes, " ")
+	if expiresInDays > 0 {
+		expiresAt := time.Now().AddDate(0, 0, expiresInDays)
+		token.ExpiresAt = &expiresAt
+	}
+
+	db := GetDB()
+	err = db.Create(token).Error
+	defer db.Close()
+
+	if err != nil {
+		resp = util.Message(false, http.StatusInternalServerError, "Failed to create the token, connection error.", errors)
+		return resp
+	}
+
+	resp = util.Message(true, http.StatusOK, "You have successfully created the token. Copy it now as it will not be shown again.", errors)
+	resp["data"] = token
+	resp["token"] = plainToken
+
+	return resp
+}
+
+func revokeAPIToken(query *gorm.DB) map[string]interface{} {
+	var errors []string
+	var resp map[string]interface{}
+
+	result := query.Model(APIToken{}).Where("revoked_at IS NULL").Update("RevokedAt", time.Now())
+
+	if result.Error != nil || result.RowsAffected == 0 {
+		resp = util.Message(false, http.StatusUnprocessableEntity, "No available result.", errors)
+		return resp
+	}
+
+	resp = util.Message(true, http.StatusOK, "You have successfully revoked the token.", errors)
+
+	return resp
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
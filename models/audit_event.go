@@ -0,0 +1,98 @@
+package models
+
+import (
+	"encoding/json"
+	"github.com/jinzhu/gorm"
+	"github.com/satori/go.uuid"
+)
+
+// Actions of the audit events
+const (
+	AuditPasswordChanged = "password.changed"
+	AuditPasswordReset   = "password.reset"
+
+	AuditAccountCreated           = "account.created"
+	AuditDataExported             = "account.exported"
+	AuditAccountDeletionRequested = "account.deletion_requested"
+	AuditAccountDeletionCancelled = "account.deletion_cancelled"
+	AuditAccountDeleted           = "account.deleted"
+
+	AuditImpersonationStarted = "impersonation.started"
+	AuditImpersonationEnded   = "impersonation.ended"
+	AuditImpersonatedRequest  = "impersonation.request"
+
+	AuditMemberRoleChanged  = "member.role_changed"
+	AuditMemberRemoved      = "member.removed"
+	AuditMemberLeft         = "member.left"
+	AuditMemberJoined       = "member.joined"
+	AuditMemberRoleFallback = "member.role_fallback" // The role of the invitation was deleted, the default role is given instead
+
+	AuditOwnershipTransferRequested = "company.ownership_transfer_requested"
+	AuditOwnershipTransferCancelled = "company.ownership_transfer_cancelled"
+	AuditOwnershipTransferDeclined  = "company.ownership_transfer_declined"
+	AuditOwnershipTransferred       = "company.ownership_transferred"
+
+	AuditCompanyDeleted  = "company.deleted"
+	AuditCompanyRestored = "company.restored"
+	AuditCompanyPurged   = "company.purged"
+)
+
+// Security relevant action taken on the account of the user, kept for the investigation
+type AuditEvent struct {
+	Base
+	UserID    *uuid.UUID `json:"userId" gorm:"type:uuid;index"`    // The user affected by the action
+	ActorID   *uuid.UUID `json:"actorId" gorm:"type:uuid;index"`   // The user who took the action, if different from the affected user
+	CompanyID *uuid.UUID `json:"companyId" gorm:"type:uuid;index"` // The company that the action belongs to, if any
+	Action    string     `json:"action" gorm:"not null;index"`
+	IP        string     `json:"ip"`
+	UserAgent string     `json:"userAgent"`
+	Data      string     `json:"data" sql:"type:text"` // Details of the action in JSON
+}
+
+// Record the audit event of the action on the user, within the transaction of the action
+// The superuser impersonating the user is recorded as the actor
+func RecordAuditEvent(db *gorm.DB, action string, userId *uuid.UUID, client Client, data map[string]interface{}) error {
+	event := &AuditEvent{
+		UserID:    userId,
+		ActorID:   client.ImpersonatorID,
+		Action:    action,
+		IP:        client.IP,
+		UserAgent: truncate(client.UserAgent, 255),
+	}
+
+	return createAuditEvent(db, event, data)
+}
+
+// Record the audit event of the action taken by the actor on the user within the company
+// The superuser impersonating the actor is kept in the data of the event
+func RecordCompanyAuditEvent(db *gorm.DB, action string, companyId, userId, actorId uuid.UUID, client Client, data map[string]interface{}) error {
+	event := &AuditEvent{
+		UserID:    &userId,
+		ActorID:   &actorId,
+		CompanyID: &companyId,
+		Action:    action,
+		IP:        client.IP,
+		UserAgent: truncate(client.UserAgent, 255),
+	}
+
+	if client.ImpersonatorID != nil {
+		if data == nil {
+			data = map[string]interface{}{}
+		}
+		data["impersonatorId"] = *client.ImpersonatorID
+	}
+
+	return createAuditEvent(db, event, data)
+}
+
+func createAuditEvent(db *gorm.DB, event *AuditEvent, data map[string]interface{}) error {
+	if len(data) > 0 {
+		encoded, err := json.Marshal(data)
+		if err != nil {
+			return err
+		}
+		event.Data = string(encoded)
+	}
+
+	return db.Create(event).Error
+}
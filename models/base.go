@@ -9,6 +9,7 @@ import (
 	"time"
 	"log"
 	"fmt"
+	"strings"
 )
 
 var db *gorm.DB // database
@@ -54,6 +55,26 @@ func migrateDatabase() {
 		&Role{},
 		&CompanyUser{},
 		&CompanyInvitationRequest{},
+		&RefreshToken{},
+		&RevokedToken{},
+		&EmailOutbox{},
+		&RecoveryCode{},
+		&TwoFactorChallenge{},
+		&VerificationToken{},
+		&UserIdentity{},
+		&CompanySSO{},
+		&APIToken{},
+		&Session{},
+		&SigningKey{},
+		&CompanyPasswordPolicy{},
+		&PasswordHistory{},
+		&AuditEvent{},
+		&Impersonation{},
+		&CompanyOwnershipTransfer{},
+		&Team{},
+		&TeamUser{},
+		&CompanyJoinLink{},
+		&CompanyDomain{},
 	) 
 
 	// Migration scripts
@@ -63,8 +84,59 @@ func migrateDatabase() {
 	db.Model(&CompanyUser{}).AddForeignKey("role_id", "roles(id)", "RESTRICT", "RESTRICT")
 	db.Model(&CompanyInvitationRequest{}).AddForeignKey("company_id", "companies(id)", "CASCADE", "RESTRICT")
 	db.Model(&CompanyInvitationRequest{}).AddForeignKey("user_id", "users(id)", "SET NULL", "RESTRICT")
+	db.Model(&RefreshToken{}).AddForeignKey("user_id", "users(id)", "CASCADE", "RESTRICT")
+	db.Model(&EmailOutbox{}).AddForeignKey("company_id", "companies(id)", "SET NULL", "RESTRICT")
+	db.Model(&RecoveryCode{}).AddForeignKey("user_id", "users(id)", "CASCADE", "RESTRICT")
+	db.Model(&TwoFactorChallenge{}).AddForeignKey("user_id", "users(id)", "CASCADE", "RESTRICT")
+	db.Model(&VerificationToken{}).AddForeignKey("user_id", "users(id)", "CASCADE", "RESTRICT")
+	db.Model(&UserIdentity{}).AddForeignKey("user_id", "users(id)", "CASCADE", "RESTRICT")
+	db.Model(&CompanySSO{}).AddForeignKey("company_id", "companies(id)", "CASCADE", "RESTRICT")
+	db.Model(&APIToken{}).AddForeignKey("user_id", "users(id)", "CASCADE", "RESTRICT")
+	db.Model(&APIToken{}).AddForeignKey("company_id", "companies(id)", "CASCADE", "RESTRICT")
+	db.Model(&Session{}).AddForeignKey("user_id", "users(id)", "CASCADE", "RESTRICT")
+	db.Model(&CompanyPasswordPolicy{}).AddForeignKey("company_id", "companies(id)", "CASCADE", "RESTRICT")
+	db.Model(&PasswordHistory{}).AddForeignKey("user_id", "users(id)", "CASCADE", "RESTRICT")
+	db.Model(&AuditEvent{}).AddForeignKey("user_id", "users(id)", "SET NULL", "RESTRICT")
+	db.Model(&AuditEvent{}).AddForeignKey("actor_id", "users(id)", "SET NULL", "RESTRICT")
+	db.Model(&AuditEvent{}).AddForeignKey("company_id", "companies(id)", "SET NULL", "RESTRICT")
+	db.Model(&Impersonation{}).AddForeignKey("impersonator_id", "users(id)", "CASCADE", "RESTRICT")
+	db.Model(&Impersonation{}).AddForeignKey("user_id", "users(id)", "CASCADE", "RESTRICT")
+	db.Model(&Company{}).AddForeignKey("owner_id", "users(id)", "SET NULL", "RESTRICT")
+	db.Model(&CompanyInvitationRequest{}).AddForeignKey("role_id", "roles(id)", "SET NULL", "RESTRICT")
+	db.Model(&Team{}).AddForeignKey("company_id", "companies(id)", "CASCADE", "RESTRICT")
+	db.Model(&TeamUser{}).AddForeignKey("team_id", "teams(id)", "CASCADE", "RESTRICT")
+	db.Model(&TeamUser{}).AddForeignKey("user_id", "users(id)", "CASCADE", "RESTRICT")
+	db.Model(&CompanyOwnershipTransfer{}).AddForeignKey("company_id", "companies(id)", "CASCADE", "RESTRICT")
+	db.Model(&CompanyOwnershipTransfer{}).AddForeignKey("from_user_id", "users(id)", "CASCADE", "RESTRICT")
+	db.Model(&CompanyOwnershipTransfer{}).AddForeignKey("to_user_id", "users(id)", "CASCADE", "RESTRICT")
+	db.Model(&CompanyJoinLink{}).AddForeignKey("company_id", "companies(id)", "CASCADE", "RESTRICT")
+	db.Model(&CompanyJoinLink{}).AddForeignKey("creator_id", "users(id)", "SET NULL", "RESTRICT")
+	db.Model(&CompanyJoinLink{}).AddForeignKey("role_id", "roles(id)", "SET NULL", "RESTRICT")
+	db.Model(&CompanyDomain{}).AddForeignKey("company_id", "companies(id)", "CASCADE", "RESTRICT")
+	db.Model(&CompanyDomain{}).AddForeignKey("role_id", "roles(id)", "SET NULL", "RESTRICT")
+	db.Model(&CompanyInvitationRequest{}).AddForeignKey("join_link_id", "company_join_links(id)", "SET NULL", "RESTRICT")
 	db.Model(&User{}).DropColumn("birthday_string")
 	db.Model(&User{}).DropColumn("token")
+
+	// The accounts activated before the verification tokens have no activation code left
+	if db.Dialect().HasColumn("users", "activation_code") {
+		db.Exec("UPDATE users SET activated_at = created_at WHERE activated_at IS NULL AND activation_code IS NULL")
+	}
+	db.Model(&User{}).DropColumn("activation_code")
+	db.Model(&User{}).DropColumn("reset_password_code")
+	db.Model(&User{}).DropColumn("reset_password_expiry_dt")
+
+	// The roles created before the permissions, the member roles get the default permissions and become the default role
+	db.Exec("UPDATE roles SET permissions = ? WHERE permissions IS NULL AND is_admin = ?", strings.Join(DefaultMemberPermissions, " "), false)
+	db.Exec("UPDATE roles SET is_default = ? WHERE is_admin = ? AND company_id NOT IN (SELECT company_id FROM roles WHERE is_default = ?)", true, false, true)
+
+	// The companies created before the owners are owned by their longest-standing admin, and only the owner can delete the company
+	db.Exec(`UPDATE companies SET owner_id = (SELECT CU.user_id FROM company_users CU JOIN roles R ON R.id = CU.role_id JOIN users U ON U.id = CU.user_id
+		WHERE CU.company_id = companies.id AND R.is_admin = ? ORDER BY U.created_at ASC LIMIT 1) WHERE owner_id IS NULL`, true)
+	// The invitations sent before the expiry are valid for the default number of days from now, so that they do not expire at once
+	db.Exec(fmt.Sprintf("UPDATE company_invitation_requests SET expires_at = NOW() + INTERVAL '%d days', sent_at = created_at WHERE expires_at IS NULL", invitationExpiryDays))
+	// The emails that are no longer pending do not keep their bodies with the links
+	db.Exec("UPDATE email_outbox SET text_body = '', html_body = '' WHERE status <> ? AND (text_body <> '' OR html_body <> '')", emailPending)
 }
 
 func GetDB() *gorm.DB {
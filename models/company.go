@@ -2,10 +2,15 @@ package models
 
 import (
 	"errors"
+	"app/mailer"
 	util "app/utils"
 	"net/http"
 	"github.com/jinzhu/gorm"
 	"github.com/satori/go.uuid"
+	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type Company struct {
@@ -17,6 +22,9 @@ type Company struct {
 	Phone string
 	Fax string
 	Address string
+	RequireTwoFactor bool `gorm:"default:false"`
+	OwnerID *uuid.UUID `gorm:"type:uuid"` // The member who can delete and hand over the company
+	InvitationExpiryDays int // Number of days the invitations are valid, the default of the environment is used if not set
 	Roles []Role `gorm:"foreignkey:CompanyID"`
 	Users []User `gorm:"many2many:company_users"`
 	CompanyUsers []CompanyUser `gorm:"foreignkey:CompanyID"`
@@ -77,6 +85,12 @@ func (user User) CreateCompany(company *Company) (map[string] interface{}) {
 	var errors []string
 	var resp map[string] interface{}
 	
+	// The account that is about to be deleted cannot become the owner of a company
+	if user.DeletionScheduledAt != nil {
+		resp = util.Message(false, http.StatusUnprocessableEntity, "Your account is scheduled for deletion. Please cancel the deletion before creating a company.", errors)
+		return resp
+	}
+
 	// Validate the input first
 	if resp, ok := company.Validate(); !ok {
 		return resp;
@@ -107,6 +121,8 @@ func (company *Company) ShowCompany(id, userId uuid.UUID) (map[string] interface
 		user := GetUser(userId)
 		resp["data"] = company
 		resp["isAdmin"] = user.IsAdmin(company)
+		resp["isOwner"] = company.IsOwner(userId)
+		resp["permissions"] = user.GetPermissions(company)
 	}
 	
 	return resp
@@ -124,6 +140,8 @@ func (company *Company) EditCompany() (map[string] interface{}) {
 	
 	db := GetDB()
 	db.Model(&company).Updates(company)
+	// The zero expiry is not updated with the rest, and it resets the expiry to the default
+	db.Model(&company).Update("InvitationExpiryDays", company.InvitationExpiryDays)
 	defer db.Close()
 
 	resp = util.Message(true, http.StatusOK, "You have successfully updated company details.", errors)
@@ -132,22 +150,43 @@ func (company *Company) EditCompany() (map[string] interface{}) {
 	return resp
 }
 
-// Delete the company
-func (company *Company) DeleteCompany() (map[string] interface{}) {
+// Delete the company, it is kept in the trash to be restored until the retention has passed
+func (company *Company) DeleteCompany(user *User, client Client) (map[string] interface{}) {
 	var errors []string
 	var resp map[string] interface{}
 	
 	db := GetDB()
-	db.Delete(&company)
 	defer db.Close()
 
-	resp = util.Message(true, http.StatusOK, "You have successfully deleted the company.", errors)
+	tx := db.Begin()
+	err := tx.Delete(&company).Error
+
+	if err == nil {
+		err = cancelOwnershipTransfers(tx, company.ID)
+	}
+
+	if err == nil {
+		err = RecordCompanyAuditEvent(tx, AuditCompanyDeleted, company.ID, user.ID, user.ID, client, nil)
+	}
+
+	if err != nil {
+		tx.Rollback()
+		resp = util.Message(false, http.StatusInternalServerError, "Failed to delete the company, connection error.", errors)
+		return resp
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		resp = util.Message(false, http.StatusInternalServerError, "Failed to delete the company, connection error.", errors)
+		return resp
+	}
+
+	resp = util.Message(true, http.StatusOK, "You have successfully deleted the company. It can be restored within " + strconv.Itoa(companyRetention()) + " days.", errors)
 
 	return resp
 }
 
-// Send the invitation to emails to join the company
-func (company *Company) InviteToCompany(email string, message string, senderId uuid.UUID) (map[string] interface{}) {
+// Send the invitation to emails to join the company, with the role and the teams given on joining
+func (company *Company) InviteToCompany(email string, message string, senderId uuid.UUID, roleId *uuid.UUID, teamIds []uuid.UUID) (map[string] interface{}) {
 	var errors []string
 	var resp map[string] interface{}
 
@@ -159,18 +198,35 @@ func (company *Company) InviteToCompany(email string, message string, senderId u
 	companyInvitationRequest := CompanyInvitationRequest{}
 	db.Table("company_invitation_requests").Where("company_id = ? and email = ?", company.ID, email).First(&companyInvitationRequest)
 
+	// The email that has been removed, has left or whose invitation is no longer valid can be invited again with the same invitation
+	// The invitation also supersedes the request to join of the email
+	rejoin := false
+	switch companyInvitationRequest.Status {
+	case InvitationRemoved, InvitationLeft, InvitationExpired, InvitationRevoked, InvitationRequested:
+		rejoin = true
+	case InvitationPending:
+		rejoin = companyInvitationRequest.ExpiresAt != nil && companyInvitationRequest.ExpiresAt.Before(time.Now())
+	}
+
 	// If email is not in the company and not in the invitation list, create the invitation
-	if(companyUser.UserID == uuid.Nil && companyInvitationRequest.Email == "") {
+	if(companyUser.UserID == uuid.Nil && (companyInvitationRequest.Email == "" || rejoin)) {
 		companyInvitationRequest := CompanyInvitationRequest{
+			Base: companyInvitationRequest.Base,
 			CompanyID: company.ID,
 			Email: email,
 			Message: message,
 			SenderID: &senderId,
+			RoleID: roleId,
+			Source: JoinSourceInvitation,
 		}
+		companyInvitationRequest.SetTeamIDs(teamIds)
 
-		db.Create(&companyInvitationRequest)
-		resp = util.Message(true, http.StatusOK, "You have successfully invited " + email + " to the company.", errors)
-		resp["data"] = companyInvitationRequest
+		if err := company.createInvitationTransaction(&companyInvitationRequest); err != nil {
+			resp = util.Message(false, http.StatusInternalServerError, "Failed to invite " + email + " to the company, connection error.", errors)
+		} else {
+			resp = util.Message(true, http.StatusOK, "You have successfully invited " + email + " to the company.", errors)
+			resp["data"] = companyInvitationRequest
+		}
 	} else {
 		resp = util.Message(false, http.StatusOK, "The user with the email " + email + " is already part of the company.", errors)
 	}
@@ -320,6 +376,8 @@ func CreateCompanyTransaction(user User, company *Company) error {
 	  return err
 	}
   
+	// The creator owns the company
+	company.OwnerID = &user.ID
 	if err := tx.Create(&company).Error; err != nil {
 	   tx.Rollback()
 	   return err
@@ -327,7 +385,7 @@ func CreateCompanyTransaction(user User, company *Company) error {
 
 	// Attach the admin & user roles as well
 	admin := Role{Name: "Admin", IsAdmin: true, CompanyID: company.ID}
-	normalUser := Role{Name: "User", CompanyID: company.ID}
+	normalUser := Role{Name: "User", IsDefault: true, Permissions: strings.Join(DefaultMemberPermissions, " "), CompanyID: company.ID}
 
 	if err := tx.Create(&admin).Error; err != nil {
 		tx.Rollback()
@@ -358,4 +416,91 @@ func CreateCompanyTransaction(user User, company *Company) error {
 	}
 	
 	return tx.Commit().Error
-}
\ No newline at end of file
+}
+
+// The database transaction to create the invitation and queue the invitation email
+func (company *Company) createInvitationTransaction(invitation *CompanyInvitationRequest) error {
+	sender := GetUser(*invitation.SenderID)
+	if sender == nil {
+		return errors.New("The sender of the invitation does not exist.")
+	}
+
+	db := GetDB()
+
+	defer db.Close()
+	// Note the use of tx as the database handle once you are within a transaction
+	tx := db.Begin()
+
+	defer func() {
+	  if r := recover(); r != nil {
+		tx.Rollback()
+	  }
+	}()
+
+	if err := tx.Error; err != nil {
+	  return err
+	}
+
+	// Reset the previous invitation of the email that can be invited again
+	if invitation.ID != uuid.Nil {
+		invitation.Status = InvitationPending
+		invitation.UserID = nil
+		if err := tx.Save(invitation).Error; err != nil {
+			tx.Rollback()
+			return err
+		}
+	} else if err := tx.Create(invitation).Error; err != nil {
+	   tx.Rollback()
+	   return err
+	}
+
+	if err := company.sendInvitation(tx, invitation, sender); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit().Error
+}
+
+// Email the invitation with a fresh link, the invitation expires after the lifetime configured by the company from now on
+func (company *Company) sendInvitation(tx *gorm.DB, invitation *CompanyInvitationRequest, sender *User) error {
+	now := time.Now()
+	expiresAt := now.AddDate(0, 0, company.invitationExpiry())
+
+	token, err := createVerificationToken(tx, PurposeInvitation, nil, &invitation.ID, "", expiresAt)
+	if err != nil {
+		return err
+	}
+
+	msg, err := mailer.NewInvitationEmail(invitation.Email, company.Name, sender.Name, sender.Email, invitation.Message, token, expiresAt)
+	if err != nil {
+		return err
+	}
+
+	if err := QueueEmail(tx, &company.ID, msg); err != nil {
+		return err
+	}
+
+	invitation.ExpiresAt = &expiresAt
+	invitation.SentAt = &now
+	invitation.RemindedAt = nil
+
+	return tx.Model(invitation).Updates(map[string]interface{}{
+		"ExpiresAt":  invitation.ExpiresAt,
+		"SentAt":     invitation.SentAt,
+		"RemindedAt": nil,
+	}).Error
+}
+
+// Get the number of days the invitations of the company are valid, the company setting overrides the environment
+func (company *Company) invitationExpiry() int {
+	if company.InvitationExpiryDays > 0 {
+		return company.InvitationExpiryDays
+	}
+
+	if days, err := strconv.Atoi(os.Getenv("invitation_expiry_days")); err == nil && days > 0 {
+		return days
+	}
+
+	return invitationExpiryDays
+}
@@ -0,0 +1,339 @@
+package models
+
+import (
+	util "app/utils"
+	"context"
+	"github.com/jinzhu/gorm"
+	"github.com/satori/go.uuid"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	domainVerificationPrefix = "go-application-verification=" // Prefix of the DNS TXT record that verifies the domain
+	domainLookupTimeout      = time.Second * 5                // How long the DNS lookup of the domain can take
+	joinRequestCooldown      = time.Hour * 24 * 30            // How long the user waits to request again after the request is declined
+)
+
+// Email domain of the company, the users with the email of the verified domain can join or request to join the company
+type CompanyDomain struct {
+	Base
+	CompanyID          uuid.UUID  `json:"companyId" gorm:"type:uuid;not null;index"`
+	Domain             string     `json:"domain" gorm:"not null;index"`
+	VerificationCode   string     `json:"-" gorm:"not null"`
+	VerificationRecord string     `json:"verificationRecord" gorm:"-"` // The DNS TXT record to add to the domain to verify it
+	VerifiedAt         *time.Time `json:"verifiedAt"`
+	AutoJoin           bool       `json:"autoJoin" gorm:"default:false"` // Join right away instead of requesting to join
+	RoleID             *uuid.UUID `json:"roleId" gorm:"type:uuid"`       // The role given on joining, the default role of the company if not set
+}
+
+// Company that the user can join or request to join with the email domain
+type JoinableCompanyOutput struct {
+	ID       uuid.UUID `json:"id"`
+	Name     string    `json:"name"`
+	Slug     string    `json:"slug"`
+	AutoJoin bool      `json:"autoJoin"`
+}
+
+// Get the email domains of the company
+func (company *Company) GetDomains() map[string]interface{} {
+	var errors []string
+	var resp map[string]interface{}
+
+	domains := []CompanyDomain{}
+	db := GetDB()
+	db.Where("company_id = ?", company.ID).Order("domain asc").Find(&domains)
+	defer db.Close()
+
+	for i := range domains {
+		domains[i].setVerificationRecord()
+	}
+
+	resp = util.Message(true, http.StatusOK, "You have successfully retrieved the email domains of the company.", errors)
+	resp["data"] = domains
+
+	return resp
+}
+
+// Add the email domain to the company, the domain has to be verified before the users can join with it
+func (company *Company) AddDomain(creator *User, input *CompanyDomain) map[string]interface{} {
+	var errors []string
+	var resp map[string]interface{}
+
+	input.Domain = strings.TrimPrefix(strings.ToLower(strings.TrimSpace(input.Domain)), "@")
+	if !strings.Contains(input.Domain, ".") || strings.ContainsAny(input.Domain, " @/") {
+		errors = append(errors, "The email domain is invalid.")
+		resp = util.Message(false, http.StatusUnprocessableEntity, "Validation error", errors)
+		return resp
+	}
+
+	if resp, ok := company.ValidateInvitationGrant(creator, input.RoleID, nil); !ok {
+		return resp
+	}
+
+	db := GetDB()
+	defer db.Close()
+
+	count := 0
+	db.Model(CompanyDomain{}).Where("company_id = ? AND domain = ?", company.ID, input.Domain).Count(&count)
+	if count > 0 {
+		resp = util.Message(false, http.StatusUnprocessableEntity, "The email domain has already been added.", errors)
+		return resp
+	}
+
+	code, err := util.GenerateRandomToken(16)
+	if err != nil {
+		resp = util.Message(false, http.StatusInternalServerError, "Failed to add the email domain, please try again.", errors)
+		return resp
+	}
+
+	domain := &CompanyDomain{
+		CompanyID:        company.ID,
+		Domain:           input.Domain,
+		VerificationCode: code,
+		AutoJoin:         input.AutoJoin,
+		RoleID:           input.RoleID,
+	}
+
+	if err := db.Create(domain).Error; err != nil {
+		resp = util.Message(false, http.StatusInternalServerError, "Failed to add the email domain, connection error.", errors)
+		return resp
+	}
+
+	domain.setVerificationRecord()
+
+	resp = util.Message(true, http.StatusOK, "You have successfully added the email domain. Add the TXT record to the DNS of the domain to verify it.", errors)
+	resp["data"] = domain
+
+	return resp
+}
+
+// Update how the users with the email domain join the company
+func (company *Company) UpdateDomain(updater *User, domainId uuid.UUID, input *CompanyDomain) map[string]interface{} {
+	var errors []string
+	var resp map[string]interface{}
+
+	db := GetDB()
+	defer db.Close()
+
+	domain := company.getDomain(db, domainId)
+	if domain == nil {
+		resp = util.Message(false, http.StatusUnprocessableEntity, "No available result.", errors)
+		return resp
+	}
+
+	if resp, ok := company.ValidateInvitationGrant(updater, input.RoleID, nil); !ok {
+		return resp
+	}
+
+	err := db.Model(domain).Updates(map[string]interface{}{
+		"AutoJoin": input.AutoJoin,
+		"RoleID":   input.RoleID,
+	}).Error
+
+	if err != nil {
+		resp = util.Message(false, http.StatusInternalServerError, "Failed to update the email domain, connection error.", errors)
+		return resp
+	}
+
+	domain.AutoJoin = input.AutoJoin
+	domain.RoleID = input.RoleID
+
+	resp = util.Message(true, http.StatusOK, "You have successfully updated the email domain.", errors)
+	resp["data"] = domain
+
+	return resp
+}
+
+// Verify the email domain by looking up the TXT record of the domain
+func (company *Company) VerifyDomain(domainId uuid.UUID) map[string]interface{} {
+	var errors []string
+	var resp map[string]interface{}
+
+	db := GetDB()
+	defer db.Close()
+
+	domain := company.getDomain(db, domainId)
+	if domain == nil {
+		resp = util.Message(false, http.StatusUnprocessableEntity, "No available result.", errors)
+		return resp
+	}
+
+	if domain.VerifiedAt != nil {
+		resp = util.Message(false, http.StatusUnprocessableEntity, "The email domain has already been verified.", errors)
+		return resp
+	}
+
+	// The email domain can only be verified by one company
+	count := 0
+	db.Model(CompanyDomain{}).Where("domain = ? AND company_id <> ? AND verified_at IS NOT NULL", domain.Domain, company.ID).Count(&count)
+	if count > 0 {
+		resp = util.Message(false, http.StatusUnprocessableEntity, "The email domain has been verified by another company.", errors)
+		return resp
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), domainLookupTimeout)
+	defer cancel()
+
+	records, _ := net.DefaultResolver.LookupTXT(ctx, domain.Domain)
+	if !contains(records, domain.VerificationRecord) {
+		resp = util.Message(false, http.StatusUnprocessableEntity, "The TXT record "+domain.VerificationRecord+" is not found in the DNS of "+domain.Domain+". It may take a while for the DNS changes to take effect.", errors)
+		return resp
+	}
+
+	now := time.Now()
+	if err := db.Model(domain).Update("VerifiedAt", now).Error; err != nil {
+		resp = util.Message(false, http.StatusInternalServerError, "Failed to verify the email domain, connection error.", errors)
+		return resp
+	}
+
+	domain.VerifiedAt = &now
+
+	resp = util.Message(true, http.StatusOK, "You have successfully verified the email domain.", errors)
+	resp["data"] = domain
+
+	return resp
+}
+
+// Delete the email domain of the company, the users with the email domain can no longer join with it
+func (company *Company) DeleteDomain(domainId uuid.UUID) map[string]interface{} {
+	var errors []string
+	var resp map[string]interface{}
+
+	db := GetDB()
+	result := db.Where("id = ? AND company_id = ?", domainId, company.ID).Delete(CompanyDomain{})
+	defer db.Close()
+
+	if result.Error != nil || result.RowsAffected == 0 {
+		resp = util.Message(false, http.StatusUnprocessableEntity, "No available result.", errors)
+		return resp
+	}
+
+	resp = util.Message(true, http.StatusOK, "You have successfully deleted the email domain.", errors)
+
+	return resp
+}
+
+// Get the companies that the user can join or request to join with the email domain
+func (user *User) GetJoinableCompanies() map[string]interface{} {
+	var errors []string
+	var resp map[string]interface{}
+
+	companies := []JoinableCompanyOutput{}
+
+	db := GetDB()
+	db.Table("company_domains").
+		Joins("JOIN companies ON companies.id = company_domains.company_id").
+		Select("companies.id, companies.name, companies.slug, company_domains.auto_join").
+		Where("company_domains.domain = ? AND company_domains.verified_at IS NOT NULL AND company_domains.deleted_at IS NULL AND companies.deleted_at IS NULL", emailDomain(user.Email)).
+		Where("companies.id NOT IN (SELECT company_id FROM company_users WHERE user_id = ?)", user.ID).
+		Order("companies.name asc").
+		Scan(&companies)
+
+	defer db.Close()
+
+	resp = util.Message(true, http.StatusOK, "You have successfully retrieved the companies that you can join.", errors)
+	resp["data"] = companies
+
+	return resp
+}
+
+// Join the company with the verified email domain of the user, or request to join if the company approves the members
+func (user *User) JoinCompanyByDomain(company *Company, client Client) map[string]interface{} {
+	var errors []string
+	var resp map[string]interface{}
+
+	db := GetDB()
+	defer db.Close()
+
+	domain := CompanyDomain{}
+	db.Where("company_id = ? AND domain = ? AND verified_at IS NOT NULL", company.ID, emailDomain(user.Email)).First(&domain)
+
+	if domain.ID == uuid.Nil {
+		resp = util.Message(false, http.StatusForbidden, "You cannot join the company with your email address. Please ask for an invitation.", errors)
+		return resp
+	}
+
+	if resp, ok := company.canAdmit(db, user); !ok {
+		return resp
+	}
+
+	invitation := &CompanyInvitationRequest{
+		Status: InvitationRequested,
+		RoleID: domain.RoleID,
+		Source: JoinSourceDomain,
+	}
+
+	existing := CompanyInvitationRequest{}
+	db.Where("company_id = ? AND email = ? AND status = ?", company.ID, user.Email, InvitationRequested).First(&existing)
+	if existing.ID != uuid.Nil && !domain.AutoJoin {
+		resp = util.Message(false, http.StatusUnprocessableEntity, "You have already requested to join the company.", errors)
+		return resp
+	}
+
+	// The declined user cannot keep requesting to join the company
+	declined := CompanyInvitationRequest{}
+	db.Where("company_id = ? AND email = ? AND status = ? AND source = ? AND updated_at > ?", company.ID, user.Email, InvitationDeclined, JoinSourceDomain, time.Now().Add(-joinRequestCooldown)).
+		Order("updated_at desc").
+		First(&declined)
+	if declined.ID != uuid.Nil && !domain.AutoJoin {
+		resp = util.Message(false, http.StatusTooManyRequests, "Your request to join the company has been declined. You can request again after "+declined.UpdatedAt.Add(joinRequestCooldown).Format("02 Jan 2006")+".", errors)
+		return resp
+	}
+
+	if domain.AutoJoin {
+		invitation.Status = InvitationJoined
+	}
+
+	tx := db.Begin()
+	if err := company.admit(tx, user, invitation, client); err != nil {
+		tx.Rollback()
+		resp = util.Message(false, http.StatusInternalServerError, "Failed to join the company, connection error.", errors)
+		return resp
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		resp = util.Message(false, http.StatusInternalServerError, "Failed to join the company, connection error.", errors)
+		return resp
+	}
+
+	if invitation.Status == InvitationRequested {
+		resp = util.Message(true, http.StatusOK, "You have successfully requested to join "+company.Name+". You will be able to access the company once the request is approved.", errors)
+		resp["data"] = invitation
+		return resp
+	}
+
+	resp = util.Message(true, http.StatusOK, "You have successfully joined "+company.Name+".", errors)
+	resp["data"] = invitation
+	resp["company"] = company
+
+	return resp
+}
+
+// Check if the company has verified the ownership of the email domain
+func (company *Company) hasVerifiedDomain(db *gorm.DB, domain string) bool {
+	count := 0
+	db.Model(CompanyDomain{}).Where("company_id = ? AND domain = ? AND verified_at IS NOT NULL", company.ID, domain).Count(&count)
+
+	return count > 0
+}
+
+// Get the email domain of the company
+func (company *Company) getDomain(db *gorm.DB, domainId uuid.UUID) *CompanyDomain {
+	domain := &CompanyDomain{}
+	db.Where("id = ? AND company_id = ?", domainId, company.ID).First(domain)
+
+	if domain.ID == uuid.Nil {
+		return nil
+	}
+
+	domain.setVerificationRecord()
+
+	return domain
+}
+
+func (domain *CompanyDomain) setVerificationRecord() {
+	domain.VerificationRecord = domainVerificationPrefix + domain.VerificationCode
+}
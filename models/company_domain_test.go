@@ -0,0 +1,68 @@
+package models
+
+import (
+	"github.com/satori/go.uuid"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestJoinCompanyByDomain(t *testing.T) {
+	db := testDB(t)
+	defer db.Close()
+
+	admin := createTestUser(t, db, "Password123!")
+	defer deleteTestUser(db, admin)
+
+	company, _, _ := createTestCompany(t, db, admin)
+	defer deleteTestCompany(db, company)
+	defer db.Where("company_id = ?", company.ID).Delete(AuditEvent{})
+
+	domainName := "join-" + uuid.NewV4().String() + ".test"
+	now := time.Now()
+	domain := &CompanyDomain{CompanyID: company.ID, Domain: domainName, VerificationCode: "code", VerifiedAt: &now}
+	db.Create(domain)
+	defer db.Unscoped().Delete(domain)
+
+	user := createTestUser(t, db, "Password123!")
+	defer deleteTestUser(db, user)
+	db.Model(user).Update("Email", "test-"+uuid.NewV4().String()+"@"+domainName)
+
+	tests := []struct {
+		name     string
+		prepare  func()
+		status   int
+		requests int // Number of the records of the email kept in the company
+	}{
+		{"request", func() {}, http.StatusOK, 1},
+		{"request again", func() {}, http.StatusUnprocessableEntity, 1},
+		{"request after the decline", func() {
+			db.Model(CompanyInvitationRequest{}).Where("company_id = ? AND email = ?", company.ID, user.Email).Update("Status", InvitationDeclined)
+		}, http.StatusTooManyRequests, 1},
+		{"join with the auto join", func() {
+			db.Model(domain).Update("AutoJoin", true)
+		}, http.StatusOK, 2},
+	}
+
+	for _, test := range tests {
+		test.prepare()
+
+		resp := user.JoinCompanyByDomain(company, testClient)
+		if resp["status"] != test.status {
+			t.Errorf("%s: JoinCompanyByDomain() status = %v, want %v", test.name, resp["status"], test.status)
+		}
+
+		count := 0
+		db.Model(CompanyInvitationRequest{}).Where("company_id = ? AND email = ?", company.ID, user.Email).Count(&count)
+		if count != test.requests {
+			t.Errorf("%s: %d record(s) of the email, want %d", test.name, count, test.requests)
+		}
+	}
+
+	// The decline is kept in the history after joining
+	count := 0
+	db.Model(CompanyInvitationRequest{}).Where("company_id = ? AND email = ? AND status = ?", company.ID, user.Email, InvitationDeclined).Count(&count)
+	if count != 1 {
+		t.Errorf("%d declined request(s) kept, want 1", count)
+	}
+}
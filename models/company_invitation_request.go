@@ -3,18 +3,28 @@ package models
 import (
 	util "app/utils"
 	"errors"
+	"github.com/jinzhu/gorm"
 	"github.com/satori/go.uuid"
 	"net/http"
+	"strings"
+	"time"
 )
 
 type CompanyInvitationRequest struct {
 	Base
-	CompanyID uuid.UUID `gorm:"type:uuid;not null;primary_key"`
-	Email     string    `gorm:"not null;primary_key"`
-	Message   string
-	SenderID  *uuid.UUID `gorm:"type:uuid"`
-	Status    int        `gorm:"default:'0'"`
-	UserID    *uuid.UUID `gorm:"type:uuid"`
+	CompanyID  uuid.UUID `gorm:"type:uuid;not null;primary_key"`
+	Email      string    `gorm:"not null;primary_key"`
+	Message    string
+	SenderID   *uuid.UUID `gorm:"type:uuid"`
+	Status     int        `gorm:"default:'0'"`
+	UserID     *uuid.UUID `gorm:"type:uuid"`
+	ExpiresAt  *time.Time `gorm:"index"`
+	SentAt     *time.Time // When the invitation was last emailed, by sending or resending it
+	RemindedAt *time.Time // When the reminder was emailed before the expiry
+	RoleID     *uuid.UUID `gorm:"type:uuid"` // The role given on joining, the default role of the company if not set
+	Teams      string     `sql:"type:text"`  // Space-separated IDs of the teams joined on joining
+	Source     string     `gorm:"default:'invitation'"`
+	JoinLinkID *uuid.UUID `gorm:"type:uuid"` // The join link that the user joined with
 }
 
 type CompanyInvitationRequestOutput struct {
@@ -25,10 +35,35 @@ type CompanyInvitationRequestOutput struct {
 	Timestamp   string
 }
 
+const (
+	InvitationPending = iota
+	InvitationJoined
+	InvitationDeclined
+	InvitationRemoved // The user joined and was removed from the company afterwards
+	InvitationLeft    // The user joined and left the company afterwards
+	InvitationExpired
+	InvitationRevoked
+	InvitationRequested // The user with the email of the verified domain requested to join the company
+)
+
+// How the user came to join the company
+const (
+	JoinSourceInvitation = "invitation"
+	JoinSourceLink       = "link"
+	JoinSourceDomain     = "domain"
+)
+
+const invitationResendInterval = time.Minute // How often the invitation can be resent to the same email
+
 var InvitationStatus = []string{
 	"Awaiting response",
 	"Joined",
 	"Declined",
+	"Removed",
+	"Left",
+	"Expired",
+	"Revoked",
+	"Awaiting approval",
 }
 
 // Show the company invitation request
@@ -65,6 +100,177 @@ func (invitation *CompanyInvitationRequest) DeleteInvitation() map[string]interf
 	return resp
 }
 
+// Check if the sender can invite with the role and the teams, the sender cannot grant the permissions that the sender does not have
+func (company *Company) ValidateInvitationGrant(sender *User, roleId *uuid.UUID, teamIds []uuid.UUID) (map[string]interface{}, bool) {
+	var errors []string
+	var resp map[string]interface{}
+
+	if roleId != nil {
+		role := company.getRole(*roleId)
+		if role == nil {
+			resp = util.Message(false, http.StatusUnprocessableEntity, "The role of the invitation does not exist.", errors)
+			return resp, false
+		}
+
+		if !sender.canAssignRole(company, role) {
+			resp = util.Message(false, http.StatusForbidden, "You cannot invite with the role "+role.Name+" that has the permissions that you do not have.", errors)
+			return resp, false
+		}
+	}
+
+	if len(teamIds) > 0 {
+		if !sender.HasPermission(company, PermissionTeamsManage) {
+			resp = util.Message(false, http.StatusForbidden, "You are not allowed to add the members to the teams.", errors)
+			return resp, false
+		}
+
+		db := GetDB()
+		existing := existingTeamIds(db, company.ID, teamIds)
+		defer db.Close()
+
+		for _, teamId := range teamIds {
+			if !containsId(existing, teamId) {
+				resp = util.Message(false, http.StatusUnprocessableEntity, "The team "+teamId.String()+" of the invitation does not exist.", errors)
+				return resp, false
+			}
+		}
+	}
+
+	resp = util.Message(true, http.StatusOK, "Input has been validated.", errors)
+	return resp, true
+}
+
+// Get the IDs of the teams that the invited user joins
+func (invitation *CompanyInvitationRequest) GetTeamIDs() []uuid.UUID {
+	ids := []uuid.UUID{}
+	for _, value := range strings.Fields(invitation.Teams) {
+		if id, err := uuid.FromString(value); err == nil {
+			ids = append(ids, id)
+		}
+	}
+
+	return ids
+}
+
+// Store the IDs of the teams that the invited user joins
+func (invitation *CompanyInvitationRequest) SetTeamIDs(teamIds []uuid.UUID) {
+	values := []string{}
+	for _, id := range teamIds {
+		if !contains(values, id.String()) {
+			values = append(values, id.String())
+		}
+	}
+
+	invitation.Teams = strings.Join(values, " ")
+}
+
+func containsId(ids []uuid.UUID, id uuid.UUID) bool {
+	for _, value := range ids {
+		if value == id {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Email the invitation again with a fresh link and expiry, the invitation that has expired or has been revoked is reopened
+func (invitation *CompanyInvitationRequest) ResendInvitation(company *Company, sender *User) map[string]interface{} {
+	var errors []string
+	var resp map[string]interface{}
+
+	switch invitation.Status {
+	case InvitationPending, InvitationExpired, InvitationRevoked:
+	default:
+		resp = util.Message(false, http.StatusUnprocessableEntity, "The invitation has already been responded to.", errors)
+		return resp
+	}
+
+	if invitation.SentAt != nil && time.Since(*invitation.SentAt) < invitationResendInterval {
+		resp = util.Message(false, http.StatusTooManyRequests, "The invitation has just been sent. Please wait a minute before resending it.", errors)
+		return resp
+	}
+
+	// The invitation is now sent by the member resending it, who must be able to grant the role and the teams
+	if resp, ok := company.ValidateInvitationGrant(sender, invitation.RoleID, nil); !ok {
+		return resp
+	}
+
+	if len(invitation.GetTeamIDs()) > 0 && !sender.HasPermission(company, PermissionTeamsManage) {
+		resp = util.Message(false, http.StatusForbidden, "You are not allowed to add the members to the teams.", errors)
+		return resp
+	}
+
+	db := GetDB()
+	defer db.Close()
+
+	invitation.Status = InvitationPending
+	invitation.SenderID = &sender.ID
+
+	tx := db.Begin()
+	err := tx.Model(invitation).Updates(map[string]interface{}{
+		"Status":   invitation.Status,
+		"SenderID": invitation.SenderID,
+	}).Error
+
+	if err == nil {
+		err = company.sendInvitation(tx, invitation, sender)
+	}
+
+	if err != nil {
+		tx.Rollback()
+		resp = util.Message(false, http.StatusInternalServerError, "Failed to resend the invitation, connection error.", errors)
+		return resp
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		resp = util.Message(false, http.StatusInternalServerError, "Failed to resend the invitation, connection error.", errors)
+		return resp
+	}
+
+	resp = util.Message(true, http.StatusOK, "You have successfully resent the invitation to "+invitation.Email+".", errors)
+	resp["data"] = invitation
+
+	return resp
+}
+
+// Revoke the pending invitation, the link in the invitation email no longer works
+func (invitation *CompanyInvitationRequest) RevokeInvitation() map[string]interface{} {
+	var errors []string
+	var resp map[string]interface{}
+
+	if invitation.Status != InvitationPending {
+		resp = util.Message(false, http.StatusUnprocessableEntity, "Only the invitation awaiting response can be revoked.", errors)
+		return resp
+	}
+
+	db := GetDB()
+	defer db.Close()
+
+	tx := db.Begin()
+	err := tx.Model(invitation).Update("Status", InvitationRevoked).Error
+
+	if err == nil {
+		err = tx.Where("purpose = ? AND reference_id = ?", PurposeInvitation, invitation.ID).Delete(VerificationToken{}).Error
+	}
+
+	if err != nil {
+		tx.Rollback()
+		resp = util.Message(false, http.StatusInternalServerError, "Failed to revoke the invitation, connection error.", errors)
+		return resp
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		resp = util.Message(false, http.StatusInternalServerError, "Failed to revoke the invitation, connection error.", errors)
+		return resp
+	}
+
+	resp = util.Message(true, http.StatusOK, "You have successfully revoked the invitation to "+invitation.Email+".", errors)
+	resp["data"] = invitation
+
+	return resp
+}
+
 // Show the invitation from company
 func (invitation *CompanyInvitationRequest) GetInvitationFromCompany(id uuid.UUID) map[string]interface{} {
 	var errors []string
@@ -86,11 +292,11 @@ func (invitation *CompanyInvitationRequest) GetInvitationFromCompany(id uuid.UUI
 }
 
 // User responds to the invitation request from company
-func (invitation *CompanyInvitationRequest) RespondCompanyInvitation(user User) map[string]interface{} {
+func (invitation *CompanyInvitationRequest) RespondCompanyInvitation(user User, client Client) map[string]interface{} {
 	var errors []string
 	var resp map[string]interface{}
 
-	if err := invitation.RespondCompanyTransaction(user); err != nil {
+	if err := invitation.RespondCompanyTransaction(user, client); err != nil {
 		resp = util.Message(false, http.StatusInternalServerError, err.Error(), errors)
 		return resp
 	}
@@ -103,7 +309,7 @@ func (invitation *CompanyInvitationRequest) RespondCompanyInvitation(user User)
 }
 
 // A transaction of responding to the company invitation request
-func (invitation *CompanyInvitationRequest) RespondCompanyTransaction(user User) error {
+func (invitation *CompanyInvitationRequest) RespondCompanyTransaction(user User, client Client) error {
 	db := GetDB()
 
 	defer db.Close()
@@ -132,30 +338,228 @@ func (invitation *CompanyInvitationRequest) RespondCompanyTransaction(user User)
 
 	// Only create the company user if it's a join response
 	if invitation.Status == 1 {
-		// Get the user role ID in the company
-		userRole := Role{}
-		db.Where("company_id = ? AND is_admin = ?", invitation.CompanyID, false).First(&userRole)
-
-		if userRole.ID == uuid.Nil {
+		if err := invitation.joinCompany(tx, user.ID, user.ID, client); err != nil {
 			tx.Rollback()
-			err := errors.New("The user role is not created in the company.")
 			return err
 		}
+	}
 
-		// Associate the user to the company
-		companyUser := CompanyUser{
-			UserID:    user.ID,
-			CompanyID: invitation.CompanyID,
-			RoleID:    userRole.ID,
-		}
+	return tx.Commit().Error
+}
 
-		if err := tx.Where(companyUser).FirstOrCreate(&companyUser).Error; err != nil {
-			tx.Rollback()
+// Add the invited user to the company with the role and the teams of the invitation, the fallback to the default role
+// is recorded in the audit trail
+func (invitation *CompanyInvitationRequest) joinCompany(tx *gorm.DB, userId, actorId uuid.UUID, client Client) error {
+	// Get the role of the invitation, or the default role in the company if the role is not set or has been deleted
+	userRole := Role{}
+	if invitation.RoleID != nil {
+		tx.Where("id = ? AND company_id = ?", *invitation.RoleID, invitation.CompanyID).First(&userRole)
+	}
+
+	if userRole.ID == uuid.Nil {
+		tx.Where("company_id = ? AND is_default = ?", invitation.CompanyID, true).First(&userRole)
+	}
+
+	if userRole.ID == uuid.Nil {
+		return errors.New("The user role is not created in the company.")
+	}
+
+	// Associate the user to the company
+	companyUser := CompanyUser{
+		UserID:    userId,
+		CompanyID: invitation.CompanyID,
+		RoleID:    userRole.ID,
+	}
+
+	if err := tx.Where(companyUser).FirstOrCreate(&companyUser).Error; err != nil {
+		return err
+	}
+
+	if invitation.RoleID != nil && *invitation.RoleID != userRole.ID {
+		err := RecordCompanyAuditEvent(tx, AuditMemberRoleFallback, invitation.CompanyID, userId, actorId, client, map[string]interface{}{
+			"invitationId": invitation.ID,
+			"roleId":       invitation.RoleID,
+			"fallbackId":   userRole.ID,
+		})
+		if err != nil {
 			return err
 		}
 	}
 
-	return tx.Commit().Error
+	// Join the teams of the invitation that still exist
+	return addTeamMembers(tx, userId, existingTeamIds(tx, invitation.CompanyID, invitation.GetTeamIDs()))
+}
+
+// Sign up with the email of the invitation and join the company at once, the account is activated right away
+// as the link in the invitation email proves that the invitee owns the email
+func SignupWithInvitation(token string, user *User, client Client) map[string]interface{} {
+	var errors []string
+	var resp map[string]interface{}
+
+	db := GetDB()
+	defer db.Close()
+
+	invitation := getPendingInvitationByToken(db, token)
+	company := (*Company)(nil)
+	if invitation != nil {
+		company = GetCompanyByID(invitation.CompanyID)
+	}
+
+	if invitation == nil || company == nil {
+		resp = util.Message(false, http.StatusUnprocessableEntity, "Invalid/expired invitation link.", errors)
+		return resp
+	}
+
+	user.Email = invitation.Email
+	if GetUserByEmail(user.Email) != nil {
+		resp = util.Message(false, http.StatusUnprocessableEntity, "An account with the email "+user.Email+" already exists. Please login to accept the invitation.", errors)
+		return resp
+	}
+
+	// The members with the email domain of the company that enforces SSO sign up through the IdP instead
+	sso := CompanySSO{}
+	db.Where("company_id = ? AND email_domain = ? AND enabled = ? AND enforced = ?", company.ID, emailDomain(user.Email), true, true).First(&sso)
+	if sso.ID != uuid.Nil {
+		resp = util.Message(false, http.StatusForbidden, "The company requires you to sign up with single sign-on.", errors)
+		resp["sso"] = company.Slug
+		return resp
+	}
+
+	if errors = user.validatePassword(db, user.Password, company); len(errors) > 0 {
+		resp = util.Message(false, http.StatusUnprocessableEntity, "Validation error", errors)
+		return resp
+	}
+
+	hashedPassword, err := hashPassword(user.Password)
+	if err != nil {
+		resp = util.Message(false, http.StatusInternalServerError, "Failed to create account, connection error.", errors)
+		return resp
+	}
+
+	now := time.Now()
+	user.Password = hashedPassword
+	user.ActivatedAt = &now
+	user.Token = ""
+	user.RefreshToken = ""
+
+	tx := db.Begin()
+	err = tx.Create(user).Error
+
+	// The link can only be used once
+	if err == nil {
+		_, err = ConsumeVerificationToken(tx, PurposeInvitation, token)
+	}
+
+	// The invitation might have been responded to or withdrawn in the meantime
+	if err == nil {
+		result := tx.Model(CompanyInvitationRequest{}).
+			Where("id = ? AND status = ?", invitation.ID, InvitationPending).
+			Updates(map[string]interface{}{
+				"Status": InvitationJoined,
+				"UserID": user.ID,
+			})
+
+		err = result.Error
+		if err == nil && result.RowsAffected == 0 {
+			err = ErrInvalidVerificationToken
+		}
+	}
+
+	if err == nil {
+		invitation.Status = InvitationJoined
+		invitation.UserID = &user.ID
+		err = invitation.joinCompany(tx, user.ID, user.ID, client)
+	}
+
+	if err == nil {
+		err = RecordAuditEvent(tx, AuditAccountCreated, &user.ID, client, map[string]interface{}{
+			"invitationId": invitation.ID,
+		})
+	}
+
+	if err == nil {
+		err = RecordCompanyAuditEvent(tx, AuditMemberJoined, company.ID, user.ID, user.ID, client, map[string]interface{}{
+			"source": invitation.Source,
+		})
+	}
+
+	if err == ErrInvalidVerificationToken {
+		tx.Rollback()
+		resp = util.Message(false, http.StatusUnprocessableEntity, "Invalid/expired invitation link.", errors)
+		return resp
+	}
+
+	if err != nil {
+		tx.Rollback()
+		resp = util.Message(false, http.StatusInternalServerError, "Failed to create account, connection error.", errors)
+		return resp
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		resp = util.Message(false, http.StatusInternalServerError, "Failed to create account, connection error.", errors)
+		return resp
+	}
+
+	user.Password = "" // delete the password
+
+	resp = user.authenticated(db, client)
+	if success, _ := resp["success"].(bool); success {
+		resp["message"] = "You have successfully signed up and joined " + company.Name + "."
+		resp["company"] = company
+	}
+
+	return resp
+}
+
+// Get the invitation awaiting response by the token of the invitation link
+func getPendingInvitationByToken(db *gorm.DB, token string) *CompanyInvitationRequest {
+	verificationToken := GetVerificationToken(db, PurposeInvitation, token)
+	if verificationToken == nil || verificationToken.ReferenceID == nil {
+		return nil
+	}
+
+	invitation := &CompanyInvitationRequest{}
+	db.Where("id = ? AND status = ? AND expires_at > ?", *verificationToken.ReferenceID, InvitationPending, time.Now()).First(invitation)
+
+	if invitation.ID == uuid.Nil {
+		return nil
+	}
+
+	return invitation
+}
+
+// Show the invitation from the link in the invitation email
+func GetInvitationByToken(token string) map[string]interface{} {
+	var errors []string
+	var resp map[string]interface{}
+
+	db := GetDB()
+	defer db.Close()
+
+	verificationToken := GetVerificationToken(db, PurposeInvitation, token)
+	if verificationToken == nil || verificationToken.ReferenceID == nil {
+		resp = util.Message(false, http.StatusUnprocessableEntity, "Invalid/expired invitation link.", errors)
+		return resp
+	}
+
+	invitation := CompanyInvitationRequestOutput{}
+	db.Table("company_invitation_requests").
+		Joins("JOIN companies ON company_invitation_requests.company_id = companies.id").
+		Joins("JOIN users on company_invitation_requests.sender_id = users.id").
+		Select("company_invitation_requests.*, companies.name as company_name, users.name as sender_name, users.email as sender_email, TO_CHAR(company_invitation_requests.created_at, '"+util.DateSQLFormat+"') as timestamp").
+		Where("company_invitation_requests.id = ? AND companies.deleted_at IS NULL", *verificationToken.ReferenceID).
+		Scan(&invitation)
+
+	if invitation.ID == uuid.Nil {
+		resp = util.Message(false, http.StatusUnprocessableEntity, "Invalid/expired invitation link.", errors)
+		return resp
+	}
+
+	resp = util.Message(true, http.StatusOK, "The invitation is retrieved.", errors)
+	resp["data"] = invitation
+	resp["hasAccount"] = GetUserByEmail(invitation.Email) != nil
+
+	return resp
 }
 
 func GetCompanyInvitationRequest(invitationID uuid.UUID) *CompanyInvitationRequest {
@@ -171,3 +575,143 @@ func GetCompanyInvitationRequest(invitationID uuid.UUID) *CompanyInvitationReque
 
 	return invitation
 }
+
+// Get the requests to join the company from the users with the email of the verified domain
+func (company *Company) GetJoinRequests() map[string]interface{} {
+	var errors []string
+	var resp map[string]interface{}
+
+	requests := []CompanyInvitationRequest{}
+	db := GetDB()
+	db.Where("company_id = ? AND status = ?", company.ID, InvitationRequested).Order("created_at asc").Find(&requests)
+	defer db.Close()
+
+	resp = util.Message(true, http.StatusOK, "You have successfully retrieved the requests to join the company.", errors)
+	resp["data"] = requests
+
+	return resp
+}
+
+// Approve or decline the request to join the company, the user joins with the role of the email domain
+func (invitation *CompanyInvitationRequest) RespondJoinRequest(approver *User, approve bool, client Client) map[string]interface{} {
+	var errors []string
+	var resp map[string]interface{}
+
+	if invitation.Status != InvitationRequested || invitation.UserID == nil {
+		resp = util.Message(false, http.StatusUnprocessableEntity, "The request has already been responded to.", errors)
+		return resp
+	}
+
+	db := GetDB()
+	defer db.Close()
+
+	invitation.Status = InvitationDeclined
+	if approve {
+		invitation.Status = InvitationJoined
+	}
+
+	invitation.SenderID = &approver.ID
+
+	tx := db.Begin()
+	err := tx.Model(invitation).Updates(map[string]interface{}{
+		"Status":   invitation.Status,
+		"SenderID": invitation.SenderID,
+	}).Error
+
+	if err == nil && approve {
+		err = invitation.joinCompany(tx, *invitation.UserID, approver.ID, client)
+	}
+
+	if err == nil && approve {
+		err = RecordCompanyAuditEvent(tx, AuditMemberJoined, invitation.CompanyID, *invitation.UserID, approver.ID, client, map[string]interface{}{
+			"source": invitation.Source,
+		})
+	}
+
+	if err != nil {
+		tx.Rollback()
+		resp = util.Message(false, http.StatusInternalServerError, "Failed to respond to the request, connection error.", errors)
+		return resp
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		resp = util.Message(false, http.StatusInternalServerError, "Failed to respond to the request, connection error.", errors)
+		return resp
+	}
+
+	message := "You have successfully declined the request of " + invitation.Email + "."
+	if approve {
+		message = "You have successfully approved the request of " + invitation.Email + "."
+	}
+
+	resp = util.Message(true, http.StatusOK, message, errors)
+	resp["data"] = invitation
+
+	return resp
+}
+
+// Check if the user can join the company without an invitation
+func (company *Company) canAdmit(db *gorm.DB, user *User) (map[string]interface{}, bool) {
+	var errors []string
+	var resp map[string]interface{}
+
+	if !user.IsActivated() {
+		resp = util.Message(false, http.StatusForbidden, "Please activate your account before joining the company.", errors)
+		return resp, false
+	}
+
+	if company.getMember(db, user.ID) != nil {
+		resp = util.Message(false, http.StatusUnprocessableEntity, "You are already a member of the company.", errors)
+		return resp, false
+	}
+
+	// The user removed from the company can only come back with an invitation
+	count := 0
+	db.Model(CompanyInvitationRequest{}).Where("company_id = ? AND email = ? AND status = ?", company.ID, user.Email, InvitationRemoved).Count(&count)
+	if count > 0 {
+		resp = util.Message(false, http.StatusForbidden, "You have been removed from the company. Please ask for an invitation.", errors)
+		return resp, false
+	}
+
+	resp = util.Message(true, http.StatusOK, "The user can join the company.", errors)
+	return resp, true
+}
+
+// Record the user joining or requesting to join the company without an invitation, alongside the invitations of the company
+// The earlier invitation or request of the email is revoked, while the record is kept for the history
+func (company *Company) admit(tx *gorm.DB, user *User, invitation *CompanyInvitationRequest, client Client) error {
+	invitation.CompanyID = company.ID
+	invitation.Email = user.Email
+	invitation.UserID = &user.ID
+
+	openIds := []uuid.UUID{}
+	err := tx.Model(CompanyInvitationRequest{}).
+		Where("company_id = ? AND email = ? AND status IN (?)", company.ID, user.Email, []int{InvitationPending, InvitationRequested}).
+		Pluck("id", &openIds).Error
+
+	if err == nil && len(openIds) > 0 {
+		err = tx.Model(CompanyInvitationRequest{}).Where("id IN (?)", openIds).Update("Status", InvitationRevoked).Error
+	}
+
+	// The link in the earlier invitation email no longer works
+	if err == nil && len(openIds) > 0 {
+		err = tx.Where("purpose = ? AND reference_id IN (?)", PurposeInvitation, openIds).Delete(VerificationToken{}).Error
+	}
+
+	if err == nil {
+		err = tx.Create(invitation).Error
+	}
+
+	if err != nil || invitation.Status != InvitationJoined {
+		return err
+	}
+
+	if err := invitation.joinCompany(tx, user.ID, user.ID, client); err != nil {
+		return err
+	}
+
+	return RecordCompanyAuditEvent(tx, AuditMemberJoined, company.ID, user.ID, user.ID, client, map[string]interface{}{
+		"source":     invitation.Source,
+		"joinLinkId": invitation.JoinLinkID,
+	})
+}
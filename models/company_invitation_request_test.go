@@ -0,0 +1,130 @@
+package models
+
+import (
+	"github.com/satori/go.uuid"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestJoinCompanyRoleFallback(t *testing.T) {
+	db := testDB(t)
+	defer db.Close()
+
+	admin := createTestUser(t, db, "Password123!")
+	defer deleteTestUser(db, admin)
+
+	company, adminRole, memberRole := createTestCompany(t, db, admin)
+	defer deleteTestCompany(db, company)
+	defer db.Where("company_id = ?", company.ID).Delete(AuditEvent{})
+
+	deletedRoleId := uuid.NewV4()
+
+	tests := []struct {
+		name     string
+		roleId   *uuid.UUID
+		want     uuid.UUID
+		fallback bool
+	}{
+		{"role of the invitation", &adminRole.ID, adminRole.ID, false},
+		{"no role", nil, memberRole.ID, false},
+		{"deleted role", &deletedRoleId, memberRole.ID, true},
+	}
+
+	for _, test := range tests {
+		user := createTestUser(t, db, "Password123!")
+		defer deleteTestUser(db, user)
+
+		invitation := &CompanyInvitationRequest{CompanyID: company.ID, Email: user.Email, RoleID: test.roleId}
+
+		tx := db.Begin()
+		if err := invitation.joinCompany(tx, user.ID, user.ID, testClient); err != nil {
+			tx.Rollback()
+			t.Fatalf("%s: joinCompany() returned the error: %v", test.name, err)
+		}
+		tx.Commit()
+
+		if member := company.getMember(db, user.ID); member == nil || member.RoleID != test.want {
+			t.Errorf("%s: the member = %+v, want the role %v", test.name, member, test.want)
+		}
+
+		count := 0
+		db.Model(AuditEvent{}).Where("company_id = ? AND user_id = ? AND action = ?", company.ID, user.ID, AuditMemberRoleFallback).Count(&count)
+		if (count > 0) != test.fallback {
+			t.Errorf("%s: the fallback is recorded = %v, want %v", test.name, count > 0, test.fallback)
+		}
+	}
+}
+
+func TestSignupWithInvitation(t *testing.T) {
+	db := testDB(t)
+	defer db.Close()
+
+	admin := createTestUser(t, db, "Password123!")
+	defer deleteTestUser(db, admin)
+
+	company, adminRole, memberRole := createTestCompany(t, db, admin)
+	defer deleteTestCompany(db, company)
+	defer db.Where("company_id = ?", company.ID).Delete(AuditEvent{})
+
+	domain := "sso-" + uuid.NewV4().String() + ".test"
+	otherDomain := "other-" + uuid.NewV4().String() + ".test"
+	sso := &CompanySSO{CompanyID: company.ID, Enabled: true, Enforced: true, EmailDomain: domain}
+	db.Create(sso)
+	defer db.Unscoped().Delete(sso)
+
+	tests := []struct {
+		name   string
+		domain string
+		roleId uuid.UUID
+		joined bool
+	}{
+		{"member with the SSO domain", domain, memberRole.ID, false},
+		{"admin with the SSO domain", domain, adminRole.ID, false},
+		{"member with another domain", otherDomain, memberRole.ID, true},
+	}
+
+	for _, test := range tests {
+		expiresAt := time.Now().AddDate(0, 0, 7)
+		invitation := &CompanyInvitationRequest{
+			CompanyID: company.ID,
+			Email:     "test-" + uuid.NewV4().String() + "@" + test.domain,
+			RoleID:    &test.roleId,
+			ExpiresAt: &expiresAt,
+		}
+		db.Create(invitation)
+
+		token, err := createVerificationToken(db, PurposeInvitation, nil, &invitation.ID, "", expiresAt)
+		if err != nil {
+			t.Fatalf("Failed to create the token: %v", err)
+		}
+
+		SignupWithInvitation(token, &User{Name: "Test User", Password: "Password123!"}, testClient)
+
+		user := GetUserByEmail(invitation.Email)
+		if user != nil {
+			defer deleteTestUser(db, user)
+		}
+
+		if joined := user != nil && company.getMember(db, user.ID) != nil; joined != test.joined {
+			t.Errorf("%s: joined = %v, want %v", test.name, joined, test.joined)
+			continue
+		}
+
+		if !test.joined {
+			continue
+		}
+
+		count := 0
+		db.Model(AuditEvent{}).Where("user_id = ? AND action IN (?)", user.ID, []string{AuditAccountCreated, AuditMemberJoined}).Count(&count)
+		if count != 2 {
+			t.Errorf("%s: %d audit event(s) recorded, want 2", test.name, count)
+		}
+
+		// The link cannot be used again
+		resp := SignupWithInvitation(token, &User{Name: "Test User", Password: "Password123!"}, testClient)
+		if resp["status"] != http.StatusUnprocessableEntity {
+			t.Errorf("%s: signing up again = %v, want %v", test.name, resp["status"], http.StatusUnprocessableEntity)
+		}
+	}
+}
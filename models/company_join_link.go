@@ -0,0 +1,241 @@
+package models
+
+import (
+	"app/mailer"
+	util "app/utils"
+	"github.com/jinzhu/gorm"
+	"github.com/satori/go.uuid"
+	"net/http"
+	"time"
+)
+
+const (
+	JoinLinkPrefix      = "join_"
+	maxJoinLinkLifetime = 365 // days
+)
+
+// Link shared by the company for anyone with it to join the company, only the hash of the token is stored
+type CompanyJoinLink struct {
+	Base
+	CompanyID uuid.UUID  `json:"companyId" gorm:"type:uuid;not null;index"`
+	CreatorID *uuid.UUID `json:"creatorId" gorm:"type:uuid"`
+	TokenHash string     `json:"-" gorm:"not null;unique_index"`
+	Hint      string     `json:"hint"`                    // The last characters of the token to identify it
+	RoleID    *uuid.UUID `json:"roleId" gorm:"type:uuid"` // The role given on joining, the default role of the company if not set
+	MaxUses   int        `json:"maxUses"`                 // Unlimited if not set
+	Uses      int        `json:"uses"`
+	ExpiresAt *time.Time `json:"expiresAt"`
+	RevokedAt *time.Time `json:"revokedAt"`
+}
+
+// Details of the join link shown to the user before joining
+type CompanyJoinLinkOutput struct {
+	CompanyID   uuid.UUID  `json:"companyId"`
+	CompanyName string     `json:"companyName"`
+	ExpiresAt   *time.Time `json:"expiresAt"`
+}
+
+// Create the join link of the company, the creator cannot grant the role with the permissions that the creator does not have
+func (company *Company) CreateJoinLink(creator *User, roleId *uuid.UUID, maxUses, expiresInDays int) map[string]interface{} {
+	var errors []string
+	var resp map[string]interface{}
+
+	if maxUses < 0 {
+		errors = append(errors, "The maximum uses cannot be negative.")
+	}
+
+	if expiresInDays < 0 || expiresInDays > maxJoinLinkLifetime {
+		errors = append(errors, "The link can only be valid for up to 365 days.")
+	}
+
+	if len(errors) > 0 {
+		resp = util.Message(false, http.StatusUnprocessableEntity, "Validation error", errors)
+		return resp
+	}
+
+	if resp, ok := company.ValidateInvitationGrant(creator, roleId, nil); !ok {
+		return resp
+	}
+
+	randomToken, err := util.GenerateRandomToken(32)
+	if err != nil {
+		resp = util.Message(false, http.StatusInternalServerError, "Failed to create the join link, please try again.", errors)
+		return resp
+	}
+
+	plainToken := JoinLinkPrefix + randomToken
+	link := &CompanyJoinLink{
+		CompanyID: company.ID,
+		CreatorID: &creator.ID,
+		TokenHash: util.HashToken(plainToken),
+		Hint:      plainToken[len(plainToken)-4:],
+		RoleID:    roleId,
+		MaxUses:   maxUses,
+	}
+
+	if expiresInDays > 0 {
+		expiresAt := time.Now().AddDate(0, 0, expiresInDays)
+		link.ExpiresAt = &expiresAt
+	}
+
+	db := GetDB()
+	err = db.Create(link).Error
+	defer db.Close()
+
+	if err != nil {
+		resp = util.Message(false, http.StatusInternalServerError, "Failed to create the join link, connection error.", errors)
+		return resp
+	}
+
+	resp = util.Message(true, http.StatusOK, "You have successfully created the join link. Copy it now as it will not be shown again.", errors)
+	resp["data"] = link
+	resp["token"] = plainToken
+	resp["link"] = mailer.Link("/join/" + plainToken)
+
+	return resp
+}
+
+// Get the join links of the company
+func (company *Company) GetJoinLinks() map[string]interface{} {
+	var errors []string
+	var resp map[string]interface{}
+
+	links := []CompanyJoinLink{}
+	db := GetDB()
+	db.Where("company_id = ?", company.ID).Order("created_at desc").Find(&links)
+	defer db.Close()
+
+	resp = util.Message(true, http.StatusOK, "You have successfully retrieved the join links of the company.", errors)
+	resp["data"] = links
+
+	return resp
+}
+
+// Revoke the join link of the company, the link no longer works
+func (company *Company) RevokeJoinLink(linkId uuid.UUID) map[string]interface{} {
+	var errors []string
+	var resp map[string]interface{}
+
+	db := GetDB()
+	result := db.Model(CompanyJoinLink{}).
+		Where("id = ? AND company_id = ? AND revoked_at IS NULL", linkId, company.ID).
+		Update("RevokedAt", time.Now())
+	defer db.Close()
+
+	if result.Error != nil || result.RowsAffected == 0 {
+		resp = util.Message(false, http.StatusUnprocessableEntity, "No available result.", errors)
+		return resp
+	}
+
+	resp = util.Message(true, http.StatusOK, "You have successfully revoked the join link.", errors)
+
+	return resp
+}
+
+// Get the company of the join link for the user to confirm before joining
+func GetJoinLinkByToken(token string) map[string]interface{} {
+	var errors []string
+	var resp map[string]interface{}
+
+	db := GetDB()
+	defer db.Close()
+
+	link := getJoinLink(db, token)
+	company := (*Company)(nil)
+	if link != nil {
+		company = GetCompanyByID(link.CompanyID)
+	}
+
+	if link == nil || company == nil {
+		resp = util.Message(false, http.StatusUnprocessableEntity, "Invalid/expired join link.", errors)
+		return resp
+	}
+
+	resp = util.Message(true, http.StatusOK, "The join link is retrieved.", errors)
+	resp["data"] = CompanyJoinLinkOutput{
+		CompanyID:   company.ID,
+		CompanyName: company.Name,
+		ExpiresAt:   link.ExpiresAt,
+	}
+
+	return resp
+}
+
+// Join the company with the join link
+func (user *User) JoinCompanyByLink(token string, client Client) map[string]interface{} {
+	var errors []string
+	var resp map[string]interface{}
+
+	db := GetDB()
+	defer db.Close()
+
+	link := getJoinLink(db, token)
+	company := (*Company)(nil)
+	if link != nil {
+		company = GetCompanyByID(link.CompanyID)
+	}
+
+	if link == nil || company == nil {
+		resp = util.Message(false, http.StatusUnprocessableEntity, "Invalid/expired join link.", errors)
+		return resp
+	}
+
+	if resp, ok := company.canAdmit(db, user); !ok {
+		return resp
+	}
+
+	tx := db.Begin()
+
+	// Count the use of the link, unless the link has been used up in the meantime
+	result := tx.Model(CompanyJoinLink{}).
+		Where("id = ? AND revoked_at IS NULL AND (max_uses = 0 OR uses < max_uses)", link.ID).
+		UpdateColumn("uses", gorm.Expr("uses + ?", 1))
+
+	if result.Error == nil && result.RowsAffected == 0 {
+		tx.Rollback()
+		resp = util.Message(false, http.StatusUnprocessableEntity, "Invalid/expired join link.", errors)
+		return resp
+	}
+
+	err := result.Error
+	invitation := &CompanyInvitationRequest{
+		SenderID:   link.CreatorID,
+		Status:     InvitationJoined,
+		RoleID:     link.RoleID,
+		Source:     JoinSourceLink,
+		JoinLinkID: &link.ID,
+	}
+
+	if err == nil {
+		err = company.admit(tx, user, invitation, client)
+	}
+
+	if err != nil {
+		tx.Rollback()
+		resp = util.Message(false, http.StatusInternalServerError, "Failed to join the company, connection error.", errors)
+		return resp
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		resp = util.Message(false, http.StatusInternalServerError, "Failed to join the company, connection error.", errors)
+		return resp
+	}
+
+	resp = util.Message(true, http.StatusOK, "You have successfully joined "+company.Name+".", errors)
+	resp["data"] = invitation
+	resp["company"] = company
+
+	return resp
+}
+
+// Get the join link that can still be used by the plain token
+func getJoinLink(db *gorm.DB, token string) *CompanyJoinLink {
+	link := &CompanyJoinLink{}
+	db.Where("token_hash = ? AND revoked_at IS NULL AND (max_uses = 0 OR uses < max_uses)", util.HashToken(token)).First(link)
+
+	if link.ID == uuid.Nil || (link.ExpiresAt != nil && time.Now().After(*link.ExpiresAt)) {
+		return nil
+	}
+
+	return link
+}
@@ -0,0 +1,54 @@
+package models
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestJoinCompanyByLinkMaxUses(t *testing.T) {
+	db := testDB(t)
+	defer db.Close()
+
+	admin := createTestUser(t, db, "Password123!")
+	defer deleteTestUser(db, admin)
+
+	company, _, _ := createTestCompany(t, db, admin)
+	defer deleteTestCompany(db, company)
+	defer db.Where("company_id = ?", company.ID).Delete(AuditEvent{})
+	defer db.Unscoped().Where("company_id = ?", company.ID).Delete(CompanyJoinLink{})
+
+	resp := company.CreateJoinLink(admin, nil, 1, 0)
+	token, ok := resp["token"].(string)
+	if !ok {
+		t.Fatalf("CreateJoinLink() = %v", resp)
+	}
+
+	tests := []struct {
+		name   string
+		status int
+		joined bool
+	}{
+		{"first use", http.StatusOK, true},
+		{"over the maximum uses", http.StatusUnprocessableEntity, false},
+	}
+
+	for _, test := range tests {
+		user := createTestUser(t, db, "Password123!")
+		defer deleteTestUser(db, user)
+
+		resp := user.JoinCompanyByLink(token, testClient)
+		if resp["status"] != test.status {
+			t.Errorf("%s: JoinCompanyByLink() status = %v, want %v", test.name, resp["status"], test.status)
+		}
+
+		if joined := company.getMember(db, user.ID) != nil; joined != test.joined {
+			t.Errorf("%s: joined = %v, want %v", test.name, joined, test.joined)
+		}
+	}
+
+	link := CompanyJoinLink{}
+	db.Where("company_id = ?", company.ID).First(&link)
+	if link.Uses != 1 {
+		t.Errorf("The link is used %d time(s), want 1", link.Uses)
+	}
+}
@@ -0,0 +1,316 @@
+package models
+
+import (
+	"app/mailer"
+	util "app/utils"
+	"github.com/jinzhu/gorm"
+	"github.com/satori/go.uuid"
+	"net/http"
+	"time"
+)
+
+const ownershipTransferLifetime = time.Hour * 24 * 7 // How long the nominated member has to accept the ownership
+
+const (
+	ownershipTransferPending = iota
+	ownershipTransferAccepted
+	ownershipTransferDeclined
+	ownershipTransferCancelled
+)
+
+var OwnershipTransferStatus = []string{
+	"Awaiting response",
+	"Accepted",
+	"Declined",
+	"Cancelled",
+}
+
+// Handover of the company from the owner to another member, the company only changes hands once the member accepts
+type CompanyOwnershipTransfer struct {
+	Base
+	CompanyID   uuid.UUID  `json:"companyId" gorm:"type:uuid;not null;index"`
+	FromUserID  uuid.UUID  `json:"fromUserId" gorm:"type:uuid;not null"`
+	ToUserID    uuid.UUID  `json:"toUserId" gorm:"type:uuid;not null;index"`
+	Status      int        `json:"status" gorm:"default:'0'"`
+	ExpiresAt   time.Time  `json:"expiresAt" gorm:"not null"`
+	RespondedAt *time.Time `json:"respondedAt"`
+}
+
+// Check if the user is the owner of the company
+func (company *Company) IsOwner(userId uuid.UUID) bool {
+	return company.OwnerID != nil && *company.OwnerID == userId
+}
+
+// Get the pending ownership transfer of the company, only visible to the owner and the nominated member
+func (company *Company) GetOwnershipTransfer(user *User) map[string]interface{} {
+	var errors []string
+	var resp map[string]interface{}
+
+	db := GetDB()
+	defer db.Close()
+
+	transfer := company.pendingOwnershipTransfer(db)
+	if transfer == nil || (transfer.FromUserID != user.ID && transfer.ToUserID != user.ID) {
+		resp = util.Message(false, http.StatusUnprocessableEntity, "No available result.", errors)
+		return resp
+	}
+
+	resp = util.Message(true, http.StatusOK, "The ownership transfer is retrieved.", errors)
+	resp["data"] = transfer
+
+	return resp
+}
+
+// Nominate another member of the company as the new owner, replacing the previous nomination if any
+func (company *Company) TransferOwnership(owner *User, toUserId uuid.UUID, client Client) map[string]interface{} {
+	var errors []string
+	var resp map[string]interface{}
+
+	if !company.IsOwner(owner.ID) {
+		resp = util.Message(false, http.StatusForbidden, "Only the owner can transfer the ownership of the company.", errors)
+		return resp
+	}
+
+	if toUserId == owner.ID {
+		resp = util.Message(false, http.StatusUnprocessableEntity, "You are already the owner of the company.", errors)
+		return resp
+	}
+
+	db := GetDB()
+	defer db.Close()
+
+	target := GetUser(toUserId)
+	if target == nil || company.getMember(db, toUserId) == nil {
+		resp = util.Message(false, http.StatusUnprocessableEntity, "No available result.", errors)
+		return resp
+	}
+
+	if !target.IsActivated() || target.DeletionScheduledAt != nil {
+		resp = util.Message(false, http.StatusUnprocessableEntity, "The ownership cannot be transferred to "+target.Email+".", errors)
+		return resp
+	}
+
+	transfer := &CompanyOwnershipTransfer{
+		CompanyID:  company.ID,
+		FromUserID: owner.ID,
+		ToUserID:   target.ID,
+		ExpiresAt:  time.Now().Add(ownershipTransferLifetime),
+	}
+
+	msg, err := mailer.NewOwnershipTransferEmail(target.Name, target.Email, owner.Name, company.Name, company.ID.String(), transfer.ExpiresAt)
+
+	tx := db.Begin()
+	if err == nil {
+		err = cancelOwnershipTransfers(tx, company.ID)
+	}
+
+	if err == nil {
+		err = tx.Create(transfer).Error
+	}
+
+	if err == nil {
+		err = QueueEmail(tx, &company.ID, msg)
+	}
+
+	if err == nil {
+		err = RecordCompanyAuditEvent(tx, AuditOwnershipTransferRequested, company.ID, target.ID, owner.ID, client, nil)
+	}
+
+	if err != nil {
+		tx.Rollback()
+		resp = util.Message(false, http.StatusInternalServerError, "Failed to transfer the ownership, connection error.", errors)
+		return resp
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		resp = util.Message(false, http.StatusInternalServerError, "Failed to transfer the ownership, connection error.", errors)
+		return resp
+	}
+
+	resp = util.Message(true, http.StatusOK, "You have nominated "+target.Email+" as the new owner. The ownership is transferred once accepted.", errors)
+	resp["data"] = transfer
+
+	return resp
+}
+
+// Withdraw the pending nomination of the new owner
+func (company *Company) CancelOwnershipTransfer(owner *User, client Client) map[string]interface{} {
+	var errors []string
+	var resp map[string]interface{}
+
+	db := GetDB()
+	defer db.Close()
+
+	transfer := company.pendingOwnershipTransfer(db)
+	if transfer == nil || !company.IsOwner(owner.ID) {
+		resp = util.Message(false, http.StatusUnprocessableEntity, "No available result.", errors)
+		return resp
+	}
+
+	tx := db.Begin()
+	err := cancelOwnershipTransfers(tx, company.ID)
+
+	if err == nil {
+		err = RecordCompanyAuditEvent(tx, AuditOwnershipTransferCancelled, company.ID, transfer.ToUserID, owner.ID, client, nil)
+	}
+
+	if err != nil {
+		tx.Rollback()
+		resp = util.Message(false, http.StatusInternalServerError, "Failed to cancel the ownership transfer, connection error.", errors)
+		return resp
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		resp = util.Message(false, http.StatusInternalServerError, "Failed to cancel the ownership transfer, connection error.", errors)
+		return resp
+	}
+
+	resp = util.Message(true, http.StatusOK, "You have cancelled the ownership transfer.", errors)
+
+	return resp
+}
+
+// Accept or decline the ownership of the company, the new owner is given the admin role on accepting
+func (company *Company) RespondOwnershipTransfer(user *User, accept bool, client Client) map[string]interface{} {
+	var errors []string
+	var resp map[string]interface{}
+
+	db := GetDB()
+	defer db.Close()
+
+	transfer := company.pendingOwnershipTransfer(db)
+	if transfer == nil || transfer.ToUserID != user.ID {
+		resp = util.Message(false, http.StatusUnprocessableEntity, "No available result.", errors)
+		return resp
+	}
+
+	// The account that is about to be deleted cannot become the owner
+	if accept && user.DeletionScheduledAt != nil {
+		resp = util.Message(false, http.StatusUnprocessableEntity, "Your account is scheduled for deletion. Please cancel the deletion before accepting the ownership.", errors)
+		return resp
+	}
+
+	admin := Role{}
+	db.Where("company_id = ? AND is_admin = ?", company.ID, true).First(&admin)
+
+	if accept && admin.ID == uuid.Nil {
+		resp = util.Message(false, http.StatusInternalServerError, "The admin role is not created in the company.", errors)
+		return resp
+	}
+
+	status, action, audit := ownershipTransferDeclined, "declined", AuditOwnershipTransferDeclined
+	if accept {
+		status, action, audit = ownershipTransferAccepted, "accepted", AuditOwnershipTransferred
+	}
+
+	previousOwner := GetUser(transfer.FromUserID)
+	if previousOwner == nil {
+		previousOwner = &User{}
+	}
+
+	msg, err := mailer.NewOwnershipTransferredEmail(previousOwner.Name, previousOwner.Email, user.Name, action, company.Name)
+
+	// The company and the transfer are locked so that the ownership cannot change hands in the meantime
+	tx := db.Begin()
+	locked := Company{}
+	tx.Raw("SELECT * FROM companies WHERE id = ? FOR UPDATE", company.ID).Scan(&locked)
+
+	pending := CompanyOwnershipTransfer{}
+	tx.Raw("SELECT * FROM company_ownership_transfers WHERE id = ? AND status = ? FOR UPDATE", transfer.ID, ownershipTransferPending).
+		Scan(&pending)
+
+	if pending.ID == uuid.Nil || company.getMember(tx, user.ID) == nil {
+		tx.Rollback()
+		resp = util.Message(false, http.StatusUnprocessableEntity, "The ownership transfer is no longer valid.", errors)
+		return resp
+	}
+
+	// The ownership is void if the owner has changed in the meantime
+	if !locked.IsOwner(transfer.FromUserID) {
+		if err := cancelOwnershipTransfers(tx, company.ID); err != nil {
+			tx.Rollback()
+		} else {
+			tx.Commit()
+		}
+
+		resp = util.Message(false, http.StatusUnprocessableEntity, "The ownership transfer is no longer valid.", errors)
+		return resp
+	}
+
+	now := time.Now()
+	if err == nil {
+		err = tx.Model(transfer).Updates(map[string]interface{}{
+			"Status":      status,
+			"RespondedAt": now,
+		}).Error
+	}
+
+	if err == nil && accept {
+		err = tx.Model(company).Update("OwnerID", user.ID).Error
+	}
+
+	// The owner always has the admin role, while the previous owner stays as an admin
+	if err == nil && accept {
+		err = tx.Model(CompanyUser{}).
+			Where("company_id = ? AND user_id = ?", company.ID, user.ID).
+			Update("RoleID", admin.ID).Error
+	}
+
+	if err == nil && previousOwner.Email != "" {
+		err = QueueEmail(tx, &company.ID, msg)
+	}
+
+	if err == nil {
+		err = RecordCompanyAuditEvent(tx, audit, company.ID, user.ID, user.ID, client, map[string]interface{}{
+			"fromUserId": transfer.FromUserID,
+		})
+	}
+
+	if err != nil {
+		tx.Rollback()
+		resp = util.Message(false, http.StatusInternalServerError, "Failed to respond to the ownership transfer, connection error.", errors)
+		return resp
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		resp = util.Message(false, http.StatusInternalServerError, "Failed to respond to the ownership transfer, connection error.", errors)
+		return resp
+	}
+
+	resp = util.Message(true, http.StatusOK, "You have "+action+" the ownership of "+company.Name+".", errors)
+	resp["data"] = transfer
+
+	return resp
+}
+
+// Get the nomination of the new owner that is still awaiting the response
+func (company *Company) pendingOwnershipTransfer(db *gorm.DB) *CompanyOwnershipTransfer {
+	transfer := &CompanyOwnershipTransfer{}
+	db.Where("company_id = ? AND status = ? AND expires_at > ?", company.ID, ownershipTransferPending, time.Now()).
+		Order("created_at desc").
+		First(transfer)
+
+	if transfer.ID == uuid.Nil {
+		return nil
+	}
+
+	return transfer
+}
+
+// Cancel all the pending nominations of the company
+func cancelOwnershipTransfers(db *gorm.DB, companyId uuid.UUID) error {
+	return db.Model(CompanyOwnershipTransfer{}).
+		Where("company_id = ? AND status = ?", companyId, ownershipTransferPending).
+		Updates(map[string]interface{}{
+			"Status":      ownershipTransferCancelled,
+			"RespondedAt": time.Now(),
+		}).Error
+}
+
+// Get the companies owned by the user
+func (user *User) ownedCompanies(db *gorm.DB) []Company {
+	companies := []Company{}
+	db.Where("owner_id = ?", user.ID).Order("name asc").Find(&companies)
+
+	return companies
+}
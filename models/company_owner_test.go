@@ -0,0 +1,65 @@
+package models
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestRespondOwnershipTransfer(t *testing.T) {
+	db := testDB(t)
+	defer db.Close()
+
+	owner := createTestUser(t, db, "Password123!")
+	defer deleteTestUser(db, owner)
+
+	nominee := createTestUser(t, db, "Password123!")
+	defer deleteTestUser(db, nominee)
+
+	company, _, memberRole := createTestCompany(t, db, owner)
+	defer deleteTestCompany(db, company)
+	defer db.Unscoped().Where("company_id = ?", company.ID).Delete(CompanyOwnershipTransfer{})
+
+	tests := []struct {
+		name    string
+		prepare func()
+		status  int
+		owner   bool // Whether the nominee owns the company afterwards
+	}{
+		{"nominee removed", func() {
+			company.RemoveMember(owner, nominee.ID, testClient)
+		}, http.StatusUnprocessableEntity, false},
+		{"owner changed", func() {
+			db.Exec("UPDATE companies SET owner_id = NULL WHERE id = ?", company.ID)
+		}, http.StatusUnprocessableEntity, false},
+		{"accepted", func() {}, http.StatusOK, true},
+	}
+
+	for _, test := range tests {
+		db.Model(company).Update("OwnerID", owner.ID)
+		db.Unscoped().Where("company_id = ? AND user_id = ?", company.ID, nominee.ID).Delete(CompanyUser{})
+		addTestMember(t, db, company, nominee, memberRole)
+
+		if resp := company.TransferOwnership(owner, nominee.ID, testClient); resp["status"] != http.StatusOK {
+			t.Fatalf("%s: TransferOwnership() = %v", test.name, resp)
+		}
+
+		test.prepare()
+
+		resp := company.RespondOwnershipTransfer(nominee, true, testClient)
+		if resp["status"] != test.status {
+			t.Errorf("%s: RespondOwnershipTransfer() status = %v, want %v", test.name, resp["status"], test.status)
+		}
+
+		updated := GetCompany(company.ID, owner.ID)
+		isOwner := updated != nil && updated.IsOwner(nominee.ID)
+		if isOwner != test.owner {
+			t.Errorf("%s: the nominee is the owner = %v, want %v", test.name, isOwner, test.owner)
+		}
+
+		pending := 0
+		db.Model(CompanyOwnershipTransfer{}).Where("company_id = ? AND status = ?", company.ID, ownershipTransferPending).Count(&pending)
+		if pending != 0 {
+			t.Errorf("%s: %d transfer(s) still pending", test.name, pending)
+		}
+	}
+}
@@ -0,0 +1,443 @@
+package models
+
+import (
+	"app/saml"
+	util "app/utils"
+	"encoding/json"
+	"github.com/jinzhu/gorm"
+	"github.com/satori/go.uuid"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Single sign-on settings of the company with its SAML identity provider
+type CompanySSO struct {
+	Base
+	CompanyID   uuid.UUID `json:"companyId" gorm:"type:uuid;not null;unique_index"`
+	Enabled     bool      `json:"enabled" gorm:"default:false"`
+	IdPEntityID string    `json:"idpEntityId"`
+	SSOURL      string    `json:"ssoUrl"`
+	Certificate string    `json:"certificate" sql:"type:text"`
+	EmailDomain string    `json:"emailDomain" gorm:"index"`
+	Enforced    bool      `json:"enforced" gorm:"default:false"` // Block the password login of the members except the admins
+}
+
+type samlRequestState struct {
+	CompanyID uuid.UUID `json:"companyId"`
+	RequestID string    `json:"requestId"`
+}
+
+func (CompanySSO) TableName() string {
+	return "company_sso"
+}
+
+// Get the SSO settings of the company, along with the settings to be configured at the IdP
+func (company *Company) GetSSO() map[string]interface{} {
+	var errors []string
+	var resp map[string]interface{}
+
+	db := GetDB()
+	sso := CompanySSO{}
+	db.Where("company_id = ?", company.ID).First(&sso)
+	defer db.Close()
+
+	resp = util.Message(true, http.StatusOK, "You have successfully retrieved the single sign-on settings.", errors)
+	resp["data"] = sso
+	resp["serviceProvider"] = map[string]string{
+		"entityId":    saml.EntityID(),
+		"acsUrl":      saml.ACSURL(),
+		"metadataUrl": saml.APIURL() + "/api/sso/metadata",
+		"loginUrl":    saml.APIURL() + "/api/sso/" + company.Slug + "/login",
+	}
+
+	return resp
+}
+
+// Update the SSO settings of the company, the IdP settings can be imported from its metadata
+func (company *Company) UpdateSSO(input *CompanySSO, metadata string) map[string]interface{} {
+	var errors []string
+	var resp map[string]interface{}
+
+	if strings.TrimSpace(metadata) != "" {
+		idp, err := saml.ParseMetadata([]byte(metadata))
+		if err != nil {
+			resp = util.Message(false, http.StatusUnprocessableEntity, err.Error(), errors)
+			return resp
+		}
+
+		input.IdPEntityID = idp.EntityID
+		input.SSOURL = idp.SSOURL
+		input.Certificate = idp.Certificate
+	}
+
+	input.IdPEntityID = strings.TrimSpace(input.IdPEntityID)
+	input.SSOURL = strings.TrimSpace(input.SSOURL)
+	input.EmailDomain = strings.TrimPrefix(strings.ToLower(strings.TrimSpace(input.EmailDomain)), "@")
+
+	if input.Certificate != "" {
+		cert, err := saml.ParseCertificate(input.Certificate)
+		if err != nil {
+			resp = util.Message(false, http.StatusUnprocessableEntity, "The certificate of the identity provider is invalid.", errors)
+			return resp
+		}
+		input.Certificate = saml.EncodeCertificate(cert)
+	}
+
+	if input.Enabled {
+		if input.IdPEntityID == "" || input.Certificate == "" {
+			errors = append(errors, "The entity ID and the certificate of the identity provider are required.")
+		}
+
+		if ssoURL, err := url.Parse(input.SSOURL); err != nil || (ssoURL.Scheme != "https" && ssoURL.Scheme != "http") || ssoURL.Host == "" {
+			errors = append(errors, "The single sign-on URL of the identity provider is invalid.")
+		}
+
+		if input.EmailDomain == "" || !strings.Contains(input.EmailDomain, ".") {
+			errors = append(errors, "The email domain is invalid.")
+		}
+
+		if len(errors) > 0 {
+			resp = util.Message(false, http.StatusUnprocessableEntity, "Validation error", errors)
+			return resp
+		}
+	}
+
+	if input.Enforced && !input.Enabled {
+		resp = util.Message(false, http.StatusUnprocessableEntity, "Single sign-on must be enabled before it can be enforced.", errors)
+		return resp
+	}
+
+	db := GetDB()
+	defer db.Close()
+
+	// The IdP can only sign in the users of the email domain that the company has proven to own
+	if input.EmailDomain != "" && !company.hasVerifiedDomain(db, input.EmailDomain) {
+		resp = util.Message(false, http.StatusUnprocessableEntity, "The email domain has to be added and verified in the email domains of the company first.", errors)
+		return resp
+	}
+
+	sso := CompanySSO{}
+	db.Where("company_id = ?", company.ID).First(&sso)
+	sso.CompanyID = company.ID
+	sso.Enabled = input.Enabled
+	sso.IdPEntityID = input.IdPEntityID
+	sso.SSOURL = input.SSOURL
+	sso.Certificate = input.Certificate
+	sso.EmailDomain = input.EmailDomain
+	sso.Enforced = input.Enforced
+
+	if err := db.Save(&sso).Error; err != nil {
+		resp = util.Message(false, http.StatusInternalServerError, "Failed to update the single sign-on settings, connection error.", errors)
+		return resp
+	}
+
+	resp = util.Message(true, http.StatusOK, "You have successfully updated the single sign-on settings.", errors)
+	resp["data"] = sso
+
+	return resp
+}
+
+// Start the SSO login of the company, return the URL of the IdP to redirect the user to
+func StartSSOLogin(slug string) map[string]interface{} {
+	var errors []string
+	var resp map[string]interface{}
+
+	db := GetDB()
+	defer db.Close()
+
+	company, sso := getCompanySSOBySlug(db, slug)
+	if sso == nil {
+		resp = util.Message(false, http.StatusNotFound, "Single sign-on is not available for the company.", errors)
+		return resp
+	}
+
+	requestId, err := saml.NewRequestID()
+	if err != nil {
+		resp = util.Message(false, http.StatusInternalServerError, "Failed to start the login, please try again.", errors)
+		return resp
+	}
+
+	data, _ := json.Marshal(samlRequestState{CompanyID: company.ID, RequestID: requestId})
+	relayState, err := CreateVerificationToken(db, PurposeSAMLRequest, nil, nil, string(data))
+	if err != nil {
+		resp = util.Message(false, http.StatusInternalServerError, "Failed to start the login, please try again.", errors)
+		return resp
+	}
+
+	loginURL, err := saml.AuthnRequestURL(sso.SSOURL, requestId, relayState)
+	if err != nil {
+		resp = util.Message(false, http.StatusInternalServerError, "Failed to start the login, please try again.", errors)
+		return resp
+	}
+
+	resp = util.Message(true, http.StatusOK, "Redirect to the identity provider of the company.", errors)
+	resp["url"] = loginURL
+
+	return resp
+}
+
+// Verify the response posted by the IdP, and return the one-time code to complete the login at the frontend
+func CompleteSSOLogin(samlResponse, relayState string) map[string]interface{} {
+	var errors []string
+	var resp map[string]interface{}
+
+	db := GetDB()
+	defer db.Close()
+
+	token, err := ConsumeVerificationToken(db, PurposeSAMLRequest, relayState)
+	state := samlRequestState{}
+	if err == nil {
+		err = json.Unmarshal([]byte(token.Data), &state)
+	}
+
+	if err != nil {
+		resp = util.Message(false, http.StatusUnprocessableEntity, "The login has expired. Please try again.", errors)
+		return resp
+	}
+
+	sso := CompanySSO{}
+	db.Where("company_id = ? AND enabled = ?", state.CompanyID, true).First(&sso)
+	company := GetCompanyByID(state.CompanyID)
+	if sso.ID == uuid.Nil || company == nil {
+		resp = util.Message(false, http.StatusNotFound, "Single sign-on is not available for the company.", errors)
+		return resp
+	}
+
+	cert, err := saml.ParseCertificate(sso.Certificate)
+	if err != nil {
+		resp = util.Message(false, http.StatusInternalServerError, "The single sign-on settings of the company are invalid.", errors)
+		return resp
+	}
+
+	assertion, err := saml.ParseResponse(samlResponse, saml.ResponseOptions{
+		IdPEntityID: sso.IdPEntityID,
+		Certificate: cert,
+		RequestID:   state.RequestID,
+	})
+	if err != nil {
+		log.Println("Failed to verify the SAML response:", err)
+		resp = util.Message(false, http.StatusUnprocessableEntity, err.Error(), errors)
+		return resp
+	}
+
+	// The IdP can only authenticate the users of the verified email domain of the company
+	email := strings.ToLower(strings.TrimSpace(assertion.Email))
+	if emailDomain(email) != sso.EmailDomain || !company.hasVerifiedDomain(db, sso.EmailDomain) {
+		resp = util.Message(false, http.StatusForbidden, "The email address is not within the email domain of the company.", errors)
+		return resp
+	}
+
+	user, resp := getOrCreateUserBySSO(db, company, assertion, email)
+	if user == nil {
+		return resp
+	}
+
+	if user.IsLocked() {
+		resp = util.Message(false, http.StatusLocked, "The account has been temporarily locked due to too many failed login attempts. Please try again later or reset your password.", errors)
+		return resp
+	}
+
+	code, err := CreateVerificationToken(db, PurposeSSOLogin, &user.ID, nil, "")
+	if err != nil {
+		resp = util.Message(false, http.StatusInternalServerError, "Failed to login, connection error.", errors)
+		return resp
+	}
+
+	resp = util.Message(true, http.StatusOK, "You have been authenticated by the identity provider.", errors)
+	resp["code"] = code
+
+	return resp
+}
+
+// Exchange the one-time code from the SSO login for the login tokens
+func RedeemSSOLogin(code string, client Client) map[string]interface{} {
+	var errors []string
+	var resp map[string]interface{}
+
+	db := GetDB()
+	defer db.Close()
+
+	token, err := ConsumeVerificationToken(db, PurposeSSOLogin, code)
+	if err != nil || token.UserID == nil {
+		resp = util.Message(false, http.StatusUnprocessableEntity, "The login has expired. Please try again.", errors)
+		return resp
+	}
+
+	user := GetUser(*token.UserID)
+	if user == nil {
+		resp = util.Message(false, http.StatusUnprocessableEntity, "The login has expired. Please try again.", errors)
+		return resp
+	}
+
+	if user.IsLocked() {
+		resp = util.Message(false, http.StatusLocked, "The account has been temporarily locked due to too many failed login attempts. Please try again later or reset your password.", errors)
+		return resp
+	}
+
+	return user.authenticated(db, client)
+}
+
+// Get the company that enforces SSO for the user, the password login is not allowed for its members whatever their email is,
+// so that the members cannot get around it by changing the email address
+// The admins are exempted so that they can still fix the settings if the IdP is unavailable
+func GetSSOEnforcingCompany(user *User) *Company {
+	db := GetDB()
+	company := &Company{}
+	db.Table("companies").
+		Joins("JOIN company_sso ON company_sso.company_id = companies.id").
+		Joins("JOIN company_users ON company_users.company_id = companies.id").
+		Joins("JOIN roles ON roles.id = company_users.role_id").
+		Where("company_users.user_id = ? AND roles.is_admin = ?", user.ID, false).
+		Where("company_sso.enabled = ? AND company_sso.enforced = ?", true, true).
+		Where("companies.deleted_at IS NULL AND company_sso.deleted_at IS NULL").
+		Select("companies.*").
+		First(company)
+	defer db.Close()
+
+	if company.ID == uuid.Nil {
+		return nil
+	}
+
+	return company
+}
+
+// Get the user authenticated by the IdP, new users of the email domain join the company
+func getOrCreateUserBySSO(db *gorm.DB, company *Company, assertion *saml.Assertion, email string) (*User, map[string]interface{}) {
+	var errors []string
+	var resp map[string]interface{}
+
+	provider := "saml:" + company.ID.String()
+
+	// The identity has been linked before
+	userIdentity := UserIdentity{}
+	db.Where("provider = ? AND subject = ?", provider, assertion.NameID).First(&userIdentity)
+	if userIdentity.ID != uuid.Nil {
+		if user := GetUser(userIdentity.UserID); user != nil {
+			// The members who have been removed or left can no longer be signed in by the IdP
+			if GetCompany(company.ID, user.ID) == nil {
+				resp = util.Message(false, http.StatusForbidden, "The account is not a member of the company.", errors)
+				return nil, resp
+			}
+
+			return user, nil
+		}
+	}
+
+	tx := db.Begin()
+	user := &User{}
+	tx.Where("lower(email) = ?", email).First(user)
+
+	if user.ID != uuid.Nil {
+		// The existing account is never linked to the IdP of the company that it has not joined, the owner of the account
+		// has to login with the password and join the company first to prove the ownership of the account
+		if GetCompany(company.ID, user.ID) == nil {
+			tx.Rollback()
+			resp = util.Message(false, http.StatusForbidden, "The account is not a member of the company. Please login with your password and accept the invitation to the company first.", errors)
+			return nil, resp
+		}
+
+		if !user.IsActivated() {
+			if err := resetUnverifiedAccount(tx, user); err != nil {
+				tx.Rollback()
+				resp = util.Message(false, http.StatusInternalServerError, "Failed to login, connection error.", errors)
+				return nil, resp
+			}
+		}
+	} else {
+		// Create the account, the password is unusable until the user sets it with the link from the email
+		hashedPassword, err := unusablePassword()
+		if err != nil {
+			tx.Rollback()
+			resp = util.Message(false, http.StatusInternalServerError, "Failed to create account, connection error.", errors)
+			return nil, resp
+		}
+
+		now := time.Now()
+		user = &User{
+			Name:             assertion.Name,
+			Email:            email,
+			Password:         hashedPassword,
+			PasswordUnusable: true,
+			ActivatedAt:      &now,
+		}
+		if user.Name == "" {
+			user.Name = email
+		}
+
+		if err := tx.Create(user).Error; err != nil {
+			tx.Rollback()
+			resp = util.Message(false, http.StatusInternalServerError, "Failed to create account, connection error.", errors)
+			return nil, resp
+		}
+
+		role := Role{}
+		tx.Where("company_id = ? AND is_default = ?", company.ID, true).First(&role)
+		if role.ID == uuid.Nil {
+			tx.Rollback()
+			resp = util.Message(false, http.StatusInternalServerError, "Failed to join the company, the role is not available.", errors)
+			return nil, resp
+		}
+
+		companyUser := CompanyUser{
+			CompanyID: company.ID,
+			UserID:    user.ID,
+			RoleID:    role.ID,
+		}
+
+		if err := tx.Create(&companyUser).Error; err != nil {
+			tx.Rollback()
+			resp = util.Message(false, http.StatusInternalServerError, "Failed to join the company, connection error.", errors)
+			return nil, resp
+		}
+	}
+
+	userIdentity = UserIdentity{
+		UserID:   user.ID,
+		Provider: provider,
+		Subject:  assertion.NameID,
+		Email:    email,
+	}
+
+	if err := tx.Create(&userIdentity).Error; err != nil {
+		tx.Rollback()
+		resp = util.Message(false, http.StatusInternalServerError, "Failed to login, connection error.", errors)
+		return nil, resp
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		resp = util.Message(false, http.StatusInternalServerError, "Failed to login, connection error.", errors)
+		return nil, resp
+	}
+
+	user.Password = "" // remove the password
+
+	return user, nil
+}
+
+// Get the company and its SSO settings by the slug, only if SSO is enabled
+func getCompanySSOBySlug(db *gorm.DB, slug string) (*Company, *CompanySSO) {
+	company := &Company{}
+	db.Where("slug = ?", slug).First(company)
+	if company.ID == uuid.Nil {
+		return nil, nil
+	}
+
+	sso := &CompanySSO{}
+	db.Where("company_id = ? AND enabled = ?", company.ID, true).First(sso)
+	if sso.ID == uuid.Nil {
+		return nil, nil
+	}
+
+	return company, sso
+}
+
+func emailDomain(email string) string {
+	if i := strings.LastIndex(email, "@"); i >= 0 {
+		return strings.ToLower(email[i+1:])
+	}
+
+	return ""
+}
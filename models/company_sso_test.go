@@ -0,0 +1,151 @@
+package models
+
+import (
+	"app/saml"
+	"github.com/satori/go.uuid"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestUpdateSSORequiresVerifiedDomain(t *testing.T) {
+	db := testDB(t)
+	defer db.Close()
+
+	admin := createTestUser(t, db, "Password123!")
+	defer deleteTestUser(db, admin)
+
+	company, _, _ := createTestCompany(t, db, admin)
+	defer deleteTestCompany(db, company)
+
+	now := time.Now()
+	verified := "verified-" + uuid.NewV4().String() + ".test"
+	unverified := "unverified-" + uuid.NewV4().String() + ".test"
+	db.Create(&CompanyDomain{CompanyID: company.ID, Domain: verified, VerificationCode: "code", VerifiedAt: &now})
+	db.Create(&CompanyDomain{CompanyID: company.ID, Domain: unverified, VerificationCode: "code"})
+
+	tests := []struct {
+		name   string
+		domain string
+		status int
+	}{
+		{"unknown domain", "unknown-" + uuid.NewV4().String() + ".test", http.StatusUnprocessableEntity},
+		{"unverified domain", unverified, http.StatusUnprocessableEntity},
+		{"verified domain", verified, http.StatusOK},
+	}
+
+	for _, test := range tests {
+		resp := company.UpdateSSO(&CompanySSO{EmailDomain: test.domain}, "")
+		if resp["status"] != test.status {
+			t.Errorf("%s: UpdateSSO() status = %v, want %v", test.name, resp["status"], test.status)
+		}
+	}
+}
+
+func TestGetOrCreateUserBySSO(t *testing.T) {
+	db := testDB(t)
+	defer db.Close()
+
+	admin := createTestUser(t, db, "Password123!")
+	defer deleteTestUser(db, admin)
+
+	member := createTestUser(t, db, "Password123!")
+	defer deleteTestUser(db, member)
+
+	outsider := createTestUser(t, db, "Password123!")
+	defer deleteTestUser(db, outsider)
+
+	company, _, memberRole := createTestCompany(t, db, admin)
+	defer deleteTestCompany(db, company)
+	addTestMember(t, db, company, member, memberRole)
+
+	newEmail := "test-" + uuid.NewV4().String() + "@example.com"
+	defer db.Unscoped().Where("email = ?", newEmail).Delete(User{})
+
+	tests := []struct {
+		name       string
+		email      string
+		wantUser   *User // The existing user that is linked, nil if a new user is created
+		wantError  bool
+		wantMember bool
+	}{
+		{name: "account outside of the company", email: outsider.Email, wantError: true},
+		{name: "member", email: member.Email, wantUser: member, wantMember: true},
+		{name: "new user", email: newEmail, wantMember: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assertion := &saml.Assertion{NameID: uuid.NewV4().String(), Email: test.email}
+			user, resp := getOrCreateUserBySSO(db, company, assertion, test.email)
+
+			if test.wantError {
+				if user != nil {
+					t.Fatalf("getOrCreateUserBySSO() = %v, want an error", user.ID)
+				}
+
+				count := 0
+				db.Model(UserIdentity{}).Where("subject = ?", assertion.NameID).Count(&count)
+				if count != 0 {
+					t.Error("The identity is linked to the account outside of the company")
+				}
+				return
+			}
+
+			if user == nil {
+				t.Fatalf("getOrCreateUserBySSO() = %v", resp)
+			}
+
+			if test.wantUser != nil && user.ID != test.wantUser.ID {
+				t.Errorf("getOrCreateUserBySSO() linked %v, want %v", user.ID, test.wantUser.ID)
+			}
+
+			if isMember := GetCompany(company.ID, user.ID) != nil; isMember != test.wantMember {
+				t.Errorf("The user is a member = %v, want %v", isMember, test.wantMember)
+			}
+		})
+	}
+}
+
+func TestGetSSOEnforcingCompany(t *testing.T) {
+	db := testDB(t)
+	defer db.Close()
+
+	admin := createTestUser(t, db, "Password123!")
+	defer deleteTestUser(db, admin)
+
+	member := createTestUser(t, db, "Password123!")
+	defer deleteTestUser(db, member)
+
+	outsider := createTestUser(t, db, "Password123!")
+	defer deleteTestUser(db, outsider)
+
+	company, _, memberRole := createTestCompany(t, db, admin)
+	defer deleteTestCompany(db, company)
+	addTestMember(t, db, company, member, memberRole)
+
+	sso := &CompanySSO{CompanyID: company.ID, Enabled: true, Enforced: true, EmailDomain: "example.com"}
+	db.Create(sso)
+	defer db.Unscoped().Delete(sso)
+
+	// The member has changed the email address to another domain
+	otherEmail := "test-" + uuid.NewV4().String() + "@another.test"
+	db.Model(member).Update("Email", otherEmail)
+
+	tests := []struct {
+		name string
+		user *User
+		want bool
+	}{
+		{"member with another email domain", member, true},
+		{"admin", admin, false},
+		{"user outside of the company", outsider, false},
+	}
+
+	for _, test := range tests {
+		company := GetSSOEnforcingCompany(test.user)
+		if got := company != nil; got != test.want {
+			t.Errorf("%s: enforced = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,204 @@
+package models
+
+import (
+	util "app/utils"
+	"github.com/jinzhu/gorm"
+	"github.com/satori/go.uuid"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+const (
+	companyRetentionDays = 30        // Default number of days the deleted company can be restored before it is purged
+	companyPurgeInterval = time.Hour // How often the companies past the retention are purged
+)
+
+// Deleted company in the trash with the time it will be purged
+type DeletedCompanyOutput struct {
+	Company
+	PurgeAt time.Time
+}
+
+// Get the companies deleted within the retention that the user owns or administers
+func (user *User) GetDeletedCompanies() map[string]interface{} {
+	var errors []string
+	var resp map[string]interface{}
+
+	companies := []Company{}
+	db := GetDB()
+	deletedCompanies(db, user.ID).Order("companies.deleted_at desc").Find(&companies)
+	defer db.Close()
+
+	output := []DeletedCompanyOutput{}
+	for _, company := range companies {
+		output = append(output, DeletedCompanyOutput{Company: company, PurgeAt: company.DeletedAt.AddDate(0, 0, companyRetention())})
+	}
+
+	message := "You have successfully retrieved the deleted companies."
+	if len(output) == 0 {
+		message = "No more results."
+	}
+
+	resp = util.Message(true, http.StatusOK, message, errors)
+	resp["data"] = output
+
+	return resp
+}
+
+// Get the company deleted within the retention if the user owns or administers it
+func GetDeletedCompany(companyId, userId uuid.UUID) *Company {
+	company := &Company{}
+	db := GetDB()
+	deletedCompanies(db, userId).Where("companies.id = ?", companyId).First(company)
+	defer db.Close()
+
+	if company.ID == uuid.Nil {
+		return nil
+	}
+
+	return company
+}
+
+// Restore the deleted company along with its members and invitations
+func (company *Company) RestoreCompany(user *User, client Client) map[string]interface{} {
+	var errors []string
+	var resp map[string]interface{}
+
+	// Another company might have taken the slug in the meantime
+	if resp, ok := company.Validate(); !ok {
+		return resp
+	}
+
+	db := GetDB()
+	defer db.Close()
+
+	tx := db.Begin()
+	err := tx.Unscoped().Model(company).Update("DeletedAt", nil).Error
+
+	if err == nil {
+		err = RecordCompanyAuditEvent(tx, AuditCompanyRestored, company.ID, user.ID, user.ID, client, nil)
+	}
+
+	if err != nil {
+		tx.Rollback()
+		resp = util.Message(false, http.StatusInternalServerError, "Failed to restore the company, connection error.", errors)
+		return resp
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		resp = util.Message(false, http.StatusInternalServerError, "Failed to restore the company, connection error.", errors)
+		return resp
+	}
+
+	company.DeletedAt = nil
+
+	resp = util.Message(true, http.StatusOK, "You have successfully restored the company "+company.Name+".", errors)
+	resp["data"] = company
+
+	return resp
+}
+
+// Purge the deleted companies past the retention periodically, run in its own goroutine
+func RunCompanyPurger() {
+	ticker := time.NewTicker(companyPurgeInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		count, err := PurgeDeletedCompanies()
+		if err != nil {
+			log.Println("Failed to purge the deleted companies:", err)
+		}
+
+		if count > 0 {
+			log.Println("Purged", count, "deleted company(s).")
+		}
+	}
+}
+
+// Hard delete the companies deleted before the retention, return the number of companies purged
+func PurgeDeletedCompanies() (int, error) {
+	db := GetDB()
+	defer db.Close()
+
+	companies := []Company{}
+	err := db.Unscoped().Where("deleted_at < ?", time.Now().AddDate(0, 0, -companyRetention())).Find(&companies).Error
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for i := range companies {
+		if err := purgeCompany(db, &companies[i]); err != nil {
+			return count, err
+		}
+		count++
+	}
+
+	return count, nil
+}
+
+// Delete the company with its members, roles and invitations, the rest of its records are removed by the foreign keys
+func purgeCompany(db *gorm.DB, company *Company) error {
+	tx := db.Begin()
+
+	// The links in the invitation emails are no longer valid
+	invitationIds := []uuid.UUID{}
+	err := tx.Unscoped().Model(CompanyInvitationRequest{}).Where("company_id = ?", company.ID).Pluck("id", &invitationIds).Error
+
+	if err == nil && len(invitationIds) > 0 {
+		err = tx.Unscoped().Where("purpose = ? AND reference_id IN (?)", PurposeInvitation, invitationIds).Delete(VerificationToken{}).Error
+	}
+
+	// The members are deleted before the roles that they refer to
+	deletions := []interface{}{
+		CompanyInvitationRequest{},
+		CompanyUser{},
+		Role{},
+	}
+
+	for _, model := range deletions {
+		if err == nil {
+			err = tx.Unscoped().Where("company_id = ?", company.ID).Delete(model).Error
+		}
+	}
+
+	if err == nil {
+		err = tx.Unscoped().Delete(company).Error
+	}
+
+	if err == nil {
+		err = RecordAuditEvent(tx, AuditCompanyPurged, nil, Client{}, map[string]interface{}{
+			"companyId": company.ID,
+			"name":      company.Name,
+		})
+	}
+
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit().Error
+}
+
+// Query the companies deleted within the retention that the user owns or administers
+func deletedCompanies(db *gorm.DB, userId uuid.UUID) *gorm.DB {
+	return db.Unscoped().
+		Table("companies").
+		Select("companies.*").
+		Where("companies.deleted_at IS NOT NULL AND companies.deleted_at >= ?", time.Now().AddDate(0, 0, -companyRetention())).
+		Where(`companies.owner_id = ? OR EXISTS (SELECT 1 FROM company_users CU JOIN roles R ON R.id = CU.role_id
+			WHERE CU.company_id = companies.id AND CU.user_id = ? AND R.is_admin = ?)`, userId, userId, true)
+}
+
+// Get the retention in days configured in the environment
+func companyRetention() int {
+	if days, err := strconv.Atoi(os.Getenv("company_retention_days")); err == nil && days >= 0 {
+		return days
+	}
+
+	return companyRetentionDays
+}
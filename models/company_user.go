@@ -1,7 +1,10 @@
 package models
 
 import (
+	util "app/utils"
+	"github.com/jinzhu/gorm"
 	"github.com/satori/go.uuid"
+	"net/http"
 	"time"
 )
 
@@ -11,3 +14,252 @@ type CompanyUser struct {
 	RoleID      uuid.UUID  `gorm:"type:uuid"`
 	LastVisited *time.Time `gorm:"index:last_visited"`
 }
+
+// Change the role of the member of the company, the actor can only move the members between the roles within the permissions of the actor
+func (company *Company) ChangeMemberRole(actor *User, targetUserId, roleId uuid.UUID, client Client) map[string]interface{} {
+	var errors []string
+	var resp map[string]interface{}
+
+	db := GetDB()
+	defer db.Close()
+
+	member := company.getMember(db, targetUserId)
+	role := company.getRole(roleId)
+	if member == nil || role == nil {
+		resp = util.Message(false, http.StatusUnprocessableEntity, "No available result.", errors)
+		return resp
+	}
+
+	if member.RoleID == role.ID {
+		resp = util.Message(true, http.StatusOK, "The member already has the role "+role.Name+".", errors)
+		return resp
+	}
+
+	current := company.getRole(member.RoleID)
+	if current == nil {
+		current = &Role{}
+	}
+
+	if !actor.canAssignRole(company, current) || !actor.canAssignRole(company, role) {
+		resp = util.Message(false, http.StatusForbidden, "You cannot change the role of the member to or from a role with the permissions that you do not have.", errors)
+		return resp
+	}
+
+	if company.IsOwner(targetUserId) && !role.IsAdmin {
+		resp = util.Message(false, http.StatusUnprocessableEntity, "The owner of the company must stay an admin. Please transfer the ownership first.", errors)
+		return resp
+	}
+
+	// The admins are counted with their rows locked, so that the admins cannot demote each other at the same time
+	tx := db.Begin()
+	if current.IsAdmin && !role.IsAdmin && company.isSoleAdmin(tx, targetUserId) {
+		tx.Rollback()
+		resp = util.Message(false, http.StatusUnprocessableEntity, "The last admin of the company cannot be demoted. Please assign another admin first.", errors)
+		return resp
+	}
+
+	err := tx.Model(CompanyUser{}).
+		Where("company_id = ? AND user_id = ?", company.ID, targetUserId).
+		Update("RoleID", role.ID).Error
+
+	if err == nil {
+		err = RecordCompanyAuditEvent(tx, AuditMemberRoleChanged, company.ID, targetUserId, actor.ID, client, map[string]interface{}{
+			"fromRoleId": current.ID,
+			"fromRole":   current.Name,
+			"toRoleId":   role.ID,
+			"toRole":     role.Name,
+		})
+	}
+
+	if err != nil {
+		tx.Rollback()
+		resp = util.Message(false, http.StatusInternalServerError, "Failed to change the role of the member, connection error.", errors)
+		return resp
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		resp = util.Message(false, http.StatusInternalServerError, "Failed to change the role of the member, connection error.", errors)
+		return resp
+	}
+
+	resp = util.Message(true, http.StatusOK, "You have successfully changed the role of the member to "+role.Name+".", errors)
+	resp["data"] = role.output()
+
+	return resp
+}
+
+// Remove the member from the company, the invitation of the member is marked as removed
+func (company *Company) RemoveMember(actor *User, targetUserId uuid.UUID, client Client) map[string]interface{} {
+	var errors []string
+	var resp map[string]interface{}
+
+	if actor.ID == targetUserId {
+		resp = util.Message(false, http.StatusUnprocessableEntity, "You cannot remove yourself, please leave the company instead.", errors)
+		return resp
+	}
+
+	if company.IsOwner(targetUserId) {
+		resp = util.Message(false, http.StatusUnprocessableEntity, "The owner of the company cannot be removed.", errors)
+		return resp
+	}
+
+	db := GetDB()
+	defer db.Close()
+
+	member := company.getMember(db, targetUserId)
+	if member == nil {
+		resp = util.Message(false, http.StatusUnprocessableEntity, "No available result.", errors)
+		return resp
+	}
+
+	role := company.getRole(member.RoleID)
+	if role == nil {
+		role = &Role{}
+	}
+
+	if !actor.canAssignRole(company, role) {
+		resp = util.Message(false, http.StatusForbidden, "You cannot remove the member with the permissions that you do not have.", errors)
+		return resp
+	}
+
+	tx := db.Begin()
+	if role.IsAdmin && company.isSoleAdmin(tx, targetUserId) {
+		tx.Rollback()
+		resp = util.Message(false, http.StatusUnprocessableEntity, "The last admin of the company cannot be removed. Please assign another admin first.", errors)
+		return resp
+	}
+
+	if err := company.removeMember(tx, member, InvitationRemoved, AuditMemberRemoved, actor.ID, client); err != nil {
+		tx.Rollback()
+		resp = util.Message(false, http.StatusInternalServerError, "Failed to remove the member, connection error.", errors)
+		return resp
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		resp = util.Message(false, http.StatusInternalServerError, "Failed to remove the member, connection error.", errors)
+		return resp
+	}
+
+	resp = util.Message(true, http.StatusOK, "You have successfully removed the member from the company.", errors)
+
+	return resp
+}
+
+// Leave the company, the last admin has to assign another admin or delete the company instead
+func (user *User) LeaveCompany(company *Company, client Client) map[string]interface{} {
+	var errors []string
+	var resp map[string]interface{}
+
+	db := GetDB()
+	defer db.Close()
+
+	member := company.getMember(db, user.ID)
+	if member == nil {
+		resp = util.Message(false, http.StatusUnprocessableEntity, "No available result.", errors)
+		return resp
+	}
+
+	if company.IsOwner(user.ID) {
+		resp = util.Message(false, http.StatusUnprocessableEntity, "You are the owner of "+company.Name+". Please transfer the ownership or delete the company first.", errors)
+		return resp
+	}
+
+	tx := db.Begin()
+	if company.isSoleAdmin(tx, user.ID) {
+		tx.Rollback()
+		resp = util.Message(false, http.StatusUnprocessableEntity, "You are the last admin of "+company.Name+". Please assign another admin or delete the company first.", errors)
+		return resp
+	}
+
+	if err := company.removeMember(tx, member, InvitationLeft, AuditMemberLeft, user.ID, client); err != nil {
+		tx.Rollback()
+		resp = util.Message(false, http.StatusInternalServerError, "Failed to leave the company, connection error.", errors)
+		return resp
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		resp = util.Message(false, http.StatusInternalServerError, "Failed to leave the company, connection error.", errors)
+		return resp
+	}
+
+	resp = util.Message(true, http.StatusOK, "You have successfully left "+company.Name+".", errors)
+
+	return resp
+}
+
+// Delete the membership along with the teams and the company API keys of the member, and mark the invitation of the member
+// within the transaction
+func (company *Company) removeMember(tx *gorm.DB, member *CompanyUser, invitationStatus int, action string, actorId uuid.UUID, client Client) error {
+	user := GetUser(member.UserID)
+	if user == nil {
+		user = &User{}
+	}
+
+	err := tx.Where("company_id = ? AND user_id = ?", company.ID, member.UserID).Delete(CompanyUser{}).Error
+
+	if err == nil {
+		err = removeTeamMemberships(tx, company.ID, member.UserID)
+	}
+
+	if err == nil {
+		err = tx.Model(APIToken{}).
+			Where("company_id = ? AND user_id = ? AND revoked_at IS NULL", company.ID, member.UserID).
+			Update("RevokedAt", time.Now()).Error
+	}
+
+	if err == nil {
+		err = tx.Model(CompanyInvitationRequest{}).
+			Where("company_id = ? AND status = ? AND (user_id = ? OR email = ?)", company.ID, InvitationJoined, member.UserID, user.Email).
+			Update("Status", invitationStatus).Error
+	}
+
+	// The former member can no longer be nominated as the new owner
+	if err == nil {
+		err = tx.Model(CompanyOwnershipTransfer{}).
+			Where("company_id = ? AND to_user_id = ? AND status = ?", company.ID, member.UserID, ownershipTransferPending).
+			Updates(map[string]interface{}{"Status": ownershipTransferCancelled, "RespondedAt": time.Now()}).Error
+	}
+
+	if err == nil {
+		err = RecordCompanyAuditEvent(tx, action, company.ID, member.UserID, actorId, client, map[string]interface{}{
+			"roleId": member.RoleID,
+		})
+	}
+
+	return err
+}
+
+// Get the membership of the user in the company
+func (company *Company) getMember(db *gorm.DB, userId uuid.UUID) *CompanyUser {
+	member := &CompanyUser{}
+	db.Where("company_id = ? AND user_id = ?", company.ID, userId).First(member)
+
+	if member.UserID == uuid.Nil {
+		return nil
+	}
+
+	return member
+}
+
+// Check if the user is the only admin of the company, the admin rows are locked until the end of the transaction
+// so that the concurrent changes cannot remove the other admins after they are counted
+func (company *Company) isSoleAdmin(tx *gorm.DB, userId uuid.UUID) bool {
+	admins := []CompanyUser{}
+	tx.Raw(`SELECT company_users.* FROM company_users JOIN roles ON roles.id = company_users.role_id
+		WHERE company_users.company_id = ? AND roles.is_admin = ? FOR UPDATE OF company_users`, company.ID, true).
+		Scan(&admins)
+
+	return len(admins) == 1 && admins[0].UserID == userId
+}
+
+// Check if the user holds all the permissions of the role, so that the user cannot hand out or take away more than the user has
+func (user *User) canAssignRole(company *Company, role *Role) bool {
+	granted := user.GetPermissions(company)
+	for _, permission := range role.GetPermissions() {
+		if !contains(granted, permission) {
+			return false
+		}
+	}
+
+	return true
+}
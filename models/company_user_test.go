@@ -0,0 +1,64 @@
+package models
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestLastAdminGuard(t *testing.T) {
+	db := testDB(t)
+	defer db.Close()
+
+	admin := createTestUser(t, db, "Password123!")
+	defer deleteTestUser(db, admin)
+
+	other := createTestUser(t, db, "Password123!")
+	defer deleteTestUser(db, other)
+
+	company, adminRole, memberRole := createTestCompany(t, db, admin)
+	defer deleteTestCompany(db, company)
+
+	// Without the owner, only the last admin guard keeps the company administrable
+	db.Model(company).Update("OwnerID", nil)
+	company.OwnerID = nil
+
+	tests := []struct {
+		name        string
+		secondAdmin bool
+		change      func() map[string]interface{}
+		status      int
+	}{
+		{"demote the last admin", false, func() map[string]interface{} {
+			return company.ChangeMemberRole(admin, admin.ID, memberRole.ID, testClient)
+		}, http.StatusUnprocessableEntity},
+		{"leave as the last admin", false, func() map[string]interface{} {
+			return admin.LeaveCompany(company, testClient)
+		}, http.StatusUnprocessableEntity},
+		{"demote with another admin", true, func() map[string]interface{} {
+			return company.ChangeMemberRole(admin, admin.ID, memberRole.ID, testClient)
+		}, http.StatusOK},
+		{"remove with another admin", true, func() map[string]interface{} {
+			return company.RemoveMember(other, admin.ID, testClient)
+		}, http.StatusOK},
+	}
+
+	for _, test := range tests {
+		// Reset the memberships before every case
+		db.Unscoped().Where("company_id = ?", company.ID).Delete(CompanyUser{})
+		addTestMember(t, db, company, admin, adminRole)
+		if test.secondAdmin {
+			addTestMember(t, db, company, other, adminRole)
+		}
+
+		resp := test.change()
+		if resp["status"] != test.status {
+			t.Errorf("%s: status = %v, want %v", test.name, resp["status"], test.status)
+		}
+
+		admins := 0
+		db.Model(CompanyUser{}).Where("company_id = ? AND role_id = ?", company.ID, adminRole.ID).Count(&admins)
+		if admins == 0 {
+			t.Errorf("%s: the company is left without an admin", test.name)
+		}
+	}
+}
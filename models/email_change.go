@@ -0,0 +1,166 @@
+package models
+
+import (
+	"app/mailer"
+	util "app/utils"
+	"github.com/jinzhu/gorm"
+	"github.com/satori/go.uuid"
+	"golang.org/x/crypto/bcrypt"
+	"net/http"
+	"strings"
+)
+
+// Request to change the email address of the user, the new address has to be confirmed before it is used
+func (user *User) RequestEmailChange(newEmail, password string) map[string]interface{} {
+	var errors []string
+	var resp map[string]interface{}
+
+	db := GetDB()
+	defer db.Close()
+
+	// Get the user with the password
+	account := User{}
+	db.Table("users").Where("id = ?", user.ID).First(&account)
+
+	if account.ID != user.ID {
+		resp = util.Message(false, http.StatusUnprocessableEntity, "Something wrong has occured. Please try again.", errors)
+		return resp
+	}
+
+	if account.IsLocked() {
+		resp = util.Message(false, http.StatusLocked, "The account has been temporarily locked due to too many failed login attempts. Please try again later or reset your password.", errors)
+		return resp
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(account.Password), []byte(password)); err != nil {
+		account.registerFailedLogin()
+		resp = util.Message(false, http.StatusUnprocessableEntity, "The password is incorrect.", errors)
+		return resp
+	}
+
+	newEmail = strings.TrimSpace(newEmail)
+	if newEmail == account.Email {
+		resp = util.Message(false, http.StatusUnprocessableEntity, "The new email address is the same as the current one.", errors)
+		return resp
+	}
+
+	if GetUserByEmail(newEmail) != nil {
+		resp = util.Message(false, http.StatusUnprocessableEntity, "Email address has already been taken.", errors)
+		return resp
+	}
+
+	// Store the new email address in the token and queue the emails in the same transaction
+	tx := db.Begin()
+	token, err := CreateVerificationToken(tx, PurposeEmailChange, &account.ID, nil, newEmail)
+
+	var confirmation, notice *mailer.Message
+	if err == nil {
+		confirmation, err = mailer.NewEmailChangeEmail(account.Name, newEmail, token)
+	}
+
+	if err == nil {
+		notice, err = mailer.NewEmailChangedEmail(account.Name, account.Email, newEmail)
+	}
+
+	if err == nil {
+		err = QueueEmail(tx, nil, confirmation)
+	}
+
+	if err == nil {
+		err = QueueEmail(tx, nil, notice)
+	}
+
+	if err != nil {
+		tx.Rollback()
+		resp = util.Message(false, http.StatusInternalServerError, "Failed to send the confirmation email. Please try again.", errors)
+		return resp
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		resp = util.Message(false, http.StatusInternalServerError, "Failed to send the confirmation email. Please try again.", errors)
+		return resp
+	}
+
+	resp = util.Message(true, http.StatusOK, "A confirmation email has been sent to "+newEmail+". Please check the inbox to complete the change.", errors)
+
+	return resp
+}
+
+// Confirm the new email address with the token from the confirmation email and replace the current one
+func ConfirmEmailChange(token string) map[string]interface{} {
+	var errors []string
+	var resp map[string]interface{}
+
+	db := GetDB()
+	defer db.Close()
+
+	tx := db.Begin()
+	verificationToken, err := ConsumeVerificationToken(tx, PurposeEmailChange, token)
+	if err != nil || verificationToken.UserID == nil || verificationToken.Data == "" {
+		tx.Rollback()
+		resp = util.Message(false, http.StatusUnprocessableEntity, "Invalid/expired confirmation link.", errors)
+		return resp
+	}
+
+	user := User{}
+	tx.Where("id = ?", *verificationToken.UserID).First(&user)
+
+	if user.ID != *verificationToken.UserID {
+		tx.Rollback()
+		resp = util.Message(false, http.StatusUnprocessableEntity, "Invalid/expired confirmation link.", errors)
+		return resp
+	}
+
+	// The new email address might have been taken since the change was requested
+	newEmail := verificationToken.Data
+	temp := User{}
+	tx.Where("email = ? AND id <> ?", newEmail, user.ID).First(&temp)
+
+	if temp.Email != "" {
+		tx.Rollback()
+		resp = util.Message(false, http.StatusUnprocessableEntity, "Email address has already been taken.", errors)
+		return resp
+	}
+
+	oldEmail := user.Email
+	if err := tx.Model(&user).Update("Email", newEmail).Error; err != nil {
+		tx.Rollback()
+		resp = util.Message(false, http.StatusInternalServerError, "Failed to change the email address. Please try again.", errors)
+		return resp
+	}
+
+	if err := moveInvitations(tx, oldEmail, newEmail); err != nil {
+		tx.Rollback()
+		resp = util.Message(false, http.StatusInternalServerError, "Failed to change the email address. Please try again.", errors)
+		return resp
+	}
+
+	// The links sent to the old email address, ie. to reset the password or to login, no longer work
+	if err := tx.Where("user_id = ?", user.ID).Delete(VerificationToken{}).Error; err != nil {
+		tx.Rollback()
+		resp = util.Message(false, http.StatusInternalServerError, "Failed to change the email address. Please try again.", errors)
+		return resp
+	}
+
+	// Sign out everywhere, the account has to login again with the new email address
+	revokeUserSessions(tx, user.ID, uuid.Nil)
+
+	if err := tx.Commit().Error; err != nil {
+		resp = util.Message(false, http.StatusInternalServerError, "Failed to change the email address. Please try again.", errors)
+		return resp
+	}
+
+	user.Password = ""
+
+	resp = util.Message(true, http.StatusOK, "Your email address has been changed to "+newEmail+". Please login again with the new email address.", errors)
+	resp["data"] = user
+
+	return resp
+}
+
+// Move the pending invitations of the old email address to the new one, unless the company has already invited the new one
+func moveInvitations(tx *gorm.DB, oldEmail, newEmail string) error {
+	return tx.Exec(`UPDATE company_invitation_requests SET email = ?, updated_at = NOW()
+		WHERE email = ? AND status = ? AND deleted_at IS NULL
+		AND company_id NOT IN (SELECT company_id FROM company_invitation_requests WHERE email = ?)`, newEmail, oldEmail, InvitationPending, newEmail).Error
+}
@@ -0,0 +1,57 @@
+package models
+
+import (
+	"github.com/satori/go.uuid"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestConfirmEmailChangeSignsOut(t *testing.T) {
+	db := testDB(t)
+	defer db.Close()
+
+	user := createTestUser(t, db, "Password123!")
+	defer deleteTestUser(db, user)
+
+	session := &Session{UserID: user.ID, ExpiresAt: time.Now().Add(time.Hour)}
+	db.Create(session)
+
+	newEmail := "test-" + uuid.NewV4().String() + "@example.com"
+	token, err := CreateVerificationToken(db, PurposeEmailChange, &user.ID, nil, newEmail)
+	if err != nil {
+		t.Fatalf("Failed to create the confirmation token: %v", err)
+	}
+
+	for _, purpose := range []string{PurposeResetPassword, PurposeMagicLogin} {
+		if _, err := CreateVerificationToken(db, purpose, &user.ID, nil, ""); err != nil {
+			t.Fatalf("Failed to create the %s token: %v", purpose, err)
+		}
+	}
+
+	resp := ConfirmEmailChange(token)
+	if resp["status"] != http.StatusOK {
+		t.Fatalf("ConfirmEmailChange() = %v", resp)
+	}
+
+	tests := []struct {
+		name  string
+		model interface{}
+		where string
+	}{
+		{"verification tokens", VerificationToken{}, "user_id = ?"},
+		{"sessions", Session{}, "user_id = ? AND revoked_at IS NULL"},
+	}
+
+	for _, test := range tests {
+		count := 0
+		db.Model(test.model).Where(test.where, user.ID).Count(&count)
+		if count != 0 {
+			t.Errorf("%d %s are left, want none", count, test.name)
+		}
+	}
+
+	if got := GetUser(user.ID); got == nil || got.Email != newEmail {
+		t.Errorf("The email address is not changed to %s", newEmail)
+	}
+}
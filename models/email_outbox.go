@@ -0,0 +1,235 @@
+package models
+
+import (
+	"app/mailer"
+	util "app/utils"
+	"github.com/jinzhu/gorm"
+	"github.com/satori/go.uuid"
+	"log"
+	"net/http"
+	"time"
+)
+
+const (
+	emailPending = iota
+	emailSent
+	emailFailed
+)
+
+const (
+	emailMaxAttempts       = 8
+	emailBaseRetryInterval = time.Second * 30
+	emailMaxRetryInterval  = time.Hour * 2
+	emailDispatchInterval  = time.Second * 10
+	emailDispatchBatchSize = 20
+	emailPurgeInterval     = time.Hour
+	emailRetention         = time.Hour * 24 * 30 // How long the sent and failed emails are kept for the delivery history
+)
+
+var EmailStatus = []string{
+	"Pending",
+	"Sent",
+	"Failed",
+}
+
+// Email waiting to be delivered, written in the same transaction as the change that triggers it
+type EmailOutbox struct {
+	Base
+	CompanyID     *uuid.UUID `json:"companyId" gorm:"type:uuid;index"`
+	Recipient     string     `json:"recipient" gorm:"not null"`
+	Subject       string     `json:"subject" gorm:"not null"`
+	TextBody      string     `json:"-" sql:"type:text"` // Cleared once the email is sent or has failed, as it may contain the links with the tokens
+	HTMLBody      string     `json:"-" sql:"type:text"`
+	Status        int        `json:"status" gorm:"default:'0';index"`
+	Attempts      int        `json:"attempts" gorm:"default:'0'"`
+	NextAttemptAt time.Time  `json:"nextAttemptAt" gorm:"index"`
+	LastError     string     `json:"lastError" sql:"type:text"`
+	SentAt        *time.Time `json:"sentAt"`
+}
+
+type EmailOutboxOutput struct {
+	EmailOutbox
+	StatusName string `json:"statusName"`
+}
+
+func (EmailOutbox) TableName() string {
+	return "email_outbox"
+}
+
+// Queue the email to be sent by the dispatcher, pass in the transaction of the triggering change
+func QueueEmail(tx *gorm.DB, companyId *uuid.UUID, msg *mailer.Message) error {
+	for _, recipient := range msg.To {
+		email := EmailOutbox{
+			CompanyID:     companyId,
+			Recipient:     recipient,
+			Subject:       msg.Subject,
+			TextBody:      msg.Text,
+			HTMLBody:      msg.HTML,
+			NextAttemptAt: time.Now(),
+		}
+
+		if err := tx.Create(&email).Error; err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Get the pending and failed emails of the company
+func (company *Company) GetEmailOutbox(status string, page int) map[string]interface{} {
+	var errors []string
+	var resp map[string]interface{}
+	const resultsPerPage int = 25
+
+	db := GetDB()
+	emails := []EmailOutbox{}
+
+	query := db.Where("company_id = ?", company.ID)
+	switch status {
+	case "pending":
+		query = query.Where("status = ?", emailPending)
+	case "sent":
+		query = query.Where("status = ?", emailSent)
+	case "failed":
+		query = query.Where("status = ?", emailFailed)
+	default:
+		query = query.Where("status IN (?)", []int{emailPending, emailFailed})
+	}
+
+	if page <= 0 {
+		query.Order("created_at desc").Find(&emails)
+	} else {
+		offset := resultsPerPage * (page - 1)
+		query.Order("created_at desc").Offset(offset).Limit(resultsPerPage).Find(&emails)
+	}
+
+	defer db.Close()
+
+	result := []EmailOutboxOutput{}
+	for _, email := range emails {
+		result = append(result, EmailOutboxOutput{EmailOutbox: email, StatusName: EmailStatus[email.Status]})
+	}
+
+	message := "You have successfully retrieved the emails of the company."
+	if len(result) == 0 {
+		message = "No more results."
+	}
+
+	resp = util.Message(true, http.StatusOK, message, errors)
+	resp["data"] = result
+
+	return resp
+}
+
+// Keep dispatching the queued emails in the background, and purge the old emails
+func RunEmailDispatcher() {
+	ticker := time.NewTicker(emailDispatchInterval)
+	defer ticker.Stop()
+
+	purgeTicker := time.NewTicker(emailPurgeInterval)
+	defer purgeTicker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			for {
+				count, err := DispatchEmails()
+				if err != nil {
+					log.Println("Failed to dispatch emails:", err)
+				}
+
+				// Continue with the next batch only if the batch is full
+				if err != nil || count < emailDispatchBatchSize {
+					break
+				}
+			}
+		case <-purgeTicker.C:
+			if err := PurgeEmails(); err != nil {
+				log.Println("Failed to purge emails:", err)
+			}
+		}
+	}
+}
+
+// Delete the sent and failed emails that are older than the retention
+func PurgeEmails() error {
+	db := GetDB()
+	defer db.Close()
+
+	return db.Unscoped().
+		Where("status IN (?) AND updated_at < ?", []int{emailSent, emailFailed}, time.Now().Add(-emailRetention)).
+		Delete(EmailOutbox{}).Error
+}
+
+// Send a batch of the due emails, return the number of emails processed
+func DispatchEmails() (int, error) {
+	db := GetDB()
+	defer db.Close()
+
+	tx := db.Begin()
+	if err := tx.Error; err != nil {
+		return 0, err
+	}
+
+	// Lock the rows so that multiple instances do not send the same email
+	emails := []EmailOutbox{}
+	err := tx.Set("gorm:query_option", "FOR UPDATE SKIP LOCKED").
+		Where("status = ? AND next_attempt_at <= ?", emailPending, time.Now()).
+		Order("next_attempt_at asc").
+		Limit(emailDispatchBatchSize).
+		Find(&emails).Error
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	for _, email := range emails {
+		msg := &mailer.Message{
+			To:      []string{email.Recipient},
+			Subject: email.Subject,
+			Text:    email.TextBody,
+			HTML:    email.HTMLBody,
+		}
+
+		now := time.Now()
+		updates := map[string]interface{}{"Attempts": email.Attempts + 1}
+
+		if err := mailer.Send(msg); err != nil {
+			updates["LastError"] = err.Error()
+			if email.Attempts+1 >= emailMaxAttempts {
+				updates["Status"] = emailFailed
+				updates["TextBody"] = ""
+				updates["HTMLBody"] = ""
+			} else {
+				updates["NextAttemptAt"] = now.Add(emailRetryInterval(email.Attempts + 1))
+			}
+		} else {
+			updates["Status"] = emailSent
+			updates["SentAt"] = now
+			updates["LastError"] = ""
+			updates["TextBody"] = ""
+			updates["HTMLBody"] = ""
+		}
+
+		if err := tx.Model(&email).Updates(updates).Error; err != nil {
+			tx.Rollback()
+			return 0, err
+		}
+	}
+
+	return len(emails), tx.Commit().Error
+}
+
+// Exponential backoff of the retry, ie. 30s, 1m, 2m, 4m... up to the maximum interval
+func emailRetryInterval(attempts int) time.Duration {
+	interval := emailBaseRetryInterval
+	for i := 1; i < attempts; i++ {
+		interval *= 2
+		if interval >= emailMaxRetryInterval {
+			return emailMaxRetryInterval
+		}
+	}
+
+	return interval
+}
@@ -0,0 +1,78 @@
+package models
+
+import (
+	"github.com/jinzhu/gorm"
+	"github.com/satori/go.uuid"
+	"testing"
+	"time"
+)
+
+var testClient = Client{IP: "127.0.0.1", UserAgent: "go-test"}
+
+// Get the connection to the test database, the test is skipped if the database is not available
+func testDB(t *testing.T) *gorm.DB {
+	db := GetDB()
+	if db == nil || db.DB().Ping() != nil {
+		t.Skip("The database is not available.")
+	}
+
+	return db
+}
+
+// Create the activated user with the unique email, the user is deleted at the end of the test
+func createTestUser(t *testing.T, db *gorm.DB, password string) *User {
+	hashedPassword, err := hashPassword(password)
+	if err != nil {
+		t.Fatalf("Failed to hash the password: %v", err)
+	}
+
+	now := time.Now()
+	user := &User{
+		Name:        "Test User",
+		Email:       "test-" + uuid.NewV4().String() + "@example.com",
+		Password:    hashedPassword,
+		ActivatedAt: &now,
+	}
+
+	if err := db.Create(user).Error; err != nil {
+		t.Fatalf("Failed to create the user: %v", err)
+	}
+
+	return user
+}
+
+func deleteTestUser(db *gorm.DB, user *User) {
+	db.Unscoped().Where("user_id = ?", user.ID).Delete(CompanyUser{})
+	db.Unscoped().Delete(user)
+}
+
+// Create the company with the admin and the default member role, the company is deleted at the end of the test
+func createTestCompany(t *testing.T, db *gorm.DB, admin *User) (*Company, *Role, *Role) {
+	company := &Company{Name: "Test Company", Slug: "test-" + uuid.NewV4().String(), OwnerID: &admin.ID}
+	if err := db.Create(company).Error; err != nil {
+		t.Fatalf("Failed to create the company: %v", err)
+	}
+
+	adminRole := &Role{Name: "Admin", IsAdmin: true, CompanyID: company.ID}
+	memberRole := &Role{Name: "Member", IsDefault: true, CompanyID: company.ID}
+	db.Create(adminRole)
+	db.Create(memberRole)
+
+	addTestMember(t, db, company, admin, adminRole)
+
+	return company, adminRole, memberRole
+}
+
+func addTestMember(t *testing.T, db *gorm.DB, company *Company, user *User, role *Role) {
+	member := &CompanyUser{CompanyID: company.ID, UserID: user.ID, RoleID: role.ID}
+	if err := db.Create(member).Error; err != nil {
+		t.Fatalf("Failed to add the member: %v", err)
+	}
+}
+
+func deleteTestCompany(db *gorm.DB, company *Company) {
+	db.Unscoped().Where("company_id = ?", company.ID).Delete(CompanyUser{})
+	db.Unscoped().Where("company_id = ?", company.ID).Delete(CompanyInvitationRequest{})
+	db.Unscoped().Where("company_id = ?", company.ID).Delete(Role{})
+	db.Unscoped().Delete(company)
+}
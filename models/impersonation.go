@@ -0,0 +1,212 @@
+package models
+
+import (
+	util "app/utils"
+	"errors"
+	"github.com/jinzhu/gorm"
+	"github.com/satori/go.uuid"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+const (
+	impersonationDefaultMinutes = 30 // Default duration of the impersonation
+	impersonationMaxMinutes     = 60 // The impersonation can never last longer than this, whatever is configured
+)
+
+// Support session of the superuser acting as another user, its ID is the session ID of the impersonation token
+type Impersonation struct {
+	Base
+	ImpersonatorID uuid.UUID  `json:"impersonatorId" gorm:"type:uuid;not null;index"`
+	UserID         uuid.UUID  `json:"userId" gorm:"type:uuid;not null;index"`
+	Reason         string     `json:"reason" sql:"type:text"`
+	TokenID        uuid.UUID  `json:"-" gorm:"type:uuid"`
+	ExpiresAt      time.Time  `json:"expiresAt" gorm:"not null"`
+	EndedAt        *time.Time `json:"endedAt"`
+}
+
+// Issue the token for the superuser to act as the user, the token cannot be refreshed and expires with the impersonation
+func (user *User) Impersonate(targetUserId uuid.UUID, reason string, client Client) map[string]interface{} {
+	var errors []string
+	var resp map[string]interface{}
+
+	target := GetUser(targetUserId)
+	if target == nil {
+		resp = util.Message(false, http.StatusUnprocessableEntity, "No result available.", errors)
+		return resp
+	}
+
+	now := time.Now()
+	impersonation := &Impersonation{
+		ImpersonatorID: user.ID,
+		UserID:         target.ID,
+		Reason:         reason,
+		TokenID:        uuid.NewV4(),
+		ExpiresAt:      now.Add(time.Minute * time.Duration(impersonationMinutes())),
+	}
+
+	db := GetDB()
+	defer db.Close()
+
+	tx := db.Begin()
+	if err := tx.Create(impersonation).Error; err != nil {
+		tx.Rollback()
+		resp = util.Message(false, http.StatusInternalServerError, "Failed to impersonate the user, connection error.", errors)
+		return resp
+	}
+
+	tk := &Token{UserId: target.ID, SessionId: impersonation.ID, ImpersonatorId: user.ID, Expiry: impersonation.ExpiresAt}
+	tk.Id = impersonation.TokenID.String()
+	tk.ExpiresAt = impersonation.ExpiresAt.Unix()
+	tokenString, err := SignToken(tk)
+
+	if err == nil {
+		err = recordImpersonationEvent(tx, AuditImpersonationStarted, impersonation, client, map[string]interface{}{
+			"reason":    reason,
+			"expiresAt": impersonation.ExpiresAt,
+		})
+	}
+
+	if err != nil {
+		tx.Rollback()
+		resp = util.Message(false, http.StatusInternalServerError, "Failed to impersonate the user, connection error.", errors)
+		return resp
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		resp = util.Message(false, http.StatusInternalServerError, "Failed to impersonate the user, connection error.", errors)
+		return resp
+	}
+
+	target.Token = tokenString
+
+	resp = util.Message(true, http.StatusOK, "You are now impersonating "+target.Email+" until "+impersonation.ExpiresAt.Format(time.RFC1123)+".", errors)
+	resp["data"] = target
+	resp["impersonation"] = impersonation
+
+	return resp
+}
+
+// End the impersonation before it expires, the token is revoked
+func EndImpersonation(impersonationId uuid.UUID, client Client) map[string]interface{} {
+	var errors []string
+	var resp map[string]interface{}
+
+	db := GetDB()
+	defer db.Close()
+
+	impersonation := Impersonation{}
+	db.Where("id = ? AND ended_at IS NULL", impersonationId).First(&impersonation)
+
+	if impersonation.ID == uuid.Nil {
+		resp = util.Message(false, http.StatusUnprocessableEntity, "The impersonation has already ended.", errors)
+		return resp
+	}
+
+	now := time.Now()
+	tx := db.Begin()
+	err := tx.Model(&impersonation).Update("EndedAt", now).Error
+
+	if err == nil {
+		err = revokeAccessToken(tx, impersonation.TokenID, impersonation.ExpiresAt)
+	}
+
+	if err == nil {
+		err = recordImpersonationEvent(tx, AuditImpersonationEnded, &impersonation, client, nil)
+	}
+
+	if err != nil {
+		tx.Rollback()
+		resp = util.Message(false, http.StatusInternalServerError, "Failed to end the impersonation, connection error.", errors)
+		return resp
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		resp = util.Message(false, http.StatusInternalServerError, "Failed to end the impersonation, connection error.", errors)
+		return resp
+	}
+
+	resp = util.Message(true, http.StatusOK, "The impersonation has ended.", errors)
+
+	return resp
+}
+
+// Check if the impersonation is still ongoing and the impersonator is still a superuser
+func IsImpersonationActive(impersonationId uuid.UUID) bool {
+	db := GetDB()
+	defer db.Close()
+
+	impersonation := Impersonation{}
+	db.Table("impersonations").
+		Joins("JOIN users ON users.id = impersonations.impersonator_id").
+		Select("impersonations.*").
+		Where("impersonations.id = ? AND impersonations.ended_at IS NULL AND impersonations.expires_at > ?", impersonationId, time.Now()).
+		Where("users.is_superuser = ? AND users.deleted_at IS NULL", true).
+		Scan(&impersonation)
+
+	return impersonation.ID != uuid.Nil
+}
+
+// Record the request made under the impersonation in the audit trail
+func RecordImpersonatedRequest(impersonationId uuid.UUID, method, path string, client Client) {
+	db := GetDB()
+	defer db.Close()
+
+	impersonation := Impersonation{}
+	db.Where("id = ?", impersonationId).First(&impersonation)
+
+	err := recordImpersonationEvent(db, AuditImpersonatedRequest, &impersonation, client, map[string]interface{}{
+		"method": method,
+		"path":   path,
+	})
+
+	if err != nil {
+		log.Println("Failed to record the impersonated request:", err)
+	}
+}
+
+// Grant or revoke the superuser flag of the user
+func SetSuperuser(email string, superuser bool) (*User, error) {
+	user := GetUserByEmail(email)
+	if user == nil {
+		return nil, errors.New("The user " + email + " does not exist.")
+	}
+
+	db := GetDB()
+	defer db.Close()
+
+	if err := db.Model(user).Update("IsSuperuser", superuser).Error; err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// Record the audit event on the impersonated user with the superuser as the actor
+func recordImpersonationEvent(db *gorm.DB, action string, impersonation *Impersonation, client Client, data map[string]interface{}) error {
+	if data == nil {
+		data = map[string]interface{}{}
+	}
+	data["impersonationId"] = impersonation.ID
+
+	client.ImpersonatorID = &impersonation.ImpersonatorID
+
+	return RecordAuditEvent(db, action, &impersonation.UserID, client, data)
+}
+
+// Get the duration of the impersonation in minutes configured in the environment
+func impersonationMinutes() int {
+	minutes, err := strconv.Atoi(os.Getenv("impersonation_minutes"))
+	if err != nil || minutes <= 0 {
+		minutes = impersonationDefaultMinutes
+	}
+
+	if minutes > impersonationMaxMinutes {
+		minutes = impersonationMaxMinutes
+	}
+
+	return minutes
+}
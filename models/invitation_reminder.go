@@ -0,0 +1,124 @@
+package models
+
+import (
+	"app/mailer"
+	"github.com/jinzhu/gorm"
+	"log"
+	"os"
+	"strconv"
+	"time"
+)
+
+const (
+	invitationExpiryDays        = 14             // Default number of days the invitation is valid
+	invitationReminderDays      = 3              // Default number of days before the expiry that the reminder is sent
+	invitationReminderMinAge    = time.Hour * 24 // The reminder is not sent right after the invitation
+	invitationSchedulerInterval = time.Hour      // How often the invitations are expired and reminded
+)
+
+// Expire the invitations and send the reminders periodically, run in its own goroutine
+func RunInvitationScheduler() {
+	ticker := time.NewTicker(invitationSchedulerInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		count, err := ExpireInvitations()
+		if err != nil {
+			log.Println("Failed to expire the invitations:", err)
+		}
+
+		if count > 0 {
+			log.Println("Expired", count, "invitation(s).")
+		}
+
+		count, err = SendInvitationReminders()
+		if err != nil {
+			log.Println("Failed to send the invitation reminders:", err)
+		}
+
+		if count > 0 {
+			log.Println("Sent", count, "invitation reminder(s).")
+		}
+	}
+}
+
+// Mark the pending invitations past their expiry as expired, return the number of invitations expired
+func ExpireInvitations() (int, error) {
+	db := GetDB()
+	defer db.Close()
+
+	result := db.Model(CompanyInvitationRequest{}).
+		Where("status = ? AND expires_at <= ?", InvitationPending, time.Now()).
+		Update("Status", InvitationExpired)
+
+	return int(result.RowsAffected), result.Error
+}
+
+// Remind the invited emails of the invitations that are about to expire, return the number of reminders sent
+func SendInvitationReminders() (int, error) {
+	db := GetDB()
+	defer db.Close()
+
+	now := time.Now()
+	invitations := []CompanyInvitationRequest{}
+	err := db.Where("status = ? AND reminded_at IS NULL AND expires_at > ? AND expires_at <= ? AND sent_at <= ?",
+		InvitationPending, now, now.AddDate(0, 0, invitationReminder()), now.Add(-invitationReminderMinAge)).
+		Find(&invitations).Error
+
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for i := range invitations {
+		invitation := &invitations[i]
+
+		// The company might have been deleted
+		company := GetCompanyByID(invitation.CompanyID)
+		if company == nil {
+			continue
+		}
+
+		tx := db.Begin()
+		if err := sendInvitationReminder(tx, company, invitation); err != nil {
+			tx.Rollback()
+			return count, err
+		}
+
+		if err := tx.Commit().Error; err != nil {
+			return count, err
+		}
+		count++
+	}
+
+	return count, nil
+}
+
+// Email the reminder with another link, as only the hash of the previous link is kept, the link sent before stays valid
+// and the expiry stays the same
+func sendInvitationReminder(tx *gorm.DB, company *Company, invitation *CompanyInvitationRequest) error {
+	token, err := addVerificationToken(tx, PurposeInvitation, nil, &invitation.ID, "", *invitation.ExpiresAt)
+	if err != nil {
+		return err
+	}
+
+	msg, err := mailer.NewInvitationReminderEmail(invitation.Email, company.Name, token, *invitation.ExpiresAt)
+	if err != nil {
+		return err
+	}
+
+	if err := QueueEmail(tx, &company.ID, msg); err != nil {
+		return err
+	}
+
+	return tx.Model(invitation).Update("RemindedAt", time.Now()).Error
+}
+
+// Get the number of days before the expiry to send the reminder configured in the environment
+func invitationReminder() int {
+	if days, err := strconv.Atoi(os.Getenv("invitation_reminder_days")); err == nil && days >= 0 {
+		return days
+	}
+
+	return invitationReminderDays
+}
@@ -0,0 +1,51 @@
+package models
+
+import (
+	"github.com/satori/go.uuid"
+	"testing"
+	"time"
+)
+
+func TestSendInvitationReminderKeepsLink(t *testing.T) {
+	db := testDB(t)
+	defer db.Close()
+
+	admin := createTestUser(t, db, "Password123!")
+	defer deleteTestUser(db, admin)
+
+	company, _, _ := createTestCompany(t, db, admin)
+	defer deleteTestCompany(db, company)
+
+	expiresAt := time.Now().AddDate(0, 0, 2)
+	invitation := &CompanyInvitationRequest{
+		CompanyID: company.ID,
+		Email:     "test-" + uuid.NewV4().String() + "@example.com",
+		ExpiresAt: &expiresAt,
+	}
+	if err := db.Create(invitation).Error; err != nil {
+		t.Fatalf("Failed to create the invitation: %v", err)
+	}
+	defer db.Where("reference_id = ?", invitation.ID).Delete(VerificationToken{})
+
+	sent, err := createVerificationToken(db, PurposeInvitation, nil, &invitation.ID, "", expiresAt)
+	if err != nil {
+		t.Fatalf("Failed to create the token: %v", err)
+	}
+
+	tx := db.Begin()
+	if err := sendInvitationReminder(tx, company, invitation); err != nil {
+		tx.Rollback()
+		t.Fatalf("sendInvitationReminder() returned the error: %v", err)
+	}
+	tx.Commit()
+
+	if GetVerificationToken(db, PurposeInvitation, sent) == nil {
+		t.Error("The link sent with the invitation is no longer valid after the reminder")
+	}
+
+	count := 0
+	db.Model(VerificationToken{}).Where("purpose = ? AND reference_id = ?", PurposeInvitation, invitation.ID).Count(&count)
+	if count != 2 {
+		t.Errorf("The invitation has %d link(s), want 2", count)
+	}
+}
@@ -0,0 +1,103 @@
+package models
+
+import (
+	"app/mailer"
+	util "app/utils"
+	"github.com/satori/go.uuid"
+	"log"
+	"net/http"
+	"time"
+)
+
+const magicLoginInterval = time.Minute // How often the login link can be sent to the same user
+
+// Email the one-time login link to the user
+// The same response is returned whether the link is sent or not, so that the response does not reveal if the account exists
+func (user *User) SendMagicLogin() map[string]interface{} {
+	var errors []string
+	var resp map[string]interface{}
+
+	resp = util.Message(true, http.StatusOK, "If the account exists, a login link has been sent to it. Please check your inbox.", errors)
+
+	// Get the user by email
+	user = GetUserByEmail(user.Email)
+
+	// The link is not sent to the accounts that cannot login with it
+	if user == nil || !user.IsActivated() || user.IsLocked() || GetSSOEnforcingCompany(user) != nil {
+		return resp
+	}
+
+	db := GetDB()
+	defer db.Close()
+
+	// Prevent flooding the inbox of the user
+	recent := VerificationToken{}
+	db.Where("purpose = ? AND user_id = ? AND created_at > ?", PurposeMagicLogin, user.ID, time.Now().Add(-magicLoginInterval)).First(&recent)
+	if recent.ID != uuid.Nil {
+		return resp
+	}
+
+	// Store the login token and queue the email in the same transaction
+	tx := db.Begin()
+	token, err := CreateVerificationToken(tx, PurposeMagicLogin, &user.ID, nil, "")
+
+	var msg *mailer.Message
+	if err == nil {
+		msg, err = mailer.NewMagicLoginEmail(user.Name, user.Email, token)
+	}
+
+	if err == nil {
+		err = QueueEmail(tx, nil, msg)
+	}
+
+	if err != nil {
+		tx.Rollback()
+		log.Println("Failed to send the login link:", err)
+		return resp
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		log.Println("Failed to send the login link:", err)
+	}
+
+	return resp
+}
+
+// Log in the user with the one-time login link
+func RedeemMagicLogin(token string, client Client) map[string]interface{} {
+	var errors []string
+	var resp map[string]interface{}
+
+	db := GetDB()
+	defer db.Close()
+
+	verificationToken, err := ConsumeVerificationToken(db, PurposeMagicLogin, token)
+	if err != nil || verificationToken.UserID == nil {
+		resp = util.Message(false, http.StatusUnprocessableEntity, "Invalid/expired login link.", errors)
+		return resp
+	}
+
+	user := GetUser(*verificationToken.UserID)
+	if user == nil {
+		resp = util.Message(false, http.StatusUnprocessableEntity, "Invalid/expired login link.", errors)
+		return resp
+	}
+
+	if !user.IsActivated() {
+		resp = util.Message(false, http.StatusUnprocessableEntity, "The account has not been activated yet. Please activate the account first.", errors)
+		return resp
+	}
+
+	if user.IsLocked() {
+		resp = util.Message(false, http.StatusLocked, "The account has been temporarily locked due to too many failed login attempts. Please try again later or reset your password.", errors)
+		return resp
+	}
+
+	if company := GetSSOEnforcingCompany(user); company != nil {
+		resp = util.Message(false, http.StatusForbidden, "Your company requires you to login with single sign-on.", errors)
+		resp["sso"] = company.Slug
+		return resp
+	}
+
+	return user.authenticated(db, client)
+}
@@ -0,0 +1,53 @@
+package models
+
+import (
+	"github.com/satori/go.uuid"
+	"reflect"
+	"testing"
+)
+
+func TestSendMagicLoginSameResponse(t *testing.T) {
+	db := testDB(t)
+	defer db.Close()
+
+	activated := createTestUser(t, db, "Password123!")
+	defer deleteTestUser(db, activated)
+
+	unactivated := createTestUser(t, db, "Password123!")
+	defer deleteTestUser(db, unactivated)
+	db.Model(unactivated).Update("ActivatedAt", nil)
+
+	tests := []struct {
+		name     string
+		email    string
+		user     *User
+		wantLink bool
+	}{
+		{"unknown email", "unknown-" + uuid.NewV4().String() + "@example.com", nil, false},
+		{"unactivated user", unactivated.Email, unactivated, false},
+		{"activated user", activated.Email, activated, true},
+		{"link sent just now", activated.Email, activated, true},
+	}
+
+	var want map[string]interface{}
+	for _, test := range tests {
+		resp := (&User{Email: test.email}).SendMagicLogin()
+		if want == nil {
+			want = resp
+		}
+
+		if !reflect.DeepEqual(resp, want) {
+			t.Errorf("%s: SendMagicLogin() = %v, want the same response %v", test.name, resp, want)
+		}
+
+		if test.user == nil {
+			continue
+		}
+
+		count := 0
+		db.Model(VerificationToken{}).Where("purpose = ? AND user_id = ?", PurposeMagicLogin, test.user.ID).Count(&count)
+		if (count > 0) != test.wantLink {
+			t.Errorf("%s: the link is sent = %v, want %v", test.name, count > 0, test.wantLink)
+		}
+	}
+}
@@ -0,0 +1,274 @@
+package models
+
+import (
+	"app/mailer"
+	pwpolicy "app/password"
+	util "app/utils"
+	"github.com/jinzhu/gorm"
+	"github.com/satori/go.uuid"
+	"golang.org/x/crypto/bcrypt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+const maxPasswordHistory = 24 // How many previous passwords are kept for each user
+
+// Password policy of the company, the members have to meet the stricter one of it and the policy of the deployment
+type CompanyPasswordPolicy struct {
+	Base
+	CompanyID        uuid.UUID `json:"companyId" gorm:"type:uuid;not null;unique_index"`
+	MinLength        int       `json:"minLength" gorm:"default:0"`
+	RequireUpper     bool      `json:"requireUpper" gorm:"default:false"`
+	RequireLower     bool      `json:"requireLower" gorm:"default:false"`
+	RequireDigit     bool      `json:"requireDigit" gorm:"default:false"`
+	RequireSymbol    bool      `json:"requireSymbol" gorm:"default:false"`
+	DisallowPersonal bool      `json:"disallowPersonal" gorm:"default:false"`
+	History          int       `json:"history" gorm:"default:0"`
+}
+
+// Previous password of the user, to prevent the passwords from being reused
+type PasswordHistory struct {
+	Base
+	UserID       uuid.UUID `gorm:"type:uuid;not null;index"`
+	PasswordHash string    `gorm:"not null"`
+}
+
+func (CompanyPasswordPolicy) TableName() string {
+	return "company_password_policies"
+}
+
+func (PasswordHistory) TableName() string {
+	return "password_histories"
+}
+
+// Convert the company settings to the policy
+func (companyPolicy *CompanyPasswordPolicy) Policy() pwpolicy.Policy {
+	return pwpolicy.Policy{
+		MinLength:        companyPolicy.MinLength,
+		RequireUpper:     companyPolicy.RequireUpper,
+		RequireLower:     companyPolicy.RequireLower,
+		RequireDigit:     companyPolicy.RequireDigit,
+		RequireSymbol:    companyPolicy.RequireSymbol,
+		DisallowPersonal: companyPolicy.DisallowPersonal,
+		History:          companyPolicy.History,
+	}
+}
+
+// Get the password policy set by the company alone
+func (company *Company) passwordPolicy(db *gorm.DB) pwpolicy.Policy {
+	companyPolicy := CompanyPasswordPolicy{}
+	db.Where("company_id = ?", company.ID).First(&companyPolicy)
+
+	return companyPolicy.Policy()
+}
+
+// Get the password policy of the company, along with the policy of the deployment
+func (company *Company) GetPasswordPolicy() map[string]interface{} {
+	var errors []string
+	var resp map[string]interface{}
+
+	db := GetDB()
+	companyPolicy := CompanyPasswordPolicy{CompanyID: company.ID}
+	db.Where("company_id = ?", company.ID).First(&companyPolicy)
+	defer db.Close()
+
+	resp = util.Message(true, http.StatusOK, "You have successfully retrieved the password policy.", errors)
+	resp["data"] = companyPolicy
+	resp["default"] = pwpolicy.Default()
+
+	return resp
+}
+
+// Update the password policy of the company, it only applies to the passwords set from now on
+func (company *Company) UpdatePasswordPolicy(input *CompanyPasswordPolicy) map[string]interface{} {
+	var errors []string
+	var resp map[string]interface{}
+
+	defaultPolicy := pwpolicy.Default()
+
+	if input.MinLength < 0 || (defaultPolicy.MaxLength > 0 && input.MinLength > defaultPolicy.MaxLength) {
+		errors = append(errors, "MinLength must be between 0 and "+strconv.Itoa(defaultPolicy.MaxLength)+".")
+	}
+
+	if input.History < 0 || input.History > maxPasswordHistory {
+		errors = append(errors, "History must be between 0 and "+strconv.Itoa(maxPasswordHistory)+".")
+	}
+
+	if len(errors) > 0 {
+		resp = util.Message(false, http.StatusUnprocessableEntity, "Validation error", errors)
+		return resp
+	}
+
+	db := GetDB()
+	defer db.Close()
+
+	companyPolicy := CompanyPasswordPolicy{}
+	db.Where("company_id = ?", company.ID).First(&companyPolicy)
+	companyPolicy.CompanyID = company.ID
+	companyPolicy.MinLength = input.MinLength
+	companyPolicy.RequireUpper = input.RequireUpper
+	companyPolicy.RequireLower = input.RequireLower
+	companyPolicy.RequireDigit = input.RequireDigit
+	companyPolicy.RequireSymbol = input.RequireSymbol
+	companyPolicy.DisallowPersonal = input.DisallowPersonal
+	companyPolicy.History = input.History
+
+	if err := db.Save(&companyPolicy).Error; err != nil {
+		resp = util.Message(false, http.StatusInternalServerError, "Failed to update the password policy, connection error.", errors)
+		return resp
+	}
+
+	resp = util.Message(true, http.StatusOK, "You have successfully updated the password policy.", errors)
+	resp["data"] = companyPolicy
+
+	return resp
+}
+
+// Get the policy that applies to the user, which is the stricter of the deployment and the companies of the user
+func (user *User) passwordPolicy(db *gorm.DB) pwpolicy.Policy {
+	policy := pwpolicy.Default()
+	if user.ID == uuid.Nil {
+		return policy
+	}
+
+	companyPolicies := []CompanyPasswordPolicy{}
+	db.Table("company_password_policies").
+		Joins("JOIN company_users ON company_users.company_id = company_password_policies.company_id").
+		Select("company_password_policies.*").
+		Where("company_users.user_id = ? AND company_password_policies.deleted_at IS NULL", user.ID).
+		Find(&companyPolicies)
+
+	for _, companyPolicy := range companyPolicies {
+		policy = policy.Merge(companyPolicy.Policy())
+	}
+
+	return policy
+}
+
+// Check the new password of the user against the password policy and the previous passwords
+// The policies of the companies that the user is joining also apply
+func (user *User) validatePassword(db *gorm.DB, plain string, joining ...*Company) []string {
+	var errors []string
+
+	policy := user.passwordPolicy(db)
+	for _, company := range joining {
+		policy = policy.Merge(company.passwordPolicy(db))
+	}
+	for _, violation := range policy.Validate(plain, user.Email, user.Name) {
+		errors = append(errors, "Password "+violation)
+	}
+
+	if policy.History > 0 && user.ID != uuid.Nil {
+		// The current password counts as one of the last passwords
+		hashes := []string{}
+		db.Table("users").Where("id = ?", user.ID).Pluck("password", &hashes)
+
+		previous := []string{}
+		db.Model(PasswordHistory{}).
+			Where("user_id = ?", user.ID).
+			Order("created_at desc").
+			Limit(policy.History-1).
+			Pluck("password_hash", &previous)
+
+		for _, hash := range append(hashes, previous...) {
+			if bcrypt.CompareHashAndPassword([]byte(hash), []byte(plain)) == nil {
+				errors = append(errors, "Password must not be the same as your last "+strconv.Itoa(policy.History)+" password(s).")
+				break
+			}
+		}
+	}
+
+	return errors
+}
+
+// Replace the password of the user with the hash and keep the current one in the history
+func setPasswordHash(tx *gorm.DB, userId uuid.UUID, hash string, fields map[string]interface{}) error {
+	current := []string{}
+	tx.Table("users").Where("id = ?", userId).Pluck("password", &current)
+
+	if len(current) > 0 && current[0] != "" {
+		if err := tx.Create(&PasswordHistory{UserID: userId, PasswordHash: current[0]}).Error; err != nil {
+			return err
+		}
+	}
+
+	updates := map[string]interface{}{"Password": hash, "PasswordUnusable": false}
+	for field, value := range fields {
+		updates[field] = value
+	}
+
+	if err := tx.Model(User{}).Where("id = ?", userId).Updates(updates).Error; err != nil {
+		return err
+	}
+
+	// Only keep the most recent passwords
+	return tx.Exec(`DELETE FROM password_histories WHERE user_id = ? AND id NOT IN (
+		SELECT id FROM password_histories WHERE user_id = ? ORDER BY created_at DESC LIMIT ?)`, userId, userId, maxPasswordHistory).Error
+}
+
+// Get the bcrypt cost configured in the environment
+func passwordCost() int {
+	cost, err := strconv.Atoi(os.Getenv("bcrypt_cost"))
+	if err != nil || cost < bcrypt.MinCost || cost > bcrypt.MaxCost {
+		return bcrypt.DefaultCost
+	}
+
+	return cost
+}
+
+// Hash the password with the configured cost
+func hashPassword(plain string) (string, error) {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(plain), passwordCost())
+	return string(hashedPassword), err
+}
+
+// Hash a random password that nobody knows, for the account that has to set its password with the reset email
+func unusablePassword() (string, error) {
+	randomPassword, err := util.GenerateRandomToken(32)
+	if err != nil {
+		return "", err
+	}
+
+	return hashPassword(randomPassword)
+}
+
+// Hash the password again after it is verified if the configured cost has changed since it was hashed
+func rehashPassword(db *gorm.DB, userId uuid.UUID, hash, plain string) {
+	if cost, err := bcrypt.Cost([]byte(hash)); err != nil || cost == passwordCost() {
+		return
+	}
+
+	newHash, err := hashPassword(plain)
+	if err != nil {
+		log.Println("Failed to rehash the password:", err)
+		return
+	}
+
+	// Only replace the hash that has been verified, in case the password has just been changed
+	if err := db.Model(User{}).Where("id = ? AND password = ?", userId, hash).Update("Password", newHash).Error; err != nil {
+		log.Println("Failed to rehash the password:", err)
+	}
+}
+
+// Notify the user and record the audit event when the password has been changed or reset
+func passwordChanged(tx *gorm.DB, user *User, reset bool, client Client) error {
+	now := time.Now()
+	msg, err := mailer.NewPasswordChangedEmail(user.Name, user.Email, reset, now, client.IP)
+	if err != nil {
+		return err
+	}
+
+	if err := QueueEmail(tx, nil, msg); err != nil {
+		return err
+	}
+
+	action := AuditPasswordChanged
+	if reset {
+		action = AuditPasswordReset
+	}
+
+	return RecordAuditEvent(tx, action, &user.ID, client, nil)
+}
@@ -0,0 +1,100 @@
+package models
+
+import (
+	"github.com/satori/go.uuid"
+	"strings"
+)
+
+// Permissions that can be given to the roles of the company, in the form of {area}.{action}
+const (
+	PermissionCompanyUpdate    = "company.update"
+	PermissionCompanySecurity  = "company.security"
+	PermissionMembersView      = "members.view"
+	PermissionMembersManage    = "members.manage"
+	PermissionInvitationView   = "invitation.view"
+	PermissionInvitationCreate = "invitation.create"
+	PermissionInvitationDelete = "invitation.delete"
+	PermissionRolesManage      = "roles.manage"
+	PermissionTeamsManage      = "teams.manage"
+	PermissionAPIKeysManage    = "apikeys.manage"
+	PermissionEmailsView       = "emails.view"
+)
+
+type Permission struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// All the permissions with their descriptions, the admin role always has all of them
+var Permissions = []Permission{
+	{PermissionCompanyUpdate, "Update the details of the company"},
+	{PermissionCompanySecurity, "Manage the two-factor requirement, single sign-on, password policy and email domains"},
+	{PermissionMembersView, "View the members of the company"},
+	{PermissionMembersManage, "Manage the members of the company, ie. unlock their accounts"},
+	{PermissionInvitationView, "View the invitations sent by the company"},
+	{PermissionInvitationCreate, "Invite people to the company"},
+	{PermissionInvitationDelete, "Delete the invitations sent by the company"},
+	{PermissionRolesManage, "Manage the roles and their permissions"},
+	{PermissionTeamsManage, "Manage the teams and their members"},
+	{PermissionAPIKeysManage, "Manage the API keys of the company"},
+	{PermissionEmailsView, "View the outgoing emails of the company"},
+}
+
+// Permissions of the default member role of the new companies
+var DefaultMemberPermissions = []string{
+	PermissionMembersView,
+}
+
+// Check if the permission exists
+func IsPermission(name string) bool {
+	for _, permission := range Permissions {
+		if permission.Name == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Get the names of all the permissions
+func allPermissions() []string {
+	names := []string{}
+	for _, permission := range Permissions {
+		names = append(names, permission.Name)
+	}
+
+	return names
+}
+
+// Get the permissions of the user in the company, none if the user is not a member
+func (user *User) GetPermissions(company *Company) []string {
+	role := Role{}
+	db := GetDB()
+	db.Table("roles").
+		Joins("JOIN company_users ON company_users.role_id = roles.id").
+		Joins("JOIN companies ON companies.id = company_users.company_id").
+		Select("roles.*").
+		Where("company_users.user_id = ? AND company_users.company_id = ? AND companies.deleted_at IS NULL", user.ID, company.ID).
+		Scan(&role)
+	defer db.Close()
+
+	if role.ID == uuid.Nil {
+		return []string{}
+	}
+
+	return role.GetPermissions()
+}
+
+// Check if the user has the permission in the company
+func (user *User) HasPermission(company *Company, permission string) bool {
+	return contains(user.GetPermissions(company), permission)
+}
+
+// Get the permissions of the role, the admin role has all the permissions
+func (role *Role) GetPermissions() []string {
+	if role.IsAdmin {
+		return allPermissions()
+	}
+
+	return strings.Fields(role.Permissions)
+}
@@ -0,0 +1,191 @@
+package models
+
+import (
+	util "app/utils"
+	"github.com/jinzhu/gorm"
+	"github.com/satori/go.uuid"
+	"net/http"
+	"time"
+)
+
+const (
+	accessTokenLifetime  = time.Hour * 2       // Only valid for 2 hours
+	refreshTokenLifetime = time.Hour * 24 * 30 // Refresh token is valid for 30 days
+)
+
+// Refresh token that is rotated on every use, tokens issued from the same login share the family ID
+type RefreshToken struct {
+	Base
+	UserID        uuid.UUID  `gorm:"type:uuid;not null;index"`
+	FamilyID      uuid.UUID  `gorm:"type:uuid;not null;index"`
+	TokenHash     string     `gorm:"not null;unique_index"`
+	AccessTokenID uuid.UUID  `gorm:"type:uuid;index"`
+	ExpiresAt     time.Time  `gorm:"not null"`
+	RevokedAt     *time.Time
+}
+
+// Access token ID (jti) that can no longer be used even though it has not expired
+type RevokedToken struct {
+	TokenID   uuid.UUID `gorm:"type:uuid;primary_key"`
+	ExpiresAt time.Time `gorm:"index"`
+	CreatedAt time.Time
+}
+
+// Exchange the refresh token for a new access token and refresh token
+func RefreshLogin(refreshToken string, client Client) map[string]interface{} {
+	var errors []string
+	var resp map[string]interface{}
+
+	db := GetDB()
+	defer db.Close()
+
+	token := RefreshToken{}
+	db.Where("token_hash = ?", util.HashToken(refreshToken)).First(&token)
+
+	if token.ID == uuid.Nil || time.Now().After(token.ExpiresAt) {
+		resp = util.Message(false, http.StatusUnauthorized, "Invalid/expired refresh token. Please login again.", errors)
+		return resp
+	}
+
+	// A rotated refresh token is being reused, the whole login might have been stolen
+	if token.RevokedAt != nil {
+		revokeTokenFamily(db, token.FamilyID)
+		resp = util.Message(false, http.StatusUnauthorized, "Invalid/expired refresh token. Please login again.", errors)
+		return resp
+	}
+
+	user := GetUser(token.UserID)
+	if user == nil {
+		resp = util.Message(false, http.StatusUnauthorized, "Invalid/expired refresh token. Please login again.", errors)
+		return resp
+	}
+
+	// Only one request can rotate the token, the concurrent one is refused without ending the session
+	// as it is not the reuse of the revoked token, ie. another tab or the retry after the timeout
+	tx := db.Begin()
+	result := tx.Model(RefreshToken{}).Where("id = ? AND revoked_at IS NULL", token.ID).Update("RevokedAt", time.Now())
+	if result.Error != nil {
+		tx.Rollback()
+		resp = util.Message(false, http.StatusInternalServerError, "Failed to refresh token, connection error.", errors)
+		return resp
+	}
+
+	if result.RowsAffected == 0 {
+		tx.Rollback()
+		resp = util.Message(false, http.StatusUnauthorized, "Invalid/expired refresh token. Please login again.", errors)
+		return resp
+	}
+
+	if err := user.generateTokens(tx, token.FamilyID); err != nil {
+		tx.Rollback()
+		resp = util.Message(false, http.StatusInternalServerError, "Failed to refresh token, connection error.", errors)
+		return resp
+	}
+
+	// The session is extended along with the refresh token
+	now := time.Now()
+	err := tx.Model(Session{}).Where("id = ?", token.FamilyID).Updates(map[string]interface{}{
+		"IP":         client.IP,
+		"UserAgent":  truncate(client.UserAgent, 255),
+		"LastSeenAt": now,
+		"ExpiresAt":  now.Add(refreshTokenLifetime),
+	}).Error
+
+	if err != nil {
+		tx.Rollback()
+		resp = util.Message(false, http.StatusInternalServerError, "Failed to refresh token, connection error.", errors)
+		return resp
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		resp = util.Message(false, http.StatusInternalServerError, "Failed to refresh token, connection error.", errors)
+		return resp
+	}
+
+	resp = util.Message(true, http.StatusOK, "You have successfully refreshed the token.", errors)
+	resp["data"] = user
+
+	return resp
+}
+
+// Log out the user by revoking the access token and the refresh tokens issued with it
+func Logout(tokenId uuid.UUID, expiry time.Time) map[string]interface{} {
+	var errors []string
+	var resp map[string]interface{}
+
+	db := GetDB()
+	defer db.Close()
+
+	token := RefreshToken{}
+	db.Where("access_token_id = ?", tokenId).First(&token)
+
+	if token.ID != uuid.Nil {
+		revokeTokenFamily(db, token.FamilyID)
+	}
+
+	if err := revokeAccessToken(db, tokenId, expiry); err != nil {
+		resp = util.Message(false, http.StatusInternalServerError, "Failed to logout, connection error.", errors)
+		return resp
+	}
+
+	resp = util.Message(true, http.StatusOK, "You have successfully logged out.", errors)
+
+	return resp
+}
+
+// Check if the access token has been revoked
+func IsTokenRevoked(tokenId uuid.UUID) bool {
+	revokedToken := RevokedToken{}
+	db := GetDB()
+	db.Where("token_id = ?", tokenId).First(&revokedToken)
+	defer db.Close()
+
+	return revokedToken.TokenID != uuid.Nil
+}
+
+// Create the refresh token and return the plain token, only the hash is stored
+func createRefreshToken(db *gorm.DB, userId, familyId, accessTokenId uuid.UUID) (string, error) {
+	plainToken, err := util.GenerateRandomToken(32)
+	if err != nil {
+		return "", err
+	}
+
+	token := RefreshToken{
+		UserID:        userId,
+		FamilyID:      familyId,
+		TokenHash:     util.HashToken(plainToken),
+		AccessTokenID: accessTokenId,
+		ExpiresAt:     time.Now().Add(refreshTokenLifetime),
+	}
+
+	if err := db.Create(&token).Error; err != nil {
+		return "", err
+	}
+
+	return plainToken, nil
+}
+
+// Revoke all the refresh tokens and the active access token of the same login, and end the session
+func revokeTokenFamily(db *gorm.DB, familyId uuid.UUID) {
+	now := time.Now()
+	tokens := []RefreshToken{}
+	db.Where("family_id = ?", familyId).Find(&tokens)
+
+	for _, token := range tokens {
+		if token.RevokedAt == nil {
+			revokeAccessToken(db, token.AccessTokenID, now.Add(accessTokenLifetime))
+		}
+	}
+
+	db.Model(RefreshToken{}).Where("family_id = ? AND revoked_at IS NULL", familyId).Update("RevokedAt", now)
+	db.Model(Session{}).Where("id = ? AND revoked_at IS NULL", familyId).Update("RevokedAt", now)
+}
+
+// Add the access token to the revoked list until it expires
+func revokeAccessToken(db *gorm.DB, tokenId uuid.UUID, expiry time.Time) error {
+	// Clean up the revoked tokens that have already expired
+	db.Where("expires_at < ?", time.Now()).Delete(RevokedToken{})
+
+	revokedToken := RevokedToken{TokenID: tokenId, ExpiresAt: expiry}
+	return db.Where(RevokedToken{TokenID: tokenId}).FirstOrCreate(&revokedToken).Error
+}
@@ -0,0 +1,95 @@
+package models
+
+import (
+	util "app/utils"
+	"github.com/satori/go.uuid"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRefreshLoginRotation(t *testing.T) {
+	db := testDB(t)
+	defer db.Close()
+
+	user := createTestUser(t, db, "Password123!")
+	defer deleteTestUser(db, user)
+	defer db.Where("user_id = ?", user.ID).Delete(RefreshToken{})
+
+	familyId := uuid.NewV4()
+	token, err := createRefreshToken(db, user.ID, familyId, uuid.NewV4())
+	if err != nil {
+		t.Fatalf("Failed to create the refresh token: %v", err)
+	}
+
+	resp := RefreshLogin(token, testClient)
+	if resp["status"] != http.StatusOK {
+		t.Skipf("The tokens cannot be signed in the environment: %v", resp["message"])
+	}
+
+	rotated := RefreshToken{}
+	db.Where("token_hash = ?", util.HashToken(token)).First(&rotated)
+	if rotated.RevokedAt == nil {
+		t.Fatal("The refresh token is not revoked after the rotation")
+	}
+
+	active := 0
+	db.Model(RefreshToken{}).Where("family_id = ? AND revoked_at IS NULL", familyId).Count(&active)
+	if active != 1 {
+		t.Fatalf("%d active refresh token(s) in the login, want 1", active)
+	}
+
+	// Reusing the rotated token revokes the whole login
+	if resp := RefreshLogin(token, testClient); resp["status"] != http.StatusUnauthorized {
+		t.Errorf("RefreshLogin() with the rotated token status = %v, want %v", resp["status"], http.StatusUnauthorized)
+	}
+
+	db.Model(RefreshToken{}).Where("family_id = ? AND revoked_at IS NULL", familyId).Count(&active)
+	if active != 0 {
+		t.Errorf("%d active refresh token(s) after the reuse, want 0", active)
+	}
+}
+
+func TestRefreshLoginConcurrentRotation(t *testing.T) {
+	db := testDB(t)
+	defer db.Close()
+
+	user := createTestUser(t, db, "Password123!")
+	defer deleteTestUser(db, user)
+	defer db.Where("user_id = ?", user.ID).Delete(RefreshToken{})
+
+	familyId := uuid.NewV4()
+	token, err := createRefreshToken(db, user.ID, familyId, uuid.NewV4())
+	if err != nil {
+		t.Fatalf("Failed to create the refresh token: %v", err)
+	}
+
+	// The token issued to the concurrent request that has rotated the token first
+	issued, err := createRefreshToken(db, user.ID, familyId, uuid.NewV4())
+	if err != nil {
+		t.Fatalf("Failed to create the refresh token: %v", err)
+	}
+
+	// Hold the token until the refresh below has read it, then rotate it as the concurrent request
+	tx := db.Begin()
+	tx.Exec("SELECT id FROM refresh_tokens WHERE token_hash = ? FOR UPDATE", util.HashToken(token))
+
+	done := make(chan map[string]interface{})
+	go func() {
+		done <- RefreshLogin(token, testClient)
+	}()
+
+	time.Sleep(time.Millisecond * 500)
+	tx.Model(RefreshToken{}).Where("token_hash = ?", util.HashToken(token)).Update("RevokedAt", time.Now())
+	tx.Commit()
+
+	if resp := <-done; resp["status"] != http.StatusUnauthorized {
+		t.Errorf("RefreshLogin() status = %v, want %v", resp["status"], http.StatusUnauthorized)
+	}
+
+	active := RefreshToken{}
+	db.Where("token_hash = ?", util.HashToken(issued)).First(&active)
+	if active.RevokedAt != nil {
+		t.Error("The login is revoked by the concurrent refresh")
+	}
+}
@@ -2,13 +2,284 @@ package models
 
 import (
 	//"github.com/jinzhu/gorm"
+	util "app/utils"
 	"github.com/satori/go.uuid"
+	"net/http"
+	"strconv"
+	"strings"
 )
 
 type Role struct {
 	Base
 	Name string
 	IsAdmin bool `gorm:"default:false"`
+	IsDefault bool `gorm:"default:false"` // The role given to the new members of the company
+	Permissions string `sql:"type:text"` // Space-separated names of the permissions
 	CompanyID uuid.UUID `gorm:"type:uuid;not null;"`
 	CompanyUsers []CompanyUser `gorm:"foreignkey:UserID"`
 }
+
+type RoleOutput struct {
+	ID          uuid.UUID `json:"id"`
+	Name        string    `json:"name"`
+	IsAdmin     bool      `json:"isAdmin"`
+	IsDefault   bool      `json:"isDefault"`
+	Permissions []string  `json:"permissions"`
+	MemberCount int       `json:"memberCount"`
+}
+
+// Get the roles of the company with the number of members of each
+func (company *Company) GetRoles() map[string]interface{} {
+	var errors []string
+	var resp map[string]interface{}
+
+	roles := []Role{}
+	db := GetDB()
+	db.Where("company_id = ?", company.ID).Order("is_admin desc, name asc").Find(&roles)
+	defer db.Close()
+
+	output := []RoleOutput{}
+	for i := range roles {
+		output = append(output, roles[i].output())
+	}
+
+	resp = util.Message(true, http.StatusOK, "You have successfully retrieved the roles.", errors)
+	resp["data"] = output
+	resp["permissions"] = Permissions
+
+	return resp
+}
+
+// Get the role of the company
+func (company *Company) GetRole(roleId uuid.UUID) map[string]interface{} {
+	var errors []string
+	var resp map[string]interface{}
+
+	role := company.getRole(roleId)
+	if role == nil {
+		resp = util.Message(false, http.StatusUnprocessableEntity, "No available result.", errors)
+		return resp
+	}
+
+	resp = util.Message(true, http.StatusOK, "The role is retrieved.", errors)
+	resp["data"] = role.output()
+	resp["permissions"] = Permissions
+
+	return resp
+}
+
+// Create the custom role, the user can only grant the permissions that they have
+func (company *Company) CreateRole(user *User, role *Role, permissions []string) map[string]interface{} {
+	var errors []string
+	var resp map[string]interface{}
+
+	role.CompanyID = company.ID
+	role.IsAdmin = false
+	if resp, ok := company.validateRole(user, role, permissions, nil); !ok {
+		return resp
+	}
+
+	db := GetDB()
+	defer db.Close()
+
+	tx := db.Begin()
+	if role.IsDefault {
+		tx.Model(Role{}).Where("company_id = ?", company.ID).Update("IsDefault", false)
+	}
+
+	if err := tx.Create(role).Error; err != nil {
+		tx.Rollback()
+		resp = util.Message(false, http.StatusInternalServerError, "Failed to create the role, connection error.", errors)
+		return resp
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		resp = util.Message(false, http.StatusInternalServerError, "Failed to create the role, connection error.", errors)
+		return resp
+	}
+
+	resp = util.Message(true, http.StatusOK, "You have successfully created the role "+role.Name+".", errors)
+	resp["data"] = role.output()
+
+	return resp
+}
+
+// Update the name and the permissions of the role, the admin role cannot be changed
+func (company *Company) UpdateRole(user *User, roleId uuid.UUID, input *Role, permissions []string) map[string]interface{} {
+	var errors []string
+	var resp map[string]interface{}
+
+	role := company.getRole(roleId)
+	if role == nil {
+		resp = util.Message(false, http.StatusUnprocessableEntity, "No available result.", errors)
+		return resp
+	}
+
+	if role.IsAdmin {
+		resp = util.Message(false, http.StatusUnprocessableEntity, "The admin role cannot be changed.", errors)
+		return resp
+	}
+
+	// There must always be a default role for the new members
+	if role.IsDefault && !input.IsDefault {
+		resp = util.Message(false, http.StatusUnprocessableEntity, "Please make another role the default role instead.", errors)
+		return resp
+	}
+
+	current := role.GetPermissions()
+	role.Name = input.Name
+	role.IsDefault = input.IsDefault
+	if resp, ok := company.validateRole(user, role, permissions, current); !ok {
+		return resp
+	}
+
+	db := GetDB()
+	defer db.Close()
+
+	tx := db.Begin()
+	if role.IsDefault {
+		tx.Model(Role{}).Where("company_id = ? AND id <> ?", company.ID, role.ID).Update("IsDefault", false)
+	}
+
+	err := tx.Model(role).Updates(map[string]interface{}{
+		"Name":        role.Name,
+		"IsDefault":   role.IsDefault,
+		"Permissions": role.Permissions,
+	}).Error
+
+	if err != nil {
+		tx.Rollback()
+		resp = util.Message(false, http.StatusInternalServerError, "Failed to update the role, connection error.", errors)
+		return resp
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		resp = util.Message(false, http.StatusInternalServerError, "Failed to update the role, connection error.", errors)
+		return resp
+	}
+
+	resp = util.Message(true, http.StatusOK, "You have successfully updated the role "+role.Name+".", errors)
+	resp["data"] = role.output()
+
+	return resp
+}
+
+// Delete the role that is not assigned to any member
+func (company *Company) DeleteRole(roleId uuid.UUID) map[string]interface{} {
+	var errors []string
+	var resp map[string]interface{}
+
+	role := company.getRole(roleId)
+	if role == nil {
+		resp = util.Message(false, http.StatusUnprocessableEntity, "No available result.", errors)
+		return resp
+	}
+
+	if role.IsAdmin || role.IsDefault {
+		resp = util.Message(false, http.StatusUnprocessableEntity, "The admin role and the default role cannot be deleted.", errors)
+		return resp
+	}
+
+	if count := role.memberCount(); count > 0 {
+		resp = util.Message(false, http.StatusUnprocessableEntity, "The role is still assigned to "+strconv.Itoa(count)+" member(s). Please assign them another role first.", errors)
+		return resp
+	}
+
+	db := GetDB()
+	defer db.Close()
+
+	if err := db.Delete(role).Error; err != nil {
+		resp = util.Message(false, http.StatusInternalServerError, "Failed to delete the role, connection error.", errors)
+		return resp
+	}
+
+	resp = util.Message(true, http.StatusOK, "You have successfully deleted the role "+role.Name+".", errors)
+
+	return resp
+}
+
+// Get the role by ID within the company
+func (company *Company) getRole(roleId uuid.UUID) *Role {
+	role := &Role{}
+	db := GetDB()
+	db.Where("id = ? AND company_id = ?", roleId, company.ID).First(role)
+	defer db.Close()
+
+	if role.ID == uuid.Nil {
+		return nil
+	}
+
+	return role
+}
+
+// Validate the name and the permissions of the role, and store the permissions in the role
+// The user can neither grant nor remove the permissions that the user does not have, the current permissions of the role are kept as they are
+func (company *Company) validateRole(user *User, role *Role, permissions, current []string) (map[string]interface{}, bool) {
+	var errors []string
+	var resp map[string]interface{}
+
+	role.Name = strings.TrimSpace(role.Name)
+	if role.Name == "" {
+		errors = append(errors, "Name is required.")
+	}
+
+	granted := user.GetPermissions(company)
+	names := []string{}
+	for _, permission := range permissions {
+		if !IsPermission(permission) {
+			errors = append(errors, "Permission "+permission+" is invalid.")
+		} else if !contains(granted, permission) && !contains(current, permission) {
+			errors = append(errors, "You cannot grant the permission "+permission+" that you do not have.")
+		} else if !contains(names, permission) {
+			names = append(names, permission)
+		}
+	}
+
+	for _, permission := range current {
+		if IsPermission(permission) && !contains(granted, permission) && !contains(permissions, permission) {
+			errors = append(errors, "You cannot remove the permission "+permission+" that you do not have.")
+		}
+	}
+
+	if len(errors) > 0 {
+		resp = util.Message(false, http.StatusUnprocessableEntity, "Validation error", errors)
+		return resp, false
+	}
+
+	// The name of the role must be unique within the company
+	count := 0
+	db := GetDB()
+	db.Model(Role{}).Where("company_id = ? AND lower(name) = lower(?) AND id <> ?", company.ID, role.Name, role.ID).Count(&count)
+	defer db.Close()
+
+	if count > 0 {
+		resp = util.Message(false, http.StatusUnprocessableEntity, "The role "+role.Name+" already exists.", errors)
+		return resp, false
+	}
+
+	role.Permissions = strings.Join(names, " ")
+
+	resp = util.Message(true, http.StatusOK, "Input has been validated.", errors)
+	return resp, true
+}
+
+// Get the number of the members with the role
+func (role *Role) memberCount() int {
+	count := 0
+	db := GetDB()
+	db.Model(CompanyUser{}).Where("role_id = ?", role.ID).Count(&count)
+	defer db.Close()
+
+	return count
+}
+
+func (role *Role) output() RoleOutput {
+	return RoleOutput{
+		ID:          role.ID,
+		Name:        role.Name,
+		IsAdmin:     role.IsAdmin,
+		IsDefault:   role.IsDefault,
+		Permissions: role.GetPermissions(),
+		MemberCount: role.memberCount(),
+	}
+}
@@ -0,0 +1,50 @@
+package models
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestUpdateRolePermissions(t *testing.T) {
+	db := testDB(t)
+	defer db.Close()
+
+	admin := createTestUser(t, db, "Password123!")
+	defer deleteTestUser(db, admin)
+
+	manager := createTestUser(t, db, "Password123!")
+	defer deleteTestUser(db, manager)
+
+	company, _, _ := createTestCompany(t, db, admin)
+	defer deleteTestCompany(db, company)
+
+	managerRole := &Role{Name: "Manager", CompanyID: company.ID, Permissions: PermissionRolesManage + " " + PermissionMembersView}
+	db.Create(managerRole)
+	addTestMember(t, db, company, manager, managerRole)
+
+	tests := []struct {
+		name        string
+		actor       *User
+		permissions []string
+		status      int
+	}{
+		{"grant the permission that the actor has", manager, []string{PermissionTeamsManage, PermissionMembersView}, http.StatusOK},
+		{"keep the permission that the actor does not have", manager, []string{PermissionTeamsManage}, http.StatusOK},
+		{"remove the permission that the actor does not have", manager, []string{PermissionMembersView}, http.StatusUnprocessableEntity},
+		{"grant the permission that the actor does not have", manager, []string{PermissionTeamsManage, PermissionAPIKeysManage}, http.StatusUnprocessableEntity},
+		{"admin removes any permission", admin, []string{}, http.StatusOK},
+	}
+
+	for _, test := range tests {
+		// The role starts with the permission that the manager does not have
+		role := &Role{Name: "Team lead", CompanyID: company.ID, Permissions: PermissionTeamsManage}
+		db.Create(role)
+
+		resp := company.UpdateRole(test.actor, role.ID, &Role{Name: role.Name}, test.permissions)
+		if resp["status"] != test.status {
+			t.Errorf("%s: UpdateRole() status = %v, want %v", test.name, resp["status"], test.status)
+		}
+
+		db.Unscoped().Delete(role)
+	}
+}
@@ -0,0 +1,145 @@
+package models
+
+import (
+	util "app/utils"
+	"github.com/jinzhu/gorm"
+	"github.com/satori/go.uuid"
+	"net/http"
+	"time"
+)
+
+const sessionTouchInterval = time.Minute * 5 // How often the last seen time is recorded
+
+// The client that the user logs in from
+type Client struct {
+	IP             string
+	UserAgent      string
+	ImpersonatorID *uuid.UUID // The superuser acting as the user, if impersonating
+}
+
+// Login of the user on a device, the refresh tokens of the login belong to the same family as the session ID
+type Session struct {
+	Base
+	UserID     uuid.UUID  `json:"userId" gorm:"type:uuid;not null;index"`
+	IP         string     `json:"ip"`
+	UserAgent  string     `json:"userAgent"`
+	LastSeenAt time.Time  `json:"lastSeenAt"`
+	ExpiresAt  time.Time  `json:"expiresAt" gorm:"not null"`
+	RevokedAt  *time.Time `json:"revokedAt"`
+	Current    bool       `json:"current" gorm:"-"`
+}
+
+// Get the active sessions of the user
+func (user *User) GetSessions(currentSessionId uuid.UUID) map[string]interface{} {
+	var errors []string
+	var resp map[string]interface{}
+
+	sessions := []Session{}
+	db := GetDB()
+	db.Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", user.ID, time.Now()).Order("last_seen_at desc").Find(&sessions)
+	defer db.Close()
+
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == currentSessionId
+	}
+
+	resp = util.Message(true, http.StatusOK, "You have successfully retrieved the sessions.", errors)
+	resp["data"] = sessions
+
+	return resp
+}
+
+// Sign out the session of the user
+func (user *User) RevokeSession(sessionId uuid.UUID) map[string]interface{} {
+	var errors []string
+	var resp map[string]interface{}
+
+	db := GetDB()
+	defer db.Close()
+
+	session := Session{}
+	db.Where("id = ? AND user_id = ? AND revoked_at IS NULL", sessionId, user.ID).First(&session)
+
+	if session.ID == uuid.Nil {
+		resp = util.Message(false, http.StatusUnprocessableEntity, "No available result.", errors)
+		return resp
+	}
+
+	revokeTokenFamily(db, session.ID)
+
+	resp = util.Message(true, http.StatusOK, "You have successfully signed out the session.", errors)
+
+	return resp
+}
+
+// Sign out all the sessions of the user, including the current one
+func (user *User) RevokeAllSessions() map[string]interface{} {
+	var errors []string
+	var resp map[string]interface{}
+
+	db := GetDB()
+	revokeUserSessions(db, user.ID, uuid.Nil)
+	defer db.Close()
+
+	resp = util.Message(true, http.StatusOK, "You have successfully signed out everywhere.", errors)
+
+	return resp
+}
+
+// Record the time the session was last used
+func TouchSession(sessionId uuid.UUID) {
+	if sessionId == uuid.Nil {
+		return
+	}
+
+	now := time.Now()
+	db := GetDB()
+	db.Model(Session{}).
+		Where("id = ? AND last_seen_at < ?", sessionId, now.Add(-sessionTouchInterval)).
+		Update("LastSeenAt", now)
+	defer db.Close()
+}
+
+// Create the session of the new login
+func createSession(db *gorm.DB, userId uuid.UUID, client Client) (*Session, error) {
+	now := time.Now()
+	session := &Session{
+		UserID:     userId,
+		IP:         client.IP,
+		UserAgent:  truncate(client.UserAgent, 255),
+		LastSeenAt: now,
+		ExpiresAt:  now.Add(refreshTokenLifetime),
+	}
+
+	if err := db.Create(session).Error; err != nil {
+		return nil, err
+	}
+
+	return session, nil
+}
+
+// Sign out all the sessions of the user except the given one
+func revokeUserSessions(db *gorm.DB, userId, exceptSessionId uuid.UUID) {
+	sessions := []Session{}
+	db.Where("user_id = ? AND id <> ? AND revoked_at IS NULL", userId, exceptSessionId).Find(&sessions)
+
+	for _, session := range sessions {
+		revokeTokenFamily(db, session.ID)
+	}
+
+	// Also sign out the logins from before the sessions are recorded
+	tokens := []RefreshToken{}
+	db.Where("user_id = ? AND family_id <> ? AND revoked_at IS NULL", userId, exceptSessionId).Find(&tokens)
+
+	for _, token := range tokens {
+		revokeTokenFamily(db, token.FamilyID)
+	}
+}
+
+func truncate(value string, length int) string {
+	if len(value) > length {
+		return value[:length]
+	}
+
+	return value
+}
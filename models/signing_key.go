@@ -0,0 +1,278 @@
+package models
+
+import (
+	"app/signing"
+	"errors"
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/jinzhu/gorm"
+	"github.com/satori/go.uuid"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	signingKeyRefreshInterval = time.Minute                     // How often the key ring is reloaded from the database
+	signingKeyReloadInterval  = time.Second * 5                 // How often the key ring can be reloaded for an unknown key ID
+	signingKeyRetention       = accessTokenLifetime + time.Hour // How long the retired key is kept to verify the unexpired tokens
+	signingKeyLock            = 728120                          // Advisory lock to rotate the key from one instance at a time
+)
+
+// Key pair that signs the login tokens, the retired keys are kept until the tokens signed by them have expired
+type SigningKey struct {
+	Base
+	Algorithm  string `gorm:"not null"`
+	PrivateKey string `sql:"type:text"` // Encrypted with the signing_key_secret of the environment
+	PublicKey  string `gorm:"not null" sql:"type:text"`
+	RetiredAt  *time.Time
+}
+
+// The active key and the keys that can still verify the tokens, cached in memory
+type keyRing struct {
+	sync.RWMutex
+	active   *signing.Key
+	keys     map[string]*signing.Key
+	loadedAt time.Time
+}
+
+var signingKeys = &keyRing{}
+
+// Sign the claims of the token with the active key
+func SignToken(claims jwt.Claims) (string, error) {
+	if err := signingKeys.load(false); err != nil {
+		return "", err
+	}
+
+	signingKeys.RLock()
+	key := signingKeys.active
+	signingKeys.RUnlock()
+
+	return key.Sign(claims)
+}
+
+// Parse the token and verify it with the key identified by the kid header
+func ParseToken(tokenString string, claims jwt.Claims) (*jwt.Token, error) {
+	return jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		key := signingKeys.get(kid)
+		if key == nil {
+			return nil, errors.New("The signing key of the token is unknown.")
+		}
+
+		// The algorithm must match the key to prevent the algorithm confusion attacks
+		if token.Method.Alg() != key.Algorithm {
+			return nil, errors.New("The signing algorithm of the token is invalid.")
+		}
+
+		return key.PublicKey, nil
+	})
+}
+
+// Get the public keys in the JSON Web Key Set format for the other services to verify the tokens
+func GetJWKS() map[string]interface{} {
+	keys := []map[string]interface{}{}
+	if err := signingKeys.load(false); err != nil {
+		log.Println("Failed to load the signing keys:", err)
+	}
+
+	signingKeys.RLock()
+	for _, key := range signingKeys.keys {
+		keys = append(keys, key.JWK())
+	}
+	signingKeys.RUnlock()
+
+	return map[string]interface{}{"keys": keys}
+}
+
+// Create a new active key and retire the current one, the tokens signed by the retired key stay valid until they expire
+func RotateSigningKey() (*SigningKey, error) {
+	key, err := createSigningKey(true)
+	if err != nil {
+		return nil, err
+	}
+
+	signingKeys.load(true)
+
+	return key, nil
+}
+
+// Get the key by the ID, reload the keys in case it has just been rotated by another instance
+func (ring *keyRing) get(kid string) *signing.Key {
+	if err := ring.load(false); err != nil {
+		log.Println("Failed to load the signing keys:", err)
+	}
+
+	ring.RLock()
+	key := ring.keys[kid]
+	loadedAt := ring.loadedAt
+	ring.RUnlock()
+
+	if key == nil && kid != "" && time.Since(loadedAt) > signingKeyReloadInterval {
+		ring.load(true)
+
+		ring.RLock()
+		key = ring.keys[kid]
+		ring.RUnlock()
+	}
+
+	return key
+}
+
+// Load the keys from the database, the first key is created if there is none
+func (ring *keyRing) load(force bool) error {
+	ring.RLock()
+	fresh := ring.active != nil && time.Since(ring.loadedAt) < signingKeyRefreshInterval
+	ring.RUnlock()
+
+	if fresh && !force {
+		return nil
+	}
+
+	db := GetDB()
+	defer db.Close()
+
+	signingKeyRecords := []SigningKey{}
+	db.Where("retired_at IS NULL OR retired_at > ?", time.Now().Add(-signingKeyRetention)).Order("created_at desc").Find(&signingKeyRecords)
+
+	if len(signingKeyRecords) == 0 || signingKeyRecords[0].RetiredAt != nil {
+		if _, err := createSigningKey(false); err != nil {
+			return err
+		}
+
+		db.Where("retired_at IS NULL OR retired_at > ?", time.Now().Add(-signingKeyRetention)).Order("created_at desc").Find(&signingKeyRecords)
+	}
+
+	var active *signing.Key
+	keys := map[string]*signing.Key{}
+	for _, record := range signingKeyRecords {
+		privateKey, err := signing.DecryptPrivateKey(record.PrivateKey, signingKeySecret())
+		if err != nil {
+			log.Println("Failed to decrypt the signing key", record.ID.String()+":", err)
+			continue
+		}
+
+		key, err := signing.ParseKey(record.ID.String(), record.Algorithm, privateKey, record.PublicKey)
+		if err != nil {
+			log.Println("Failed to parse the signing key", record.ID.String()+":", err)
+			continue
+		}
+
+		keys[key.ID] = key
+		if active == nil && record.RetiredAt == nil {
+			active = key
+		}
+
+		// The key stored before the private keys were encrypted is encrypted now
+		if privateKey != "" && !signing.IsEncrypted(record.PrivateKey) {
+			encryptSigningKey(db, &record, privateKey)
+		}
+	}
+
+	if active == nil {
+		return errors.New("There is no active signing key.")
+	}
+
+	ring.Lock()
+	ring.active = active
+	ring.keys = keys
+	ring.loadedAt = time.Now()
+	ring.Unlock()
+
+	return nil
+}
+
+// Create the key with the algorithm configured in the environment, the current key is retired if rotating
+func createSigningKey(rotate bool) (*SigningKey, error) {
+	algorithm := os.Getenv("jwt_algorithm")
+	if algorithm == "" {
+		algorithm = signing.RS256
+	}
+
+	privateKey, publicKey, err := signing.GenerateKey(algorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	// The private key is only stored encrypted
+	privateKey, err = signing.EncryptPrivateKey(privateKey, signingKeySecret())
+	if err != nil {
+		return nil, err
+	}
+
+	db := GetDB()
+	defer db.Close()
+
+	tx := db.Begin()
+	if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", signingKeyLock).Error; err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	key := &SigningKey{}
+	if !rotate {
+		// Another instance might have created the first key in the meantime
+		tx.Where("retired_at IS NULL").Order("created_at desc").First(key)
+		if key.ID != uuid.Nil {
+			tx.Rollback()
+			return key, nil
+		}
+	}
+
+	if err := retireSigningKeys(tx); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	key = &SigningKey{
+		Algorithm:  algorithm,
+		PrivateKey: privateKey,
+		PublicKey:  publicKey,
+	}
+
+	if err := tx.Create(key).Error; err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+// Get the secret that encrypts the private keys, kept apart from the other secrets so that changing them
+// does not lock the keys away
+func signingKeySecret() string {
+	return os.Getenv("signing_key_secret")
+}
+
+// Encrypt the private key that has been stored unencrypted
+func encryptSigningKey(db *gorm.DB, record *SigningKey, privateKey string) {
+	encrypted, err := signing.EncryptPrivateKey(privateKey, signingKeySecret())
+	if err == nil {
+		err = db.Model(record).Update("PrivateKey", encrypted).Error
+	}
+
+	if err != nil {
+		log.Println("Failed to encrypt the signing key", record.ID.String()+":", err)
+	}
+}
+
+// Retire the active keys and delete the keys that no longer have any unexpired tokens
+func retireSigningKeys(tx *gorm.DB) error {
+	now := time.Now()
+
+	// The private key is no longer needed once the key only verifies
+	err := tx.Model(SigningKey{}).Where("retired_at IS NULL").Updates(map[string]interface{}{
+		"RetiredAt":  now,
+		"PrivateKey": "",
+	}).Error
+
+	if err != nil {
+		return err
+	}
+
+	return tx.Unscoped().Where("retired_at < ?", now.Add(-signingKeyRetention)).Delete(SigningKey{}).Error
+}
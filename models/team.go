@@ -0,0 +1,287 @@
+package models
+
+import (
+	util "app/utils"
+	"github.com/jinzhu/gorm"
+	"github.com/satori/go.uuid"
+	"net/http"
+	"strings"
+)
+
+// Group of the members within the company
+type Team struct {
+	Base
+	CompanyID   uuid.UUID `json:"companyId" gorm:"type:uuid;not null;index"`
+	Name        string    `json:"name" gorm:"not null"`
+	MemberCount int       `json:"memberCount" gorm:"-"`
+}
+
+// Membership of the member of the company in the team
+type TeamUser struct {
+	TeamID uuid.UUID `gorm:"type:uuid;not null;primary_key"`
+	UserID uuid.UUID `gorm:"type:uuid;not null;primary_key"`
+}
+
+// Get the teams of the company with the number of members of each
+func (company *Company) GetTeams() map[string]interface{} {
+	var errors []string
+	var resp map[string]interface{}
+
+	teams := []Team{}
+	db := GetDB()
+	db.Where("company_id = ?", company.ID).Order("name asc").Find(&teams)
+	defer db.Close()
+
+	for i := range teams {
+		teams[i].MemberCount = teams[i].memberCount(db)
+	}
+
+	resp = util.Message(true, http.StatusOK, "You have successfully retrieved the teams.", errors)
+	resp["data"] = teams
+
+	return resp
+}
+
+// Get the team of the company with its members
+func (company *Company) GetTeam(teamId uuid.UUID) map[string]interface{} {
+	var errors []string
+	var resp map[string]interface{}
+
+	db := GetDB()
+	defer db.Close()
+
+	team := company.getTeam(db, teamId)
+	if team == nil {
+		resp = util.Message(false, http.StatusUnprocessableEntity, "No available result.", errors)
+		return resp
+	}
+
+	users := []User{}
+	db.Table("users").
+		Joins("JOIN team_users ON team_users.user_id = users.id").
+		Select("users.name, users.email, users.id, users.profile_picture").
+		Where("team_users.team_id = ?", team.ID).
+		Order("users.name asc").
+		Find(&users)
+
+	team.MemberCount = len(users)
+
+	resp = util.Message(true, http.StatusOK, "The team is retrieved.", errors)
+	resp["data"] = team
+	resp["users"] = users
+
+	return resp
+}
+
+// Create the team of the company
+func (company *Company) CreateTeam(name string) map[string]interface{} {
+	var errors []string
+	var resp map[string]interface{}
+
+	db := GetDB()
+	defer db.Close()
+
+	team := &Team{CompanyID: company.ID, Name: strings.TrimSpace(name)}
+	if resp, ok := company.validateTeam(db, team); !ok {
+		return resp
+	}
+
+	if err := db.Create(team).Error; err != nil {
+		resp = util.Message(false, http.StatusInternalServerError, "Failed to create the team, connection error.", errors)
+		return resp
+	}
+
+	resp = util.Message(true, http.StatusOK, "You have successfully created the team "+team.Name+".", errors)
+	resp["data"] = team
+
+	return resp
+}
+
+// Rename the team of the company
+func (company *Company) UpdateTeam(teamId uuid.UUID, name string) map[string]interface{} {
+	var errors []string
+	var resp map[string]interface{}
+
+	db := GetDB()
+	defer db.Close()
+
+	team := company.getTeam(db, teamId)
+	if team == nil {
+		resp = util.Message(false, http.StatusUnprocessableEntity, "No available result.", errors)
+		return resp
+	}
+
+	team.Name = strings.TrimSpace(name)
+	if resp, ok := company.validateTeam(db, team); !ok {
+		return resp
+	}
+
+	if err := db.Model(team).Update("Name", team.Name).Error; err != nil {
+		resp = util.Message(false, http.StatusInternalServerError, "Failed to update the team, connection error.", errors)
+		return resp
+	}
+
+	team.MemberCount = team.memberCount(db)
+
+	resp = util.Message(true, http.StatusOK, "You have successfully updated the team "+team.Name+".", errors)
+	resp["data"] = team
+
+	return resp
+}
+
+// Delete the team of the company along with its memberships
+func (company *Company) DeleteTeam(teamId uuid.UUID) map[string]interface{} {
+	var errors []string
+	var resp map[string]interface{}
+
+	db := GetDB()
+	defer db.Close()
+
+	team := company.getTeam(db, teamId)
+	if team == nil {
+		resp = util.Message(false, http.StatusUnprocessableEntity, "No available result.", errors)
+		return resp
+	}
+
+	tx := db.Begin()
+	err := tx.Where("team_id = ?", team.ID).Delete(TeamUser{}).Error
+
+	if err == nil {
+		err = tx.Delete(team).Error
+	}
+
+	if err != nil {
+		tx.Rollback()
+		resp = util.Message(false, http.StatusInternalServerError, "Failed to delete the team, connection error.", errors)
+		return resp
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		resp = util.Message(false, http.StatusInternalServerError, "Failed to delete the team, connection error.", errors)
+		return resp
+	}
+
+	resp = util.Message(true, http.StatusOK, "You have successfully deleted the team "+team.Name+".", errors)
+
+	return resp
+}
+
+// Add the member of the company to the team
+func (company *Company) AddTeamMember(teamId, userId uuid.UUID) map[string]interface{} {
+	var errors []string
+	var resp map[string]interface{}
+
+	db := GetDB()
+	defer db.Close()
+
+	team := company.getTeam(db, teamId)
+	if team == nil || company.getMember(db, userId) == nil {
+		resp = util.Message(false, http.StatusUnprocessableEntity, "No available result.", errors)
+		return resp
+	}
+
+	if err := addTeamMembers(db, userId, []uuid.UUID{team.ID}); err != nil {
+		resp = util.Message(false, http.StatusInternalServerError, "Failed to add the member to the team, connection error.", errors)
+		return resp
+	}
+
+	resp = util.Message(true, http.StatusOK, "You have successfully added the member to the team "+team.Name+".", errors)
+
+	return resp
+}
+
+// Remove the member from the team
+func (company *Company) RemoveTeamMember(teamId, userId uuid.UUID) map[string]interface{} {
+	var errors []string
+	var resp map[string]interface{}
+
+	db := GetDB()
+	defer db.Close()
+
+	team := company.getTeam(db, teamId)
+	if team == nil {
+		resp = util.Message(false, http.StatusUnprocessableEntity, "No available result.", errors)
+		return resp
+	}
+
+	if err := db.Where("team_id = ? AND user_id = ?", team.ID, userId).Delete(TeamUser{}).Error; err != nil {
+		resp = util.Message(false, http.StatusInternalServerError, "Failed to remove the member from the team, connection error.", errors)
+		return resp
+	}
+
+	resp = util.Message(true, http.StatusOK, "You have successfully removed the member from the team "+team.Name+".", errors)
+
+	return resp
+}
+
+// Get the team of the company
+func (company *Company) getTeam(db *gorm.DB, teamId uuid.UUID) *Team {
+	team := &Team{}
+	db.Where("id = ? AND company_id = ?", teamId, company.ID).First(team)
+
+	if team.ID == uuid.Nil {
+		return nil
+	}
+
+	return team
+}
+
+// Get the IDs of the given teams that belong to the company
+func existingTeamIds(db *gorm.DB, companyId uuid.UUID, teamIds []uuid.UUID) []uuid.UUID {
+	ids := []uuid.UUID{}
+	if len(teamIds) == 0 {
+		return ids
+	}
+
+	db.Model(Team{}).Where("company_id = ? AND id IN (?)", companyId, teamIds).Pluck("id", &ids)
+
+	return ids
+}
+
+// Validate the name of the team, it must be unique within the company
+func (company *Company) validateTeam(db *gorm.DB, team *Team) (map[string]interface{}, bool) {
+	var errors []string
+	var resp map[string]interface{}
+
+	if team.Name == "" {
+		errors = append(errors, "Name is required.")
+		resp = util.Message(false, http.StatusUnprocessableEntity, "Validation error", errors)
+		return resp, false
+	}
+
+	count := 0
+	db.Model(Team{}).Where("company_id = ? AND lower(name) = lower(?) AND id <> ?", company.ID, team.Name, team.ID).Count(&count)
+
+	if count > 0 {
+		resp = util.Message(false, http.StatusUnprocessableEntity, "The team "+team.Name+" already exists.", errors)
+		return resp, false
+	}
+
+	resp = util.Message(true, http.StatusOK, "Input has been validated.", errors)
+	return resp, true
+}
+
+// Get the number of the members in the team
+func (team *Team) memberCount(db *gorm.DB) int {
+	count := 0
+	db.Model(TeamUser{}).Where("team_id = ?", team.ID).Count(&count)
+
+	return count
+}
+
+// Add the user to the teams, skipping the teams that the user is already in
+func addTeamMembers(db *gorm.DB, userId uuid.UUID, teamIds []uuid.UUID) error {
+	for _, teamId := range teamIds {
+		teamUser := TeamUser{TeamID: teamId, UserID: userId}
+		if err := db.Where(teamUser).FirstOrCreate(&teamUser).Error; err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Remove the user from all the teams of the company
+func removeTeamMemberships(db *gorm.DB, companyId, userId uuid.UUID) error {
+	return db.Where("user_id = ? AND team_id IN (SELECT id FROM teams WHERE company_id = ?)", userId, companyId).Delete(TeamUser{}).Error
+}
@@ -0,0 +1,367 @@
+package models
+
+import (
+	"app/throttle"
+	"app/totp"
+	util "app/utils"
+	"github.com/jinzhu/gorm"
+	"github.com/satori/go.uuid"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	twoFactorChallengeLifetime    = time.Minute * 5
+	twoFactorChallengeMaxAttempts = 5
+	noOfRecoveryCodes             = 10
+)
+
+// One-time recovery code to login when the authenticator app is not available
+type RecoveryCode struct {
+	Base
+	UserID   uuid.UUID `gorm:"type:uuid;not null;index"`
+	CodeHash string    `gorm:"not null"`
+	UsedAt   *time.Time
+}
+
+// Short-lived challenge issued after the password is verified, exchanged for the login tokens with the code
+type TwoFactorChallenge struct {
+	Base
+	UserID     uuid.UUID `gorm:"type:uuid;not null;index"`
+	TokenHash  string    `gorm:"not null;unique_index"`
+	ExpiresAt  time.Time `gorm:"not null"`
+	Attempts   int       `gorm:"default:'0'"`
+	ConsumedAt *time.Time
+}
+
+// Generate the secret of the authenticator app, 2FA is only enabled after the first code is verified
+func (user *User) EnrollTwoFactor() map[string]interface{} {
+	var errors []string
+	var resp map[string]interface{}
+
+	if user.TwoFactorEnabled {
+		resp = util.Message(false, http.StatusUnprocessableEntity, "Two-factor authentication has already been enabled.", errors)
+		return resp
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		resp = util.Message(false, http.StatusInternalServerError, "Failed to enroll two-factor authentication. Please try again.", errors)
+		return resp
+	}
+
+	db := GetDB()
+	err = db.Model(&user).Update("TwoFactorSecret", secret).Error
+	defer db.Close()
+
+	if err != nil {
+		resp = util.Message(false, http.StatusInternalServerError, "Failed to enroll two-factor authentication. Please try again.", errors)
+		return resp
+	}
+
+	resp = util.Message(true, http.StatusOK, "Scan the QR code with your authenticator app and verify the code to enable two-factor authentication.", errors)
+	resp["secret"] = secret
+	resp["uri"] = totp.URI(os.Getenv("app_name"), user.Email, secret)
+
+	return resp
+}
+
+// Verify the first code from the authenticator app and enable 2FA
+func (user *User) VerifyTwoFactor(code string) map[string]interface{} {
+	var errors []string
+	var resp map[string]interface{}
+
+	if user.TwoFactorEnabled {
+		resp = util.Message(false, http.StatusUnprocessableEntity, "Two-factor authentication has already been enabled.", errors)
+		return resp
+	}
+
+	if user.TwoFactorSecret == nil {
+		resp = util.Message(false, http.StatusUnprocessableEntity, "Please enroll two-factor authentication first.", errors)
+		return resp
+	}
+
+	step, ok := totp.Validate(code, *user.TwoFactorSecret, time.Now())
+	if !ok {
+		resp = util.Message(false, http.StatusUnprocessableEntity, "Invalid authentication code.", errors)
+		return resp
+	}
+
+	db := GetDB()
+	defer db.Close()
+
+	tx := db.Begin()
+	err := tx.Model(&user).Updates(map[string]interface{}{
+		"TwoFactorEnabled":  true,
+		"TwoFactorLastStep": step,
+	}).Error
+
+	var recoveryCodes []string
+	if err == nil {
+		recoveryCodes, err = generateRecoveryCodes(tx, user.ID)
+	}
+
+	if err != nil {
+		tx.Rollback()
+		resp = util.Message(false, http.StatusInternalServerError, "Failed to enable two-factor authentication. Please try again.", errors)
+		return resp
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		resp = util.Message(false, http.StatusInternalServerError, "Failed to enable two-factor authentication. Please try again.", errors)
+		return resp
+	}
+
+	resp = util.Message(true, http.StatusOK, "Two-factor authentication has been enabled. Keep the recovery codes in a safe place.", errors)
+	resp["recoveryCodes"] = recoveryCodes
+
+	return resp
+}
+
+// Disable 2FA with the password and a code, unless it is required by any of the companies
+func (user *User) DisableTwoFactor(password, code string) map[string]interface{} {
+	var errors []string
+	var resp map[string]interface{}
+
+	if !user.TwoFactorEnabled {
+		resp = util.Message(false, http.StatusUnprocessableEntity, "Two-factor authentication is not enabled.", errors)
+		return resp
+	}
+
+	if user.IsTwoFactorRequired() {
+		resp = util.Message(false, http.StatusUnprocessableEntity, "Two-factor authentication is required by your company and cannot be disabled.", errors)
+		return resp
+	}
+
+	if !user.CheckPassword(password) {
+		resp = util.Message(false, http.StatusUnprocessableEntity, "Invalid password.", errors)
+		return resp
+	}
+
+	db := GetDB()
+	defer db.Close()
+
+	if !user.verifySecondFactor(db, code) {
+		resp = util.Message(false, http.StatusUnprocessableEntity, "Invalid authentication code.", errors)
+		return resp
+	}
+
+	tx := db.Begin()
+	err := tx.Model(&user).Updates(map[string]interface{}{
+		"TwoFactorEnabled":  false,
+		"TwoFactorSecret":   nil,
+		"TwoFactorLastStep": 0,
+	}).Error
+
+	if err == nil {
+		err = tx.Where("user_id = ?", user.ID).Delete(RecoveryCode{}).Error
+	}
+
+	if err != nil {
+		tx.Rollback()
+		resp = util.Message(false, http.StatusInternalServerError, "Failed to disable two-factor authentication. Please try again.", errors)
+		return resp
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		resp = util.Message(false, http.StatusInternalServerError, "Failed to disable two-factor authentication. Please try again.", errors)
+		return resp
+	}
+
+	resp = util.Message(true, http.StatusOK, "Two-factor authentication has been disabled.", errors)
+
+	return resp
+}
+
+// Replace the recovery codes of the user with new ones
+func (user *User) RegenerateRecoveryCodes(code string) map[string]interface{} {
+	var errors []string
+	var resp map[string]interface{}
+
+	if !user.TwoFactorEnabled {
+		resp = util.Message(false, http.StatusUnprocessableEntity, "Two-factor authentication is not enabled.", errors)
+		return resp
+	}
+
+	db := GetDB()
+	defer db.Close()
+
+	if !user.verifySecondFactor(db, code) {
+		resp = util.Message(false, http.StatusUnprocessableEntity, "Invalid authentication code.", errors)
+		return resp
+	}
+
+	tx := db.Begin()
+	err := tx.Where("user_id = ?", user.ID).Delete(RecoveryCode{}).Error
+
+	var recoveryCodes []string
+	if err == nil {
+		recoveryCodes, err = generateRecoveryCodes(tx, user.ID)
+	}
+
+	if err != nil {
+		tx.Rollback()
+		resp = util.Message(false, http.StatusInternalServerError, "Failed to generate the recovery codes. Please try again.", errors)
+		return resp
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		resp = util.Message(false, http.StatusInternalServerError, "Failed to generate the recovery codes. Please try again.", errors)
+		return resp
+	}
+
+	resp = util.Message(true, http.StatusOK, "New recovery codes have been generated. Keep them in a safe place.", errors)
+	resp["recoveryCodes"] = recoveryCodes
+
+	return resp
+}
+
+// Complete the login with the challenge token and the code from the authenticator app or a recovery code
+func CompleteTwoFactorLogin(challengeToken, code string, client Client) map[string]interface{} {
+	var errors []string
+	var resp map[string]interface{}
+
+	db := GetDB()
+	defer db.Close()
+
+	challenge := TwoFactorChallenge{}
+	db.Where("token_hash = ?", util.HashToken(challengeToken)).First(&challenge)
+
+	if challenge.ID == uuid.Nil || challenge.ConsumedAt != nil || time.Now().After(challenge.ExpiresAt) || challenge.Attempts >= twoFactorChallengeMaxAttempts {
+		resp = util.Message(false, http.StatusUnauthorized, "The login has expired. Please login again.", errors)
+		return resp
+	}
+
+	user := GetUser(challenge.UserID)
+	if user == nil {
+		resp = util.Message(false, http.StatusUnauthorized, "The login has expired. Please login again.", errors)
+		return resp
+	}
+
+	if user.IsLocked() {
+		resp = util.Message(false, http.StatusLocked, "The account has been temporarily locked due to too many failed login attempts. Please try again later or reset your password.", errors)
+		return resp
+	}
+
+	// The wrong codes count towards the lockout, as a new challenge is given on every login with the password
+	if !user.verifySecondFactor(db, code) {
+		user.registerFailedLogin()
+		db.Model(&challenge).Update("Attempts", challenge.Attempts+1)
+		resp = util.Message(false, http.StatusUnprocessableEntity, "Invalid authentication code.", errors)
+		return resp
+	}
+
+	// The challenge can only be used once
+	result := db.Model(TwoFactorChallenge{}).Where("id = ? AND consumed_at IS NULL", challenge.ID).Update("ConsumedAt", time.Now())
+	if result.Error != nil || result.RowsAffected == 0 {
+		resp = util.Message(false, http.StatusUnauthorized, "The login has expired. Please login again.", errors)
+		return resp
+	}
+
+	throttle.Account.Reset(user.ID.String())
+
+	return user.loginResponse(db, "You have successfully logged in.", client)
+}
+
+// Check if any of the companies of the user requires 2FA
+func (user *User) IsTwoFactorRequired() bool {
+	count := 0
+	db := GetDB()
+	db.Table("companies").
+		Joins("JOIN company_users ON company_users.company_id = companies.id").
+		Where("company_users.user_id = ? AND companies.require_two_factor = ? AND companies.deleted_at IS NULL", user.ID, true).
+		Count(&count)
+	defer db.Close()
+
+	return count > 0
+}
+
+// Require all the members of the company to enable 2FA
+func (company *Company) SetRequireTwoFactor(required bool) map[string]interface{} {
+	var errors []string
+	var resp map[string]interface{}
+
+	db := GetDB()
+	err := db.Model(&company).Update("RequireTwoFactor", required).Error
+	defer db.Close()
+
+	if err != nil {
+		resp = util.Message(false, http.StatusInternalServerError, "Failed to update the company, connection error.", errors)
+		return resp
+	}
+
+	message := "Two-factor authentication is no longer required for the members of the company."
+	if required {
+		message = "Two-factor authentication is now required for all the members of the company."
+	}
+
+	resp = util.Message(true, http.StatusOK, message, errors)
+	resp["data"] = company
+
+	return resp
+}
+
+// Verify the code from the authenticator app, or use up one of the recovery codes
+func (user *User) verifySecondFactor(db *gorm.DB, code string) bool {
+	if user.TwoFactorSecret == nil {
+		return false
+	}
+
+	// The code of the same time step cannot be reused
+	if step, ok := totp.Validate(code, *user.TwoFactorSecret, time.Now()); ok {
+		result := db.Model(User{}).Where("id = ? AND two_factor_last_step < ?", user.ID, step).Update("TwoFactorLastStep", step)
+		return result.Error == nil && result.RowsAffected > 0
+	}
+
+	codeHash := util.HashToken(normalizeRecoveryCode(code))
+	result := db.Model(RecoveryCode{}).Where("user_id = ? AND code_hash = ? AND used_at IS NULL", user.ID, codeHash).Update("UsedAt", time.Now())
+
+	return result.Error == nil && result.RowsAffected > 0
+}
+
+// Create the challenge of the login and return the plain token
+func createTwoFactorChallenge(db *gorm.DB, userId uuid.UUID) (string, error) {
+	plainToken, err := util.GenerateRandomToken(32)
+	if err != nil {
+		return "", err
+	}
+
+	challenge := TwoFactorChallenge{
+		UserID:    userId,
+		TokenHash: util.HashToken(plainToken),
+		ExpiresAt: time.Now().Add(twoFactorChallengeLifetime),
+	}
+
+	if err := db.Create(&challenge).Error; err != nil {
+		return "", err
+	}
+
+	return plainToken, nil
+}
+
+// Generate the recovery codes, only the hashes are stored
+func generateRecoveryCodes(db *gorm.DB, userId uuid.UUID) ([]string, error) {
+	var recoveryCodes []string
+	for i := 0; i < noOfRecoveryCodes; i++ {
+		code, err := util.GenerateRandomToken(5)
+		if err != nil {
+			return nil, err
+		}
+
+		recoveryCode := RecoveryCode{UserID: userId, CodeHash: util.HashToken(code)}
+		if err := db.Create(&recoveryCode).Error; err != nil {
+			return nil, err
+		}
+
+		// Shown as xxxxx-xxxxx for readability
+		recoveryCodes = append(recoveryCodes, code[:5]+"-"+code[5:])
+	}
+
+	return recoveryCodes, nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.Replace(strings.TrimSpace(code), "-", "", -1))
+}
@@ -0,0 +1,44 @@
+package models
+
+import (
+	"app/throttle"
+	"net/http"
+	"testing"
+)
+
+func TestCompleteTwoFactorLoginLockout(t *testing.T) {
+	db := testDB(t)
+	defer db.Close()
+
+	user := createTestUser(t, db, "Password123!")
+	defer deleteTestUser(db, user)
+	defer db.Where("user_id = ?", user.ID).Delete(TwoFactorChallenge{})
+	defer throttle.Account.Reset(user.ID.String())
+
+	secret := "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+	db.Model(user).Updates(map[string]interface{}{"TwoFactorEnabled": true, "TwoFactorSecret": secret})
+	user.TwoFactorEnabled = true
+
+	// Every login with the password gives a new challenge, the wrong codes still add up across them
+	for i := 0; i < maxFailedLogins; i++ {
+		resp := user.authenticated(db, testClient)
+		challenge, ok := resp["challengeToken"].(string)
+		if !ok {
+			t.Fatalf("authenticated() = %v, want the challenge", resp)
+		}
+
+		if resp := CompleteTwoFactorLogin(challenge, "abcdef", testClient); resp["status"] != http.StatusUnprocessableEntity {
+			t.Fatalf("CompleteTwoFactorLogin() attempt %d status = %v, want %v", i+1, resp["status"], http.StatusUnprocessableEntity)
+		}
+	}
+
+	locked := GetUser(user.ID)
+	if locked == nil || !locked.IsLocked() {
+		t.Fatal("The account is not locked after the wrong codes")
+	}
+
+	challenge, _ := createTwoFactorChallenge(db, user.ID)
+	if resp := CompleteTwoFactorLogin(challenge, "abcdef", testClient); resp["status"] != http.StatusLocked {
+		t.Errorf("CompleteTwoFactorLogin() of the locked account status = %v, want %v", resp["status"], http.StatusLocked)
+	}
+}
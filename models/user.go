@@ -1,27 +1,31 @@
 package models
 
 import (
+	"app/mailer"
+	"app/throttle"
 	util "app/utils"
-	"crypto/md5"
-	"encoding/hex"
-	"fmt"
 	"github.com/dgrijalva/jwt-go"
 	"github.com/jinzhu/gorm"
 	"github.com/satori/go.uuid"
 	"golang.org/x/crypto/bcrypt"
+	"log"
 	"net/http"
-	"os"
 	"strings"
 	"time"
 )
 
 const (
-	formattedDate = "01/02/2006"
+	formattedDate   = "01/02/2006"
+	maxFailedLogins = 10 // Lock the account after the number of failed logins
+	lockoutDuration = time.Minute * 30
+	passwordLinkInterval = time.Minute // How often the link to set the password can be sent to the user that has logged in
 )
 
 type Token struct {
-	UserId uuid.UUID
-	Expiry time.Time
+	UserId         uuid.UUID
+	SessionId      uuid.UUID
+	ImpersonatorId uuid.UUID // The superuser acting as the user, nil if not impersonating
+	Expiry         time.Time
 	jwt.StandardClaims
 }
 
@@ -32,9 +36,8 @@ type User struct {
 	Password              string     `json:"password" gorm:"not null"`
 	ProfilePicture        string     `json:"profilePicture"`
 	Token                 string     `json:"token" gorm:"-"`
-	ActivationCode        *string    `json:"activationCode"`
-	ResetPasswordCode     *string    `json:"resetPasswordCode"`
-	ResetPasswordExpiryDT *time.Time `json:"resetPasswordExpiryDateTime"`
+	RefreshToken          string     `json:"refreshToken" gorm:"-"`
+	ActivatedAt           *time.Time `json:"activatedAt"`
 	Phone                 string     `json:"phone"`
 	City                  string     `json:"city"`
 	Country               int        `json:"country" gorm:"default:'0'"`
@@ -42,59 +45,200 @@ type User struct {
 	Birthday              *time.Time `json:"birthday"`
 	BirthdayString        string     `json:"birthday_string" gorm:"-"`
 	Bio                   string     `json:"bio" sql:"type:text"`
+	TwoFactorEnabled      bool       `json:"twoFactorEnabled" gorm:"default:false"`
+	TwoFactorSecret       *string    `json:"-"`
+	TwoFactorLastStep     int64      `json:"-" gorm:"default:'0'"`
+	LockedUntil           *time.Time `json:"lockedUntil"`
+	DeletionScheduledAt   *time.Time `json:"deletionScheduledAt"`
+	IsSuperuser           bool       `json:"isSuperuser" gorm:"default:false"` // Platform staff, ie. the support team
+	PasswordUnusable      bool       `json:"-" gorm:"default:false"`           // Signed up through the provider, the password has never been set
 }
 
-func (user *User) Login(email string, password string) map[string]interface{} {
+func (user *User) Login(email string, password string, client Client) map[string]interface{} {
 	var errors []string
 	var resp map[string]interface{}
 
 	// Get the user by email
 	db := GetDB()
 	db.Table("users").Where("email = ?", email).First(&user)
-	// Also get the companies that the user is assigned to
-	companies := []Company{}
-	db.Table("companies").
-		Joins("JOIN company_users ON company_users.company_id = companies.id").
-		Select("companies.*").
-		Where("company_users.user_id = ?", user.ID).
-		Order("company_users.last_visited desc").
-		Find(&companies)
 
 	defer db.Close()
 
 	if user.Email == "" {
 		resp = util.Message(false, http.StatusUnprocessableEntity, "Invalid email address or password.", errors)
+	} else if user.IsLocked() {
+		resp = util.Message(false, http.StatusLocked, "The account has been temporarily locked due to too many failed login attempts. Please try again later or reset your password.", errors)
+	} else if ok, wait := throttle.Account.Allow(user.ID.String()); !ok {
+		resp = util.Message(false, http.StatusTooManyRequests, throttle.RetryMessage(wait), errors)
+		resp["retryAfter"] = throttle.RetryAfter(wait)
+	} else if company := GetSSOEnforcingCompany(user); company != nil {
+		resp = util.Message(false, http.StatusForbidden, "Your company requires you to login with single sign-on.", errors)
+		resp["sso"] = company.Slug
 	} else {
 		err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password))
 		// If password does not match
-		if err != nil && err == bcrypt.ErrMismatchedHashAndPassword {
+		if err != nil {
+			user.registerFailedLogin()
 			resp = util.Message(false, http.StatusUnprocessableEntity, "Invalid email address or password.", errors)
 		} else {
 			// Password matches
+			rehashPassword(db, user.ID, user.Password, password)
 			user.Password = "" // remove the password
-
-			// Create new JWT token for the newly registered account
-			expiry := time.Now().Add(time.Hour * 2) // Only valid for 2 hours
-			tk := &Token{UserId: user.ID, Expiry: expiry}
-			token := jwt.NewWithClaims(jwt.SigningMethodHS256, tk)
-			tokenString, _ := token.SignedString([]byte(os.Getenv("token_password")))
-			user.Token = tokenString
-
-			resp = util.Message(true, http.StatusOK, "You have successfully logged in.", errors)
-			resp["data"] = user
-			resp["companies"] = companies
-			resp["selectedCompany"] = nil
-			if len(companies) > 0 {
-				selectedCompany := companies[0]
-				resp["selectedCompany"] = selectedCompany
-				user.SelectCompany(&selectedCompany)
-			}
+			resp = user.authenticated(db, client)
 		}
 	}
 
 	return resp
 }
 
+// The first factor has been verified, either complete the login or ask for the second factor
+func (user *User) authenticated(db *gorm.DB, client Client) map[string]interface{} {
+	var errors []string
+	var resp map[string]interface{}
+
+	// The failed logins are only forgotten once the login is complete, not while the second factor is awaited
+	if !user.TwoFactorEnabled {
+		throttle.Account.Reset(user.ID.String())
+		return user.loginResponse(db, "You have successfully logged in.", client)
+	}
+
+	challengeToken, err := createTwoFactorChallenge(db, user.ID)
+	if err != nil {
+		resp = util.Message(false, http.StatusInternalServerError, "Failed to login, connection error.", errors)
+		return resp
+	}
+
+	resp = util.Message(true, http.StatusOK, "Please enter the code from your authenticator app.", errors)
+	resp["twoFactorRequired"] = true
+	resp["challengeToken"] = challengeToken
+
+	return resp
+}
+
+// Check if the account is locked due to too many failed logins
+func (user *User) IsLocked() bool {
+	return user.LockedUntil != nil && time.Now().Before(*user.LockedUntil)
+}
+
+// Record the failed login, and lock the account and notify the owner when there are too many
+func (user *User) registerFailedLogin() {
+	if count := throttle.Account.Fail(user.ID.String()); count < maxFailedLogins {
+		return
+	}
+
+	lockedUntil := time.Now().Add(lockoutDuration)
+	msg, err := mailer.NewAccountLockedEmail(user.Name, user.Email, lockedUntil)
+	if err != nil {
+		log.Println("Failed to build account locked email:", err)
+		return
+	}
+
+	db := GetDB()
+	defer db.Close()
+
+	tx := db.Begin()
+	err = tx.Model(&user).Update("LockedUntil", lockedUntil).Error
+	if err == nil {
+		err = QueueEmail(tx, nil, msg)
+	}
+
+	if err != nil {
+		tx.Rollback()
+		log.Println("Failed to lock the account:", err)
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		log.Println("Failed to lock the account:", err)
+		return
+	}
+
+	throttle.Account.Reset(user.ID.String())
+}
+
+// Unlock the account that has been locked due to too many failed logins
+func (user *User) Unlock() map[string]interface{} {
+	var errors []string
+	var resp map[string]interface{}
+
+	db := GetDB()
+	err := db.Model(&user).Update("LockedUntil", nil).Error
+	defer db.Close()
+
+	if err != nil {
+		resp = util.Message(false, http.StatusInternalServerError, "Failed to unlock the account, connection error.", errors)
+		return resp
+	}
+
+	throttle.Account.Reset(user.ID.String())
+
+	resp = util.Message(true, http.StatusOK, "The account of "+user.Email+" has been unlocked.", errors)
+
+	return resp
+}
+
+// Build the login response with the tokens and the companies that the user is assigned to
+func (user *User) loginResponse(db *gorm.DB, message string, client Client) map[string]interface{} {
+	var errors []string
+	var resp map[string]interface{}
+
+	// Create new session, JWT token and refresh token for the login
+	session, err := createSession(db, user.ID, client)
+	if err != nil {
+		resp = util.Message(false, http.StatusInternalServerError, "Failed to login, connection error.", errors)
+		return resp
+	}
+
+	if err := user.generateTokens(db, session.ID); err != nil {
+		resp = util.Message(false, http.StatusInternalServerError, "Failed to login, connection error.", errors)
+		return resp
+	}
+
+	// Also get the companies that the user is assigned to
+	companies := []Company{}
+	db.Table("companies").
+		Joins("JOIN company_users ON company_users.company_id = companies.id").
+		Select("companies.*").
+		Where("company_users.user_id = ?", user.ID).
+		Order("company_users.last_visited desc").
+		Find(&companies)
+
+	resp = util.Message(true, http.StatusOK, message, errors)
+	resp["data"] = user
+	resp["companies"] = companies
+	resp["selectedCompany"] = nil
+	if len(companies) > 0 {
+		selectedCompany := companies[0]
+		resp["selectedCompany"] = selectedCompany
+		user.SelectCompany(&selectedCompany)
+	}
+
+	return resp
+}
+
+// Generate the access token and the refresh token of the login
+func (user *User) generateTokens(db *gorm.DB, sessionId uuid.UUID) error {
+	tokenId := uuid.NewV4()
+	expiry := time.Now().Add(accessTokenLifetime)
+	tk := &Token{UserId: user.ID, SessionId: sessionId, Expiry: expiry}
+	tk.Id = tokenId.String()
+	tk.ExpiresAt = expiry.Unix()
+	tokenString, err := SignToken(tk)
+	if err != nil {
+		return err
+	}
+
+	refreshToken, err := createRefreshToken(db, user.ID, sessionId, tokenId)
+	if err != nil {
+		return err
+	}
+
+	user.Token = tokenString
+	user.RefreshToken = refreshToken
+
+	return nil
+}
+
 // Validate the incoming details for signup
 func (user *User) ValidateSignup() (map[string]interface{}, bool) {
 	var errors []string
@@ -131,26 +275,39 @@ func (user *User) Create() map[string]interface{} {
 		return resp
 	}
 
-	hashedPassword, _ := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
-	user.Password = string(hashedPassword)
-	user.Token = ""
-
 	db := GetDB()
-	db.Create(user)
+	defer db.Close()
 
-	if user.ID == uuid.Nil {
-		resp := util.Message(false, http.StatusInternalServerError, "Failed to create account, connection error.", errors)
+	// Check the password against the password policy
+	if errors = user.validatePassword(db, user.Password); len(errors) > 0 {
+		resp := util.Message(false, http.StatusUnprocessableEntity, "Validation error", errors)
 		return resp
 	}
 
-	// Store the activation code to the user
-	hash := md5.New()
-	hash.Write([]byte(fmt.Sprint(user.ID)))
-	activationCode := hex.EncodeToString(hash.Sum(nil))
+	hashedPassword, _ := hashPassword(user.Password)
+	user.Password = hashedPassword
+	user.Token = ""
+	user.RefreshToken = ""
+
+	// Create the account and queue the activation email in the same transaction
+	tx := db.Begin()
+	if err := tx.Create(user).Error; err != nil || user.ID == uuid.Nil {
+		tx.Rollback()
+		resp := util.Message(false, http.StatusInternalServerError, "Failed to create account, connection error.", errors)
+		return resp
+	}
 
-	db.Model(&user).Update("ActivationCode", activationCode)
+	// Create the activation token and queue the activation email
+	if err := user.queueActivationEmail(tx); err != nil {
+		tx.Rollback()
+		resp := util.Message(false, http.StatusInternalServerError, "Failed to create account, connection error.", errors)
+		return resp
+	}
 
-	defer db.Close()
+	if err := tx.Commit().Error; err != nil {
+		resp := util.Message(false, http.StatusInternalServerError, "Failed to create account, connection error.", errors)
+		return resp
+	}
 
 	user.Password = "" // delete the password
 
@@ -169,9 +326,25 @@ func (user *User) ResendActivation() map[string]interface{} {
 
 	if user == nil {
 		resp = util.Message(false, http.StatusUnprocessableEntity, "Invalid email address.", errors)
-	} else if user.ActivationCode == nil {
+	} else if user.IsActivated() {
 		resp = util.Message(false, http.StatusUnprocessableEntity, "The account has already been activated.", errors)
 	} else {
+		// A new activation link is sent, the previous link is no longer valid
+		db := GetDB()
+		defer db.Close()
+
+		tx := db.Begin()
+		if err := user.queueActivationEmail(tx); err != nil {
+			tx.Rollback()
+			resp = util.Message(false, http.StatusInternalServerError, "Failed to send the activation email. Please try again.", errors)
+			return resp
+		}
+
+		if err := tx.Commit().Error; err != nil {
+			resp = util.Message(false, http.StatusInternalServerError, "Failed to send the activation email. Please try again.", errors)
+			return resp
+		}
+
 		resp = util.Message(true, http.StatusOK, "The activation link has been emailed to you. Please check your inbox.", errors)
 		resp["data"] = user
 	}
@@ -188,24 +361,25 @@ func (user *User) ForgetPassword() map[string]interface{} {
 
 	if user == nil {
 		resp = util.Message(false, http.StatusUnprocessableEntity, "Invalid email address.", errors)
-	} else if user.ActivationCode != nil {
+	} else if !user.IsActivated() {
 		resp = util.Message(false, http.StatusUnprocessableEntity, "The account has not been activated yet. Please activate the account first.", errors)
 	} else {
-		// Store the reset password code to the user
-		hash := md5.New()
-		hash.Write([]byte(fmt.Sprint(user.ID) + time.Now().String()))
-		resetPasswordCode := hex.EncodeToString(hash.Sum(nil))
-		// Add one hour to the expiry date for reseting the password
-		resetPasswordExpiryDT := time.Now().Local().Add(time.Hour * 1)
-
+		// Store the reset password token and queue the email in the same transaction
 		db := GetDB()
-		db.Model(&user).Update(map[string]interface{}{
-			"ResetPasswordCode":     resetPasswordCode,
-			"ResetPasswordExpiryDT": resetPasswordExpiryDT,
-		})
-
 		defer db.Close()
 
+		tx := db.Begin()
+		if err := user.queueResetPasswordEmail(tx); err != nil {
+			tx.Rollback()
+			resp = util.Message(false, http.StatusInternalServerError, "Failed to send the reset password email. Please try again.", errors)
+			return resp
+		}
+
+		if err := tx.Commit().Error; err != nil {
+			resp = util.Message(false, http.StatusInternalServerError, "Failed to send the reset password email. Please try again.", errors)
+			return resp
+		}
+
 		resp = util.Message(true, http.StatusOK, "An email to reset password has been sent to you. Please check your inbox.", errors)
 		resp["data"] = user
 	}
@@ -213,52 +387,164 @@ func (user *User) ForgetPassword() map[string]interface{} {
 	return resp
 }
 
+// Email the link to set the password to the user that has logged in, ie. the user that has signed up with the social login
+// or single sign-on does not know the current password to change it
+func (user *User) SendPasswordLink() map[string]interface{} {
+	var errors []string
+	var resp map[string]interface{}
+
+	db := GetDB()
+	defer db.Close()
+
+	// Prevent flooding the inbox of the user
+	recent := VerificationToken{}
+	db.Where("purpose = ? AND user_id = ? AND created_at > ?", PurposeResetPassword, user.ID, time.Now().Add(-passwordLinkInterval)).First(&recent)
+	if recent.ID != uuid.Nil {
+		resp = util.Message(false, http.StatusTooManyRequests, "A link to set the password has just been sent. Please check your inbox or try again in a minute.", errors)
+		return resp
+	}
+
+	tx := db.Begin()
+	if err := user.queueResetPasswordEmail(tx); err != nil {
+		tx.Rollback()
+		resp = util.Message(false, http.StatusInternalServerError, "Failed to send the email to set the password. Please try again.", errors)
+		return resp
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		resp = util.Message(false, http.StatusInternalServerError, "Failed to send the email to set the password. Please try again.", errors)
+		return resp
+	}
+
+	resp = util.Message(true, http.StatusOK, "A link to set the password has been sent to "+user.Email+". Please check your inbox.", errors)
+
+	return resp
+}
+
+// Create the reset password token and queue the reset password email to the user
+func (user *User) queueResetPasswordEmail(db *gorm.DB) error {
+	resetPasswordCode, err := CreateVerificationToken(db, PurposeResetPassword, &user.ID, nil, "")
+	if err != nil {
+		return err
+	}
+
+	msg, err := mailer.NewResetPasswordEmail(user.Name, user.Email, resetPasswordCode)
+	if err != nil {
+		return err
+	}
+
+	return QueueEmail(db, nil, msg)
+}
+
+// Check if the account has been activated
+func (user *User) IsActivated() bool {
+	return user.ActivatedAt != nil
+}
+
+// Create the activation token and queue the activation email to the user
+func (user *User) queueActivationEmail(db *gorm.DB) error {
+	activationCode, err := CreateVerificationToken(db, PurposeActivation, &user.ID, nil, "")
+	if err != nil {
+		return err
+	}
+
+	msg, err := mailer.NewActivationEmail(user.Name, user.Email, activationCode)
+	if err != nil {
+		return err
+	}
+
+	return QueueEmail(db, nil, msg)
+}
+
 func (user *User) ActivateAccount(code string) map[string]interface{} {
 	var errors []string
 	var resp map[string]interface{}
 
-	// Get the user by activation code
-	user = GetUserByActivationCode(code)
+	db := GetDB()
+	defer db.Close()
 
-	if user == nil {
-		resp = util.Message(false, http.StatusUnprocessableEntity, "Invalid activation link.", errors)
-	} else {
-		// Reset the activation code of the user
-		db := GetDB()
-		db.Model(&user).Update("ActivationCode", nil)
+	// Use up the activation token
+	tx := db.Begin()
+	token, err := ConsumeVerificationToken(tx, PurposeActivation, code)
+	if err != nil || token.UserID == nil {
+		tx.Rollback()
+		resp = util.Message(false, http.StatusUnprocessableEntity, "Invalid/expired activation link.", errors)
+		return resp
+	}
 
-		defer db.Close()
+	err = tx.Model(User{}).Where("id = ? AND activated_at IS NULL", *token.UserID).Update("ActivatedAt", time.Now()).Error
+	if err != nil {
+		tx.Rollback()
+		resp = util.Message(false, http.StatusInternalServerError, "Failed to activate the account, connection error.", errors)
+		return resp
+	}
 
-		resp = util.Message(true, http.StatusOK, "Thank you for signing up. Your account has been activated.", errors)
+	if err := tx.Commit().Error; err != nil {
+		resp = util.Message(false, http.StatusInternalServerError, "Failed to activate the account, connection error.", errors)
+		return resp
 	}
 
+	resp = util.Message(true, http.StatusOK, "Thank you for signing up. Your account has been activated.", errors)
+
 	return resp
 }
 
-func (user *User) ResetPassword(code string, password string) map[string]interface{} {
+func (user *User) ResetPassword(code string, password string, client Client) map[string]interface{} {
 	var errors []string
 	var resp map[string]interface{}
 
-	// Get the user by reset password code
-	user = GetUserByResetPasswordCode(code)
+	db := GetDB()
+	defer db.Close()
 
-	if user == nil {
+	// Use up the reset password token
+	tx := db.Begin()
+	token, err := ConsumeVerificationToken(tx, PurposeResetPassword, code)
+	if err != nil || token.UserID == nil {
+		tx.Rollback()
 		resp = util.Message(false, http.StatusUnprocessableEntity, "Invalid/expired reset password link.", errors)
-	} else {
-		// Reset the password of the user
-		hashedPassword, _ := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
-		db := GetDB()
-		db.Model(&user).Update(map[string]interface{}{
-			"ResetPasswordCode":     nil,
-			"ResetPasswordExpiryDT": nil,
-			"Password":              string(hashedPassword),
+		return resp
+	}
+
+	account := User{}
+	tx.Where("id = ?", *token.UserID).First(&account)
+
+	// Check the password against the password policy, the link can be used again with another password
+	if errors = account.validatePassword(tx, password); len(errors) > 0 {
+		tx.Rollback()
+		resp = util.Message(false, http.StatusUnprocessableEntity, "Validation error", errors)
+		return resp
+	}
+
+	// Reset the password of the user
+	hashedPassword, err := hashPassword(password)
+	if err == nil {
+		err = setPasswordHash(tx, *token.UserID, hashedPassword, map[string]interface{}{
+			"LockedUntil": nil,
 		})
+	}
 
-		defer db.Close()
+	if err == nil {
+		err = passwordChanged(tx, &account, true, client)
+	}
 
-		resp = util.Message(true, http.StatusOK, "Successfully reset the password.", errors)
+	if err != nil {
+		tx.Rollback()
+		resp = util.Message(false, http.StatusInternalServerError, "Failed to reset the password, connection error.", errors)
+		return resp
 	}
 
+	if err := tx.Commit().Error; err != nil {
+		resp = util.Message(false, http.StatusInternalServerError, "Failed to reset the password, connection error.", errors)
+		return resp
+	}
+
+	throttle.Account.Reset(token.UserID.String())
+
+	// Sign out everywhere in case the password has been compromised
+	revokeUserSessions(db, *token.UserID, uuid.Nil)
+
+	resp = util.Message(true, http.StatusOK, "Successfully reset the password.", errors)
+
 	return resp
 }
 
@@ -316,18 +602,59 @@ func (user *User) DeletePicture() map[string]interface{} {
 	return resp
 }
 
-func (user *User) EditPassword() map[string]interface{} {
+func (user *User) EditPassword(currentPassword string, currentSessionId uuid.UUID, client Client) map[string]interface{} {
 	var errors []string
-	hashedPassword, _ := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
-	password := string(hashedPassword)
 
 	db := GetDB()
-	db.Model(&user).Update(map[string]interface{}{
-		"Password": password,
-	})
-
 	defer db.Close()
 
+	// Verify the current password, in case the token has been stolen
+	currentHash := []string{}
+	db.Table("users").Where("id = ?", user.ID).Pluck("password", &currentHash)
+
+	if user.IsLocked() {
+		resp := util.Message(false, http.StatusLocked, "The account has been temporarily locked due to too many failed login attempts. Please try again later or reset your password.", errors)
+		return resp
+	}
+
+	if len(currentHash) == 0 || bcrypt.CompareHashAndPassword([]byte(currentHash[0]), []byte(currentPassword)) != nil {
+		user.registerFailedLogin()
+		resp := util.Message(false, http.StatusUnprocessableEntity, "The current password is incorrect.", errors)
+		return resp
+	}
+
+	// Check the password against the password policy
+	if errors = user.validatePassword(db, user.Password); len(errors) > 0 {
+		resp := util.Message(false, http.StatusUnprocessableEntity, "Validation error", errors)
+		return resp
+	}
+
+	hashedPassword, err := hashPassword(user.Password)
+	user.Password = ""
+
+	tx := db.Begin()
+	if err == nil {
+		err = setPasswordHash(tx, user.ID, hashedPassword, nil)
+	}
+
+	if err == nil {
+		err = passwordChanged(tx, user, false, client)
+	}
+
+	if err != nil {
+		tx.Rollback()
+		resp := util.Message(false, http.StatusInternalServerError, "Failed to update the password, connection error.", errors)
+		return resp
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		resp := util.Message(false, http.StatusInternalServerError, "Failed to update the password, connection error.", errors)
+		return resp
+	}
+
+	// Sign out the other sessions, only the current session stays logged in
+	revokeUserSessions(db, user.ID, currentSessionId)
+
 	resp := util.Message(true, http.StatusOK, "Successfully updated password.", errors)
 
 	return resp
@@ -410,6 +737,20 @@ func (user *User) IsAdmin(company *Company) bool {
 	return result.IsAdmin
 }
 
+// Check the password against the hash stored in database, as the loaded user has the password removed
+func (user *User) CheckPassword(password string) bool {
+	temp := User{}
+	db := GetDB()
+	db.Table("users").Select("password").Where("id = ?", user.ID).First(&temp)
+	defer db.Close()
+
+	if temp.Password == "" {
+		return false
+	}
+
+	return bcrypt.CompareHashAndPassword([]byte(temp.Password), []byte(password)) == nil
+}
+
 func getUser(user *User) *User {
 	if user.Email == "" {
 		return nil
@@ -432,32 +773,6 @@ func GetUserByEmail(email string) *User {
 	return getUser(user)
 }
 
-func GetUserByActivationCode(activationCode string) *User {
-	user := &User{}
-	db := GetDB()
-	db.Table("users").
-		Select("users.*, TO_CHAR(users.birthday, '"+util.DateSQLFormat+"') as birthday_string").
-		Where("activation_code = ?", activationCode).
-		First(user)
-	defer db.Close()
-
-	return getUser(user)
-}
-
-func GetUserByResetPasswordCode(resetPasswordCode string) *User {
-	user := &User{}
-	now := time.Now().Local()
-	db := GetDB()
-	db.Table("users").
-		Select("users.*, TO_CHAR(users.birthday, '"+util.DateSQLFormat+"') as birthday_string").
-		Where("reset_password_code = ?", resetPasswordCode).
-		Where("reset_password_expiry_dt > ?", now).
-		First(user)
-	defer db.Close()
-
-	return getUser(user)
-}
-
 func GetUser(u uuid.UUID) *User {
 	user := &User{}
 	db := GetDB()
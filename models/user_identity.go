@@ -0,0 +1,273 @@
+package models
+
+import (
+	"app/oauth"
+	util "app/utils"
+	"encoding/json"
+	"github.com/jinzhu/gorm"
+	"github.com/satori/go.uuid"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Account at the external provider that is linked to the user
+type UserIdentity struct {
+	Base
+	UserID   uuid.UUID `json:"userId" gorm:"type:uuid;not null;index"`
+	Provider string    `json:"provider" gorm:"not null;unique_index:idx_provider_subject"`
+	Subject  string    `json:"-" gorm:"not null;unique_index:idx_provider_subject"`
+	Email    string    `json:"email"`
+}
+
+type oauthState struct {
+	Provider     string `json:"provider"`
+	CodeVerifier string `json:"codeVerifier"`
+}
+
+// Start the social login, return the URL of the provider to redirect the user to
+func StartOAuthLogin(provider oauth.Provider) map[string]interface{} {
+	var errors []string
+	var resp map[string]interface{}
+
+	codeVerifier, err := util.GenerateRandomToken(32)
+	if err != nil {
+		resp = util.Message(false, http.StatusInternalServerError, "Failed to start the login, please try again.", errors)
+		return resp
+	}
+
+	data, _ := json.Marshal(oauthState{Provider: provider.Name(), CodeVerifier: codeVerifier})
+
+	db := GetDB()
+	state, err := CreateVerificationToken(db, PurposeOAuthState, nil, nil, string(data))
+	defer db.Close()
+
+	if err != nil {
+		resp = util.Message(false, http.StatusInternalServerError, "Failed to start the login, please try again.", errors)
+		return resp
+	}
+
+	authURL, err := provider.AuthCodeURL(state, oauth.CodeChallenge(codeVerifier), oauth.RedirectURI(provider.Name()))
+	if err != nil {
+		log.Println("Failed to get the authorization URL:", err)
+		resp = util.Message(false, http.StatusBadGateway, "Failed to connect to the login provider, please try again.", errors)
+		return resp
+	}
+
+	resp = util.Message(true, http.StatusOK, "Redirect to the login provider.", errors)
+	resp["url"] = authURL
+
+	return resp
+}
+
+// Complete the social login with the code from the provider
+func CompleteOAuthLogin(provider oauth.Provider, code, state string, client Client) map[string]interface{} {
+	var errors []string
+	var resp map[string]interface{}
+
+	db := GetDB()
+	defer db.Close()
+
+	token, err := ConsumeVerificationToken(db, PurposeOAuthState, state)
+	data := oauthState{}
+	if err == nil {
+		err = json.Unmarshal([]byte(token.Data), &data)
+	}
+
+	if err != nil || data.Provider != provider.Name() {
+		resp = util.Message(false, http.StatusUnprocessableEntity, "The login has expired. Please try again.", errors)
+		return resp
+	}
+
+	identity, err := provider.Exchange(code, data.CodeVerifier, oauth.RedirectURI(provider.Name()))
+	if err != nil {
+		log.Println("Failed to exchange the authorization code:", err)
+		resp = util.Message(false, http.StatusBadGateway, "Failed to login with the provider, please try again.", errors)
+		return resp
+	}
+
+	user, resp := getOrCreateUserByIdentity(db, provider.Name(), identity)
+	if user == nil {
+		return resp
+	}
+
+	if user.IsLocked() {
+		resp = util.Message(false, http.StatusLocked, "The account has been temporarily locked due to too many failed login attempts. Please try again later or reset your password.", errors)
+		return resp
+	}
+
+	if company := GetSSOEnforcingCompany(user); company != nil {
+		resp = util.Message(false, http.StatusForbidden, "Your company requires you to login with single sign-on.", errors)
+		resp["sso"] = company.Slug
+		return resp
+	}
+
+	return user.authenticated(db, client)
+}
+
+// Get the user linked to the identity, or link/create the user by the verified email
+func getOrCreateUserByIdentity(db *gorm.DB, provider string, identity *oauth.Identity) (*User, map[string]interface{}) {
+	var errors []string
+	var resp map[string]interface{}
+
+	// The identity has been linked before
+	userIdentity := UserIdentity{}
+	db.Where("provider = ? AND subject = ?", provider, identity.Subject).First(&userIdentity)
+	if userIdentity.ID != uuid.Nil {
+		if user := GetUser(userIdentity.UserID); user != nil {
+			return user, nil
+		}
+
+		// The account has been deleted, the identity is linked again below
+		if err := db.Unscoped().Delete(&userIdentity).Error; err != nil {
+			resp = util.Message(false, http.StatusInternalServerError, "Failed to login, connection error.", errors)
+			return nil, resp
+		}
+	}
+
+	if identity.Email == "" || !identity.EmailVerified {
+		resp = util.Message(false, http.StatusUnprocessableEntity, "The email address of the account has not been verified by the provider.", errors)
+		return nil, resp
+	}
+
+	email := strings.ToLower(strings.TrimSpace(identity.Email))
+
+	tx := db.Begin()
+	user := &User{}
+	tx.Where("lower(email) = ?", email).First(user)
+
+	if user.ID == uuid.Nil {
+		// Create the account, the password is unusable until the user sets it with the link from the email
+		hashedPassword, err := unusablePassword()
+		if err != nil {
+			tx.Rollback()
+			resp = util.Message(false, http.StatusInternalServerError, "Failed to create account, connection error.", errors)
+			return nil, resp
+		}
+
+		now := time.Now()
+		user = &User{
+			Name:             identity.Name,
+			Email:            email,
+			Password:         hashedPassword,
+			PasswordUnusable: true,
+			ActivatedAt:      &now,
+		}
+		if user.Name == "" {
+			user.Name = email
+		}
+
+		if err := tx.Create(user).Error; err != nil {
+			tx.Rollback()
+			resp = util.Message(false, http.StatusInternalServerError, "Failed to create account, connection error.", errors)
+			return nil, resp
+		}
+	} else if !user.IsActivated() {
+		// The provider has verified the ownership of the email, but not the password of the account
+		if err := resetUnverifiedAccount(tx, user); err != nil {
+			tx.Rollback()
+			resp = util.Message(false, http.StatusInternalServerError, "Failed to login, connection error.", errors)
+			return nil, resp
+		}
+	}
+
+	userIdentity = UserIdentity{
+		UserID:   user.ID,
+		Provider: provider,
+		Subject:  identity.Subject,
+		Email:    email,
+	}
+
+	if err := tx.Create(&userIdentity).Error; err != nil {
+		tx.Rollback()
+		resp = util.Message(false, http.StatusInternalServerError, "Failed to login, connection error.", errors)
+		return nil, resp
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		resp = util.Message(false, http.StatusInternalServerError, "Failed to login, connection error.", errors)
+		return nil, resp
+	}
+
+	user.Password = "" // remove the password
+
+	return user, nil
+}
+
+// Activate the account signed up with the email that the provider has verified
+// The account might have been signed up by someone else before the owner of the email, so its password is made unusable
+// and its logins and pending links are revoked
+func resetUnverifiedAccount(tx *gorm.DB, user *User) error {
+	password, err := unusablePassword()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	err = tx.Model(user).Updates(map[string]interface{}{
+		"ActivatedAt":      now,
+		"Password":         password,
+		"PasswordUnusable": true,
+	}).Error
+
+	if err == nil {
+		err = tx.Model(APIToken{}).Where("user_id = ? AND revoked_at IS NULL", user.ID).Update("RevokedAt", now).Error
+	}
+
+	if err == nil {
+		err = tx.Where("user_id = ?", user.ID).Delete(VerificationToken{}).Error
+	}
+
+	if err != nil {
+		return err
+	}
+
+	revokeUserSessions(tx, user.ID, uuid.Nil)
+
+	return nil
+}
+
+// Get the identities linked to the user
+func (user *User) GetIdentities() map[string]interface{} {
+	var errors []string
+	var resp map[string]interface{}
+
+	identities := []UserIdentity{}
+	db := GetDB()
+	db.Where("user_id = ?", user.ID).Order("created_at asc").Find(&identities)
+	defer db.Close()
+
+	resp = util.Message(true, http.StatusOK, "You have successfully retrieved the linked accounts.", errors)
+	resp["data"] = identities
+
+	return resp
+}
+
+// Unlink the identity from the user
+func (user *User) UnlinkIdentity(identityId uuid.UUID) map[string]interface{} {
+	var errors []string
+	var resp map[string]interface{}
+
+	db := GetDB()
+	defer db.Close()
+
+	// The account signed up through the provider would be left without a way to login
+	count := 0
+	db.Model(UserIdentity{}).Where("user_id = ? AND id <> ?", user.ID, identityId).Count(&count)
+	if current := GetUser(user.ID); count == 0 && current != nil && current.PasswordUnusable {
+		resp = util.Message(false, http.StatusUnprocessableEntity, "Please set a password before unlinking the last linked account.", errors)
+		return resp
+	}
+
+	result := db.Unscoped().Where("id = ? AND user_id = ?", identityId, user.ID).Delete(UserIdentity{})
+
+	if result.Error != nil || result.RowsAffected == 0 {
+		resp = util.Message(false, http.StatusUnprocessableEntity, "No available result.", errors)
+		return resp
+	}
+
+	resp = util.Message(true, http.StatusOK, "You have successfully unlinked the account.", errors)
+
+	return resp
+}
@@ -0,0 +1,348 @@
+package models
+
+import (
+	"app/oauth"
+	"github.com/satori/go.uuid"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// Provider that returns the identity without calling the external service
+type fakeProvider struct {
+	identity      *oauth.Identity
+	codeChallenge string
+	codeVerifier  string
+}
+
+func (p *fakeProvider) Name() string {
+	return "fake"
+}
+
+func (p *fakeProvider) AuthCodeURL(state, codeChallenge, redirectURI string) (string, error) {
+	p.codeChallenge = codeChallenge
+	return "https://provider.test/authorize?state=" + url.QueryEscape(state), nil
+}
+
+func (p *fakeProvider) Exchange(code, codeVerifier, redirectURI string) (*oauth.Identity, error) {
+	p.codeVerifier = codeVerifier
+	return p.identity, nil
+}
+
+// Start the login at the provider and return the state of the login
+func startTestOAuthLogin(t *testing.T, provider oauth.Provider) string {
+	resp := StartOAuthLogin(provider)
+	if resp["status"] != http.StatusOK {
+		t.Fatalf("StartOAuthLogin() = %v", resp)
+	}
+
+	authURL, _ := url.Parse(resp["url"].(string))
+	return authURL.Query().Get("state")
+}
+
+func TestCompleteOAuthLoginState(t *testing.T) {
+	db := testDB(t)
+	defer db.Close()
+
+	user := createTestUser(t, db, "Password123!")
+	defer deleteTestUser(db, user)
+
+	provider := &fakeProvider{identity: &oauth.Identity{Subject: uuid.NewV4().String(), Email: user.Email, EmailVerified: true}}
+	state := startTestOAuthLogin(t, provider)
+
+	tests := []struct {
+		name   string
+		state  string
+		status int
+	}{
+		{"unknown state", "unknown", http.StatusUnprocessableEntity},
+		{"valid state", state, http.StatusOK},
+		{"reused state", state, http.StatusUnprocessableEntity},
+	}
+
+	for _, test := range tests {
+		resp := CompleteOAuthLogin(provider, "code", test.state, testClient)
+		if resp["status"] != test.status {
+			t.Errorf("%s: CompleteOAuthLogin() status = %v, want %v", test.name, resp["status"], test.status)
+		}
+	}
+
+	if oauth.CodeChallenge(provider.codeVerifier) != provider.codeChallenge {
+		t.Error("The code verifier of the exchange does not match the code challenge of the login")
+	}
+}
+
+func TestCompleteOAuthLoginOtherProvider(t *testing.T) {
+	db := testDB(t)
+	defer db.Close()
+
+	// The state of the login with another provider cannot be used
+	data := `{"provider":"another","codeVerifier":"verifier"}`
+	state, err := CreateVerificationToken(db, PurposeOAuthState, nil, nil, data)
+	if err != nil {
+		t.Fatalf("Failed to create the state: %v", err)
+	}
+
+	provider := &fakeProvider{identity: &oauth.Identity{Subject: "subject"}}
+	resp := CompleteOAuthLogin(provider, "code", state, testClient)
+	if resp["status"] != http.StatusUnprocessableEntity {
+		t.Errorf("CompleteOAuthLogin() status = %v, want %v", resp["status"], http.StatusUnprocessableEntity)
+	}
+}
+
+func TestGetOrCreateUserByIdentity(t *testing.T) {
+	db := testDB(t)
+	defer db.Close()
+
+	activated := createTestUser(t, db, "Password123!")
+	defer deleteTestUser(db, activated)
+
+	unactivated := createTestUser(t, db, "Password123!")
+	defer deleteTestUser(db, unactivated)
+	db.Model(unactivated).Update("ActivatedAt", nil)
+
+	newEmail := "test-" + uuid.NewV4().String() + "@example.com"
+	defer db.Unscoped().Where("email = ?", newEmail).Delete(User{})
+
+	tests := []struct {
+		name          string
+		identity      *oauth.Identity
+		wantUser      *User // The existing user that is linked, nil if a new user is created
+		wantError     bool
+		wantActivated bool
+		resetPassword bool
+	}{
+		{
+			name:      "unverified email",
+			identity:  &oauth.Identity{Subject: uuid.NewV4().String(), Email: newEmail},
+			wantError: true,
+		},
+		{
+			name:          "new user",
+			identity:      &oauth.Identity{Subject: uuid.NewV4().String(), Email: newEmail, EmailVerified: true, Name: "New User"},
+			wantActivated: true,
+		},
+		{
+			name:          "activated user",
+			identity:      &oauth.Identity{Subject: uuid.NewV4().String(), Email: activated.Email, EmailVerified: true},
+			wantUser:      activated,
+			wantActivated: true,
+		},
+		{
+			name:          "unactivated user",
+			identity:      &oauth.Identity{Subject: uuid.NewV4().String(), Email: unactivated.Email, EmailVerified: true},
+			wantUser:      unactivated,
+			wantActivated: true,
+			resetPassword: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			user, resp := getOrCreateUserByIdentity(db, "fake", test.identity)
+
+			if test.wantError {
+				if user != nil {
+					t.Fatalf("getOrCreateUserByIdentity() = %v, want an error", user.ID)
+				}
+				return
+			}
+
+			if user == nil {
+				t.Fatalf("getOrCreateUserByIdentity() = %v", resp)
+			}
+
+			if test.wantUser != nil && user.ID != test.wantUser.ID {
+				t.Errorf("getOrCreateUserByIdentity() linked %v, want %v", user.ID, test.wantUser.ID)
+			}
+
+			if got := GetUser(user.ID); got.IsActivated() != test.wantActivated {
+				t.Errorf("IsActivated() = %v, want %v", got.IsActivated(), test.wantActivated)
+			}
+
+			if user.CheckPassword("Password123!") == test.resetPassword && test.wantUser != nil {
+				t.Errorf("The password is reset = %v, want %v", !test.resetPassword, test.resetPassword)
+			}
+
+			// The linked identity logs in the same user
+			linked, _ := getOrCreateUserByIdentity(db, "fake", test.identity)
+			if linked == nil || linked.ID != user.ID {
+				t.Error("The identity is not linked to the user")
+			}
+		})
+	}
+}
+
+func TestResetUnverifiedAccountRevokesSessions(t *testing.T) {
+	db := testDB(t)
+	defer db.Close()
+
+	user := createTestUser(t, db, "Password123!")
+	defer deleteTestUser(db, user)
+
+	session := &Session{UserID: user.ID, ExpiresAt: time.Now().Add(time.Hour)}
+	if err := db.Create(session).Error; err != nil {
+		t.Fatalf("Failed to create the session: %v", err)
+	}
+
+	if _, err := CreateVerificationToken(db, PurposeResetPassword, &user.ID, nil, ""); err != nil {
+		t.Fatalf("Failed to create the reset token: %v", err)
+	}
+
+	tx := db.Begin()
+	if err := resetUnverifiedAccount(tx, user); err != nil {
+		tx.Rollback()
+		t.Fatalf("resetUnverifiedAccount() returned the error: %v", err)
+	}
+	tx.Commit()
+
+	count := 0
+	db.Model(VerificationToken{}).Where("user_id = ?", user.ID).Count(&count)
+	if count != 0 {
+		t.Errorf("%d verification tokens are left, want none", count)
+	}
+
+	db.Model(Session{}).Where("user_id = ? AND revoked_at IS NULL", user.ID).Count(&count)
+	if count != 0 {
+		t.Errorf("%d sessions are left, want none", count)
+	}
+}
+
+func TestCompleteOAuthLoginSSOEnforced(t *testing.T) {
+	db := testDB(t)
+	defer db.Close()
+
+	admin := createTestUser(t, db, "Password123!")
+	defer deleteTestUser(db, admin)
+
+	member := createTestUser(t, db, "Password123!")
+	defer deleteTestUser(db, member)
+
+	company, _, memberRole := createTestCompany(t, db, admin)
+	defer deleteTestCompany(db, company)
+	addTestMember(t, db, company, member, memberRole)
+
+	sso := &CompanySSO{CompanyID: company.ID, Enabled: true, Enforced: true, EmailDomain: "example.com"}
+	db.Create(sso)
+	defer db.Unscoped().Delete(sso)
+
+	tests := []struct {
+		name   string
+		user   *User
+		status int
+	}{
+		{"member", member, http.StatusForbidden},
+		{"admin", admin, http.StatusOK},
+	}
+
+	for _, test := range tests {
+		provider := &fakeProvider{identity: &oauth.Identity{Subject: uuid.NewV4().String(), Email: test.user.Email, EmailVerified: true}}
+		state := startTestOAuthLogin(t, provider)
+
+		resp := CompleteOAuthLogin(provider, "code", state, testClient)
+		if resp["status"] != test.status {
+			t.Errorf("%s: CompleteOAuthLogin() status = %v, want %v", test.name, resp["status"], test.status)
+		}
+	}
+}
+
+func TestUnlinkIdentity(t *testing.T) {
+	db := testDB(t)
+	defer db.Close()
+
+	user := createTestUser(t, db, "Password123!")
+	defer deleteTestUser(db, user)
+
+	other := createTestUser(t, db, "Password123!")
+	defer deleteTestUser(db, other)
+
+	identity := &UserIdentity{UserID: user.ID, Provider: "fake", Subject: uuid.NewV4().String(), Email: user.Email}
+	db.Create(identity)
+
+	tests := []struct {
+		name   string
+		user   *User
+		status int
+	}{
+		{"another user", other, http.StatusUnprocessableEntity},
+		{"owner", user, http.StatusOK},
+		{"already unlinked", user, http.StatusUnprocessableEntity},
+	}
+
+	for _, test := range tests {
+		resp := test.user.UnlinkIdentity(identity.ID)
+		if resp["status"] != test.status {
+			t.Errorf("%s: UnlinkIdentity() status = %v, want %v", test.name, resp["status"], test.status)
+		}
+	}
+}
+
+func TestGetOrCreateUserByStaleIdentity(t *testing.T) {
+	db := testDB(t)
+	defer db.Close()
+
+	deleted := createTestUser(t, db, "Password123!")
+	defer deleteTestUser(db, deleted)
+
+	identity := &oauth.Identity{Subject: uuid.NewV4().String(), Email: "test-" + uuid.NewV4().String() + "@example.com", EmailVerified: true}
+	defer db.Unscoped().Where("email = ?", identity.Email).Delete(User{})
+
+	db.Create(&UserIdentity{UserID: deleted.ID, Provider: "fake", Subject: identity.Subject, Email: deleted.Email})
+	db.Delete(deleted)
+
+	user, resp := getOrCreateUserByIdentity(db, "fake", identity)
+	if user == nil {
+		t.Fatalf("getOrCreateUserByIdentity() = %v", resp)
+	}
+
+	if user.ID == deleted.ID {
+		t.Error("The identity logs in the deleted user")
+	}
+
+	count := 0
+	db.Unscoped().Model(UserIdentity{}).Where("provider = ? AND subject = ?", "fake", identity.Subject).Count(&count)
+	if count != 1 {
+		t.Errorf("%d identities of the subject, want 1", count)
+	}
+}
+
+func TestUnlinkLastIdentity(t *testing.T) {
+	db := testDB(t)
+	defer db.Close()
+
+	user := createTestUser(t, db, "Password123!")
+	defer deleteTestUser(db, user)
+	defer db.Unscoped().Where("user_id = ?", user.ID).Delete(UserIdentity{})
+
+	// The account has been signed up through the provider
+	db.Model(user).Update("PasswordUnusable", true)
+
+	first := &UserIdentity{UserID: user.ID, Provider: "fake", Subject: uuid.NewV4().String(), Email: user.Email}
+	second := &UserIdentity{UserID: user.ID, Provider: "other", Subject: uuid.NewV4().String(), Email: user.Email}
+	db.Create(first)
+	db.Create(second)
+
+	tests := []struct {
+		name     string
+		identity *UserIdentity
+		prepare  func()
+		status   int
+	}{
+		{"another identity is left", first, func() {}, http.StatusOK},
+		{"last identity without the password", second, func() {}, http.StatusUnprocessableEntity},
+		{"last identity with the password", second, func() {
+			hash, _ := hashPassword("Password123!")
+			setPasswordHash(db, user.ID, hash, nil)
+		}, http.StatusOK},
+	}
+
+	for _, test := range tests {
+		test.prepare()
+
+		resp := user.UnlinkIdentity(test.identity.ID)
+		if resp["status"] != test.status {
+			t.Errorf("%s: UnlinkIdentity() status = %v, want %v", test.name, resp["status"], test.status)
+		}
+	}
+}
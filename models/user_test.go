@@ -0,0 +1,52 @@
+package models
+
+import (
+	"golang.org/x/crypto/bcrypt"
+	"net/http"
+	"testing"
+)
+
+func TestSendPasswordLink(t *testing.T) {
+	db := testDB(t)
+	defer db.Close()
+
+	user := createTestUser(t, db, "Password123!")
+	defer deleteTestUser(db, user)
+
+	tests := []struct {
+		name   string
+		status int
+	}{
+		{"first link", http.StatusOK},
+		{"link sent just now", http.StatusTooManyRequests},
+	}
+
+	for _, test := range tests {
+		resp := user.SendPasswordLink()
+		if resp["status"] != test.status {
+			t.Errorf("%s: SendPasswordLink() status = %v, want %v", test.name, resp["status"], test.status)
+		}
+	}
+
+	count := 0
+	db.Model(VerificationToken{}).Where("purpose = ? AND user_id = ?", PurposeResetPassword, user.ID).Count(&count)
+	if count != 1 {
+		t.Errorf("%d reset password tokens are created, want 1", count)
+	}
+}
+
+func TestUnusablePassword(t *testing.T) {
+	hashed, err := unusablePassword()
+	if err != nil {
+		t.Fatalf("unusablePassword() returned the error: %v", err)
+	}
+
+	other, _ := unusablePassword()
+	if hashed == "" || hashed == other {
+		t.Error("unusablePassword() does not hash a random password")
+	}
+
+	if cost, err := bcrypt.Cost([]byte(hashed)); err != nil || cost != passwordCost() {
+		t.Errorf("unusablePassword() = %q, want the bcrypt hash with the cost %d", hashed, passwordCost())
+	}
+}
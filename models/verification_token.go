@@ -0,0 +1,137 @@
+package models
+
+import (
+	"errors"
+	util "app/utils"
+	"github.com/jinzhu/gorm"
+	"github.com/satori/go.uuid"
+	"time"
+)
+
+// Purpose of the verification tokens
+const (
+	PurposeActivation    = "activation"
+	PurposeResetPassword = "reset_password"
+	PurposeEmailChange   = "email_change"
+	PurposeInvitation    = "invitation"
+	PurposeOAuthState    = "oauth_state"
+	PurposeSAMLRequest   = "saml_request"
+	PurposeSSOLogin      = "sso_login"
+	PurposeMagicLogin    = "magic_login"
+)
+
+// How long the token of each purpose is valid
+var verificationTokenLifetimes = map[string]time.Duration{
+	PurposeActivation:    time.Hour * 48,
+	PurposeResetPassword: time.Hour * 1,
+	PurposeEmailChange:   time.Hour * 24,
+	PurposeInvitation:    time.Hour * 24 * 7,
+	PurposeOAuthState:    time.Minute * 10,
+	PurposeSAMLRequest:   time.Minute * 10,
+	PurposeSSOLogin:      time.Minute * 2,
+	PurposeMagicLogin:    time.Minute * 15,
+}
+
+var ErrInvalidVerificationToken = errors.New("The link is invalid or has expired.")
+
+// Single-use token sent by email, only the hash of the token is stored
+type VerificationToken struct {
+	Base
+	UserID      *uuid.UUID `gorm:"type:uuid;index"`
+	ReferenceID *uuid.UUID `gorm:"type:uuid;index"` // ie. the invitation of the invitation token
+	Purpose     string     `gorm:"not null;index"`
+	TokenHash   string     `gorm:"not null;unique_index"`
+	Data        string     // Extra data of the purpose, ie. the new email address of the email change
+	ExpiresAt   time.Time  `gorm:"not null"`
+	ConsumedAt  *time.Time
+}
+
+// Create the token for the purpose and return the plain token, the previous tokens of the same purpose are invalidated
+func CreateVerificationToken(db *gorm.DB, purpose string, userId, referenceId *uuid.UUID, data string) (string, error) {
+	lifetime, ok := verificationTokenLifetimes[purpose]
+	if !ok {
+		return "", errors.New("The verification token purpose " + purpose + " is invalid.")
+	}
+
+	return createVerificationToken(db, purpose, userId, referenceId, data, time.Now().Add(lifetime))
+}
+
+// Create the token that expires at the given time instead of the lifetime of the purpose, ie. the invitation that expires with the invitation
+func createVerificationToken(db *gorm.DB, purpose string, userId, referenceId *uuid.UUID, data string, expiresAt time.Time) (string, error) {
+	// Only the latest token of the user or the reference is valid
+	query := db.Where("purpose = ?", purpose)
+	if referenceId != nil {
+		query = query.Where("reference_id = ?", *referenceId)
+	} else if userId != nil {
+		query = query.Where("user_id = ?", *userId)
+	}
+
+	if referenceId != nil || userId != nil {
+		if err := query.Delete(VerificationToken{}).Error; err != nil {
+			return "", err
+		}
+	}
+
+	return addVerificationToken(db, purpose, userId, referenceId, data, expiresAt)
+}
+
+// Create another token alongside the tokens already sent, ie. the reminder that must not void the link of the invitation
+func addVerificationToken(db *gorm.DB, purpose string, userId, referenceId *uuid.UUID, data string, expiresAt time.Time) (string, error) {
+	plainToken, err := util.GenerateRandomToken(32)
+	if err != nil {
+		return "", err
+	}
+
+	token := VerificationToken{
+		UserID:      userId,
+		ReferenceID: referenceId,
+		Purpose:     purpose,
+		TokenHash:   util.HashToken(plainToken),
+		Data:        data,
+		ExpiresAt:   expiresAt,
+	}
+
+	if err := db.Create(&token).Error; err != nil {
+		return "", err
+	}
+
+	return plainToken, nil
+}
+
+// Mark the token as used, the token can only be consumed once and before it expires
+func ConsumeVerificationToken(db *gorm.DB, purpose, plainToken string) (*VerificationToken, error) {
+	token := GetVerificationToken(db, purpose, plainToken)
+	if token == nil {
+		return nil, ErrInvalidVerificationToken
+	}
+
+	now := time.Now()
+	result := db.Model(VerificationToken{}).
+		Where("id = ? AND consumed_at IS NULL", token.ID).
+		Update("ConsumedAt", now)
+
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return nil, ErrInvalidVerificationToken
+	}
+
+	token.ConsumedAt = &now
+
+	return token, nil
+}
+
+// Get the valid token of the purpose without consuming it
+func GetVerificationToken(db *gorm.DB, purpose, plainToken string) *VerificationToken {
+	token := &VerificationToken{}
+	db.Where("purpose = ? AND token_hash = ? AND consumed_at IS NULL AND expires_at > ?", purpose, util.HashToken(plainToken), time.Now()).
+		First(token)
+
+	if token.ID == uuid.Nil {
+		return nil
+	}
+
+	return token
+}
@@ -0,0 +1,74 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestConsumeVerificationToken(t *testing.T) {
+	db := testDB(t)
+	defer db.Close()
+
+	user := createTestUser(t, db, "Password123!")
+	defer deleteTestUser(db, user)
+	defer db.Where("user_id = ?", user.ID).Delete(VerificationToken{})
+
+	valid, err := CreateVerificationToken(db, PurposeResetPassword, &user.ID, nil, "")
+	if err != nil {
+		t.Fatalf("Failed to create the token: %v", err)
+	}
+
+	expired, err := createVerificationToken(db, PurposeMagicLogin, &user.ID, nil, "", time.Now().Add(-time.Minute))
+	if err != nil {
+		t.Fatalf("Failed to create the token: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		purpose string
+		token   string
+		wantErr bool
+	}{
+		{"another purpose", PurposeActivation, valid, true},
+		{"valid token", PurposeResetPassword, valid, false},
+		{"consumed token", PurposeResetPassword, valid, true},
+		{"expired token", PurposeMagicLogin, expired, true},
+		{"unknown token", PurposeResetPassword, "unknown", true},
+	}
+
+	for _, test := range tests {
+		token, err := ConsumeVerificationToken(db, test.purpose, test.token)
+		if (err != nil) != test.wantErr {
+			t.Errorf("%s: ConsumeVerificationToken() error = %v, want error %v", test.name, err, test.wantErr)
+			continue
+		}
+
+		if err != nil && err != ErrInvalidVerificationToken {
+			t.Errorf("%s: ConsumeVerificationToken() error = %v, want %v", test.name, err, ErrInvalidVerificationToken)
+		}
+
+		if err == nil && (token.ConsumedAt == nil || token.UserID == nil || *token.UserID != user.ID) {
+			t.Errorf("%s: ConsumeVerificationToken() = %+v", test.name, token)
+		}
+	}
+}
+
+func TestCreateVerificationTokenReplacesPrevious(t *testing.T) {
+	db := testDB(t)
+	defer db.Close()
+
+	user := createTestUser(t, db, "Password123!")
+	defer deleteTestUser(db, user)
+	defer db.Where("user_id = ?", user.ID).Delete(VerificationToken{})
+
+	first, _ := CreateVerificationToken(db, PurposeActivation, &user.ID, nil, "")
+	second, _ := CreateVerificationToken(db, PurposeActivation, &user.ID, nil, "")
+
+	if GetVerificationToken(db, PurposeActivation, first) != nil {
+		t.Error("The previous token is still valid")
+	}
+
+	if GetVerificationToken(db, PurposeActivation, second) == nil {
+		t.Error("The latest token is not valid")
+	}
+}
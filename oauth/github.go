@@ -0,0 +1,76 @@
+package oauth
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+)
+
+// GitHub only supports OAuth2, the user and emails are retrieved from the API
+type githubProvider struct {
+	clientId     string
+	clientSecret string
+	authURL      string
+	tokenURL     string
+	apiURL       string
+}
+
+func (p *githubProvider) Name() string {
+	return "github"
+}
+
+func (p *githubProvider) AuthCodeURL(state, codeChallenge, redirectURI string) (string, error) {
+	values := url.Values{}
+	values.Set("client_id", p.clientId)
+	values.Set("redirect_uri", redirectURI)
+	values.Set("scope", "read:user user:email")
+	values.Set("state", state)
+	values.Set("code_challenge", codeChallenge)
+	values.Set("code_challenge_method", "S256")
+
+	return p.authURL + "?" + values.Encode(), nil
+}
+
+func (p *githubProvider) Exchange(code, codeVerifier, redirectURI string) (*Identity, error) {
+	accessToken, err := exchangeCode(p.tokenURL, p.clientId, p.clientSecret, code, codeVerifier, redirectURI)
+	if err != nil {
+		return nil, err
+	}
+
+	user := struct {
+		ID    int64  `json:"id"`
+		Login string `json:"login"`
+		Name  string `json:"name"`
+	}{}
+	if err := getWithToken(p.apiURL+"/user", accessToken, &user); err != nil {
+		return nil, err
+	}
+
+	if user.ID == 0 {
+		return nil, errors.New("The provider did not return the user.")
+	}
+
+	// Only the primary email that has been verified by GitHub is used
+	emails := []struct {
+		Email    string `json:"email"`
+		Primary  bool   `json:"primary"`
+		Verified bool   `json:"verified"`
+	}{}
+	if err := getWithToken(p.apiURL+"/user/emails", accessToken, &emails); err != nil {
+		return nil, err
+	}
+
+	identity := &Identity{Subject: fmt.Sprint(user.ID), Name: user.Name}
+	if identity.Name == "" {
+		identity.Name = user.Login
+	}
+
+	for _, email := range emails {
+		if email.Primary {
+			identity.Email = email.Email
+			identity.EmailVerified = email.Verified
+		}
+	}
+
+	return identity, nil
+}
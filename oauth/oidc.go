@@ -0,0 +1,125 @@
+package oauth
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// Provider that supports OpenID Connect discovery, ie. Google or any OIDC identity provider
+type oidcProvider struct {
+	name         string
+	issuer       string
+	clientId     string
+	clientSecret string
+
+	mutex    sync.Mutex
+	metadata *oidcMetadata
+}
+
+type oidcMetadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	UserinfoEndpoint      string `json:"userinfo_endpoint"`
+}
+
+var oidcProviders = map[string]*oidcProvider{}
+var oidcProvidersMutex sync.Mutex
+
+// Reuse the provider so that the discovery document is only fetched once
+func getOIDCProvider(name, issuer, clientId, clientSecret string) *oidcProvider {
+	oidcProvidersMutex.Lock()
+	defer oidcProvidersMutex.Unlock()
+
+	provider, ok := oidcProviders[name]
+	if !ok || provider.issuer != issuer || provider.clientId != clientId {
+		provider = &oidcProvider{name: name, issuer: issuer, clientId: clientId, clientSecret: clientSecret}
+		oidcProviders[name] = provider
+	}
+
+	return provider
+}
+
+func (p *oidcProvider) Name() string {
+	return p.name
+}
+
+func (p *oidcProvider) AuthCodeURL(state, codeChallenge, redirectURI string) (string, error) {
+	metadata, err := p.discover()
+	if err != nil {
+		return "", err
+	}
+
+	values := url.Values{}
+	values.Set("response_type", "code")
+	values.Set("client_id", p.clientId)
+	values.Set("redirect_uri", redirectURI)
+	values.Set("scope", "openid email profile")
+	values.Set("state", state)
+	values.Set("code_challenge", codeChallenge)
+	values.Set("code_challenge_method", "S256")
+
+	return metadata.AuthorizationEndpoint + "?" + values.Encode(), nil
+}
+
+func (p *oidcProvider) Exchange(code, codeVerifier, redirectURI string) (*Identity, error) {
+	metadata, err := p.discover()
+	if err != nil {
+		return nil, err
+	}
+
+	accessToken, err := exchangeCode(metadata.TokenEndpoint, p.clientId, p.clientSecret, code, codeVerifier, redirectURI)
+	if err != nil {
+		return nil, err
+	}
+
+	// The claims are retrieved from the userinfo endpoint over TLS instead of verifying the ID token
+	userinfo := struct {
+		Subject       string      `json:"sub"`
+		Email         string      `json:"email"`
+		EmailVerified interface{} `json:"email_verified"`
+		Name          string      `json:"name"`
+	}{}
+	if err := getWithToken(metadata.UserinfoEndpoint, accessToken, &userinfo); err != nil {
+		return nil, err
+	}
+
+	if userinfo.Subject == "" {
+		return nil, errors.New("The provider did not return the subject of the user.")
+	}
+
+	// Some providers return the flag as string
+	emailVerified := userinfo.EmailVerified == true || userinfo.EmailVerified == "true"
+
+	return &Identity{
+		Subject:       userinfo.Subject,
+		Email:         userinfo.Email,
+		EmailVerified: emailVerified,
+		Name:          userinfo.Name,
+	}, nil
+}
+
+// Fetch the OpenID configuration of the issuer
+func (p *oidcProvider) discover() (*oidcMetadata, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.metadata != nil {
+		return p.metadata, nil
+	}
+
+	metadata := &oidcMetadata{}
+	if err := getWithToken(strings.TrimRight(p.issuer, "/")+"/.well-known/openid-configuration", "", metadata); err != nil {
+		return nil, err
+	}
+
+	if metadata.AuthorizationEndpoint == "" || metadata.TokenEndpoint == "" || metadata.UserinfoEndpoint == "" {
+		return nil, errors.New("The OpenID configuration of the provider is incomplete.")
+	}
+
+	p.metadata = metadata
+
+	return metadata, nil
+}
@@ -0,0 +1,198 @@
+package oauth
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+const (
+	testClientId     = "client-id"
+	testClientSecret = "client-secret"
+	testCode         = "authorization-code"
+	testVerifier     = "code-verifier"
+	testAccessToken  = "access-token"
+	testRedirectURI  = "http://localhost:3000/oauth/oidc/callback"
+)
+
+// Mock OpenID Connect provider that issues the access token for the code and the verifier of the PKCE challenge
+func newMockOIDCServer(t *testing.T, userinfo map[string]interface{}, complete bool) *httptest.Server {
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		metadata := map[string]string{
+			"issuer":                 server.URL,
+			"authorization_endpoint": server.URL + "/authorize",
+			"token_endpoint":         server.URL + "/token",
+		}
+		if complete {
+			metadata["userinfo_endpoint"] = server.URL + "/userinfo"
+		}
+		json.NewEncoder(w).Encode(metadata)
+	})
+
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if r.Form.Get("grant_type") != "authorization_code" || r.Form.Get("code") != testCode ||
+			r.Form.Get("client_id") != testClientId || r.Form.Get("client_secret") != testClientSecret ||
+			r.Form.Get("redirect_uri") != testRedirectURI ||
+			CodeChallenge(r.Form.Get("code_verifier")) != CodeChallenge(testVerifier) {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"access_token": testAccessToken, "token_type": "Bearer"})
+	})
+
+	mux.HandleFunc("/userinfo", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+testAccessToken {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(userinfo)
+	})
+
+	return server
+}
+
+func TestOIDCAuthCodeURL(t *testing.T) {
+	server := newMockOIDCServer(t, nil, true)
+	defer server.Close()
+
+	provider := &oidcProvider{name: "oidc", issuer: server.URL, clientId: testClientId, clientSecret: testClientSecret}
+	authURL, err := provider.AuthCodeURL("state-value", CodeChallenge(testVerifier), testRedirectURI)
+	if err != nil {
+		t.Fatalf("AuthCodeURL() returned the error: %v", err)
+	}
+
+	if !strings.HasPrefix(authURL, server.URL+"/authorize?") {
+		t.Fatalf("AuthCodeURL() = %q, want the authorization endpoint of the provider", authURL)
+	}
+
+	parsed, _ := url.Parse(authURL)
+	query := parsed.Query()
+	tests := []struct {
+		param string
+		want  string
+	}{
+		{"response_type", "code"},
+		{"client_id", testClientId},
+		{"redirect_uri", testRedirectURI},
+		{"state", "state-value"},
+		{"code_challenge", CodeChallenge(testVerifier)},
+		{"code_challenge_method", "S256"},
+		{"scope", "openid email profile"},
+	}
+
+	for _, test := range tests {
+		if got := query.Get(test.param); got != test.want {
+			t.Errorf("The parameter %s = %q, want %q", test.param, got, test.want)
+		}
+	}
+}
+
+func TestOIDCExchange(t *testing.T) {
+	tests := []struct {
+		name     string
+		userinfo map[string]interface{}
+		code     string
+		verifier string
+		want     *Identity
+		wantErr  bool
+	}{
+		{
+			name:     "verified email",
+			userinfo: map[string]interface{}{"sub": "123", "email": "user@example.com", "email_verified": true, "name": "User"},
+			code:     testCode,
+			verifier: testVerifier,
+			want:     &Identity{Subject: "123", Email: "user@example.com", EmailVerified: true, Name: "User"},
+		},
+		{
+			name:     "verified email as string",
+			userinfo: map[string]interface{}{"sub": "123", "email": "user@example.com", "email_verified": "true"},
+			code:     testCode,
+			verifier: testVerifier,
+			want:     &Identity{Subject: "123", Email: "user@example.com", EmailVerified: true},
+		},
+		{
+			name:     "unverified email",
+			userinfo: map[string]interface{}{"sub": "123", "email": "user@example.com", "email_verified": false},
+			code:     testCode,
+			verifier: testVerifier,
+			want:     &Identity{Subject: "123", Email: "user@example.com"},
+		},
+		{
+			name:     "missing subject",
+			userinfo: map[string]interface{}{"email": "user@example.com", "email_verified": true},
+			code:     testCode,
+			verifier: testVerifier,
+			wantErr:  true,
+		},
+		{
+			name:     "wrong code verifier",
+			userinfo: map[string]interface{}{"sub": "123"},
+			code:     testCode,
+			verifier: "another-verifier",
+			wantErr:  true,
+		},
+		{
+			name:     "wrong code",
+			userinfo: map[string]interface{}{"sub": "123"},
+			code:     "another-code",
+			verifier: testVerifier,
+			wantErr:  true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := newMockOIDCServer(t, test.userinfo, true)
+			defer server.Close()
+
+			provider := &oidcProvider{name: "oidc", issuer: server.URL, clientId: testClientId, clientSecret: testClientSecret}
+			identity, err := provider.Exchange(test.code, test.verifier, testRedirectURI)
+
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("Exchange() = %+v, want an error", identity)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Exchange() returned the error: %v", err)
+			}
+
+			if *identity != *test.want {
+				t.Errorf("Exchange() = %+v, want %+v", identity, test.want)
+			}
+		})
+	}
+}
+
+func TestOIDCIncompleteDiscovery(t *testing.T) {
+	server := newMockOIDCServer(t, nil, false)
+	defer server.Close()
+
+	provider := &oidcProvider{name: "oidc", issuer: server.URL, clientId: testClientId, clientSecret: testClientSecret}
+	if _, err := provider.AuthCodeURL("state-value", CodeChallenge(testVerifier), testRedirectURI); err == nil {
+		t.Error("AuthCodeURL() succeeded with the configuration without the userinfo endpoint")
+	}
+}
+
+func TestCodeChallenge(t *testing.T) {
+	challenge := CodeChallenge(testVerifier)
+
+	// The SHA-256 hash encoded as unpadded base64url
+	if len(challenge) != 43 || strings.ContainsAny(challenge, "+/=") {
+		t.Errorf("CodeChallenge() = %q, want the unpadded base64url encoding of the hash", challenge)
+	}
+
+	if challenge != CodeChallenge(testVerifier) || challenge == CodeChallenge("another-verifier") {
+		t.Error("CodeChallenge() is not derived from the code verifier only")
+	}
+}
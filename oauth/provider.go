@@ -0,0 +1,151 @@
+package oauth
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// The account of the user at the provider
+type Identity struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+// Provider of the social login through the OAuth2 authorization code flow
+type Provider interface {
+	Name() string
+	AuthCodeURL(state, codeChallenge, redirectURI string) (string, error)
+	Exchange(code, codeVerifier, redirectURI string) (*Identity, error)
+}
+
+var httpClient = &http.Client{Timeout: time.Second * 10}
+
+// Get the provider configured in the environment, ie. oauth_google_client_id
+func GetProvider(name string) (Provider, bool) {
+	clientId := os.Getenv("oauth_" + name + "_client_id")
+	clientSecret := os.Getenv("oauth_" + name + "_client_secret")
+	if clientId == "" {
+		return nil, false
+	}
+
+	switch name {
+	case "google":
+		return getOIDCProvider(name, "https://accounts.google.com", clientId, clientSecret), true
+	case "github":
+		return &githubProvider{
+			clientId:     clientId,
+			clientSecret: clientSecret,
+			authURL:      envOrDefault("oauth_github_auth_url", "https://github.com/login/oauth/authorize"),
+			tokenURL:     envOrDefault("oauth_github_token_url", "https://github.com/login/oauth/access_token"),
+			apiURL:       envOrDefault("oauth_github_api_url", "https://api.github.com"),
+		}, true
+	case "oidc":
+		issuer := os.Getenv("oauth_oidc_issuer")
+		if issuer == "" {
+			return nil, false
+		}
+		return getOIDCProvider(name, issuer, clientId, clientSecret), true
+	}
+
+	return nil, false
+}
+
+// The URL of the frontend page that receives the code from the provider
+func RedirectURI(name string) string {
+	baseURL := os.Getenv("frontend_url")
+	if baseURL == "" {
+		baseURL = "http://localhost:3000"
+	}
+
+	return strings.TrimRight(baseURL, "/") + "/oauth/" + name + "/callback"
+}
+
+// Derive the PKCE code challenge from the code verifier
+func CodeChallenge(codeVerifier string) string {
+	hash := sha256.Sum256([]byte(codeVerifier))
+	return base64.RawURLEncoding.EncodeToString(hash[:])
+}
+
+func envOrDefault(key, value string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+
+	return value
+}
+
+// Exchange the authorization code for the access token at the token endpoint
+func exchangeCode(tokenURL, clientId, clientSecret, code, codeVerifier, redirectURI string) (string, error) {
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", redirectURI)
+	form.Set("client_id", clientId)
+	form.Set("client_secret", clientSecret)
+	form.Set("code_verifier", codeVerifier)
+
+	req, err := http.NewRequest("POST", tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	token := struct {
+		AccessToken string `json:"access_token"`
+		Error       string `json:"error"`
+	}{}
+	if err := doJSON(req, &token); err != nil {
+		return "", err
+	}
+
+	if token.AccessToken == "" {
+		return "", errors.New("The provider did not return an access token: " + token.Error)
+	}
+
+	return token.AccessToken, nil
+}
+
+// Get the resource with the access token
+func getWithToken(resourceURL, accessToken string, result interface{}) error {
+	req, err := http.NewRequest("GET", resourceURL, nil)
+	if err != nil {
+		return err
+	}
+	if accessToken != "" {
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+	}
+	req.Header.Set("Accept", "application/json")
+
+	return doJSON(req, result)
+}
+
+func doJSON(req *http.Request, result interface{}) error {
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("The provider responded with status %d.", res.StatusCode)
+	}
+
+	return json.Unmarshal(body, result)
+}
@@ -0,0 +1,66 @@
+package password
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"log"
+	"os"
+	"strings"
+	"sync"
+)
+
+var (
+	breached     map[string]struct{}
+	breachedOnce sync.Once
+)
+
+// Check if the password is in the list of breached passwords
+func IsBreached(password string) bool {
+	breachedOnce.Do(loadBreached)
+
+	if len(breached) == 0 {
+		return false
+	}
+
+	sum := sha1.Sum([]byte(password))
+	_, ok := breached[strings.ToUpper(hex.EncodeToString(sum[:]))]
+
+	return ok
+}
+
+// Load the SHA-1 hashes of the breached passwords from the file configured in the environment,
+// one hash per line with an optional count, ie. the "HASH:COUNT" format of Have I Been Pwned
+func loadBreached() {
+	breached = map[string]struct{}{}
+
+	path := os.Getenv("password_breached_file")
+	if path == "" {
+		return
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		log.Println("Failed to open the breached password file:", err)
+		return
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if i := strings.IndexByte(line, ':'); i >= 0 {
+			line = line[:i]
+		}
+
+		if len(line) == sha1.Size*2 {
+			breached[strings.ToUpper(line)] = struct{}{}
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		log.Println("Failed to read the breached password file:", err)
+	}
+
+	log.Println("Loaded", len(breached), "breached password hashes.")
+}
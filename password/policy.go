@@ -0,0 +1,169 @@
+package password
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"gopkg.in/go-playground/validator.v9"
+)
+
+// Tag of the validation that checks the password against the policy of the deployment
+const ValidationTag = "password"
+
+// bcrypt ignores the bytes after the first 72, so the longer passwords are rejected whatever the policy is
+const MaxBytes = 72
+
+// Requirements of the password, the zero value does not require anything
+type Policy struct {
+	MinLength        int  `json:"minLength"`
+	MaxLength        int  `json:"maxLength"`
+	RequireUpper     bool `json:"requireUpper"`
+	RequireLower     bool `json:"requireLower"`
+	RequireDigit     bool `json:"requireDigit"`
+	RequireSymbol    bool `json:"requireSymbol"`
+	DisallowPersonal bool `json:"disallowPersonal"` // The password cannot contain the email address or the name of the user
+	History          int  `json:"history"`          // Number of the last passwords that cannot be reused
+}
+
+// Get the policy of the deployment configured in the environment
+func Default() Policy {
+	return Policy{
+		MinLength:        envInt("password_min_length", 8),
+		MaxLength:        envInt("password_max_length", 72),
+		RequireUpper:     envBool("password_require_upper", false),
+		RequireLower:     envBool("password_require_lower", false),
+		RequireDigit:     envBool("password_require_digit", false),
+		RequireSymbol:    envBool("password_require_symbol", false),
+		DisallowPersonal: envBool("password_disallow_personal", true),
+		History:          envInt("password_history", 0),
+	}
+}
+
+// Combine the policies by taking the stricter requirement of each
+func (policy Policy) Merge(other Policy) Policy {
+	if other.MinLength > policy.MinLength {
+		policy.MinLength = other.MinLength
+	}
+
+	if other.MaxLength > 0 && (policy.MaxLength == 0 || other.MaxLength < policy.MaxLength) {
+		policy.MaxLength = other.MaxLength
+	}
+
+	if other.History > policy.History {
+		policy.History = other.History
+	}
+
+	policy.RequireUpper = policy.RequireUpper || other.RequireUpper
+	policy.RequireLower = policy.RequireLower || other.RequireLower
+	policy.RequireDigit = policy.RequireDigit || other.RequireDigit
+	policy.RequireSymbol = policy.RequireSymbol || other.RequireSymbol
+	policy.DisallowPersonal = policy.DisallowPersonal || other.DisallowPersonal
+
+	return policy
+}
+
+// Check the password against the policy and return the unmet requirements, ie. "must contain a digit."
+// The personal details are the email address and the name of the user
+func (policy Policy) Validate(password string, personal ...string) []string {
+	var violations []string
+
+	length := utf8.RuneCountInString(password)
+	if length < policy.MinLength {
+		violations = append(violations, "must be more than or equal to "+strconv.Itoa(policy.MinLength)+" character(s).")
+	}
+
+	if policy.MaxLength > 0 && length > policy.MaxLength {
+		violations = append(violations, "must be lesser than or equal to "+strconv.Itoa(policy.MaxLength)+" character(s).")
+	} else if len(password) > MaxBytes {
+		violations = append(violations, "must be lesser than or equal to "+strconv.Itoa(MaxBytes)+" bytes, the accented letters and symbols take more than one byte.")
+	}
+
+	var upper, lower, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		case !unicode.IsSpace(r):
+			symbol = true
+		}
+	}
+
+	if policy.RequireUpper && !upper {
+		violations = append(violations, "must contain an uppercase letter.")
+	}
+
+	if policy.RequireLower && !lower {
+		violations = append(violations, "must contain a lowercase letter.")
+	}
+
+	if policy.RequireDigit && !digit {
+		violations = append(violations, "must contain a digit.")
+	}
+
+	if policy.RequireSymbol && !symbol {
+		violations = append(violations, "must contain a symbol.")
+	}
+
+	if policy.DisallowPersonal && containsPersonal(password, personal) {
+		violations = append(violations, "must not contain your email address or name.")
+	}
+
+	if IsBreached(password) {
+		violations = append(violations, "has appeared in a data breach. Please choose another one.")
+	}
+
+	return violations
+}
+
+// Register the validation of the deployment policy to the validator, ie. `validate:"required,password"`
+func RegisterValidation(validate *validator.Validate) {
+	validate.RegisterValidation(ValidationTag, func(fl validator.FieldLevel) bool {
+		return len(Default().Validate(fl.Field().String())) == 0
+	})
+}
+
+// Check if the password contains the email address or any part of the name
+func containsPersonal(password string, personal []string) bool {
+	password = strings.ToLower(password)
+
+	for _, value := range personal {
+		value = strings.ToLower(value)
+		if at := strings.Index(value, "@"); at >= 0 {
+			value = value[:at]
+		}
+
+		for _, part := range strings.FieldsFunc(value, func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		}) {
+			// Ignore the short parts, ie. initials
+			if len(part) >= 3 && strings.Contains(password, part) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func envInt(key string, fallback int) int {
+	if value, err := strconv.Atoi(os.Getenv(key)); err == nil {
+		return value
+	}
+
+	return fallback
+}
+
+func envBool(key string, fallback bool) bool {
+	if value, err := strconv.ParseBool(os.Getenv(key)); err == nil {
+		return value
+	}
+
+	return fallback
+}
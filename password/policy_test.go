@@ -0,0 +1,68 @@
+package password
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	policy := Policy{MinLength: 8, MaxLength: 72}
+
+	tests := []struct {
+		name       string
+		policy     Policy
+		password   string
+		violations int
+	}{
+		{"valid", policy, "correct horse", 0},
+		{"too short", policy, "short", 1},
+		{"72 ASCII characters", policy, strings.Repeat("a", 72), 0},
+		{"73 ASCII characters", policy, strings.Repeat("a", 73), 1},
+		{"72 characters of 2 bytes", policy, strings.Repeat("é", 72), 1},
+		{"36 characters of 2 bytes", policy, strings.Repeat("é", 36), 0},
+		{"over 72 bytes without the maximum length", Policy{}, strings.Repeat("é", 37), 1},
+		{"missing requirements", Policy{RequireUpper: true, RequireDigit: true, RequireSymbol: true}, "password", 3},
+		{"met requirements", Policy{RequireUpper: true, RequireLower: true, RequireDigit: true, RequireSymbol: true}, "Passw0rd!", 0},
+	}
+
+	for _, test := range tests {
+		if got := test.policy.Validate(test.password); len(got) != test.violations {
+			t.Errorf("%s: Validate() = %v, want %d violation(s)", test.name, got, test.violations)
+		}
+	}
+}
+
+func TestValidatePersonal(t *testing.T) {
+	policy := Policy{DisallowPersonal: true}
+
+	tests := []struct {
+		password string
+		want     bool
+	}{
+		{"johnny-password", true},
+		{"smith2019", true},
+		{"unrelated", false},
+	}
+
+	for _, test := range tests {
+		violations := policy.Validate(test.password, "johnny@example.com", "J Smith")
+		if got := len(violations) > 0; got != test.want {
+			t.Errorf("Validate(%q) contains the personal details = %v, want %v", test.password, got, test.want)
+		}
+	}
+}
+
+func TestMerge(t *testing.T) {
+	base := Policy{MinLength: 8, MaxLength: 72, History: 2}
+	other := Policy{MinLength: 12, MaxLength: 64, RequireDigit: true, History: 1}
+
+	want := Policy{MinLength: 12, MaxLength: 64, RequireDigit: true, History: 2}
+	if got := base.Merge(other); got != want {
+		t.Errorf("Merge() = %+v, want %+v", got, want)
+	}
+
+	// The zero maximum length of the other policy does not lift the limit
+	if got := base.Merge(Policy{}); got.MaxLength != 72 {
+		t.Errorf("Merge() MaxLength = %d, want 72", got.MaxLength)
+	}
+}
@@ -5,14 +5,21 @@ import (
 	"github.com/satori/go.uuid"
 )
 
-func IsAdmin(userId, companyId uuid.UUID) bool {
-	// Check if user is admin in the company
+// Check if the user is the owner of the company
+func IsOwner(userId, companyId uuid.UUID) bool {
+	company := models.GetCompany(companyId, userId)
+
+	return company != nil && company.IsOwner(userId)
+}
+
+// Check if the user has the permission in the company, the admin has all the permissions
+func HasPermission(userId, companyId uuid.UUID, permission string) bool {
 	user := models.GetUser(userId)
 	comp := models.GetCompanyByID(companyId)
 
 	if user == nil || comp == nil {
 		return false
 	}
-	
-	return user.IsAdmin(comp)
-}
\ No newline at end of file
+
+	return user.HasPermission(comp, permission)
+}
@@ -15,22 +15,119 @@ func ShowCompany(userId, companyId uuid.UUID) bool {
 
 // Check if the user can update the company
 func UpdateCompany(userId, companyId uuid.UUID) bool {
-	// Check if user is admin in the company
-	return IsAdmin(userId, companyId)
+	return HasPermission(userId, companyId, models.PermissionCompanyUpdate)
+}
+
+// Check if the user can delete the company, only the owner can
+func DeleteCompany(userId, companyId uuid.UUID) bool {
+	return IsOwner(userId, companyId)
 }
 
 // Check if the user can view all the users in the company
 func ViewCompanyUsers(userId, companyId uuid.UUID) bool {
+	return HasPermission(userId, companyId, models.PermissionMembersView)
+}
+
+// Check if the user can visit the company
+func VisitCompany(userId, companyId uuid.UUID) bool {
 	// Check if the user belongs to the company
 	company := models.GetCompany(companyId, userId)
 
 	return company != nil
 }
 
-// Check if the user can visit the company
-func VisitCompany(userId, companyId uuid.UUID) bool {
+// Check if the user can see the outgoing emails of the company
+func ShowCompanyEmails(userId, companyId uuid.UUID) bool {
+	return HasPermission(userId, companyId, models.PermissionEmailsView)
+}
+
+// Check if the user can unlock the account of the member of the company
+func UnlockCompanyUser(userId, companyId, targetUserId uuid.UUID) bool {
+	// Check if the target user belongs to the company
+	return HasPermission(userId, companyId, models.PermissionMembersManage) && models.GetCompany(companyId, targetUserId) != nil
+}
+
+// Check if the user can require the members of the company to enable two-factor authentication
+func RequireCompanyTwoFactor(userId, companyId uuid.UUID) bool {
+	return HasPermission(userId, companyId, models.PermissionCompanySecurity)
+}
+
+// Check if the user can manage the single sign-on settings of the company
+func ManageCompanySSO(userId, companyId uuid.UUID) bool {
+	return HasPermission(userId, companyId, models.PermissionCompanySecurity)
+}
+
+// Check if the user can manage the email domains that the users join the company with
+func ManageCompanyDomains(userId, companyId uuid.UUID) bool {
+	return HasPermission(userId, companyId, models.PermissionCompanySecurity)
+}
+
+// Check if the user can manage the API keys of the company
+func ManageCompanyAPIKeys(userId, companyId uuid.UUID) bool {
+	return HasPermission(userId, companyId, models.PermissionAPIKeysManage)
+}
+
+// Check if the user can manage the password policy of the company
+func ManageCompanyPasswordPolicy(userId, companyId uuid.UUID) bool {
+	return HasPermission(userId, companyId, models.PermissionCompanySecurity)
+}
+
+// Check if the user can see the roles of the company
+func ViewCompanyRoles(userId, companyId uuid.UUID) bool {
+	return HasPermission(userId, companyId, models.PermissionRolesManage) || HasPermission(userId, companyId, models.PermissionMembersManage)
+}
+
+// Check if the user can create/edit/delete the roles of the company
+func ManageCompanyRoles(userId, companyId uuid.UUID) bool {
+	return HasPermission(userId, companyId, models.PermissionRolesManage)
+}
+
+// Check if the user can change the role of the member of the company
+func ChangeCompanyUserRole(userId, companyId, targetUserId uuid.UUID) bool {
+	// Check if the target user belongs to the company
+	return HasPermission(userId, companyId, models.PermissionMembersManage) && models.GetCompany(companyId, targetUserId) != nil
+}
+
+// Check if the user can remove the member from the company
+func RemoveCompanyUser(userId, companyId, targetUserId uuid.UUID) bool {
+	// Check if the target user belongs to the company
+	return HasPermission(userId, companyId, models.PermissionMembersManage) && models.GetCompany(companyId, targetUserId) != nil
+}
+
+// Check if the user can leave the company
+func LeaveCompany(userId, companyId uuid.UUID) bool {
 	// Check if the user belongs to the company
 	company := models.GetCompany(companyId, userId)
 
 	return company != nil
 }
+
+// Check if the user can hand over the company to another member
+func TransferCompanyOwnership(userId, companyId uuid.UUID) bool {
+	return IsOwner(userId, companyId)
+}
+
+// Check if the user can see or respond to the ownership transfer of the company, as the owner or the nominated member
+func RespondCompanyOwnershipTransfer(userId, companyId uuid.UUID) bool {
+	// Check if the user belongs to the company
+	company := models.GetCompany(companyId, userId)
+
+	return company != nil
+}
+
+// Check if the user can restore the deleted company, as the owner or an admin of the company
+func RestoreCompany(userId, companyId uuid.UUID) bool {
+	company := models.GetDeletedCompany(companyId, userId)
+
+	return company != nil
+}
+
+// Check if the user can see the teams of the company
+func ViewCompanyTeams(userId, companyId uuid.UUID) bool {
+	return HasPermission(userId, companyId, models.PermissionMembersView)
+}
+
+// Check if the user can create/edit/delete the teams of the company and their members
+func ManageCompanyTeams(userId, companyId uuid.UUID) bool {
+	return HasPermission(userId, companyId, models.PermissionTeamsManage)
+}
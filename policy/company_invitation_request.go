@@ -3,18 +3,57 @@ package policy
 import (
 	"github.com/satori/go.uuid"
 	"app/models"
+	"time"
 )
 
-// Check if the user can create/edit/delete the company invitation request
-func CreateUpdateDeleteCompanyInvitation(userId, companyId uuid.UUID) bool {
-	// Check if user is admin in the company
-	return IsAdmin(userId, companyId)
+// Check if the user can invite people to the company
+func CreateCompanyInvitation(userId, companyId uuid.UUID) bool {
+	return HasPermission(userId, companyId, models.PermissionInvitationCreate)
+}
+
+// Check if the user can resend the company invitation request
+func ResendCompanyInvitation(userId, companyId uuid.UUID) bool {
+	return HasPermission(userId, companyId, models.PermissionInvitationCreate)
+}
+
+// Check if the user can revoke the company invitation request
+func RevokeCompanyInvitation(userId, companyId uuid.UUID) bool {
+	return HasPermission(userId, companyId, models.PermissionInvitationDelete)
+}
+
+// Check if the user can delete the company invitation request
+func DeleteCompanyInvitation(userId, companyId uuid.UUID) bool {
+	return HasPermission(userId, companyId, models.PermissionInvitationDelete)
 }
 
 // Check if the user can see the list of company invitation requests
 func ShowCompanyInvitation(userId, companyId uuid.UUID) bool {
-	// Check if user is admin in the company
-	return IsAdmin(userId, companyId)
+	return HasPermission(userId, companyId, models.PermissionInvitationView)
+}
+
+// Check if the user can see the join links of the company
+func ViewCompanyJoinLinks(userId, companyId uuid.UUID) bool {
+	return HasPermission(userId, companyId, models.PermissionInvitationView)
+}
+
+// Check if the user can create the join link of the company
+func CreateCompanyJoinLink(userId, companyId uuid.UUID) bool {
+	return HasPermission(userId, companyId, models.PermissionInvitationCreate)
+}
+
+// Check if the user can revoke the join link of the company
+func RevokeCompanyJoinLink(userId, companyId uuid.UUID) bool {
+	return HasPermission(userId, companyId, models.PermissionInvitationDelete)
+}
+
+// Check if the user can see the requests to join the company
+func ViewCompanyJoinRequests(userId, companyId uuid.UUID) bool {
+	return HasPermission(userId, companyId, models.PermissionInvitationView)
+}
+
+// Check if the user can approve or decline the requests to join the company
+func RespondCompanyJoinRequest(userId, companyId uuid.UUID) bool {
+	return HasPermission(userId, companyId, models.PermissionInvitationCreate)
 }
 
 // Check if the user can view the invitation from company
@@ -43,7 +82,7 @@ func RespondCompanyInvitation(invitationId, userId uuid.UUID) bool {
 	db.Table("company_invitation_requests").
 	Select("company_invitation_requests.*").
 	Joins("left join users on users.email = company_invitation_requests.email").
-	Where("company_invitation_requests.id = ? AND company_invitation_requests.status = 0 AND users.id = ?", invitationId, userId).
+	Where("company_invitation_requests.id = ? AND company_invitation_requests.status = 0 AND company_invitation_requests.expires_at > ? AND users.id = ?", invitationId, time.Now(), userId).
 	Scan(&invitation)
 
 	return invitation.ID != uuid.Nil
@@ -11,4 +11,17 @@ func ShowUserProfile(userId uuid.UUID) bool {
 	user := models.GetUser(userId)
 
 	return user != nil
-}
\ No newline at end of file
+}
+
+// Check if the user can impersonate the target user
+func Impersonate(userId, targetUserId uuid.UUID) bool {
+	// Only the superuser can impersonate, and never another superuser
+	user := models.GetUser(userId)
+	target := models.GetUser(targetUserId)
+
+	if user == nil || target == nil || user.ID == target.ID {
+		return false
+	}
+
+	return user.IsSuperuser && !target.IsSuperuser
+}
@@ -0,0 +1,63 @@
+package saml
+
+import (
+	"encoding/xml"
+	"errors"
+	"strings"
+)
+
+// The settings of the IdP from its metadata
+type IdPMetadata struct {
+	EntityID    string
+	SSOURL      string
+	Certificate string
+}
+
+type keyDescriptor struct {
+	Use         string `xml:"use,attr"`
+	Certificate string `xml:"KeyInfo>X509Data>X509Certificate"`
+}
+
+type endpoint struct {
+	Binding  string `xml:"Binding,attr"`
+	Location string `xml:"Location,attr"`
+}
+
+type idpSSODescriptor struct {
+	KeyDescriptors       []keyDescriptor `xml:"KeyDescriptor"`
+	SingleSignOnServices []endpoint      `xml:"SingleSignOnService"`
+}
+
+type entityDescriptor struct {
+	EntityID          string             `xml:"entityID,attr"`
+	IDPSSODescriptors []idpSSODescriptor `xml:"IDPSSODescriptor"`
+}
+
+// Get the entity ID, the redirect SSO URL and the signing certificate from the metadata of the IdP
+func ParseMetadata(data []byte) (*IdPMetadata, error) {
+	descriptor := entityDescriptor{}
+	if err := xml.Unmarshal(data, &descriptor); err != nil {
+		return nil, errors.New("The metadata is not a valid XML document.")
+	}
+
+	metadata := &IdPMetadata{EntityID: descriptor.EntityID}
+	for _, idp := range descriptor.IDPSSODescriptors {
+		for _, service := range idp.SingleSignOnServices {
+			if service.Binding == redirectBinding && metadata.SSOURL == "" {
+				metadata.SSOURL = service.Location
+			}
+		}
+
+		for _, key := range idp.KeyDescriptors {
+			if (key.Use == "" || key.Use == "signing") && metadata.Certificate == "" {
+				metadata.Certificate = strings.TrimSpace(key.Certificate)
+			}
+		}
+	}
+
+	if metadata.EntityID == "" || metadata.SSOURL == "" || metadata.Certificate == "" {
+		return nil, errors.New("The metadata must contain the entity ID, the HTTP-Redirect single sign-on service and the signing certificate of the IdP.")
+	}
+
+	return metadata, nil
+}
@@ -0,0 +1,86 @@
+package saml
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"net/url"
+	"strings"
+	"time"
+)
+
+type authnRequest struct {
+	XMLName                     xml.Name `xml:"samlp:AuthnRequest"`
+	ProtocolNamespace           string   `xml:"xmlns:samlp,attr"`
+	AssertionNamespace          string   `xml:"xmlns:saml,attr"`
+	ID                          string   `xml:"ID,attr"`
+	Version                     string   `xml:"Version,attr"`
+	IssueInstant                string   `xml:"IssueInstant,attr"`
+	Destination                 string   `xml:"Destination,attr"`
+	ProtocolBinding             string   `xml:"ProtocolBinding,attr"`
+	AssertionConsumerServiceURL string   `xml:"AssertionConsumerServiceURL,attr"`
+	Issuer                      string   `xml:"saml:Issuer"`
+	NameIDPolicy                struct {
+		Format      string `xml:"Format,attr"`
+		AllowCreate bool   `xml:"AllowCreate,attr"`
+	} `xml:"samlp:NameIDPolicy"`
+}
+
+// Generate the ID of the request, which is returned by the IdP in the response
+func NewRequestID() (string, error) {
+	b := make([]byte, 20)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	// The ID must not start with a digit
+	return "_" + hex.EncodeToString(b), nil
+}
+
+// Build the URL of the IdP to redirect the user to with the HTTP-Redirect binding
+func AuthnRequestURL(ssoURL, requestId, relayState string) (string, error) {
+	request := authnRequest{
+		ProtocolNamespace:           protocolNamespace,
+		AssertionNamespace:          assertionNamespace,
+		ID:                          requestId,
+		Version:                     "2.0",
+		IssueInstant:                time.Now().UTC().Format(time.RFC3339),
+		Destination:                 ssoURL,
+		ProtocolBinding:             postBinding,
+		AssertionConsumerServiceURL: ACSURL(),
+		Issuer:                      EntityID(),
+	}
+	request.NameIDPolicy.Format = emailNameIDFormat
+	request.NameIDPolicy.AllowCreate = true
+
+	data, err := xml.Marshal(request)
+	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	writer, err := flate.NewWriter(&buf, flate.DefaultCompression)
+	if err != nil {
+		return "", err
+	}
+	if _, err := writer.Write(data); err != nil {
+		return "", err
+	}
+	if err := writer.Close(); err != nil {
+		return "", err
+	}
+
+	query := url.Values{}
+	query.Set("SAMLRequest", base64.StdEncoding.EncodeToString(buf.Bytes()))
+	query.Set("RelayState", relayState)
+
+	separator := "?"
+	if strings.Contains(ssoURL, "?") {
+		separator = "&"
+	}
+
+	return ssoURL + separator + query.Encode(), nil
+}
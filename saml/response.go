@@ -0,0 +1,291 @@
+package saml
+
+import (
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/beevik/etree"
+	dsig "github.com/russellhaering/goxmldsig"
+	"github.com/russellhaering/goxmldsig/etreeutils"
+)
+
+// Allowed difference between the clocks of the IdP and the app
+const clockSkew = time.Minute * 3
+
+// Attributes that may carry the email address of the user
+var emailAttributes = []string{
+	"email",
+	"mail",
+	"emailaddress",
+	"http://schemas.xmlsoap.org/ws/2005/05/identity/claims/emailaddress",
+	"urn:oid:0.9.2342.19200300.100.1.3",
+}
+
+// Attributes that may carry the name of the user
+var nameAttributes = []string{
+	"name",
+	"displayname",
+	"http://schemas.xmlsoap.org/ws/2005/05/identity/claims/name",
+	"urn:oid:2.16.840.1.113730.3.1.241",
+}
+
+// The user authenticated by the IdP
+type Assertion struct {
+	NameID     string
+	Email      string
+	Name       string
+	Attributes map[string][]string
+}
+
+// The expected values of the response
+type ResponseOptions struct {
+	IdPEntityID string
+	Certificate *x509.Certificate
+	RequestID   string
+	Now         time.Time
+}
+
+var ErrInvalidResponse = errors.New("The response from the identity provider is invalid.")
+
+// Decode the response posted by the IdP, verify the signature and the conditions, and return the assertion
+func ParseResponse(encoded string, opts ResponseOptions) (*Assertion, error) {
+	data, err := base64.StdEncoding.DecodeString(whiteSpace.ReplaceAllString(encoded, ""))
+	if err != nil {
+		return nil, ErrInvalidResponse
+	}
+
+	doc := etree.NewDocument()
+	if err := doc.ReadFromBytes(data); err != nil {
+		return nil, ErrInvalidResponse
+	}
+
+	response := doc.Root()
+	if response == nil || !isElement(response, protocolNamespace, "Response") {
+		return nil, ErrInvalidResponse
+	}
+
+	if destination := response.SelectAttrValue("Destination", ""); destination != "" && destination != ACSURL() {
+		return nil, errors.New("The response is not intended for this application.")
+	}
+
+	if response.SelectAttrValue("InResponseTo", "") != opts.RequestID {
+		return nil, errors.New("The response does not match the login request.")
+	}
+
+	if issuer := childElement(response, assertionNamespace, "Issuer"); issuer != nil && strings.TrimSpace(issuer.Text()) != opts.IdPEntityID {
+		return nil, errors.New("The response is not issued by the identity provider of the company.")
+	}
+
+	status := childElement(response, protocolNamespace, "Status")
+	statusCode := childElement(status, protocolNamespace, "StatusCode")
+	if statusCode == nil || statusCode.SelectAttrValue("Value", "") != statusSuccess {
+		return nil, errors.New("The login has been rejected by the identity provider.")
+	}
+
+	if childElement(response, assertionNamespace, "EncryptedAssertion") != nil {
+		return nil, errors.New("Encrypted assertions are not supported.")
+	}
+
+	assertion, err := verifyAssertion(response, opts.Certificate)
+	if err != nil {
+		return nil, err
+	}
+
+	return readAssertion(assertion, opts)
+}
+
+// Get the assertion that is covered by the signature of either the response or the assertion itself
+func verifyAssertion(response *etree.Element, cert *x509.Certificate) (*etree.Element, error) {
+	ctx := dsig.NewDefaultValidationContext(&dsig.MemoryX509CertificateStore{
+		Roots: []*x509.Certificate{cert},
+	})
+
+	// Only the elements returned by the validation are trusted, anything else could have been injected
+	verified, err := ctx.Validate(response)
+	if err == nil {
+		assertions := childElements(verified, assertionNamespace, "Assertion")
+		if len(assertions) != 1 {
+			return nil, ErrInvalidResponse
+		}
+
+		return assertions[0], nil
+	}
+
+	if err != dsig.ErrMissingSignature {
+		return nil, errors.New("The signature of the response is invalid.")
+	}
+
+	assertions := childElements(response, assertionNamespace, "Assertion")
+	if len(assertions) != 1 {
+		return nil, ErrInvalidResponse
+	}
+
+	// Carry the namespaces declared on the response over to the assertion
+	nsCtx, err := etreeutils.NSBuildParentContext(assertions[0])
+	if err != nil {
+		return nil, ErrInvalidResponse
+	}
+
+	assertion, err := etreeutils.NSDetatch(nsCtx, assertions[0])
+	if err != nil {
+		return nil, ErrInvalidResponse
+	}
+
+	verified, err = ctx.Validate(assertion)
+	if err != nil {
+		return nil, errors.New("The signature of the assertion is invalid.")
+	}
+
+	return verified, nil
+}
+
+// Check the issuer, subject and conditions of the verified assertion
+func readAssertion(assertion *etree.Element, opts ResponseOptions) (*Assertion, error) {
+	now := opts.Now
+	if now.IsZero() {
+		now = time.Now()
+	}
+
+	issuer := childElement(assertion, assertionNamespace, "Issuer")
+	if issuer == nil || strings.TrimSpace(issuer.Text()) != opts.IdPEntityID {
+		return nil, errors.New("The assertion is not issued by the identity provider of the company.")
+	}
+
+	subject := childElement(assertion, assertionNamespace, "Subject")
+	nameId := childElement(subject, assertionNamespace, "NameID")
+	if nameId == nil || strings.TrimSpace(nameId.Text()) == "" {
+		return nil, errors.New("The assertion does not identify the user.")
+	}
+
+	// At least one bearer confirmation must be addressed to the app and still be valid
+	confirmed := false
+	for _, confirmation := range childElements(subject, assertionNamespace, "SubjectConfirmation") {
+		if confirmation.SelectAttrValue("Method", "") != bearerMethod {
+			continue
+		}
+
+		confirmationData := childElement(confirmation, assertionNamespace, "SubjectConfirmationData")
+		if confirmationData == nil {
+			continue
+		}
+
+		if confirmationData.SelectAttrValue("Recipient", "") != ACSURL() {
+			continue
+		}
+
+		if inResponseTo := confirmationData.SelectAttrValue("InResponseTo", ""); inResponseTo != "" && inResponseTo != opts.RequestID {
+			continue
+		}
+
+		notOnOrAfter, err := parseTime(confirmationData.SelectAttrValue("NotOnOrAfter", ""))
+		if err != nil || notOnOrAfter.IsZero() || !now.Before(notOnOrAfter.Add(clockSkew)) {
+			continue
+		}
+
+		confirmed = true
+		break
+	}
+
+	if !confirmed {
+		return nil, errors.New("The assertion has expired or is not intended for this application.")
+	}
+
+	conditions := childElement(assertion, assertionNamespace, "Conditions")
+	if conditions == nil {
+		return nil, ErrInvalidResponse
+	}
+
+	notBefore, err := parseTime(conditions.SelectAttrValue("NotBefore", ""))
+	if err != nil || (!notBefore.IsZero() && now.Add(clockSkew).Before(notBefore)) {
+		return nil, errors.New("The assertion is not valid yet.")
+	}
+
+	notOnOrAfter, err := parseTime(conditions.SelectAttrValue("NotOnOrAfter", ""))
+	if err != nil || (!notOnOrAfter.IsZero() && !now.Before(notOnOrAfter.Add(clockSkew))) {
+		return nil, errors.New("The assertion has expired.")
+	}
+
+	// Every audience restriction must include the app
+	for _, restriction := range childElements(conditions, assertionNamespace, "AudienceRestriction") {
+		allowed := false
+		for _, audience := range childElements(restriction, assertionNamespace, "Audience") {
+			if strings.TrimSpace(audience.Text()) == EntityID() {
+				allowed = true
+			}
+		}
+
+		if !allowed {
+			return nil, errors.New("The assertion is not intended for this application.")
+		}
+	}
+
+	result := &Assertion{
+		NameID:     strings.TrimSpace(nameId.Text()),
+		Attributes: map[string][]string{},
+	}
+
+	statement := childElement(assertion, assertionNamespace, "AttributeStatement")
+	for _, attribute := range childElements(statement, assertionNamespace, "Attribute") {
+		name := strings.ToLower(attribute.SelectAttrValue("Name", ""))
+		for _, value := range childElements(attribute, assertionNamespace, "AttributeValue") {
+			result.Attributes[name] = append(result.Attributes[name], strings.TrimSpace(value.Text()))
+		}
+	}
+
+	if nameId.SelectAttrValue("Format", "") == emailNameIDFormat || strings.Contains(result.NameID, "@") {
+		result.Email = result.NameID
+	} else {
+		result.Email = result.firstAttribute(emailAttributes)
+	}
+	result.Name = result.firstAttribute(nameAttributes)
+
+	return result, nil
+}
+
+func (assertion *Assertion) firstAttribute(names []string) string {
+	for _, name := range names {
+		if values := assertion.Attributes[strings.ToLower(name)]; len(values) > 0 && values[0] != "" {
+			return values[0]
+		}
+	}
+
+	return ""
+}
+
+func parseTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	return time.Parse(time.RFC3339, value)
+}
+
+func isElement(el *etree.Element, namespace, tag string) bool {
+	return el.Tag == tag && el.NamespaceURI() == namespace
+}
+
+func childElement(el *etree.Element, namespace, tag string) *etree.Element {
+	if children := childElements(el, namespace, tag); len(children) > 0 {
+		return children[0]
+	}
+
+	return nil
+}
+
+func childElements(el *etree.Element, namespace, tag string) []*etree.Element {
+	var children []*etree.Element
+	if el == nil {
+		return children
+	}
+
+	for _, child := range el.ChildElements() {
+		if isElement(child, namespace, tag) {
+			children = append(children, child)
+		}
+	}
+
+	return children
+}
@@ -0,0 +1,218 @@
+package saml
+
+import (
+	"crypto/x509"
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/beevik/etree"
+	dsig "github.com/russellhaering/goxmldsig"
+)
+
+const (
+	testIdP       = "https://idp.example.com"
+	testRequestID = "id-request"
+)
+
+// The values of the assertion built by the fixture, changed by each test case
+type fixture struct {
+	nameId       string
+	audience     string
+	recipient    string
+	notOnOrAfter time.Time
+}
+
+func validFixture(now time.Time) fixture {
+	return fixture{
+		nameId:       "user@example.com",
+		audience:     EntityID(),
+		recipient:    ACSURL(),
+		notOnOrAfter: now.Add(time.Minute * 5),
+	}
+}
+
+func (f fixture) assertion(id string) *etree.Element {
+	doc := etree.NewDocument()
+	err := doc.ReadFromString(`<saml:Assertion xmlns:saml="` + assertionNamespace + `" ID="` + id + `" Version="2.0" IssueInstant="` + time.Now().UTC().Format(time.RFC3339) + `">` +
+		`<saml:Issuer>` + testIdP + `</saml:Issuer>` +
+		`<saml:Subject><saml:NameID Format="` + emailNameIDFormat + `">` + f.nameId + `</saml:NameID>` +
+		`<saml:SubjectConfirmation Method="` + bearerMethod + `"><saml:SubjectConfirmationData InResponseTo="` + testRequestID + `" Recipient="` + f.recipient + `" NotOnOrAfter="` + f.notOnOrAfter.UTC().Format(time.RFC3339) + `"/></saml:SubjectConfirmation>` +
+		`</saml:Subject>` +
+		`<saml:Conditions NotOnOrAfter="` + f.notOnOrAfter.UTC().Format(time.RFC3339) + `"><saml:AudienceRestriction><saml:Audience>` + f.audience + `</saml:Audience></saml:AudienceRestriction></saml:Conditions>` +
+		`<saml:AttributeStatement><saml:Attribute Name="displayName"><saml:AttributeValue>Test User</saml:AttributeValue></saml:Attribute></saml:AttributeStatement>` +
+		`</saml:Assertion>`)
+	if err != nil {
+		panic(err)
+	}
+
+	return doc.Root()
+}
+
+// Build the response around the assertions
+func response(assertions ...*etree.Element) *etree.Element {
+	doc := etree.NewDocument()
+	err := doc.ReadFromString(`<samlp:Response xmlns:samlp="` + protocolNamespace + `" xmlns:saml="` + assertionNamespace + `" ID="id-response" Version="2.0" Destination="` + ACSURL() + `" InResponseTo="` + testRequestID + `">` +
+		`<saml:Issuer>` + testIdP + `</saml:Issuer>` +
+		`<samlp:Status><samlp:StatusCode Value="` + statusSuccess + `"/></samlp:Status>` +
+		`</samlp:Response>`)
+	if err != nil {
+		panic(err)
+	}
+
+	root := doc.Root()
+	for _, assertion := range assertions {
+		root.AddChild(assertion)
+	}
+
+	return root
+}
+
+func sign(t *testing.T, ks dsig.X509KeyStore, el *etree.Element) *etree.Element {
+	ctx := dsig.NewDefaultSigningContext(ks)
+	ctx.Canonicalizer = dsig.MakeC14N10ExclusiveCanonicalizerWithPrefixList("")
+
+	signed, err := ctx.SignEnveloped(el)
+	if err != nil {
+		t.Fatalf("Failed to sign the fixture: %v", err)
+	}
+
+	return signed
+}
+
+func encode(t *testing.T, el *etree.Element) string {
+	doc := etree.NewDocument()
+	doc.SetRoot(el)
+
+	data, err := doc.WriteToBytes()
+	if err != nil {
+		t.Fatalf("Failed to encode the fixture: %v", err)
+	}
+
+	return base64.StdEncoding.EncodeToString(data)
+}
+
+func certificate(t *testing.T, ks dsig.X509KeyStore) *x509.Certificate {
+	_, der, err := ks.GetKeyPair()
+	if err != nil {
+		t.Fatalf("Failed to get the key pair: %v", err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("Failed to parse the certificate: %v", err)
+	}
+
+	return cert
+}
+
+func TestParseResponse(t *testing.T) {
+	now := time.Now()
+	ks := dsig.RandomKeyStoreForTest()
+	other := dsig.RandomKeyStoreForTest()
+
+	valid := validFixture(now)
+
+	expired := validFixture(now)
+	expired.notOnOrAfter = now.Add(-clockSkew - time.Minute)
+
+	otherAudience := validFixture(now)
+	otherAudience.audience = "https://another.example.com"
+
+	otherRecipient := validFixture(now)
+	otherRecipient.recipient = "https://another.example.com/acs"
+
+	tests := []struct {
+		name     string
+		response func() *etree.Element
+		cert     *x509.Certificate
+		wantErr  bool
+	}{
+		{"signed assertion", func() *etree.Element {
+			return response(sign(t, ks, valid.assertion("id-assertion")))
+		}, certificate(t, ks), false},
+		{"signed response", func() *etree.Element {
+			return sign(t, ks, response(valid.assertion("id-assertion")))
+		}, certificate(t, ks), false},
+		{"unsigned assertion", func() *etree.Element {
+			return response(valid.assertion("id-assertion"))
+		}, certificate(t, ks), true},
+		{"injected assertion alongside the signed assertion", func() *etree.Element {
+			injected := valid
+			injected.nameId = "attacker@example.com"
+			return response(sign(t, ks, valid.assertion("id-assertion")), injected.assertion("id-injected"))
+		}, certificate(t, ks), true},
+		{"injected assertion before the signed assertion", func() *etree.Element {
+			injected := valid
+			injected.nameId = "attacker@example.com"
+			return response(injected.assertion("id-injected"), sign(t, ks, valid.assertion("id-assertion")))
+		}, certificate(t, ks), true},
+		{"assertion injected into the signed response", func() *etree.Element {
+			injected := valid
+			injected.nameId = "attacker@example.com"
+			signed := sign(t, ks, response(valid.assertion("id-assertion")))
+			signed.AddChild(injected.assertion("id-injected"))
+			return signed
+		}, certificate(t, ks), true},
+		{"assertion changed after signing", func() *etree.Element {
+			signed := sign(t, ks, valid.assertion("id-assertion"))
+			nameId := signed.FindElement("./Subject/NameID")
+			nameId.SetText("attacker@example.com")
+			return response(signed)
+		}, certificate(t, ks), true},
+		{"wrong certificate", func() *etree.Element {
+			return response(sign(t, ks, valid.assertion("id-assertion")))
+		}, certificate(t, other), true},
+		{"expired", func() *etree.Element {
+			return response(sign(t, ks, expired.assertion("id-assertion")))
+		}, certificate(t, ks), true},
+		{"another audience", func() *etree.Element {
+			return response(sign(t, ks, otherAudience.assertion("id-assertion")))
+		}, certificate(t, ks), true},
+		{"another recipient", func() *etree.Element {
+			return response(sign(t, ks, otherRecipient.assertion("id-assertion")))
+		}, certificate(t, ks), true},
+	}
+
+	for _, test := range tests {
+		opts := ResponseOptions{IdPEntityID: testIdP, Certificate: test.cert, RequestID: testRequestID, Now: now}
+
+		assertion, err := ParseResponse(encode(t, test.response()), opts)
+		if (err != nil) != test.wantErr {
+			t.Errorf("%s: ParseResponse() error = %v, want error %v", test.name, err, test.wantErr)
+			continue
+		}
+
+		if err != nil {
+			continue
+		}
+
+		if assertion.NameID != valid.nameId || assertion.Email != valid.nameId || assertion.Name != "Test User" {
+			t.Errorf("%s: ParseResponse() = %+v", test.name, assertion)
+		}
+	}
+}
+
+func TestParseResponseRequest(t *testing.T) {
+	ks := dsig.RandomKeyStoreForTest()
+	encoded := encode(t, response(sign(t, ks, validFixture(time.Now()).assertion("id-assertion"))))
+
+	tests := []struct {
+		name string
+		opts ResponseOptions
+	}{
+		{"another request", ResponseOptions{IdPEntityID: testIdP, Certificate: certificate(t, ks), RequestID: "id-another"}},
+		{"another identity provider", ResponseOptions{IdPEntityID: "https://another.example.com", Certificate: certificate(t, ks), RequestID: testRequestID}},
+	}
+
+	for _, test := range tests {
+		if _, err := ParseResponse(encoded, test.opts); err == nil {
+			t.Errorf("%s: ParseResponse() returned no error", test.name)
+		}
+	}
+
+	if _, err := ParseResponse(strings.Repeat("!", 8), ResponseOptions{}); err != ErrInvalidResponse {
+		t.Errorf("ParseResponse() of the invalid encoding error = %v, want %v", err, ErrInvalidResponse)
+	}
+}
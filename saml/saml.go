@@ -0,0 +1,115 @@
+package saml
+
+import (
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"encoding/xml"
+	"errors"
+	"os"
+	"regexp"
+	"strings"
+)
+
+const (
+	protocolNamespace  = "urn:oasis:names:tc:SAML:2.0:protocol"
+	assertionNamespace = "urn:oasis:names:tc:SAML:2.0:assertion"
+	metadataNamespace  = "urn:oasis:names:tc:SAML:2.0:metadata"
+
+	redirectBinding   = "urn:oasis:names:tc:SAML:2.0:bindings:HTTP-Redirect"
+	postBinding       = "urn:oasis:names:tc:SAML:2.0:bindings:HTTP-POST"
+	emailNameIDFormat = "urn:oasis:names:tc:SAML:1.1:nameid-format:emailAddress"
+	statusSuccess     = "urn:oasis:names:tc:SAML:2.0:status:Success"
+	bearerMethod      = "urn:oasis:names:tc:SAML:2.0:cm:bearer"
+)
+
+var whiteSpace = regexp.MustCompile(`\s+`)
+
+// The URL of the API that is reachable by the browser of the user
+func APIURL() string {
+	baseURL := os.Getenv("api_url")
+	if baseURL == "" {
+		baseURL = "http://localhost:8080"
+	}
+
+	return strings.TrimRight(baseURL, "/")
+}
+
+// The entity ID of the app as the service provider
+func EntityID() string {
+	if entityId := os.Getenv("saml_entity_id"); entityId != "" {
+		return entityId
+	}
+
+	return APIURL() + "/api/sso/metadata"
+}
+
+// The URL that receives the response from the IdP
+func ACSURL() string {
+	return APIURL() + "/api/sso/acs"
+}
+
+// Parse the certificate of the IdP, either in PEM or the base64 encoded DER from the metadata
+func ParseCertificate(data string) (*x509.Certificate, error) {
+	data = strings.TrimSpace(data)
+	if block, _ := pem.Decode([]byte(data)); block != nil {
+		return x509.ParseCertificate(block.Bytes)
+	}
+
+	der, err := base64.StdEncoding.DecodeString(whiteSpace.ReplaceAllString(data, ""))
+	if err != nil {
+		return nil, errors.New("The certificate is invalid.")
+	}
+
+	return x509.ParseCertificate(der)
+}
+
+// Encode the certificate in PEM to be stored
+func EncodeCertificate(cert *x509.Certificate) string {
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}))
+}
+
+// The metadata of the app as the service provider to be imported into the IdP
+func Metadata() ([]byte, error) {
+	type acs struct {
+		Binding  string `xml:"Binding,attr"`
+		Location string `xml:"Location,attr"`
+		Index    int    `xml:"index,attr"`
+	}
+
+	type spSSODescriptor struct {
+		AuthnRequestsSigned        bool   `xml:"AuthnRequestsSigned,attr"`
+		WantAssertionsSigned       bool   `xml:"WantAssertionsSigned,attr"`
+		ProtocolSupportEnumeration string `xml:"protocolSupportEnumeration,attr"`
+		NameIDFormat               string `xml:"md:NameIDFormat"`
+		AssertionConsumerService   acs    `xml:"md:AssertionConsumerService"`
+	}
+
+	type entityDescriptor struct {
+		XMLName         xml.Name        `xml:"md:EntityDescriptor"`
+		Namespace       string          `xml:"xmlns:md,attr"`
+		EntityID        string          `xml:"entityID,attr"`
+		SPSSODescriptor spSSODescriptor `xml:"md:SPSSODescriptor"`
+	}
+
+	metadata := entityDescriptor{
+		Namespace: metadataNamespace,
+		EntityID:  EntityID(),
+		SPSSODescriptor: spSSODescriptor{
+			WantAssertionsSigned:       true,
+			ProtocolSupportEnumeration: protocolNamespace,
+			NameIDFormat:               emailNameIDFormat,
+			AssertionConsumerService: acs{
+				Binding:  postBinding,
+				Location: ACSURL(),
+			},
+		},
+	}
+
+	data, err := xml.MarshalIndent(metadata, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]byte(xml.Header), data...), nil
+}
@@ -0,0 +1,84 @@
+package signing
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"io"
+	"strings"
+)
+
+const encryptedPrefix = "enc:" // Prefix of the private key encrypted at rest
+
+var ErrMissingSecret = errors.New("The secret to encrypt the signing keys is not set.")
+
+// Encrypt the encoded private key with AES-256-GCM, the encryption key is derived from the secret
+func EncryptPrivateKey(privateKey, secret string) (string, error) {
+	if secret == "" {
+		return "", ErrMissingSecret
+	}
+
+	gcm, err := newGCM(secret)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+
+	sealed := gcm.Seal(nonce, nonce, []byte(privateKey), nil)
+
+	return encryptedPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt the private key encrypted by EncryptPrivateKey, the unencrypted keys stored before are returned as they are
+func DecryptPrivateKey(privateKey, secret string) (string, error) {
+	if !IsEncrypted(privateKey) {
+		return privateKey, nil
+	}
+
+	if secret == "" {
+		return "", ErrMissingSecret
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(privateKey, encryptedPrefix))
+	if err != nil {
+		return "", err
+	}
+
+	gcm, err := newGCM(secret)
+	if err != nil {
+		return "", err
+	}
+
+	if len(sealed) < gcm.NonceSize() {
+		return "", errors.New("The encrypted private key is invalid.")
+	}
+
+	plain, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", errors.New("Failed to decrypt the private key, the secret might have been changed.")
+	}
+
+	return string(plain), nil
+}
+
+// Check if the stored private key is encrypted
+func IsEncrypted(privateKey string) bool {
+	return strings.HasPrefix(privateKey, encryptedPrefix)
+}
+
+func newGCM(secret string) (cipher.AEAD, error) {
+	key := sha256.Sum256([]byte(secret))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
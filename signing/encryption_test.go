@@ -0,0 +1,53 @@
+package signing
+
+import (
+	"testing"
+)
+
+func TestEncryptPrivateKey(t *testing.T) {
+	privateKey, _, err := GenerateKey(EdDSA)
+	if err != nil {
+		t.Fatalf("GenerateKey() returned the error: %v", err)
+	}
+
+	encrypted, err := EncryptPrivateKey(privateKey, "secret")
+	if err != nil {
+		t.Fatalf("EncryptPrivateKey() returned the error: %v", err)
+	}
+
+	if !IsEncrypted(encrypted) || encrypted == privateKey {
+		t.Fatalf("EncryptPrivateKey() = %q, want the encrypted key", encrypted)
+	}
+
+	tests := []struct {
+		name    string
+		stored  string
+		secret  string
+		want    string
+		wantErr bool
+	}{
+		{"encrypted key", encrypted, "secret", privateKey, false},
+		{"wrong secret", encrypted, "another-secret", "", true},
+		{"missing secret", encrypted, "", "", true},
+		{"unencrypted key", privateKey, "secret", privateKey, false},
+		{"tampered key", encrypted[:len(encrypted)-4] + "AAAA", "secret", "", true},
+	}
+
+	for _, test := range tests {
+		got, err := DecryptPrivateKey(test.stored, test.secret)
+		if (err != nil) != test.wantErr {
+			t.Errorf("%s: DecryptPrivateKey() error = %v, want error %v", test.name, err, test.wantErr)
+			continue
+		}
+
+		if got != test.want {
+			t.Errorf("%s: DecryptPrivateKey() = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestEncryptPrivateKeyWithoutSecret(t *testing.T) {
+	if _, err := EncryptPrivateKey("key", ""); err != ErrMissingSecret {
+		t.Errorf("EncryptPrivateKey() error = %v, want %v", err, ErrMissingSecret)
+	}
+}
@@ -0,0 +1,145 @@
+package signing
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"math/big"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"golang.org/x/crypto/ed25519"
+)
+
+// Supported algorithms of the signing keys
+const (
+	RS256 = "RS256"
+	EdDSA = "EdDSA"
+)
+
+const rsaKeySize = 2048
+
+var ErrUnsupportedAlgorithm = errors.New("The signing algorithm is not supported, use RS256 or EdDSA.")
+
+// Key pair that signs and verifies the tokens
+type Key struct {
+	ID         string
+	Algorithm  string
+	PrivateKey interface{} // *rsa.PrivateKey or ed25519.PrivateKey
+	PublicKey  interface{} // *rsa.PublicKey or ed25519.PublicKey
+}
+
+// Generate the key pair of the algorithm, return the encoded private and public keys to be stored
+func GenerateKey(algorithm string) (string, string, error) {
+	switch algorithm {
+	case RS256:
+		privateKey, err := rsa.GenerateKey(rand.Reader, rsaKeySize)
+		if err != nil {
+			return "", "", err
+		}
+
+		publicKey, err := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+		if err != nil {
+			return "", "", err
+		}
+
+		privatePEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(privateKey)})
+		publicPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicKey})
+
+		return string(privatePEM), string(publicPEM), nil
+	case EdDSA:
+		publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return "", "", err
+		}
+
+		return base64.StdEncoding.EncodeToString(privateKey), base64.StdEncoding.EncodeToString(publicKey), nil
+	}
+
+	return "", "", ErrUnsupportedAlgorithm
+}
+
+// Decode the stored key pair, the private key is optional for the keys that only verify
+func ParseKey(id, algorithm, privateKey, publicKey string) (*Key, error) {
+	key := &Key{ID: id, Algorithm: algorithm}
+
+	switch algorithm {
+	case RS256:
+		public, err := jwt.ParseRSAPublicKeyFromPEM([]byte(publicKey))
+		if err != nil {
+			return nil, err
+		}
+		key.PublicKey = public
+
+		if privateKey != "" {
+			private, err := jwt.ParseRSAPrivateKeyFromPEM([]byte(privateKey))
+			if err != nil {
+				return nil, err
+			}
+			key.PrivateKey = private
+		}
+	case EdDSA:
+		public, err := base64.StdEncoding.DecodeString(publicKey)
+		if err != nil || len(public) != ed25519.PublicKeySize {
+			return nil, errInvalidEdDSAKey
+		}
+		key.PublicKey = ed25519.PublicKey(public)
+
+		if privateKey != "" {
+			private, err := base64.StdEncoding.DecodeString(privateKey)
+			if err != nil || len(private) != ed25519.PrivateKeySize {
+				return nil, errInvalidEdDSAKey
+			}
+			key.PrivateKey = ed25519.PrivateKey(private)
+		}
+	default:
+		return nil, ErrUnsupportedAlgorithm
+	}
+
+	return key, nil
+}
+
+// Get the signing method of the key
+func (key *Key) Method() jwt.SigningMethod {
+	if key.Algorithm == EdDSA {
+		return SigningMethodEdDSA
+	}
+
+	return jwt.SigningMethodRS256
+}
+
+// Sign the claims with the key, the key ID is set in the header
+func (key *Key) Sign(claims jwt.Claims) (string, error) {
+	if key.PrivateKey == nil {
+		return "", errors.New("The key can only verify the tokens.")
+	}
+
+	token := jwt.NewWithClaims(key.Method(), claims)
+	token.Header["kid"] = key.ID
+
+	return token.SignedString(key.PrivateKey)
+}
+
+// Get the public key in the JSON Web Key format
+func (key *Key) JWK() map[string]interface{} {
+	jwk := map[string]interface{}{
+		"kid": key.ID,
+		"alg": key.Algorithm,
+		"use": "sig",
+	}
+
+	switch publicKey := key.PublicKey.(type) {
+	case *rsa.PublicKey:
+		jwk["kty"] = "RSA"
+		jwk["n"] = base64.RawURLEncoding.EncodeToString(publicKey.N.Bytes())
+		jwk["e"] = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(publicKey.E)).Bytes())
+	case ed25519.PublicKey:
+		jwk["kty"] = "OKP"
+		jwk["crv"] = "Ed25519"
+		jwk["x"] = base64.RawURLEncoding.EncodeToString(publicKey)
+	}
+
+	return jwk
+}
@@ -0,0 +1,113 @@
+package throttle
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"sync"
+	"time"
+)
+
+// Limiter delays the next attempt progressively after the free attempts are used up
+type Limiter struct {
+	Prefix       string
+	FreeAttempts int
+	BaseDelay    time.Duration
+	MaxDelay     time.Duration
+	Window       time.Duration // The counter is reset when there is no failure within the window
+}
+
+var store Store = NewMemoryStore()
+var storeMutex sync.RWMutex
+
+// The clock of the limiters and the memory store, replaced in the tests
+var now = time.Now
+
+// Limit the attempts from the same IP address on the login, activation and reset password endpoints
+var IP = &Limiter{
+	Prefix:       "ip:",
+	FreeAttempts: 10,
+	BaseDelay:    time.Second,
+	MaxDelay:     time.Minute * 5,
+	Window:       time.Minute * 15,
+}
+
+// Limit the failed logins of the same account
+var Account = &Limiter{
+	Prefix:       "account:",
+	FreeAttempts: 3,
+	BaseDelay:    time.Second,
+	MaxDelay:     time.Minute,
+	Window:       time.Minute * 15,
+}
+
+// Replace the store of the counters, ie. with a shared store
+func SetStore(s Store) {
+	storeMutex.Lock()
+	store = s
+	storeMutex.Unlock()
+}
+
+func getStore() Store {
+	storeMutex.RLock()
+	defer storeMutex.RUnlock()
+
+	return store
+}
+
+// Check if the attempt is allowed now, otherwise return how long to wait
+func (l *Limiter) Allow(key string) (bool, time.Duration) {
+	attempts, err := getStore().Get(l.Prefix + key)
+	if err != nil {
+		log.Println("Failed to get the attempts:", err)
+		return true, 0
+	}
+
+	wait := attempts.LastFailure.Add(l.delay(attempts.Count)).Sub(now())
+	if wait > 0 {
+		return false, wait
+	}
+
+	return true, 0
+}
+
+// Record a failed attempt and return the number of failures within the window
+func (l *Limiter) Fail(key string) int {
+	attempts, err := getStore().Increment(l.Prefix+key, l.Window)
+	if err != nil {
+		log.Println("Failed to record the attempt:", err)
+	}
+
+	return attempts.Count
+}
+
+// Clear the failed attempts, ie. after a successful attempt
+func (l *Limiter) Reset(key string) {
+	if err := getStore().Reset(l.Prefix + key); err != nil {
+		log.Println("Failed to reset the attempts:", err)
+	}
+}
+
+// The delay doubles for every failure after the free attempts
+func (l *Limiter) delay(count int) time.Duration {
+	if count < l.FreeAttempts {
+		return 0
+	}
+
+	delay := float64(l.BaseDelay) * math.Pow(2, float64(count-l.FreeAttempts))
+	if delay > float64(l.MaxDelay) {
+		return l.MaxDelay
+	}
+
+	return time.Duration(delay)
+}
+
+// Message to tell the client how long to wait before retrying
+func RetryMessage(wait time.Duration) string {
+	return fmt.Sprintf("Too many attempts. Please try again in %d second(s).", RetryAfter(wait))
+}
+
+// The number of seconds to wait, rounded up
+func RetryAfter(wait time.Duration) int {
+	return int(math.Ceil(wait.Seconds()))
+}
@@ -0,0 +1,148 @@
+package throttle
+
+import (
+	"testing"
+	"time"
+)
+
+// Replace the clock with the one that only moves when told to, the real clock is restored by the returned function
+func fakeClock() (*time.Time, func()) {
+	current := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	now = func() time.Time { return current }
+
+	return &current, func() { now = time.Now }
+}
+
+func TestDelay(t *testing.T) {
+	limiter := &Limiter{FreeAttempts: 3, BaseDelay: time.Second, MaxDelay: time.Second * 10}
+
+	tests := []struct {
+		count int
+		want  time.Duration
+	}{
+		{0, 0},
+		{2, 0},
+		{3, time.Second},
+		{4, time.Second * 2},
+		{6, time.Second * 8},
+		{7, time.Second * 10},
+		{50, time.Second * 10},
+	}
+
+	for _, test := range tests {
+		if got := limiter.delay(test.count); got != test.want {
+			t.Errorf("delay(%d) = %v, want %v", test.count, got, test.want)
+		}
+	}
+}
+
+func TestLimiter(t *testing.T) {
+	current, restore := fakeClock()
+	defer restore()
+
+	SetStore(NewMemoryStore())
+	limiter := &Limiter{Prefix: "test:", FreeAttempts: 2, BaseDelay: time.Second, MaxDelay: time.Minute, Window: time.Minute * 15}
+
+	tests := []struct {
+		name    string
+		advance time.Duration
+		fail    bool
+		reset   bool
+		allowed bool
+		wait    time.Duration
+	}{
+		{name: "first failure", fail: true, allowed: true},
+		{name: "free attempts used up", fail: true, allowed: false, wait: time.Second},
+		{name: "after the delay", advance: time.Second, allowed: true},
+		{name: "delay doubled", fail: true, allowed: false, wait: time.Second * 2},
+		{name: "during the delay", advance: time.Second, allowed: false, wait: time.Second},
+		{name: "reset", reset: true, allowed: true},
+		{name: "failure after the reset", fail: true, allowed: true},
+		{name: "second failure after the reset", fail: true, allowed: false, wait: time.Second},
+		{name: "window passed", advance: time.Minute * 16, allowed: true},
+		{name: "failure after the window", fail: true, allowed: true},
+	}
+
+	for _, test := range tests {
+		*current = current.Add(test.advance)
+
+		if test.fail {
+			limiter.Fail("key")
+		}
+
+		if test.reset {
+			limiter.Reset("key")
+		}
+
+		allowed, wait := limiter.Allow("key")
+		if allowed != test.allowed || wait != test.wait {
+			t.Errorf("%s: Allow() = %v, %v, want %v, %v", test.name, allowed, wait, test.allowed, test.wait)
+		}
+	}
+
+	// The other keys are not affected
+	if allowed, _ := limiter.Allow("other"); !allowed {
+		t.Error("Allow() of another key = false, want true")
+	}
+}
+
+func TestFailCount(t *testing.T) {
+	current, restore := fakeClock()
+	defer restore()
+
+	SetStore(NewMemoryStore())
+	limiter := &Limiter{Prefix: "test:", Window: time.Minute}
+
+	for want := 1; want <= 3; want++ {
+		if got := limiter.Fail("key"); got != want {
+			t.Errorf("Fail() = %d, want %d", got, want)
+		}
+	}
+
+	// The counter starts again once there is no failure within the window
+	*current = current.Add(time.Minute * 2)
+	if got := limiter.Fail("key"); got != 1 {
+		t.Errorf("Fail() after the window = %d, want 1", got)
+	}
+}
+
+func TestMemoryStoreSweep(t *testing.T) {
+	current, restore := fakeClock()
+	defer restore()
+
+	s := NewMemoryStore()
+	s.Increment("expired", time.Second)
+
+	*current = current.Add(time.Minute * 2)
+	s.Increment("active", time.Minute)
+
+	if _, ok := s.entries["expired"]; ok {
+		t.Error("The expired counter is not swept")
+	}
+
+	if _, ok := s.entries["active"]; !ok {
+		t.Error("The active counter is swept")
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	tests := []struct {
+		wait time.Duration
+		want int
+	}{
+		{0, 0},
+		{time.Millisecond, 1},
+		{time.Second, 1},
+		{time.Second + time.Millisecond, 2},
+	}
+
+	for _, test := range tests {
+		if got := RetryAfter(test.wait); got != test.want {
+			t.Errorf("RetryAfter(%v) = %d, want %d", test.wait, got, test.want)
+		}
+	}
+
+	if got := RetryMessage(time.Millisecond * 1500); got != "Too many attempts. Please try again in 2 second(s)." {
+		t.Errorf("RetryMessage() = %q", got)
+	}
+}
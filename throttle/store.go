@@ -0,0 +1,94 @@
+package throttle
+
+import (
+	"sync"
+	"time"
+)
+
+// Failed attempts recorded for a key, ie. an IP address or an account
+type Attempts struct {
+	Count       int
+	LastFailure time.Time
+}
+
+// Store keeps the attempt counters, can be replaced by a shared store when running multiple instances
+type Store interface {
+	Get(key string) (Attempts, error)
+	Increment(key string, ttl time.Duration) (Attempts, error)
+	Reset(key string) error
+}
+
+type memoryEntry struct {
+	attempts  Attempts
+	expiresAt time.Time
+}
+
+// Keep the counters in the memory of the process
+type MemoryStore struct {
+	mutex      sync.Mutex
+	entries    map[string]memoryEntry
+	lastSweep  time.Time
+	sweepEvery time.Duration
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		entries:    make(map[string]memoryEntry),
+		sweepEvery: time.Minute,
+	}
+}
+
+func (s *MemoryStore) Get(key string) (Attempts, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	entry, ok := s.entries[key]
+	if !ok || now().After(entry.expiresAt) {
+		return Attempts{}, nil
+	}
+
+	return entry.attempts, nil
+}
+
+func (s *MemoryStore) Increment(key string, ttl time.Duration) (Attempts, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	current := now()
+	s.sweep(current)
+
+	entry, ok := s.entries[key]
+	if !ok || current.After(entry.expiresAt) {
+		entry = memoryEntry{}
+	}
+
+	entry.attempts.Count++
+	entry.attempts.LastFailure = current
+	entry.expiresAt = current.Add(ttl)
+	s.entries[key] = entry
+
+	return entry.attempts, nil
+}
+
+func (s *MemoryStore) Reset(key string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	delete(s.entries, key)
+	return nil
+}
+
+// Remove the expired counters so that the memory does not keep growing
+func (s *MemoryStore) sweep(current time.Time) {
+	if current.Sub(s.lastSweep) < s.sweepEvery {
+		return
+	}
+
+	for key, entry := range s.entries {
+		if current.After(entry.expiresAt) {
+			delete(s.entries, key)
+		}
+	}
+
+	s.lastSweep = current
+}
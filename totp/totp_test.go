@@ -0,0 +1,93 @@
+package totp
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// The SHA1 secret of RFC 6238 appendix B, "12345678901234567890" in base32
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestGenerate(t *testing.T) {
+	// RFC 6238 appendix B, truncated to the last 6 of the 8 digits
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+
+	key := []byte("12345678901234567890")
+	for _, test := range tests {
+		if got := generate(key, test.unix/period); got != test.want {
+			t.Errorf("generate(T=%d) = %s, want %s", test.unix, got, test.want)
+		}
+	}
+}
+
+func TestGenerateCounter(t *testing.T) {
+	// RFC 4226 appendix D
+	want := []string{"755224", "287082", "359152", "969429", "338314", "254676", "287922", "162583", "399871", "520489"}
+
+	key := []byte("12345678901234567890")
+	for counter, code := range want {
+		if got := generate(key, int64(counter)); got != code {
+			t.Errorf("generate(counter=%d) = %s, want %s", counter, got, code)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	step := now.Unix() / period
+
+	tests := []struct {
+		name   string
+		code   string
+		secret string
+		at     time.Time
+		want   bool
+	}{
+		{"current period", "050471", rfcSecret, now, true},
+		{"lowercase secret", "050471", strings.ToLower(rfcSecret), now, true},
+		{"surrounding spaces", " 050471 ", rfcSecret, now, true},
+		{"previous period", "050471", rfcSecret, now.Add(period * time.Second), true},
+		{"next period", "050471", rfcSecret, now.Add(-period * time.Second), true},
+		{"two periods later", "050471", rfcSecret, now.Add(2 * period * time.Second), false},
+		{"two periods earlier", "050471", rfcSecret, now.Add(-2 * period * time.Second), false},
+		{"wrong code", "123456", rfcSecret, now, false},
+		{"short code", "05047", rfcSecret, now, false},
+		{"invalid secret", "050471", "not base32!", now, false},
+	}
+
+	for _, test := range tests {
+		matched, ok := Validate(test.code, test.secret, test.at)
+		if ok != test.want {
+			t.Errorf("%s: Validate() = %v, want %v", test.name, ok, test.want)
+			continue
+		}
+
+		// The matched step is the step of the code, not of the time validated at
+		if ok && matched != step {
+			t.Errorf("%s: Validate() step = %d, want %d", test.name, matched, step)
+		}
+	}
+}
+
+func TestGenerateSecret(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatalf("GenerateSecret() returned the error: %v", err)
+	}
+
+	key, err := encoding.DecodeString(secret)
+	if err != nil || len(key) != 20 {
+		t.Errorf("GenerateSecret() = %q, want 160 bits in base32", secret)
+	}
+}
@@ -5,6 +5,12 @@ import (
 	"net/http"
 	"reflect"
 	"encoding/json"
+	"encoding/hex"
+	"crypto/rand"
+	"crypto/sha256"
+	"net"
+	"os"
+	"app/password"
 	"gopkg.in/go-playground/validator.v9"
 )
 
@@ -44,6 +50,10 @@ func GetErrorMessages(errors *[]string, err error) {
 				} else {
 					*errors = append(*errors, errz.StructField() + " must be smaller than " + errz.Param() + ".")
 				}
+			case password.ValidationTag:
+				for _, violation := range password.Default().Validate(errz.Value().(string)) {
+					*errors = append(*errors, errz.StructField() + " " + violation)
+				}
 			default:
 				*errors = append(*errors, errz.StructField() + " is invalid.")
 		}		
@@ -90,4 +100,38 @@ func IndexOf(element interface{}, array []interface{}) (int) {
 		}
 	}
 	return -1    //not found.
- }
\ No newline at end of file
+ }
+
+// Generate a cryptographically random token of n bytes, hex encoded
+func GenerateRandomToken(n int) (string, error) {
+	bytes := make([]byte, n)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(bytes), nil
+}
+
+// Hash the token so that only the digest is stored in database
+func HashToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
+
+// Get the IP address of the client, X-Forwarded-For is only trusted when running behind a proxy
+func GetClientIP(r *http.Request) string {
+	if os.Getenv("trust_proxy") == "true" {
+		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+			// The last address is the one appended by the proxy
+			ips := strings.Split(forwarded, ",")
+			return strings.TrimSpace(ips[len(ips)-1])
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}